@@ -28,8 +28,12 @@ func main() {
 	// create the compiler
 	c := golightly.NewCompiler()
 
-	// compile the program
-	err := c.Compile(os.Args)
+	// compile the program. warnings are shown but they don't stop it.
+	result, err := c.CompileAll(os.Args)
+	for _, warning := range result.Warnings {
+		fmt.Println("warning:", warning)
+	}
+
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -1,10 +1,17 @@
 package golightly
 
+import (
+	"path"
+	"strings"
+)
+
 // type AST is a "sum type" implemented using an interface.
 // It represents an Abstract Syntax Tree.
 //
-// ASTs can be created using struct initialisers.
-// eg. StringToken{TokenIdentifier, "hello"}
+// Nodes are pointers so each one has an identity of its own. Later passes
+// use the nodes themselves to keep track of what they've found out about
+// them, eg. sourceFile.resolved. They're created using struct initialisers.
+// eg. &ASTIdentifier{pos, "", "hello"}
 type AST interface {
 	IsAST()
 	Pos() SrcSpan
@@ -19,15 +26,15 @@ type ASTTopLevel struct {
 	topLevelDecls []AST   // top level declarations
 }
 
-func (ast ASTTopLevel) IsAST() {
+func (ast *ASTTopLevel) IsAST() {
 }
 
-func (ast ASTTopLevel) Pos() SrcSpan {
+func (ast *ASTTopLevel) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTTopLevel) Equals(to AST) bool {
-	too := to.(ASTTopLevel)
+func (ast *ASTTopLevel) Equals(to AST) bool {
+	too := to.(*ASTTopLevel)
 	if !ast.pos.Equals(too.pos) ||
 		ast.packageName != too.packageName ||
 		len(ast.imports) != len(too.imports) ||
@@ -50,25 +57,84 @@ func (ast ASTTopLevel) Equals(to AST) bool {
 	return true
 }
 
+// PackageName returns the name of the package the file is a part of.
+func (ast *ASTTopLevel) PackageName() string {
+	return ast.packageName
+}
+
 // type ASTImport describes an import statement.
 type ASTImport struct {
 	pos         SrcSpan // where the keyword is in the source
 	packageName AST     // local package name to import as, or "." to import to the local scope.
 	importPath  AST     // the path to the package or local package name.
+
+	declaredName string // the name the imported package declares itself as, once we know it.
 }
 
-func (ast ASTImport) IsAST() {
+func (ast *ASTImport) IsAST() {
 }
 
-func (ast ASTImport) Pos() SrcSpan {
+func (ast *ASTImport) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTImport) Equals(to AST) bool {
-	too := to.(ASTImport)
+func (ast *ASTImport) Equals(to AST) bool {
+	too := to.(*ASTImport)
 	return ast.pos.Equals(too.pos) && ast.packageName.Equals(too.packageName) && ast.importPath.Equals(too.importPath)
 }
 
+// ImportPath returns the path of the imported package.
+func (ast *ASTImport) ImportPath() string {
+	return ast.importPath.(*ASTValue).val.(ValueString).val
+}
+
+// LocalName returns the name the package is imported as in this file. It's
+// "_" for a blank import, "." for an import into the local scope, or the
+// name the package declares if no name was given. Until the package has
+// been compiled we don't know that so we guess from the import path.
+func (ast *ASTImport) LocalName() string {
+	if ast.packageName != nil {
+		return ast.packageName.(*ASTIdentifier).name
+	}
+
+	if ast.declaredName != "" {
+		return ast.declaredName
+	}
+
+	return importPathName(ast.ImportPath())
+}
+
+// importPathName guesses a package's name from its import path. It's
+// usually the last element, but major versions like "example.com/foo/v2"
+// and "gopkg.in/yaml.v2" aren't part of the name.
+func importPathName(importPath string) string {
+	name := path.Base(importPath)
+	if isMajorVersion(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+
+	if dot := strings.LastIndex(name, "."); dot > 0 && isMajorVersion(name[dot+1:]) {
+		name = name[:dot]
+	}
+
+	return name
+}
+
+// isMajorVersion returns true for a major version suffix like "v2".
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+
+	for _, ch := range s[1:] {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
 // type ASTUnaryExpr describes an expression operation with a single operand.
 type ASTUnaryExpr struct {
 	pos   SrcSpan   // where it is in the source
@@ -76,15 +142,15 @@ type ASTUnaryExpr struct {
 	param AST       // the parameter
 }
 
-func (ast ASTUnaryExpr) IsAST() {
+func (ast *ASTUnaryExpr) IsAST() {
 }
 
-func (ast ASTUnaryExpr) Pos() SrcSpan {
+func (ast *ASTUnaryExpr) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTUnaryExpr) Equals(to AST) bool {
-	too := to.(ASTUnaryExpr)
+func (ast *ASTUnaryExpr) Equals(to AST) bool {
+	too := to.(*ASTUnaryExpr)
 	return ast.pos.Equals(too.pos) && ast.op == too.op && ast.param.Equals(too.param)
 }
 
@@ -96,38 +162,58 @@ type ASTBinaryExpr struct {
 	right AST       // the right parameter
 }
 
-func (ast ASTBinaryExpr) IsAST() {
+func (ast *ASTBinaryExpr) IsAST() {
 }
 
-func (ast ASTBinaryExpr) Pos() SrcSpan {
+func (ast *ASTBinaryExpr) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTBinaryExpr) Equals(to AST) bool {
-	too := to.(ASTBinaryExpr)
+func (ast *ASTBinaryExpr) Equals(to AST) bool {
+	too := to.(*ASTBinaryExpr)
 	return ast.pos.Equals(too.pos) && ast.op == too.op && ast.left.Equals(too.left) && ast.right.Equals(too.right)
 }
 
+// type ASTParen describes an expression in brackets. The brackets don't
+// change what the expression means since the grouping is already in the
+// tree, but they're kept so the source can be reproduced exactly.
+type ASTParen struct {
+	pos  SrcSpan // the whole expression including the brackets
+	expr AST     // the expression inside the brackets
+}
+
+func (ast *ASTParen) IsAST() {
+}
+
+func (ast *ASTParen) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTParen) Equals(to AST) bool {
+	too, ok := to.(*ASTParen)
+	return ok && ast.pos.Equals(too.pos) && ast.expr.Equals(too.expr)
+}
+
 // type ASTValue describes a literal value.
 type ASTValue struct {
 	pos SrcSpan // where it is in the source
 	val Value   // the value
 }
 
-func (ast ASTValue) IsAST() {
+func (ast *ASTValue) IsAST() {
 }
 
-func (ast ASTValue) Pos() SrcSpan {
+func (ast *ASTValue) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTValue) Equals(to AST) bool {
-	too := to.(ASTValue)
+func (ast *ASTValue) Equals(to AST) bool {
+	too := to.(*ASTValue)
 	return ast.pos.Equals(too.pos) && ast.val.Equals(too.val)
 }
 
-func NewASTValueFromToken(v Token, ts *DataTypeStore) ASTValue {
-	return ASTValue{v.Pos(), NewValueFromToken(v, ts)}
+func NewASTValueFromToken(v Token, ts *DataTypeStore) *ASTValue {
+	return &ASTValue{v.Pos(), NewValueFromToken(v, ts)}
 }
 
 // type ASTIdentifier describes an identifier reference.
@@ -137,54 +223,60 @@ type ASTIdentifier struct {
 	name        string  // the identifier name
 }
 
-func (ast ASTIdentifier) IsAST() {
+func (ast *ASTIdentifier) IsAST() {
 }
 
-func (ast ASTIdentifier) Pos() SrcSpan {
+func (ast *ASTIdentifier) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTIdentifier) Equals(to AST) bool {
-	too := to.(ASTIdentifier)
+func (ast *ASTIdentifier) Equals(to AST) bool {
+	too := to.(*ASTIdentifier)
 	return ast.pos.Equals(too.pos) && ast.packageName == too.packageName && ast.name == too.name
 }
 
 // type ASTConstDecl describes a constant declaration.
 type ASTConstDecl struct {
-	ident AST // the variable to declare
-	typ   AST // the optional data type
-	value AST // the value to set it to
+	ident AST    // the variable to declare
+	typ   AST    // the optional data type
+	value AST    // the value to set it to
+	doc   string // the comment just before it, if there is one
 }
 
-func (ast ASTConstDecl) IsAST() {
+func (ast *ASTConstDecl) IsAST() {
 }
 
-func (ast ASTConstDecl) Pos() SrcSpan {
-	return ast.ident.Pos()
+// Pos covers the whole declaration, from the name to the end of the
+// value, or to the end of the type if there's no value.
+func (ast *ASTConstDecl) Pos() SrcSpan {
+	return declSpan(ast.ident, ast.typ, ast.value)
 }
 
-func (ast ASTConstDecl) Equals(to AST) bool {
-	too := to.(ASTConstDecl)
-	return ast.ident.Equals(too.ident) && ast.typ.Equals(too.typ) && ast.value.Equals(too.value)
+func (ast *ASTConstDecl) Equals(to AST) bool {
+	too := to.(*ASTConstDecl)
+	return ast.ident.Equals(too.ident) && astEquals(ast.typ, too.typ) && astEquals(ast.value, too.value)
 }
 
 // type ASTVarDecl describes a variable declaration.
 type ASTVarDecl struct {
-	ident AST // the variable to declare
-	typ   AST // the optional data type
-	value AST // the value to set it to
+	ident AST    // the variable to declare
+	typ   AST    // the optional data type
+	value AST    // the value to set it to
+	doc   string // the comment just before it, if there is one
 }
 
-func (ast ASTVarDecl) IsAST() {
+func (ast *ASTVarDecl) IsAST() {
 }
 
-func (ast ASTVarDecl) Pos() SrcSpan {
-	return ast.ident.Pos()
+// Pos covers the whole declaration, from the name to the end of the
+// value, or to the end of the type if there's no value.
+func (ast *ASTVarDecl) Pos() SrcSpan {
+	return declSpan(ast.ident, ast.typ, ast.value)
 }
 
-func (ast ASTVarDecl) Equals(to AST) bool {
-	too := to.(ASTVarDecl)
-	return ast.ident.Equals(too.ident) && ast.typ.Equals(too.typ) && ast.value.Equals(too.value)
+func (ast *ASTVarDecl) Equals(to AST) bool {
+	too := to.(*ASTVarDecl)
+	return ast.ident.Equals(too.ident) && astEquals(ast.typ, too.typ) && astEquals(ast.value, too.value)
 }
 
 // type ASTFunctionDecl describes a function or method declaration.
@@ -195,17 +287,18 @@ type ASTFunctionDecl struct {
 	params   []AST   // the parameters
 	returns  []AST   // the return values
 	body     AST     // the body of the function
+	doc      string  // the comment just before it, if there is one
 }
 
-func (ast ASTFunctionDecl) IsAST() {
+func (ast *ASTFunctionDecl) IsAST() {
 }
 
-func (ast ASTFunctionDecl) Pos() SrcSpan {
+func (ast *ASTFunctionDecl) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTFunctionDecl) Equals(to AST) bool {
-	too := to.(ASTFunctionDecl)
+func (ast *ASTFunctionDecl) Equals(to AST) bool {
+	too := to.(*ASTFunctionDecl)
 	if !(ast.pos.Equals(too.pos) && ast.name == too.name && ast.receiver.Equals(too.receiver) && ast.body.Equals(too.body)) {
 		return false
 	}
@@ -237,34 +330,36 @@ type ASTReceiver struct {
 	typeName string  // the name of the receiver's type
 }
 
-func (ast ASTReceiver) IsAST() {
+func (ast *ASTReceiver) IsAST() {
 }
 
-func (ast ASTReceiver) Pos() SrcSpan {
+func (ast *ASTReceiver) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTReceiver) Equals(to AST) bool {
-	too := to.(ASTReceiver)
+func (ast *ASTReceiver) Equals(to AST) bool {
+	too := to.(*ASTReceiver)
 	return ast.pos.Equals(too.pos) && ast.name == too.name && ast.pointer == too.pointer && ast.typeName == too.typeName
 }
 
 // type ASTDataTypeDecl describes a type declaration using the 'type' keyword.
 type ASTDataTypeDecl struct {
-	ident AST // the variable to declare
-	typ   AST // the data type
+	ident AST    // the variable to declare
+	typ   AST    // the data type
+	alias bool   // true if it's an alias like "type T = U"
+	doc   string // the comment just before it, if there is one
 }
 
-func (ast ASTDataTypeDecl) IsAST() {
+func (ast *ASTDataTypeDecl) IsAST() {
 }
 
-func (ast ASTDataTypeDecl) Pos() SrcSpan {
+func (ast *ASTDataTypeDecl) Pos() SrcSpan {
 	return ast.ident.Pos()
 }
 
-func (ast ASTDataTypeDecl) Equals(to AST) bool {
-	too := to.(ASTDataTypeDecl)
-	return ast.ident.Equals(too.ident) && ast.typ.Equals(too.typ)
+func (ast *ASTDataTypeDecl) Equals(to AST) bool {
+	too := to.(*ASTDataTypeDecl)
+	return ast.ident.Equals(too.ident) && astEquals(ast.typ, too.typ) && ast.alias == too.alias
 }
 
 // type ASTDataTypeSlice describes a slice declaration.
@@ -273,15 +368,15 @@ type ASTDataTypeSlice struct {
 	elementType AST     // slice of this data type
 }
 
-func (ast ASTDataTypeSlice) IsAST() {
+func (ast *ASTDataTypeSlice) IsAST() {
 }
 
-func (ast ASTDataTypeSlice) Pos() SrcSpan {
+func (ast *ASTDataTypeSlice) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTDataTypeSlice) Equals(to AST) bool {
-	too := to.(ASTDataTypeSlice)
+func (ast *ASTDataTypeSlice) Equals(to AST) bool {
+	too := to.(*ASTDataTypeSlice)
 	return ast.pos.Equals(too.pos) && ast.elementType.Equals(too.elementType)
 }
 
@@ -292,15 +387,15 @@ type ASTDataTypeArray struct {
 	elementType AST     // slice of this data type
 }
 
-func (ast ASTDataTypeArray) IsAST() {
+func (ast *ASTDataTypeArray) IsAST() {
 }
 
-func (ast ASTDataTypeArray) Pos() SrcSpan {
+func (ast *ASTDataTypeArray) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTDataTypeArray) Equals(to AST) bool {
-	too := to.(ASTDataTypeArray)
+func (ast *ASTDataTypeArray) Equals(to AST) bool {
+	too := to.(*ASTDataTypeArray)
 	return ast.pos.Equals(too.pos) && ast.arraySize.Equals(too.arraySize) && ast.elementType.Equals(too.elementType)
 }
 
@@ -310,15 +405,15 @@ type ASTDataTypePointer struct {
 	elementType AST     // pointer to this data type
 }
 
-func (ast ASTDataTypePointer) IsAST() {
+func (ast *ASTDataTypePointer) IsAST() {
 }
 
-func (ast ASTDataTypePointer) Pos() SrcSpan {
+func (ast *ASTDataTypePointer) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTDataTypePointer) Equals(to AST) bool {
-	too := to.(ASTDataTypePointer)
+func (ast *ASTDataTypePointer) Equals(to AST) bool {
+	too := to.(*ASTDataTypePointer)
 	return ast.pos.Equals(too.pos) && ast.elementType.Equals(too.elementType)
 }
 
@@ -329,15 +424,15 @@ type ASTDataTypeMap struct {
 	valueType AST     // value is this data type
 }
 
-func (ast ASTDataTypeMap) IsAST() {
+func (ast *ASTDataTypeMap) IsAST() {
 }
 
-func (ast ASTDataTypeMap) Pos() SrcSpan {
+func (ast *ASTDataTypeMap) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTDataTypeMap) Equals(to AST) bool {
-	too := to.(ASTDataTypeMap)
+func (ast *ASTDataTypeMap) Equals(to AST) bool {
+	too := to.(*ASTDataTypeMap)
 	return ast.pos.Equals(too.pos) && ast.keyType.Equals(too.keyType) && ast.valueType.Equals(too.valueType)
 }
 
@@ -345,9 +440,9 @@ func (ast ASTDataTypeMap) Equals(to AST) bool {
 type ChanDirection int
 
 const (
-	ChanDirectionIn ChanDirection = iota
-	ChanDirectionOut
-	ChanDirectionBi
+	ChanDirectionIn  ChanDirection = iota // "<-chan", data only comes in from it.
+	ChanDirectionOut                      // "chan<-", data only goes out to it.
+	ChanDirectionBi                       // "chan", data goes both ways.
 )
 
 // type ASTDataTypeChan describes a channel declaration.
@@ -357,15 +452,15 @@ type ASTDataTypeChan struct {
 	elementType AST           // pointer to this data type
 }
 
-func (ast ASTDataTypeChan) IsAST() {
+func (ast *ASTDataTypeChan) IsAST() {
 }
 
-func (ast ASTDataTypeChan) Pos() SrcSpan {
+func (ast *ASTDataTypeChan) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTDataTypeChan) Equals(to AST) bool {
-	too := to.(ASTDataTypeChan)
+func (ast *ASTDataTypeChan) Equals(to AST) bool {
+	too := to.(*ASTDataTypeChan)
 	return ast.pos.Equals(too.pos) && ast.dir == too.dir && ast.elementType.Equals(too.elementType)
 }
 
@@ -375,16 +470,16 @@ type ASTDataTypeStruct struct {
 	fields []AST   // fields of this struct
 }
 
-func (ast ASTDataTypeStruct) IsAST() {
+func (ast *ASTDataTypeStruct) IsAST() {
 }
 
-func (ast ASTDataTypeStruct) Pos() SrcSpan {
+func (ast *ASTDataTypeStruct) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTDataTypeStruct) Equals(to AST) bool {
-	too := to.(ASTDataTypeStruct)
-	if !ast.pos.Equals(too.pos) && len(ast.fields) == len(too.fields) {
+func (ast *ASTDataTypeStruct) Equals(to AST) bool {
+	too := to.(*ASTDataTypeStruct)
+	if !(ast.pos.Equals(too.pos) && len(ast.fields) == len(too.fields)) {
 		return false
 	}
 
@@ -399,15 +494,15 @@ func (ast ASTDataTypeStruct) Equals(to AST) bool {
 
 // type ASTDataTypeField describes a field of a struct.
 type ASTDataTypeField struct {
-	identifier AST    // identifier of this field
-	typ        AST    // type of this field
-	tag        string // tag associated with this field
+	identifier AST       // identifier of this field
+	typ        AST       // type of this field
+	tag        StructTag // tag associated with this field
 }
 
-func (ast ASTDataTypeField) IsAST() {
+func (ast *ASTDataTypeField) IsAST() {
 }
 
-func (ast ASTDataTypeField) Pos() SrcSpan {
+func (ast *ASTDataTypeField) Pos() SrcSpan {
 	if ast.identifier != nil {
 		return ast.identifier.Pos()
 	} else {
@@ -415,8 +510,8 @@ func (ast ASTDataTypeField) Pos() SrcSpan {
 	}
 }
 
-func (ast ASTDataTypeField) Equals(to AST) bool {
-	too := to.(ASTDataTypeField)
+func (ast *ASTDataTypeField) Equals(to AST) bool {
+	too := to.(*ASTDataTypeField)
 	return ast.identifier.Equals(too.identifier) && ast.typ.Equals(too.typ) && ast.tag == too.tag
 }
 
@@ -427,16 +522,16 @@ type ASTDataTypeFunc struct {
 	returns []AST   // return values of this function
 }
 
-func (ast ASTDataTypeFunc) IsAST() {
+func (ast *ASTDataTypeFunc) IsAST() {
 }
 
-func (ast ASTDataTypeFunc) Pos() SrcSpan {
+func (ast *ASTDataTypeFunc) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTDataTypeFunc) Equals(to AST) bool {
-	too := to.(ASTDataTypeFunc)
-	if !(ast.pos.Equals(too.pos) && len(ast.params) == len(too.params) || len(ast.returns) == len(too.returns)) {
+func (ast *ASTDataTypeFunc) Equals(to AST) bool {
+	too := to.(*ASTDataTypeFunc)
+	if !(ast.pos.Equals(too.pos) && len(ast.params) == len(too.params) && len(ast.returns) == len(too.returns)) {
 		return false
 	}
 
@@ -455,26 +550,49 @@ func (ast ASTDataTypeFunc) Equals(to AST) bool {
 	return true
 }
 
+// type ASTFuncLit describes a function literal like "func(x int) int { return x; }".
+type ASTFuncLit struct {
+	pos     SrcSpan // the whole function literal including the body
+	params  []AST   // the parameters
+	returns []AST   // the return values
+	body    AST     // the body of the function
+}
+
+func (ast *ASTFuncLit) IsAST() {
+}
+
+func (ast *ASTFuncLit) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTFuncLit) Equals(to AST) bool {
+	too := to.(*ASTFuncLit)
+	return ast.pos.Equals(too.pos) && astListEquals(ast.params, too.params) && astListEquals(ast.returns, too.returns) && ast.body.Equals(too.body)
+}
+
 // type ASTParamDecl describes a function/method parameter or return value.
 type ASTParameterDecl struct {
 	identifier AST // the name of the parameter
-	typ        AST // the type of the parameter
+	ellipsis   AST // the "..." if it's a variadic parameter
+	typ        AST // the type of the parameter, or its element type if it's variadic
 }
 
-func (ast ASTParameterDecl) IsAST() {
+func (ast *ASTParameterDecl) IsAST() {
 }
 
-func (ast ASTParameterDecl) Pos() SrcSpan {
+func (ast *ASTParameterDecl) Pos() SrcSpan {
 	if ast.identifier != nil {
 		return ast.identifier.Pos().Add(ast.typ.Pos())
+	} else if ast.ellipsis != nil {
+		return ast.ellipsis.Pos().Add(ast.typ.Pos())
 	} else {
 		return ast.typ.Pos()
 	}
 }
 
-func (ast ASTParameterDecl) Equals(to AST) bool {
-	too := to.(ASTParameterDecl)
-	return ast.identifier.Equals(too.identifier) && ast.typ.Equals(too.typ)
+func (ast *ASTParameterDecl) Equals(to AST) bool {
+	too := to.(*ASTParameterDecl)
+	return astEquals(ast.identifier, too.identifier) && astEquals(ast.ellipsis, too.ellipsis) && ast.typ.Equals(too.typ)
 }
 
 // type ASTEllipsis describes an ellipsis as part of a parameter list.
@@ -482,15 +600,15 @@ type ASTEllipsis struct {
 	pos SrcSpan // where the ellipsis is
 }
 
-func (ast ASTEllipsis) IsAST() {
+func (ast *ASTEllipsis) IsAST() {
 }
 
-func (ast ASTEllipsis) Pos() SrcSpan {
+func (ast *ASTEllipsis) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTEllipsis) Equals(to AST) bool {
-	too := to.(ASTEllipsis)
+func (ast *ASTEllipsis) Equals(to AST) bool {
+	too := to.(*ASTEllipsis)
 	return ast.pos.Equals(too.pos)
 }
 
@@ -500,15 +618,15 @@ type ASTDataTypeInterface struct {
 	methods []AST   // methods of this interface
 }
 
-func (ast ASTDataTypeInterface) IsAST() {
+func (ast *ASTDataTypeInterface) IsAST() {
 }
 
-func (ast ASTDataTypeInterface) Pos() SrcSpan {
+func (ast *ASTDataTypeInterface) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTDataTypeInterface) Equals(to AST) bool {
-	too := to.(ASTDataTypeInterface)
+func (ast *ASTDataTypeInterface) Equals(to AST) bool {
+	too := to.(*ASTDataTypeInterface)
 	if !(ast.pos.Equals(too.pos) && len(ast.methods) == len(too.methods)) {
 		return false
 	}
@@ -530,16 +648,16 @@ type ASTDataTypeMethodSpec struct {
 	returns []AST   // the method return values
 }
 
-func (ast ASTDataTypeMethodSpec) IsAST() {
+func (ast *ASTDataTypeMethodSpec) IsAST() {
 }
 
-func (ast ASTDataTypeMethodSpec) Pos() SrcSpan {
+func (ast *ASTDataTypeMethodSpec) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTDataTypeMethodSpec) Equals(to AST) bool {
-	too := to.(ASTDataTypeMethodSpec)
-	if !(ast.pos.Equals(too.pos) && ast.name == too.name && len(ast.params) == len(too.params) || len(ast.returns) == len(too.returns)) {
+func (ast *ASTDataTypeMethodSpec) Equals(to AST) bool {
+	too := to.(*ASTDataTypeMethodSpec)
+	if !(ast.pos.Equals(too.pos) && ast.name == too.name && len(ast.params) == len(too.params) && len(ast.returns) == len(too.returns)) {
 		return false
 	}
 
@@ -564,15 +682,15 @@ type ASTBlock struct {
 	statements []AST   // the statements in the block
 }
 
-func (ast ASTBlock) IsAST() {
+func (ast *ASTBlock) IsAST() {
 }
 
-func (ast ASTBlock) Pos() SrcSpan {
+func (ast *ASTBlock) Pos() SrcSpan {
 	return ast.pos
 }
 
-func (ast ASTBlock) Equals(to AST) bool {
-	too := to.(ASTBlock)
+func (ast *ASTBlock) Equals(to AST) bool {
+	too := to.(*ASTBlock)
 	if !(ast.pos.Equals(too.pos) && len(ast.statements) == len(too.statements)) {
 		return false
 	}
@@ -585,3 +703,269 @@ func (ast ASTBlock) Equals(to AST) bool {
 
 	return true
 }
+
+// type ASTSelector describes a selector like "a.b". It might select a field
+// or method, or a symbol from an imported package.
+type ASTSelector struct {
+	pos  SrcSpan // the whole selector expression
+	expr AST     // the expression being selected from
+	name string  // the name being selected
+}
+
+func (ast *ASTSelector) IsAST() {
+}
+
+func (ast *ASTSelector) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTSelector) Equals(to AST) bool {
+	too := to.(*ASTSelector)
+	return ast.pos.Equals(too.pos) && ast.expr.Equals(too.expr) && ast.name == too.name
+}
+
+// type SelectionKind says what sort of thing a selector picks out. The
+// parser can't tell so it's worked out when types are inferred.
+type SelectionKind int
+
+const (
+	SelectionUnknown     SelectionKind = iota // it hasn't been worked out.
+	SelectionQualified                        // a symbol in an imported package, like "fmt.Println".
+	SelectionField                            // a struct field, like "p.x".
+	SelectionMethodValue                      // a method bound to a value, like "buf.Write".
+	SelectionMethodExpr                       // a method used as a function, like "bytes.Buffer.Write".
+)
+
+// type ASTCall describes a function call.
+type ASTCall struct {
+	pos      SrcSpan // the whole call including the arguments
+	function AST     // the function being called
+	args     []AST   // the arguments
+}
+
+func (ast *ASTCall) IsAST() {
+}
+
+func (ast *ASTCall) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTCall) Equals(to AST) bool {
+	too := to.(*ASTCall)
+	if !(ast.pos.Equals(too.pos) && ast.function.Equals(too.function) && len(ast.args) == len(too.args)) {
+		return false
+	}
+
+	for i, a := range ast.args {
+		if !a.Equals(too.args[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// type ASTIndex describes indexing an array, slice, string or map.
+type ASTIndex struct {
+	pos   SrcSpan // the whole index expression
+	expr  AST     // the expression being indexed
+	index AST     // the index
+}
+
+func (ast *ASTIndex) IsAST() {
+}
+
+func (ast *ASTIndex) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTIndex) Equals(to AST) bool {
+	too := to.(*ASTIndex)
+	return ast.pos.Equals(too.pos) && ast.expr.Equals(too.expr) && ast.index.Equals(too.index)
+}
+
+// type ASTTypeAssert describes a type assertion like "x.(T)".
+type ASTTypeAssert struct {
+	pos  SrcSpan // the whole type assertion
+	expr AST     // the interface value being asserted
+	typ  AST     // the type it's asserted to be
+}
+
+func (ast *ASTTypeAssert) IsAST() {
+}
+
+func (ast *ASTTypeAssert) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTTypeAssert) Equals(to AST) bool {
+	too := to.(*ASTTypeAssert)
+	return ast.pos.Equals(too.pos) && ast.expr.Equals(too.expr) && ast.typ.Equals(too.typ)
+}
+
+// type ASTReturn describes a return statement.
+type ASTReturn struct {
+	pos    SrcSpan // the whole statement
+	values []AST   // the values being returned
+}
+
+func (ast *ASTReturn) IsAST() {
+}
+
+func (ast *ASTReturn) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTReturn) Equals(to AST) bool {
+	too := to.(*ASTReturn)
+	if !(ast.pos.Equals(too.pos) && len(ast.values) == len(too.values)) {
+		return false
+	}
+
+	for i, a := range ast.values {
+		if !a.Equals(too.values[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// type ASTIf describes an if statement.
+type ASTIf struct {
+	pos       SrcSpan // the whole statement
+	init      AST     // the optional statement before the condition
+	condition AST     // the condition
+	then      AST     // the block to run if the condition is true
+	otherwise AST     // the optional else block or if statement
+}
+
+func (ast *ASTIf) IsAST() {
+}
+
+func (ast *ASTIf) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTIf) Equals(to AST) bool {
+	too := to.(*ASTIf)
+	return ast.pos.Equals(too.pos) && astEquals(ast.init, too.init) && ast.condition.Equals(too.condition) && ast.then.Equals(too.then) && astEquals(ast.otherwise, too.otherwise)
+}
+
+// type ASTFor describes a for statement. Any of the parts before the body
+// can be missing.
+type ASTFor struct {
+	pos       SrcSpan // the whole statement
+	init      AST     // the optional statement before the first iteration
+	condition AST     // the optional condition, which is checked before each iteration
+	post      AST     // the optional statement after each iteration
+	body      AST     // the block to run each time
+}
+
+func (ast *ASTFor) IsAST() {
+}
+
+func (ast *ASTFor) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTFor) Equals(to AST) bool {
+	too := to.(*ASTFor)
+	return ast.pos.Equals(too.pos) && astEquals(ast.init, too.init) && astEquals(ast.condition, too.condition) && astEquals(ast.post, too.post) && ast.body.Equals(too.body)
+}
+
+// type ASTAssign describes an assignment like "a, b = c, d" or "a += b".
+type ASTAssign struct {
+	pos   SrcSpan   // the whole statement
+	op    TokenKind // "=" or an operation like "+="
+	left  []AST     // what's being assigned to
+	right []AST     // the values being assigned
+}
+
+func (ast *ASTAssign) IsAST() {
+}
+
+func (ast *ASTAssign) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTAssign) Equals(to AST) bool {
+	too := to.(*ASTAssign)
+	return ast.pos.Equals(too.pos) && ast.op == too.op && astListEquals(ast.left, too.left) && astListEquals(ast.right, too.right)
+}
+
+// type ASTShortVarDecl describes a declaration like "a, b := c, d".
+type ASTShortVarDecl struct {
+	pos    SrcSpan // the whole statement
+	idents []AST   // the variables being declared
+	values []AST   // their values
+}
+
+func (ast *ASTShortVarDecl) IsAST() {
+}
+
+func (ast *ASTShortVarDecl) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTShortVarDecl) Equals(to AST) bool {
+	too := to.(*ASTShortVarDecl)
+	return ast.pos.Equals(too.pos) && astListEquals(ast.idents, too.idents) && astListEquals(ast.values, too.values)
+}
+
+// type ASTIncDec describes an increment or decrement statement.
+type ASTIncDec struct {
+	pos  SrcSpan   // the whole statement
+	op   TokenKind // "++" or "--"
+	expr AST       // what's being incremented or decremented
+}
+
+func (ast *ASTIncDec) IsAST() {
+}
+
+func (ast *ASTIncDec) Pos() SrcSpan {
+	return ast.pos
+}
+
+func (ast *ASTIncDec) Equals(to AST) bool {
+	too := to.(*ASTIncDec)
+	return ast.pos.Equals(too.pos) && ast.op == too.op && ast.expr.Equals(too.expr)
+}
+
+// astEquals compares two ASTs which might be nil.
+func astEquals(a, b AST) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return a.Equals(b)
+}
+
+// declSpan gets the span of a const or var declaration from its parts.
+// The type and value are optional.
+func declSpan(ident AST, typ AST, value AST) SrcSpan {
+	pos := ident.Pos()
+	switch {
+	case value != nil:
+		pos = pos.Add(value.Pos())
+	case typ != nil:
+		pos = pos.Add(typ.Pos())
+	}
+
+	return pos
+}
+
+// astListEquals compares two lists of ASTs.
+func astListEquals(a, b []AST) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !astEquals(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
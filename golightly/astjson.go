@@ -0,0 +1,169 @@
+package golightly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// type jsonNode is an AST node on its way to becoming JSON. Every node
+// has a "kind" saying what it is and a "pos" saying where it is.
+type jsonNode map[string]interface{}
+
+// MarshalAST turns an AST into JSON so tools which aren't written in Go
+// can look at it. Missing optional children come out as null.
+func MarshalAST(node AST) ([]byte, error) {
+	jn, err := astToJSON(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jn)
+}
+
+// astToJSON converts a single node and all its children.
+func astToJSON(ast AST) (jsonNode, error) {
+	if ast == nil {
+		return nil, nil
+	}
+
+	// children are converted as we go and the first error wins.
+	var err error
+	child := func(a AST) jsonNode {
+		jn, childErr := astToJSON(a)
+		if childErr != nil && err == nil {
+			err = childErr
+		}
+
+		return jn
+	}
+
+	list := func(asts []AST) []jsonNode {
+		jns := []jsonNode{}
+		for _, a := range asts {
+			jns = append(jns, child(a))
+		}
+
+		return jns
+	}
+
+	var jn jsonNode
+	switch a := ast.(type) {
+	case *ASTTopLevel:
+		jn = jsonNode{"kind": "toplevel", "packageName": a.packageName, "imports": list(a.imports), "decls": list(a.topLevelDecls)}
+	case *ASTImport:
+		jn = jsonNode{"kind": "import", "packageName": child(a.packageName), "importPath": child(a.importPath)}
+	case *ASTUnaryExpr:
+		jn = jsonNode{"kind": "unary", "op": operatorNames[a.op], "param": child(a.param)}
+	case *ASTBinaryExpr:
+		jn = jsonNode{"kind": "binary", "op": operatorNames[a.op], "left": child(a.left), "right": child(a.right)}
+	case *ASTParen:
+		jn = jsonNode{"kind": "paren", "expr": child(a.expr)}
+	case *ASTValue:
+		jn = jsonNode{"kind": "value", "valueKind": valueKind(a.val), "value": a.val.String()}
+	case *ASTIdentifier:
+		jn = jsonNode{"kind": "identifier", "packageName": a.packageName, "name": a.name}
+	case *ASTConstDecl:
+		jn = jsonNode{"kind": "const", "ident": child(a.ident), "type": child(a.typ), "value": child(a.value)}
+	case *ASTVarDecl:
+		jn = jsonNode{"kind": "var", "ident": child(a.ident), "type": child(a.typ), "value": child(a.value)}
+	case *ASTFunctionDecl:
+		jn = jsonNode{"kind": "func", "name": a.name, "receiver": child(a.receiver), "params": list(a.params), "returns": list(a.returns), "body": child(a.body)}
+	case *ASTReceiver:
+		jn = jsonNode{"kind": "receiver", "name": a.name, "pointer": a.pointer, "typeName": a.typeName}
+	case *ASTDataTypeDecl:
+		jn = jsonNode{"kind": "type", "ident": child(a.ident), "type": child(a.typ), "alias": a.alias}
+	case *ASTDataTypeSlice:
+		jn = jsonNode{"kind": "slice", "elementType": child(a.elementType)}
+	case *ASTDataTypeArray:
+		jn = jsonNode{"kind": "array", "size": child(a.arraySize), "elementType": child(a.elementType)}
+	case *ASTDataTypePointer:
+		jn = jsonNode{"kind": "pointer", "elementType": child(a.elementType)}
+	case *ASTDataTypeMap:
+		jn = jsonNode{"kind": "map", "keyType": child(a.keyType), "valueType": child(a.valueType)}
+	case *ASTDataTypeChan:
+		jn = jsonNode{"kind": "chan", "dir": chanDirectionNames[a.dir], "elementType": child(a.elementType)}
+	case *ASTDataTypeStruct:
+		jn = jsonNode{"kind": "struct", "fields": list(a.fields)}
+	case *ASTDataTypeField:
+		jn = jsonNode{"kind": "field", "ident": child(a.identifier), "type": child(a.typ), "tag": string(a.tag)}
+	case *ASTDataTypeFunc:
+		jn = jsonNode{"kind": "functype", "params": list(a.params), "returns": list(a.returns)}
+	case *ASTParameterDecl:
+		jn = jsonNode{"kind": "param", "ident": child(a.identifier), "ellipsis": child(a.ellipsis), "type": child(a.typ)}
+	case *ASTEllipsis:
+		jn = jsonNode{"kind": "ellipsis"}
+	case *ASTDataTypeInterface:
+		jn = jsonNode{"kind": "interface", "methods": list(a.methods)}
+	case *ASTDataTypeMethodSpec:
+		jn = jsonNode{"kind": "method", "name": a.name, "params": list(a.params), "returns": list(a.returns)}
+	case *ASTBlock:
+		jn = jsonNode{"kind": "block", "statements": list(a.statements)}
+	case *ASTSelector:
+		jn = jsonNode{"kind": "selector", "expr": child(a.expr), "name": a.name}
+	case *ASTCall:
+		jn = jsonNode{"kind": "call", "function": child(a.function), "args": list(a.args)}
+	case *ASTIndex:
+		jn = jsonNode{"kind": "index", "expr": child(a.expr), "index": child(a.index)}
+	case *ASTTypeAssert:
+		jn = jsonNode{"kind": "typeassert", "expr": child(a.expr), "type": child(a.typ)}
+	case *ASTFuncLit:
+		jn = jsonNode{"kind": "funclit", "params": list(a.params), "returns": list(a.returns), "body": child(a.body)}
+	case *ASTReturn:
+		jn = jsonNode{"kind": "return", "values": list(a.values)}
+	case *ASTIf:
+		jn = jsonNode{"kind": "if", "init": child(a.init), "condition": child(a.condition), "then": child(a.then), "else": child(a.otherwise)}
+	case *ASTFor:
+		jn = jsonNode{"kind": "for", "init": child(a.init), "condition": child(a.condition), "post": child(a.post), "body": child(a.body)}
+	case *ASTAssign:
+		jn = jsonNode{"kind": "assign", "op": operatorNames[a.op], "left": list(a.left), "right": list(a.right)}
+	case *ASTShortVarDecl:
+		jn = jsonNode{"kind": "define", "idents": list(a.idents), "values": list(a.values)}
+	case *ASTIncDec:
+		jn = jsonNode{"kind": "incdec", "op": operatorNames[a.op], "expr": child(a.expr)}
+	default:
+		return nil, errors.New(fmt.Sprintf("I don't know how to turn a %T into JSON", ast))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	jn["pos"] = srcSpanToJSON(ast.Pos())
+	return jn, nil
+}
+
+// srcSpanToJSON converts a source span to JSON.
+func srcSpanToJSON(pos SrcSpan) jsonNode {
+	return jsonNode{
+		"start": jsonNode{"line": pos.start.Line, "column": pos.start.Column},
+		"end":   jsonNode{"line": pos.end.Line, "column": pos.end.Column},
+	}
+}
+
+// valueKind says what sort of literal a value is.
+func valueKind(val Value) string {
+	switch val.(type) {
+	case ValueInt:
+		return "int"
+	case ValueUint:
+		return "uint"
+	case ValueFloat:
+		return "float"
+	case ValueRune:
+		return "rune"
+	case ValueString:
+		return "string"
+	case ValueBool:
+		return "bool"
+	}
+
+	return "unknown"
+}
+
+// chanDirectionNames are the names of the directions a channel can go in.
+var chanDirectionNames = map[ChanDirection]string{
+	ChanDirectionIn:  "in",
+	ChanDirectionOut: "out",
+	ChanDirectionBi:  "bi",
+}
@@ -0,0 +1,70 @@
+package golightly
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMarshalAST(t *testing.T) {
+	expr, err := setupParserTest("a + f(1)").parseExpression()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	js, err := MarshalAST(expr)
+	if err != nil {
+		t.Fatal("error marshaling: ", err)
+	}
+
+	var tree map[string]interface{}
+	if err := json.Unmarshal(js, &tree); err != nil {
+		t.Fatal("not valid JSON: ", err)
+	}
+
+	if tree["kind"] != "binary" || tree["op"] != "+" {
+		t.Errorf("expected a binary '+' at the top, got %s", js)
+	}
+
+	end := tree["pos"].(map[string]interface{})["end"].(map[string]interface{})
+	if end["line"] != 1.0 || end["column"] != 8.0 {
+		t.Errorf("expected the expression to end at 1:8, got %v", end)
+	}
+
+	call := tree["right"].(map[string]interface{})
+	if call["kind"] != "call" || call["function"].(map[string]interface{})["name"] != "f" {
+		t.Errorf("expected a call to f on the right, got %v", call)
+	}
+
+	arg := call["args"].([]interface{})[0].(map[string]interface{})
+	if arg["kind"] != "value" || arg["valueKind"] != "uint" || arg["value"] != "1" {
+		t.Errorf("expected the argument to be the number 1, got %v", arg)
+	}
+}
+
+func TestMarshalASTSourceFile(t *testing.T) {
+	src := "package main;\n" +
+		"import \"fmt\";\n" +
+		"type T struct { a []int `json:\"a\"`; b *T; };\n" +
+		"type I interface { M(x ...int) (bool, error); };\n" +
+		"const C = (1 + 2);\n" +
+		"func (t *T) F(a int, b [4]string) int { x := 1; x++; if x > 1 { return t.b.a[0] } else { x = -x }; return x };\n"
+
+	p := setupParserTest(src)
+	if err := p.Parse(); err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	js, err := MarshalAST(p.sf.ast)
+	if err != nil {
+		t.Fatal("error marshaling: ", err)
+	}
+
+	var tree map[string]interface{}
+	if err := json.Unmarshal(js, &tree); err != nil {
+		t.Fatal("not valid JSON: ", err)
+	}
+
+	if tree["kind"] != "toplevel" || tree["packageName"] != "main" || len(tree["decls"].([]interface{})) != 4 {
+		t.Errorf("expected the top level of package main with 4 declarations, got %s", js)
+	}
+}
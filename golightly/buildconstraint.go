@@ -0,0 +1,296 @@
+package golightly
+
+import (
+	"fmt"
+	"go/build"
+	"strings"
+	"unicode"
+)
+
+// type BuildConstraint is a parsed "//go:build" expression. It's a "sum
+// type" implemented by buildTag, buildNot, buildAnd and buildOr.
+type BuildConstraint interface {
+	Eval(tags map[string]bool) bool // true if a file with this constraint should be built with these tags.
+	String() string
+}
+
+// type buildTag is a single build tag like "linux".
+type buildTag string
+
+func (bt buildTag) Eval(tags map[string]bool) bool {
+	return tags[string(bt)]
+}
+
+func (bt buildTag) String() string {
+	return string(bt)
+}
+
+// type buildNot is "!x".
+type buildNot struct {
+	x BuildConstraint
+}
+
+func (bn buildNot) Eval(tags map[string]bool) bool {
+	return !bn.x.Eval(tags)
+}
+
+func (bn buildNot) String() string {
+	return "!" + bracketBuildConstraint(bn.x)
+}
+
+// type buildAnd is "x && y".
+type buildAnd struct {
+	x, y BuildConstraint
+}
+
+func (ba buildAnd) Eval(tags map[string]bool) bool {
+	return ba.x.Eval(tags) && ba.y.Eval(tags)
+}
+
+func (ba buildAnd) String() string {
+	// "||" binds less tightly so it needs brackets in here.
+	x, y := ba.x.String(), ba.y.String()
+	if _, ok := ba.x.(buildOr); ok {
+		x = "(" + x + ")"
+	}
+	if _, ok := ba.y.(buildOr); ok {
+		y = "(" + y + ")"
+	}
+
+	return x + " && " + y
+}
+
+// type buildOr is "x || y".
+type buildOr struct {
+	x, y BuildConstraint
+}
+
+func (bo buildOr) Eval(tags map[string]bool) bool {
+	return bo.x.Eval(tags) || bo.y.Eval(tags)
+}
+
+func (bo buildOr) String() string {
+	return bo.x.String() + " || " + bo.y.String()
+}
+
+// bracketBuildConstraint brackets anything more complicated than a tag.
+func bracketBuildConstraint(bc BuildConstraint) string {
+	if _, ok := bc.(buildTag); ok {
+		return bc.String()
+	}
+
+	return "(" + bc.String() + ")"
+}
+
+// type buildConstraintParser parses the expression in a "//go:build"
+// comment.
+type buildConstraintParser struct {
+	filename string  // where the comment is, for errors.
+	pos      SrcSpan // where the comment is, for errors.
+	tokens   []string
+}
+
+// ParseBuildConstraint parses a build constraint expression like
+// "linux && (amd64 || arm64)". The filename and pos are where it came
+// from and are only used in errors.
+func ParseBuildConstraint(filename string, pos SrcSpan, expr string) (BuildConstraint, error) {
+	bp := &buildConstraintParser{filename: filename, pos: pos}
+	err := bp.tokenise(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bp.tokens) == 0 {
+		return nil, bp.error("this //go:build line is empty")
+	}
+
+	bc, err := bp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bp.tokens) > 0 {
+		return nil, bp.error(fmt.Sprint("I wasn't expecting '", bp.tokens[0], "' here in this //go:build line"))
+	}
+
+	return bc, nil
+}
+
+// tokenise breaks the expression up into tags, operators and brackets.
+func (bp *buildConstraintParser) tokenise(expr string) error {
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		ch := runes[i]
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+
+		case ch == '!' || ch == '(' || ch == ')':
+			bp.tokens = append(bp.tokens, string(ch))
+			i++
+
+		case ch == '&' || ch == '|':
+			if i+1 >= len(runes) || runes[i+1] != ch {
+				return bp.error(fmt.Sprint("'", string(ch), "' should be '", string(ch), string(ch), "' in this //go:build line"))
+			}
+
+			bp.tokens = append(bp.tokens, string(ch)+string(ch))
+			i += 2
+
+		case isBuildTagRune(ch):
+			start := i
+			for i < len(runes) && isBuildTagRune(runes[i]) {
+				i++
+			}
+
+			bp.tokens = append(bp.tokens, string(runes[start:i]))
+
+		default:
+			return bp.error(fmt.Sprint("'", string(ch), "' can't go in a //go:build line"))
+		}
+	}
+
+	return nil
+}
+
+// isBuildTagRune returns true for characters which can be in a build tag.
+func isBuildTagRune(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_' || ch == '.'
+}
+
+// parseOr parses "x || y || ...".
+func (bp *buildConstraintParser) parseOr() (BuildConstraint, error) {
+	x, err := bp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for bp.accept("||") {
+		y, err := bp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		x = buildOr{x, y}
+	}
+
+	return x, nil
+}
+
+// parseAnd parses "x && y && ...".
+func (bp *buildConstraintParser) parseAnd() (BuildConstraint, error) {
+	x, err := bp.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for bp.accept("&&") {
+		y, err := bp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		x = buildAnd{x, y}
+	}
+
+	return x, nil
+}
+
+// parseNot parses "!x", a bracketed expression or a tag.
+func (bp *buildConstraintParser) parseNot() (BuildConstraint, error) {
+	if len(bp.tokens) == 0 {
+		return nil, bp.error("this //go:build line ends too soon")
+	}
+
+	tok := bp.tokens[0]
+	bp.tokens = bp.tokens[1:]
+	switch tok {
+	case "!":
+		x, err := bp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return buildNot{x}, nil
+
+	case "(":
+		x, err := bp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if !bp.accept(")") {
+			return nil, bp.error("there's a '(' without a ')' in this //go:build line")
+		}
+
+		return x, nil
+
+	case ")", "&&", "||":
+		return nil, bp.error(fmt.Sprint("I wasn't expecting '", tok, "' here in this //go:build line"))
+	}
+
+	return buildTag(tok), nil
+}
+
+// accept takes the next token if it's the one we want.
+func (bp *buildConstraintParser) accept(tok string) bool {
+	if len(bp.tokens) == 0 || bp.tokens[0] != tok {
+		return false
+	}
+
+	bp.tokens = bp.tokens[1:]
+	return true
+}
+
+// error makes an error at the //go:build comment.
+func (bp *buildConstraintParser) error(message string) error {
+	return NewError(bp.filename, bp.pos, message)
+}
+
+// buildConstraintExpr gets the expression out of a line comment if it's a
+// "//go:build" one. The comment is the text after the "//".
+func buildConstraintExpr(comment string) (string, bool) {
+	if !strings.HasPrefix(comment, "go:build") {
+		return "", false
+	}
+
+	rest := comment[len("go:build"):]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		// it's something else like "//go:builder".
+		return "", false
+	}
+
+	return strings.TrimSpace(rest), true
+}
+
+// unixOSes are the operating systems which satisfy the "unix" tag.
+var unixOSes = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true,
+	"freebsd": true, "hurd": true, "illumos": true, "ios": true,
+	"linux": true, "netbsd": true, "openbsd": true, "solaris": true,
+}
+
+// impliedOSes are operating systems which also count as another one, like
+// android files being built for linux too.
+var impliedOSes = map[string]string{
+	"android": "linux",
+	"illumos": "solaris",
+	"ios":     "darwin",
+}
+
+// DefaultBuildTags returns the tags the go tool would build with for an
+// operating system and architecture: the two of them, "unix" if it's a
+// unix, and a "go1.x" tag for every release up to the one we were built
+// with.
+func DefaultBuildTags(goos string, goarch string) []string {
+	tags := []string{goos, goarch}
+	if implied, ok := impliedOSes[goos]; ok {
+		tags = append(tags, implied)
+	}
+
+	if unixOSes[goos] {
+		tags = append(tags, "unix")
+	}
+
+	return append(tags, build.Default.ReleaseTags...)
+}
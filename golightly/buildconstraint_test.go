@@ -0,0 +1,182 @@
+package golightly
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseBuildConstraint(t *testing.T) {
+	linuxAmd64 := map[string]bool{"linux": true, "amd64": true}
+	cases := []struct {
+		expr   string
+		str    string
+		result bool
+	}{
+		{"linux && amd64", "linux && amd64", true},
+		{"linux && arm64", "linux && arm64", false},
+		{"darwin || linux", "darwin || linux", true},
+		{"!windows", "!windows", true},
+		{"!(linux && amd64)", "!(linux && amd64)", false},
+		{"(darwin || linux) && !386", "(darwin || linux) && !386", true},
+		{"darwin || linux && arm64", "darwin || linux && arm64", false},
+		{"go1.18&&linux", "go1.18 && linux", false},
+	}
+
+	for _, c := range cases {
+		bc, err := ParseBuildConstraint("test.go", SrcSpan{}, c.expr)
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.expr, err)
+			continue
+		}
+
+		if bc.String() != c.str {
+			t.Errorf("'%s' parsed as '%s', expected '%s'", c.expr, bc, c.str)
+		}
+
+		if bc.Eval(linuxAmd64) != c.result {
+			t.Errorf("'%s' should be %v for linux and amd64", c.expr, c.result)
+		}
+	}
+}
+
+func TestParseBuildConstraintErrors(t *testing.T) {
+	cases := []struct {
+		expr string
+		err  string
+	}{
+		{"", "test.go:1: this //go:build line is empty"},
+		{"linux &", "test.go:1: '&' should be '&&' in this //go:build line"},
+		{"linux &&", "test.go:1: this //go:build line ends too soon"},
+		{"(linux", "test.go:1: there's a '(' without a ')' in this //go:build line"},
+		{"linux amd64", "test.go:1: I wasn't expecting 'amd64' here in this //go:build line"},
+		{"linux, amd64", "test.go:1: ',' can't go in a //go:build line"},
+	}
+
+	for _, c := range cases {
+		_, err := ParseBuildConstraint("test.go", SrcSpan{SrcLoc{1, 1}, SrcLoc{1, 1}, ""}, c.expr)
+		if err == nil || err.Error() != c.err {
+			t.Errorf("'%s' gave error %v, expected '%s'", c.expr, err, c.err)
+		}
+	}
+}
+
+func TestLexerBuildConstraint(t *testing.T) {
+	l := setupLexerTest("// some words\n\n//go:build linux && amd64\n\n//go:build ignored\npackage main;\n//go:build too late\n")
+	if _, err := l.PeekToken(0); err != nil {
+		t.Fatal("error lexing: ", err)
+	}
+
+	expr, pos, ok := l.BuildConstraint()
+	if !ok || expr != "linux && amd64" || pos.start != (SrcLoc{3, 1}) {
+		t.Errorf("expected 'linux && amd64' at 3:1, got '%s' at %v", expr, pos.start)
+	}
+
+	if _, _, ok := setupLexerTest("//go:builder x\npackage main;\n").BuildConstraint(); ok {
+		t.Error("//go:builder isn't a build constraint")
+	}
+}
+
+func TestCompileBuildConstraints(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":    &fstest.MapFile{Data: []byte("package main;\nvar a = 1;\n")},
+		"linux.go":   &fstest.MapFile{Data: []byte("//go:build linux && amd64\n\npackage main;\nvar b = 1;\n")},
+		"windows.go": &fstest.MapFile{Data: []byte("//go:build windows\n\npackage other;\nvar c = \"in the wrong package\";\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	c.SetBuildTags("linux", "amd64")
+	result, err := c.CompileAll([]string{"main.go", "linux.go", "windows.go"})
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	if _, ok := result.ASTs["windows.go"]; ok {
+		t.Error("windows.go should have been left out")
+	}
+
+	if len(result.Packages["main"]) != 2 {
+		t.Errorf("expected two files in main, got %v", result.Packages["main"])
+	}
+
+	// a broken constraint is an error.
+	fsys["linux.go"] = &fstest.MapFile{Data: []byte("//go:build linux &&\n\npackage main;\nvar b = 1;\n")}
+	err = NewCompilerFS(fsys).Compile([]string{"linux.go"})
+	if err == nil || !strings.HasPrefix(err.Error(), "linux.go:1: ") {
+		t.Errorf("expected an error on line 1 of linux.go, got %v", err)
+	}
+}
+
+func TestDefaultBuildTags(t *testing.T) {
+	cases := []struct {
+		goos   string
+		goarch string
+		has    []string
+		hasnt  []string
+	}{
+		{"linux", "amd64", []string{"linux", "amd64", "unix", "go1.1", "go1.18"}, []string{"windows", "darwin"}},
+		{"darwin", "arm64", []string{"darwin", "arm64", "unix"}, []string{"linux"}},
+		{"android", "arm", []string{"android", "linux", "unix"}, nil},
+		{"ios", "arm64", []string{"ios", "darwin", "unix"}, nil},
+		{"windows", "amd64", []string{"windows", "amd64", "go1.1"}, []string{"unix", "linux"}},
+		{"js", "wasm", []string{"js", "wasm"}, []string{"unix"}},
+	}
+
+	for _, c := range cases {
+		tags := make(map[string]bool)
+		for _, tag := range DefaultBuildTags(c.goos, c.goarch) {
+			tags[tag] = true
+		}
+
+		for _, tag := range c.has {
+			if !tags[tag] {
+				t.Errorf("%s/%s should have the '%s' tag", c.goos, c.goarch, tag)
+			}
+		}
+
+		for _, tag := range c.hasnt {
+			if tags[tag] {
+				t.Errorf("%s/%s shouldn't have the '%s' tag", c.goos, c.goarch, tag)
+			}
+		}
+	}
+
+	// there's a tag for the release we're running on, like "go1.22" for
+	// "go1.22.3" or "go1.23rc1".
+	if version := runtime.Version(); strings.HasPrefix(version, "go1.") {
+		end := len("go1.")
+		for end < len(version) && version[end] >= '0' && version[end] <= '9' {
+			end++
+		}
+
+		release := version[:end]
+		found := false
+		for _, tag := range DefaultBuildTags("linux", "amd64") {
+			found = found || tag == release
+		}
+
+		if !found {
+			t.Errorf("the default tags should include %s", release)
+		}
+	}
+}
+
+func TestCompileDefaultBuildTags(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":   &fstest.MapFile{Data: []byte("package main;\nvar a = b;\n")},
+		"unix.go":   &fstest.MapFile{Data: []byte("//go:build unix && go1.1\n\npackage main;\nvar b = 1;\n")},
+		"nounix.go": &fstest.MapFile{Data: []byte("//go:build !unix\n\npackage main;\nvar b = 2;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	c.SetBuildTags(DefaultBuildTags("linux", "amd64")...)
+	result, err := c.CompileAll([]string{"main.go", "unix.go", "nounix.go"})
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	if _, ok := result.ASTs["nounix.go"]; ok {
+		t.Error("nounix.go should have been left out")
+	}
+}
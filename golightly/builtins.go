@@ -0,0 +1,246 @@
+package golightly
+
+import "fmt"
+
+// type builtin is one of Go's predeclared functions.
+type builtin int
+
+const (
+	builtinAppend builtin = iota
+	builtinCap
+	builtinCopy
+	builtinDelete
+	builtinLen
+	builtinMake
+	builtinNew
+	builtinPanic
+	builtinPrint
+	builtinPrintln
+	builtinRecover
+)
+
+// builtinNames are the names the builtins are predeclared as.
+var builtinNames = map[string]builtin{
+	"append":  builtinAppend,
+	"cap":     builtinCap,
+	"copy":    builtinCopy,
+	"delete":  builtinDelete,
+	"len":     builtinLen,
+	"make":    builtinMake,
+	"new":     builtinNew,
+	"panic":   builtinPanic,
+	"print":   builtinPrint,
+	"println": builtinPrintln,
+	"recover": builtinRecover,
+}
+
+// type builtinDecl stands in for the declaration of a builtin in the
+// universe scope, since builtins aren't declared in any source.
+type builtinDecl struct {
+	builtin builtin
+}
+
+func (ast *builtinDecl) IsAST() {
+}
+
+func (ast *builtinDecl) Pos() SrcSpan {
+	return SrcSpan{}
+}
+
+func (ast *builtinDecl) Equals(to AST) bool {
+	too, ok := to.(*builtinDecl)
+	return ok && ast.builtin == too.builtin
+}
+
+// calledBuiltin returns the builtin a call is calling, if it's calling one.
+func (inf *inferrer) calledBuiltin(call *ASTCall) (builtin, bool) {
+	ident, ok := call.function.(*ASTIdentifier)
+	if !ok {
+		return 0, false
+	}
+
+	sym := inf.sf.resolved[ident]
+	if sym == nil {
+		return 0, false
+	}
+
+	decl, ok := sym.decl.(*builtinDecl)
+	if !ok {
+		return 0, false
+	}
+
+	return decl.builtin, true
+}
+
+// inferBuiltin works out the results of a call to a builtin. Builtins have
+// their own special rules for what arguments they take.
+func (inf *inferrer) inferBuiltin(b builtin, call *ASTCall) ([]DataType, error) {
+	name := call.function.(*ASTIdentifier).name
+
+	// make() and new() take a type as their first argument.
+	if b == builtinMake || b == builtinNew {
+		if len(call.args) == 0 {
+			return nil, NewError(inf.sf.fileName, call.pos, fmt.Sprint(name, "() needs a type to make"))
+		}
+
+		dt, err := inf.typeFromAST(call.args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if b == builtinNew {
+			if len(call.args) != 1 {
+				return nil, NewError(inf.sf.fileName, call.pos, "new() just takes a type")
+			}
+
+			return []DataType{inf.ts.MakePointer(dt)}, nil
+		}
+
+		return inf.inferMake(call, dt)
+	}
+
+	var argTypes []DataType
+	for _, arg := range call.args {
+		argType, err := inf.inferExpr(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		argTypes = append(argTypes, argType)
+	}
+
+	switch b {
+	case builtinLen, builtinCap:
+		if len(argTypes) != 1 {
+			return nil, NewError(inf.sf.fileName, call.pos, fmt.Sprint(name, "() takes one argument"))
+		}
+
+		if !hasLength(argTypes[0], b == builtinLen) {
+			return nil, NewError(inf.sf.fileName, call.args[0].Pos(), fmt.Sprint("I can't get the ", name, "() of a ", argTypes[0]))
+		}
+
+		return []DataType{inf.ts.IntType()}, nil
+
+	case builtinAppend:
+		if len(argTypes) == 0 {
+			return nil, NewError(inf.sf.fileName, call.pos, "append() needs a slice to append to")
+		}
+
+		slice, ok := Underlying(argTypes[0]).(*DataTypeUnary)
+		if !ok || slice.kind != DataTypeKindSlice {
+			return nil, NewError(inf.sf.fileName, call.args[0].Pos(), fmt.Sprint("I can only append to slices, not to a ", argTypes[0]))
+		}
+
+		for i, argType := range argTypes[1:] {
+			if !Assignable(argType, slice.subType, inf.ts) {
+				return nil, inf.assignError(call.args, i+1, argType, slice.subType)
+			}
+		}
+
+		return []DataType{argTypes[0]}, nil
+
+	case builtinCopy:
+		if len(argTypes) != 2 {
+			return nil, NewError(inf.sf.fileName, call.pos, "copy() takes a destination and a source")
+		}
+
+		dst, ok := Underlying(argTypes[0]).(*DataTypeUnary)
+		if !ok || dst.kind != DataTypeKindSlice {
+			return nil, NewError(inf.sf.fileName, call.args[0].Pos(), fmt.Sprint("I can only copy to slices, not to a ", argTypes[0]))
+		}
+
+		// copying from a string to a []byte is allowed too.
+		src, ok := Underlying(argTypes[1]).(*DataTypeUnary)
+		stringToBytes := isString(argTypes[1]) && dst.subType == inf.ts.ByteType()
+		if !stringToBytes && (!ok || src.kind != DataTypeKindSlice || src.subType != dst.subType) {
+			return nil, NewError(inf.sf.fileName, call.args[1].Pos(), fmt.Sprint("I can't copy from a ", argTypes[1], " to a ", argTypes[0]))
+		}
+
+		return []DataType{inf.ts.IntType()}, nil
+
+	case builtinDelete:
+		if len(argTypes) != 2 {
+			return nil, NewError(inf.sf.fileName, call.pos, "delete() takes a map and a key")
+		}
+
+		mapType, ok := Underlying(argTypes[0]).(*DataTypeMap)
+		if !ok {
+			return nil, NewError(inf.sf.fileName, call.args[0].Pos(), fmt.Sprint("I can only delete from maps, not from a ", argTypes[0]))
+		}
+
+		if !Assignable(argTypes[1], mapType.keyType, inf.ts) {
+			return nil, inf.assignError(call.args, 1, argTypes[1], mapType.keyType)
+		}
+
+		return nil, nil
+
+	case builtinPanic:
+		if len(argTypes) != 1 {
+			return nil, NewError(inf.sf.fileName, call.pos, "panic() takes one argument")
+		}
+
+		return nil, nil
+
+	case builtinRecover:
+		if len(argTypes) != 0 {
+			return nil, NewError(inf.sf.fileName, call.pos, "recover() doesn't take any arguments")
+		}
+
+		return []DataType{inf.ts.MakeInterface(nil)}, nil
+	}
+
+	// print() and println() take anything.
+	return nil, nil
+}
+
+// inferMake checks the arguments to make() and returns the type made.
+func (inf *inferrer) inferMake(call *ASTCall, dt DataType) ([]DataType, error) {
+	// slices need a length and can have a capacity. maps and channels
+	// can have a size.
+	minArgs, maxArgs := 0, 1
+	switch Underlying(dt).DataTypeKind() {
+	case DataTypeKindSlice:
+		minArgs, maxArgs = 1, 2
+	case DataTypeKindMap, DataTypeKindChan:
+	default:
+		return nil, NewError(inf.sf.fileName, call.args[0].Pos(), fmt.Sprint("I can only make slices, maps and channels, not a ", dt))
+	}
+
+	sizes := call.args[1:]
+	if len(sizes) < minArgs || len(sizes) > maxArgs {
+		return nil, NewError(inf.sf.fileName, call.pos, fmt.Sprint("make() of a ", dt, " needs between ", minArgs, " and ", maxArgs, " sizes"))
+	}
+
+	for _, size := range sizes {
+		sizeType, err := inf.inferExpr(size)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isInteger(sizeType) {
+			return nil, NewError(inf.sf.fileName, size.Pos(), fmt.Sprint("sizes have to be integers, not a ", sizeType))
+		}
+	}
+
+	return []DataType{dt}, nil
+}
+
+// hasLength returns true if len() can be used on a type. cap() works on
+// fewer types than len().
+func hasLength(dt DataType, isLen bool) bool {
+	u := Underlying(dt)
+	if ptr, ok := u.(*DataTypeUnary); ok && ptr.kind == DataTypeKindPointer {
+		// pointers to arrays have a length too.
+		_, ok = Underlying(ptr.subType).(*DataTypeArray)
+		return ok
+	}
+
+	switch u.DataTypeKind() {
+	case DataTypeKindSlice, DataTypeKindArray, DataTypeKindChan:
+		return true
+	case DataTypeKindString, DataTypeKindUntypedString, DataTypeKindMap:
+		return isLen
+	}
+
+	return false
+}
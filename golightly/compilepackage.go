@@ -1,35 +1,198 @@
 package golightly
 
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
 // type compilePackage is a package which is imported or defined by the source code.
 type compilePackage struct {
-	packageName         string                   // the name of this package.
-	symbols             SymbolTable              // the symbols in this package - only valid once symbol creation is complete for all package files.
-	waitingFileComplete map[string]bool          // the files from this package we're still waiting on.
-	fileComplete        chan completionMessage   // files tell us they're complete with a message on this channel.
-	compileSrc          chan compileSrcMessage   // we can request files to be compiled here.
-	addImport           chan importMessage       // we can request imports here.
-	completeChannel     chan completionMessage   // channel to importPackages() to notify when our symbols are complete.
-	shutdown            chan bool                // closed when the compiler is shutting down.
+	packageName         string                 // the name of this package.
+	declaredName        string                 // the name the package's files declare, once they're compiled.
+	fileNames           []string               // the files which make up the package.
+	symbols             *SymbolTable           // the symbols in this package - only valid once symbol creation is complete for all package files.
+	waitingFileComplete map[string]bool        // the files from this package we're still waiting on.
+	fileComplete        chan completionMessage // files tell us they're complete with a message on this channel.
+	compileSrc          chan compileSrcMessage // we can request files to be compiled here.
+	addImport           chan importMessage     // we can request imports here.
+	completeChannel     chan completionMessage // channel to importPackages() to notify when our symbols are complete.
+	shutdown            chan bool              // closed if the compilation which wanted this package is abandoned.
+	closed              chan bool              // closed when the compiler is finished with.
 
-	// the following are used by Compiler.importPackages().
-	status				compileStatus            // where we are in the compilation process.
-	clientCompleteChannels    []chan completionMessage // channels back to clients for importPackages() to notify when our symbols are complete.
-	completeMessage     completionMessage        // importPackages() uses this internally.
+	// the following are only ever touched by the Compiler.importPackages()
+	// goroutine. everyone else finds out about them by message so they
+	// don't need a lock.
+	status          compileStatus     // where we are in the compilation process.
+	clients         []importMessage   // the imports waiting for importPackages() to tell them our symbols are complete.
+	completeMessage completionMessage // importPackages() uses this internally.
 }
 
 // NewCompilePackage creates a new compilePackage.
-func NewCompilePackage(packageName string, compileSrc chan compileSrcMessage, addImport chan importMessage, completeChannel chan completionMessage, shutdown chan bool) *compilePackage {
+func NewCompilePackage(packageName string, universe *SymbolTable, compileSrc chan compileSrcMessage, addImport chan importMessage, completeChannel chan completionMessage, shutdown chan bool, closed chan bool) *compilePackage {
 	sp := new(compilePackage)
 	sp.packageName = packageName
+	sp.symbols = NewSymbolTable(universe)
 	sp.waitingFileComplete = make(map[string]bool)
 	sp.fileComplete = make(chan completionMessage)
 	sp.compileSrc = compileSrc
 	sp.addImport = addImport
-	sp.completeChannel = make(chan completionMessage, completionChannelDepth)
+	sp.completeChannel = completeChannel
 	sp.shutdown = shutdown
-
-	sp.clientCompleteChannels = make([]chan completionMessage, 1)
-	sp.clientCompleteChannels[0] = completeChannel
+	sp.closed = closed
+	sp.status = compileStatusParsing
 
 	return sp
 }
+
+// compile schedules all the files of the package for compilation and
+// waits for them to complete. When they're all done it tells
+// importPackages() via completeChannel.
+func (cp *compilePackage) compile(fileNames []string) {
+	cp.fileNames = fileNames
+	for _, fileName := range fileNames {
+		cp.waitingFileComplete[fileName] = true
+	}
+
+	files := newPackageFiles(cp.symbols, len(fileNames))
+	for _, fileName := range fileNames {
+		select {
+		case cp.compileSrc <- compileSrcMessage{fileName, nil, files, cp.fileComplete, cp.shutdown}:
+		case <-cp.shutdown:
+			cp.complete(errAbandoned)
+			return
+		}
+	}
+
+	// wait for all the files to complete.
+	var err error
+	fileCompletions := make(map[string]completionMessage)
+	for len(cp.waitingFileComplete) > 0 {
+		select {
+		case cm := <-cp.fileComplete:
+			if cm.err != nil && err == nil {
+				err = cm.err
+			}
+
+			fileCompletions[cm.fileName] = cm
+			delete(cp.waitingFileComplete, cm.fileName)
+
+		case <-cp.shutdown:
+			cp.complete(errAbandoned)
+			return
+		}
+	}
+
+	// all the files must agree on the package name.
+	if err == nil {
+		cp.declaredName, err = checkPackageNames(fileNames, fileCompletions)
+	}
+
+	cp.complete(err)
+}
+
+// complete tells importPackages() that the package is done with. it's
+// told even if the package was abandoned so someone else can start it
+// again.
+func (cp *compilePackage) complete(err error) {
+	select {
+	case cp.completeChannel <- completionMessage{cp.packageName, cp.declaredName, "", SrcSpan{}, cp.symbols, err, cp.fileNames}:
+	case <-cp.closed:
+	}
+}
+
+// checkPackageNames makes sure that all the files in a package declare
+// the same package name. The first file's package name is the one the
+// others have to match, and it's returned. Test packages are ignored.
+func checkPackageNames(fileNames []string, fileCompletions map[string]completionMessage) (string, error) {
+	var first completionMessage
+	for _, fileName := range fileNames {
+		cm := fileCompletions[fileName]
+		if strings.HasSuffix(cm.packageName, "_test") || cm.packageName == "" {
+			// files left out by their build constraints don't have a
+			// package name.
+			continue
+		}
+
+		if first.fileName == "" {
+			first = cm
+		} else if cm.packageName != first.packageName {
+			return "", NewError(cm.fileName, cm.packagePos, fmt.Sprint("this file is in package '", cm.packageName, "' but ", first.fileName, " is in package '", first.packageName, "'. they should be the same"))
+		}
+	}
+
+	return first.packageName, nil
+}
+
+// type packageFiles is shared by the files of a package while they're
+// compiled. A file can use names declared in any other file of the
+// package, so none of them can resolve anything until they've all
+// declared their symbols, and none of them can work out the types of
+// expressions until they've all worked out their type declarations and
+// methods and know what their identifiers refer to.
+type packageFiles struct {
+	symbols    *SymbolTable            // the symbols in the package.
+	declFile   map[*Symbol]*sourceFile // which file each package symbol was declared in.
+	declared   *barrier                // passed once every file has declared its symbols.
+	typed      *barrier                // passed once every file has resolved its types.
+	identified *barrier                // passed once every file has resolved its identifiers.
+	mutex      sync.Mutex              // held while a file does anything which can change another file's symbols.
+}
+
+// newPackageFiles creates the shared state for a package with a number
+// of files.
+func newPackageFiles(symbols *SymbolTable, files int) *packageFiles {
+	pf := new(packageFiles)
+	pf.symbols = symbols
+	pf.declFile = make(map[*Symbol]*sourceFile)
+	pf.declared = newBarrier(files)
+	pf.typed = newBarrier(files)
+	pf.identified = newBarrier(files)
+
+	return pf
+}
+
+// type barrier holds the files of a package back until they've all got
+// to the same point. Every file has to arrive exactly once, even if it
+// fails before it gets there.
+type barrier struct {
+	mutex   sync.Mutex
+	waiting int       // how many files haven't got here yet.
+	done    chan bool // closed once they all have.
+}
+
+// newBarrier creates a barrier which waits for a number of files.
+func newBarrier(files int) *barrier {
+	b := new(barrier)
+	b.waiting = files
+	b.done = make(chan bool)
+	if files == 0 {
+		close(b.done)
+	}
+
+	return b
+}
+
+// arrive says that one more file has got to the barrier.
+func (b *barrier) arrive() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.waiting--
+	if b.waiting == 0 {
+		close(b.done)
+	}
+}
+
+// wait waits until all the files have got to the barrier. Files which
+// were never started don't arrive, so it gives up if the compiler shuts
+// down.
+func (b *barrier) wait(shutdown chan bool) error {
+	select {
+	case <-b.done:
+		return nil
+
+	case <-shutdown:
+		return errAbandoned
+	}
+}
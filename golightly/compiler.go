@@ -1,10 +1,16 @@
 package golightly
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
-	"os"
+	"io"
+	"io/fs"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -13,8 +19,12 @@ const (
 	completionChannelDepth = 4
 )
 
+// errAbandoned is given to files which stop because some other file failed.
+var errAbandoned = errors.New("compilation was abandoned")
+
 // type compileStatus
 type compileStatus int
+
 const (
 	compileStatusParsing = iota
 	compileStatusSymbolsAvailable
@@ -25,15 +35,15 @@ const (
 // all passes of all files.
 //
 // The compiler class has two main tasks:
-//   * compiling files
-//   * importing packages
+//   - compiling files
+//   - importing packages
 //
 // It tries to do this while allowing for a reasonable amount of concurrent
 // compilation. All Go files are scheduled for lexing and parsing
 // concurrently. On a multi-core machine this may result in parallel
 // compilation.
 //
-// LEXING AND PARSING
+// # LEXING AND PARSING
 //
 // The lexer is called directly from the parser so lexing and parsing
 // occur as a single pass. This pass takes source code as input and
@@ -64,7 +74,7 @@ const (
 // finished parsing the compiler can proceed to the next pass -
 // semantic analysis.
 //
-// SEMANTIC ANALYSIS
+// # SEMANTIC ANALYSIS
 //
 // Semantic analysis is a multi-pass process which checks a lot of
 // semantics of the program and transforms the AST into a somewhat
@@ -78,10 +88,10 @@ const (
 // which are unused are processed.
 //
 // Each time a new symbol is analysed it's checked for two things:
-//    - whether the file it's in has changed since the previous
-//      compilation, and
-//    - whether the AST for this symbol is identical to the previous
-//      compilation.
+//   - whether the file it's in has changed since the previous
+//     compilation, and
+//   - whether the AST for this symbol is identical to the previous
+//     compilation.
 //
 // The AST checksum from the previous compilation is stored in a
 // database for comparison purposes. Unless the symbol is changed due
@@ -89,38 +99,44 @@ const (
 // will be omitted and the symbol will retrieve its target executable
 // code from the database and go straight to linking.
 //
-// AST OPTIMISATION
+// # AST OPTIMISATION
 //
 // AST optimisation performs a series of optimisations on the AST,
 // looking for patterns which can be transformed into more efficient
 // forms.
 //
-// IR PROCESSING
+// # IR PROCESSING
 //
 // IR processing transforms the AST into a DAG intermediate
 // representation and then performs a series of optimisations on
 // the IR.
 //
-// CODE GENERATION
+// # CODE GENERATION
 //
 // Code generation transforms the IR into target executable code
 // plus debug and link information.
 //
-// LINKING
+// # LINKING
 //
 // The linker is an incremental design. It keeps track of the code
 // in the final executable using a separate database file. When a
 // symbol/function is modified it's replaced in the executable
 // without having to rewrite the whole file. Only the modified
 // portion is rewritten along with linkages to it.
-//
 type Compiler struct {
-	srcFiles map[string]*sourceFile    // the files we're compiling.
-	packages map[string]*compilePackage // the packages we're importing or defining.
+	srcFiles      map[string]*sourceFile     // the files we're compiling.
+	srcFilesMutex sync.Mutex                 // protects srcFiles, which is added to by compileSrcs().
+	packages      map[string]*compilePackage // the packages we're importing or defining. only used by importPackages().
+
+	shutdown chan bool // closed by Close() when the compiler is finished with.
 
-	shutdown chan bool // closed when the compiler is shutting down.
+	fileSystem    fs.FS           // where source files are read from.
+	importRoots   []string        // the directories which are searched for imported packages.
+	importTimeout time.Duration   // how long a file waits on its imports without any progress before giving up. zero waits forever.
+	buildTags     map[string]bool // the tags which "//go:build" lines are checked against.
 
 	dataTypeStore *DataTypeStore // keeps a global set of data types known to the compiler.
+	universe      *SymbolTable   // the predeclared symbols which every package can see.
 
 	addImport  chan importMessage     // new packages are queued for import using this stream.
 	compileSrc chan compileSrcMessage // new files are queued for compilation using this stream.
@@ -132,25 +148,44 @@ type importMessage struct {
 	fromFileName    string                 // what source file it was requested from.
 	pos             SrcSpan                // where in the source file it was requested from.
 	completeChannel chan completionMessage // how to notify when it's done.
+	shutdown        chan bool              // closed if the compilation which wants it is abandoned.
 }
 
 // type compileSrcMessage is sent to Compiler.compileSrc to request that a file be compiled.
 type compileSrcMessage struct {
-	fileName        string
-	completeChannel chan completionMessage
+	fileName        string                 // the name of the file to compile.
+	reader          io.Reader              // the source to compile or nil to read it from fileName.
+	pkg             *packageFiles          // what the file shares with the rest of its package.
+	completeChannel chan completionMessage // how to notify when it's done.
+	shutdown        chan bool              // closed if the compilation is abandoned.
 }
 
 // type completionMessage is sent to notify a caller of completion of
 // compilation, with a possible error.
 type completionMessage struct {
-	packageName string // what package we were working on.
-	fileName    string // what file we were working on.
-	err         error  // error from compilation or nil on success.
+	packageName  string       // what package we were working on.
+	declaredName string       // the name a package's files declare it as.
+	fileName     string       // what file we were working on.
+	packagePos   SrcSpan      // where a file declared its package name.
+	symbols      *SymbolTable // the symbols of the package.
+	err          error        // error from compilation or nil on success.
+	files        []string     // the files which make up a package.
 }
 
-// NewCompiler creates a new compiler object.
+// NewCompiler creates a new compiler object which reads source files
+// from the operating system's file system.
 func NewCompiler() *Compiler {
+	return NewCompilerFS(osFileSystem{})
+}
+
+// NewCompilerFS creates a new compiler object which reads source files
+// from the given file system. This lets a build run against embedded
+// files, test fixtures or overlays.
+func NewCompilerFS(fileSystem fs.FS) *Compiler {
 	c := new(Compiler)
+	c.fileSystem = fileSystem
+	c.importRoots = []string{"."}
+	c.SetBuildTags(DefaultBuildTags(runtime.GOOS, runtime.GOARCH)...)
 
 	c.srcFiles = make(map[string]*sourceFile)
 	c.packages = make(map[string]*compilePackage)
@@ -158,11 +193,12 @@ func NewCompiler() *Compiler {
 	c.shutdown = make(chan bool)
 
 	c.dataTypeStore = NewDataTypeStore()
+	c.universe = NewUniverse(c.dataTypeStore)
 	c.addImport = make(chan importMessage, addImportChannelDepth)
 	c.compileSrc = make(chan compileSrcMessage, compileSrcChannelDepth)
 
 	// accept source files for compilation
-	go c.parseSrcs()
+	go c.compileSrcs()
 
 	// accept packages to import
 	go c.importPackages()
@@ -170,104 +206,495 @@ func NewCompiler() *Compiler {
 	return c
 }
 
+// Close stops the compiler's goroutines. The compiler can't be used
+// afterwards.
 func (c *Compiler) Close() {
+	close(c.shutdown)
 }
 
 // Compile is the central point to compile a program from. It takes
 // all the files as arguments and produces a runnable program as
 // output. All passes of the compiler are run.
 func (c *Compiler) Compile(srcFiles []string) error {
+	result, _ := c.CompileAll(srcFiles)
+	return result.Errors.first()
+}
+
+// type CompileResult is everything CompileAll() found out, for tools
+// which want more than a yes or no.
+type CompileResult struct {
+	Files       []string            // the files this call compiled, including the imported ones, sorted by name.
+	ASTs        map[string]AST      // the AST of each file which could be parsed, by file name.
+	Packages    map[string][]string // the files in each package, by package name.
+	Errors      ErrorList           // all the errors, not just the first one.
+	Warnings    []error             // problems which didn't stop compilation.
+	Diagnostics ErrorList           // the errors and then the warnings, all together.
+}
+
+// CompileAll compiles like Compile() but gives back everything it found
+// out along the way. Imported packages are only included if compilation
+// worked - otherwise some of them might never have finished. The error
+// is the same as result.Errors or nil if there weren't any.
+func (c *Compiler) CompileAll(srcFiles []string) (*CompileResult, error) {
 	// create a channel for source files to notify us when their symbols are ready.
 	completeChannel := make(chan completionMessage, completionChannelDepth)
 
-	// queue the source files for compilation.
-	// these are picked up by parseSrcs() and compiled.
+	// everything this compilation started gives up if this is closed.
+	shutdown := make(chan bool)
+
+	// we're only compiling each file once.
 	waitingOn := make(map[string]bool)
+	requested := make(map[string]bool)
+	var fileNames []string
 	for _, fileName := range srcFiles {
-		// are we already compiling it?
-		_, found := waitingOn[fileName]
-		if !found {
-			// need to compile it.
-			waitingOn[fileName] = true
-			c.compileSrc <- compileSrcMessage{fileName, completeChannel}
+		if !requested[fileName] {
+			fileNames = append(fileNames, fileName)
 		}
+
+		waitingOn[fileName] = true
+		requested[fileName] = true
 	}
 
-	// wait for symbols ready or error.
-	var err error
-	for {
+	// the files are all in the same package so they share symbols.
+	files := newPackageFiles(NewSymbolTable(c.universe), len(requested))
+
+	// queue the source files for compilation.
+	// these are picked up by compileSrcs() and compiled.
+	for _, fileName := range fileNames {
+		c.compileSrc <- compileSrcMessage{fileName, nil, files, completeChannel, shutdown}
+	}
+
+	result := new(CompileResult)
+	var fileCompletions map[string]completionMessage
+	result.Errors, fileCompletions = c.waitCompletion(waitingOn, completeChannel, shutdown)
+
+	// the files in each directory must agree on the package name, just
+	// like an imported package's files.
+	if len(result.Errors) == 0 {
+		var dirs []string
+		dirFiles := make(map[string][]string)
+		for _, fileName := range fileNames {
+			dir := path.Dir(fileName)
+			if dirFiles[dir] == nil {
+				dirs = append(dirs, dir)
+			}
+
+			dirFiles[dir] = append(dirFiles[dir], fileName)
+		}
+
+		for _, dir := range dirs {
+			if _, err := checkPackageNames(dirFiles[dir], fileCompletions); err != nil {
+				result.Errors = append(result.Errors, err)
+			}
+		}
+	}
+
+	result.ASTs = make(map[string]AST)
+	result.Packages = make(map[string][]string)
+
+	compiled := fileNames
+	if len(result.Errors) == 0 {
+		compiled = c.importedFiles(fileNames)
+	}
+
+	// files which were abandoned before they started aren't included.
+	for _, fileName := range compiled {
+		if c.sourceFile(fileName) != nil {
+			result.Files = append(result.Files, fileName)
+		}
+	}
+
+	sort.Strings(result.Files)
+	for _, fileName := range result.Files {
+		sf := c.sourceFile(fileName)
+		if sf.ast != nil {
+			result.ASTs[fileName] = sf.ast
+		}
+
+		if sf.packageName != "" {
+			result.Packages[sf.packageName] = append(result.Packages[sf.packageName], fileName)
+		}
+
+		result.Warnings = append(result.Warnings, sf.warnings...)
+	}
+
+	result.Diagnostics = append(append(ErrorList{}, result.Errors...), result.Warnings...)
+
+	if len(result.Errors) > 0 {
+		return result, result.Errors
+	}
+
+	return result, nil
+}
+
+// importedFiles gets the files we were asked to compile along with the
+// files of all the packages they import, directly or not.
+func (c *Compiler) importedFiles(fileNames []string) []string {
+	found := make(map[string]bool)
+	var files []string
+	for len(fileNames) > 0 {
+		fileName := fileNames[0]
+		fileNames = fileNames[1:]
+		if found[fileName] {
+			continue
+		}
+
+		found[fileName] = true
+		files = append(files, fileName)
+
+		sf := c.sourceFile(fileName)
+		if sf == nil {
+			continue
+		}
+
+		for _, packageFiles := range sf.importedFiles {
+			fileNames = append(fileNames, packageFiles...)
+		}
+	}
+
+	return files
+}
+
+// CompileSource compiles a single source file which is read from an
+// io.Reader rather than the file system. This is handy for editors and
+// tests which have the source in memory. The fileName is only used
+// to identify the file in error messages.
+func (c *Compiler) CompileSource(fileName string, r io.Reader) error {
+	completeChannel := make(chan completionMessage, completionChannelDepth)
+	shutdown := make(chan bool)
+	c.compileSrc <- compileSrcMessage{fileName, r, newPackageFiles(NewSymbolTable(c.universe), 1), completeChannel, shutdown}
+
+	errs, _ := c.waitCompletion(map[string]bool{fileName: true}, completeChannel, shutdown)
+	return errs.first()
+}
+
+// Warnings returns the problems found while compiling which weren't bad
+// enough to stop compilation, sorted by file name.
+func (c *Compiler) Warnings() []error {
+	c.srcFilesMutex.Lock()
+	defer c.srcFilesMutex.Unlock()
+
+	var fileNames []string
+	for fileName := range c.srcFiles {
+		fileNames = append(fileNames, fileName)
+	}
+
+	sort.Strings(fileNames)
+
+	var warnings []error
+	for _, fileName := range fileNames {
+		warnings = append(warnings, c.srcFiles[fileName].warnings...)
+	}
+
+	return warnings
+}
+
+// sourceFile gets one of the files being compiled, or nil if it's not
+// known. It's safe to call while compilation is going on.
+func (c *Compiler) sourceFile(fileName string) *sourceFile {
+	c.srcFilesMutex.Lock()
+	defer c.srcFilesMutex.Unlock()
+
+	return c.srcFiles[fileName]
+}
+
+// waitCompletion waits until all of the files we're waiting on have
+// reported that they're complete or have failed. It returns the
+// errors in the order they were reported. After the first error the
+// rest of the compilation is abandoned by closing its shutdown channel.
+// Files which were abandoned because of an earlier error aren't counted,
+// but if files were abandoned with no error to explain it that's an
+// error in itself. The completion message from each file is returned
+// too.
+func (c *Compiler) waitCompletion(waitingOn map[string]bool, completeChannel chan completionMessage, shutdown chan bool) (ErrorList, map[string]completionMessage) {
+	var errs ErrorList
+	var abandoned []string
+	completions := make(map[string]completionMessage)
+	for len(waitingOn) > 0 {
 		// get a message from a compilation.
 		msg := <-completeChannel
+		completions[msg.fileName] = msg
 
 		// either got "symbols ready" from a file or an error.
-		if msg.err != nil {
-			err = msg.err
-			close(c.shutdown) // tell it to shutdown.
+		if msg.err == errAbandoned {
+			abandoned = append(abandoned, msg.fileName)
+		} else if msg.err != nil {
+			if len(errs) == 0 {
+				close(shutdown) // tell it to shutdown.
+			}
+
+			errs = append(errs, msg.err)
 		}
 
 		delete(waitingOn, msg.fileName)
-		if len(waitingOn) == 0 {
-			// we've finished all of them.
-			break
+	}
+
+	if len(errs) == 0 {
+		for _, fileName := range abandoned {
+			errs = append(errs, errors.New(fmt.Sprint("the compilation of ", fileName, " was abandoned")))
 		}
 	}
 
-	return err
+	return errs, completions
 }
 
-// parseFileAndComplete parses a single file, called from schedulePass. To compile a file
-// you should send it to the Compiler.compileSrc channel for parseSrcs() to
-// compile. After the file is parsed a completion message is sent to the client.
-func (c *Compiler) parseFileAndComplete(sf *sourceFile) {
-	err := c.parseFile(sf)
-	if err != nil {
-		sf.completeChannel <- completionMessage{sf.packageName, sf.fileName, )}
-		return
+// compileFileAndComplete compiles a single file, called from compileSrcs(). To
+// compile a file you should send it to the Compiler.compileSrc channel for
+// compileSrcs() to compile. After the file is compiled a completion message
+// is sent to the client.
+func (c *Compiler) compileFileAndComplete(sf *sourceFile, r io.Reader) {
+	// if the file didn't get as far as the barriers the other files in
+	// the package mustn't be left waiting for it.
+	defer sf.arriveIdentified()
+	defer sf.arriveTyped()
+	defer sf.arriveDeclared()
+
+	var err error
+	if r != nil {
+		err = c.compileReader(sf, r)
+	} else {
+		err = c.compileFile(sf)
 	}
-}
 
+	sf.completeChannel <- completionMessage{sf.packageName, "", sf.fileName, sf.packagePos, sf.symbols, err, nil}
+}
 
-// compileFile parses a single file, called from schedulePass. To compile a file
-// you should send it to the Compiler.compileSrc channel for parseSrcs() to
-// compile.
+// compileFile opens a single file and compiles it.
 func (c *Compiler) compileFile(sf *sourceFile) error {
 	// open the source file
-	srcFile, err := os.Open(sf.fileName)
+	srcFile, err := c.fileSystem.Open(sf.fileName)
 	if err != nil {
-		return errors.New(fmt.Sprintf("I can't find ", sf.fileName, ": ", err)
+		return errors.New(fmt.Sprint("I can't find ", sf.fileName, ": ", err))
 	}
 
 	defer srcFile.Close()
-	srcReader := bufio.NewReader(srcFile)
 
+	return c.compileReader(sf, srcFile)
+}
+
+// compileReader compiles a single file's source from a reader.
+func (c *Compiler) compileReader(sf *sourceFile, r io.Reader) (err error) {
 	// lex and parse it.
 	lex := NewLexer()
-	lex.LexReader(srcReader, sf.fileName)
+
+	// a bug in the compiler shouldn't take every other file down with it.
+	// the lexer knows roughly where we'd got to.
+	defer func() {
+		if problem := recover(); problem != nil {
+			err = NewError(sf.fileName, lex.pos, fmt.Sprint("the compiler crashed here (", problem, "). sorry - that's a bug in the compiler"))
+		}
+	}()
+
+	lex.LexReader(r, sf.fileName)
+
+	// files can be left out by a "//go:build" line. we find out about it
+	// when we look at the first token.
+	lex.PeekToken(0)
+	if expr, pos, ok := lex.BuildConstraint(); ok {
+		sf.buildConstraint, err = ParseBuildConstraint(sf.fileName, pos, expr)
+		if err != nil {
+			return err
+		}
+
+		if !sf.buildConstraint.Eval(c.buildTags) {
+			sf.excluded = true
+			return nil
+		}
+	}
+
 	parser := NewParser(lex, c.dataTypeStore, sf)
 	err = parser.Parse()
 	if err != nil {
 		return err
 	}
 
+	// struct tags which look wrong are just warnings.
+	sf.warnings = append(sf.warnings, checkStructTags(sf.fileName, sf.ast.(*ASTTopLevel))...)
+
 	// create symbols.
 	err = c.createSymbols(sf)
 	if err != nil {
 		return err
 	}
 
+	sf.arriveDeclared()
+
 	// wait for imports to complete.
 	err = c.waitImports(sf)
 	if err != nil {
 		return err
 	}
 
+	// now we know what the imported packages are called we can check
+	// the imports are all used.
+	err = checkUnusedImports(sf.fileName, sf.ast.(*ASTTopLevel))
+	if err != nil {
+		return err
+	}
+
+	// and for the rest of the package to declare its symbols.
+	err = sf.pkg.declared.wait(sf.shutdown)
+	if err != nil {
+		return err
+	}
+
+	// now the imports are available we can work out the types. aliases
+	// can be worked out by any file which uses them so the files of a
+	// package take turns.
+	sf.pkg.mutex.Lock()
+	err = resolveTypes(sf, c.dataTypeStore)
+	sf.pkg.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	sf.arriveTyped()
+
+	// functions and methods can be in any file of the package so they all
+	// have to be done before we can use them.
+	err = sf.pkg.typed.wait(sf.shutdown)
+	if err != nil {
+		return err
+	}
+
+	// and what each identifier refers to.
+	err = resolveIdentifiers(sf, c.dataTypeStore)
+	if err != nil {
+		return err
+	}
+
+	sf.arriveIdentified()
+
+	// a package var can get its type from a var in another file, which
+	// means looking at that file's identifiers.
+	err = sf.pkg.identified.wait(sf.shutdown)
+	if err != nil {
+		return err
+	}
+
+	// then the type of every expression. working out a type can mean
+	// working out the type of a symbol in another file so the files of
+	// a package take turns here too.
+	sf.pkg.mutex.Lock()
+	err = inferTypes(sf, c.dataTypeStore)
+	sf.pkg.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
 	// say we're done.
 	return nil
 }
 
+// waitImports waits for all the packages imported by a source file to
+// have their symbols available.
+func (c *Compiler) waitImports(sf *sourceFile) error {
+	for len(sf.waitingPackageComplete) > 0 {
+		// the watchdog starts again every time a package arrives.
+		var timeout <-chan time.Time
+		if c.importTimeout > 0 {
+			timeout = time.After(c.importTimeout)
+		}
+
+		select {
+		case cm := <-sf.packageComplete:
+			if cm.err != nil {
+				return cm.err
+			}
+
+			delete(sf.waitingPackageComplete, cm.packageName)
+			sf.importedSymbols[cm.packageName] = cm.symbols
+			sf.setImportName(cm.packageName, cm.declaredName)
+			sf.importedFiles[cm.packageName] = cm.files
+
+		case <-sf.shutdown:
+			return errAbandoned
+
+		case <-timeout:
+			return c.importTimeoutError(sf)
+		}
+	}
+
+	return nil
+}
+
+// importTimeoutError explains which packages a file got stuck waiting
+// for. it's positioned at the import of the first of them.
+func (c *Compiler) importTimeoutError(sf *sourceFile) error {
+	var waiting []string
+	for importPath := range sf.waitingPackageComplete {
+		waiting = append(waiting, importPath)
+	}
+
+	sort.Strings(waiting)
+
+	var pos SrcSpan
+	for _, imp := range sf.ast.(*ASTTopLevel).imports {
+		if imp.(*ASTImport).ImportPath() == waiting[0] {
+			pos = imp.Pos()
+			break
+		}
+	}
+
+	return NewError(sf.fileName, pos, fmt.Sprint("I waited ", c.importTimeout, " for \"", strings.Join(waiting, "\", \""), "\" without getting anywhere. maybe there's an import cycle?"))
+}
+
 // createSymbols creates a set of symbols from an already parsed source file.
 // when we're finished we tell our parent package that we're done.
+//
+// only the names are declared here. types can refer to imported packages
+// so they're filled in by resolveTypes() once the imports are complete.
 func (c *Compiler) createSymbols(sf *sourceFile) error {
+	top := sf.ast.(*ASTTopLevel)
+	for _, decl := range top.topLevelDecls {
+		var ident *ASTIdentifier
+		var kind SymbolKind
+		var dataType DataType
+		switch d := decl.(type) {
+		case *ASTConstDecl:
+			ident = d.ident.(*ASTIdentifier)
+			kind = SymbolKindConst
+
+		case *ASTVarDecl:
+			ident = d.ident.(*ASTIdentifier)
+			kind = SymbolKindVar
+
+		case *ASTDataTypeDecl:
+			// aliases get their type once the type they refer to is known.
+			ident = d.ident.(*ASTIdentifier)
+			kind = SymbolKindType
+			if !d.alias {
+				dataType = c.dataTypeStore.MakeNamed(sf.packageName, ident.name, nil)
+			}
+
+		case *ASTFunctionDecl:
+			if d.receiver != nil || d.name == "init" {
+				// methods belong to their type rather than the package, and
+				// there can be any number of init functions.
+				continue
+			}
+
+			ident = &ASTIdentifier{d.pos, "", d.name}
+			kind = SymbolKindFunc
+
+		default:
+			continue
+		}
+
+		if ident.name == "_" {
+			continue
+		}
+
+		sym := &Symbol{ident.name, kind, decl, dataType}
+		if !sf.symbols.Add(sym) {
+			return NewError(sf.fileName, ident.pos, fmt.Sprint("'", ident.name, "' has already been declared"))
+		}
+
+		sf.pkg.mutex.Lock()
+		sf.pkg.declFile[sym] = sf
+		sf.pkg.mutex.Unlock()
+	}
+
 	return nil
 }
 
@@ -276,16 +703,27 @@ func (c *Compiler) createSymbols(sf *sourceFile) error {
 func (c *Compiler) compileSrcs() {
 	for {
 		// wait for something to happen.
-		var running bool
+		running := true
 
 		select {
 		case csm := <-c.compileSrc:
+			// there's no point starting a file whose compilation has
+			// already been abandoned.
+			if isClosed(csm.shutdown) {
+				c.abandonSrc(csm)
+				break
+			}
+
 			// add to srcFiles.
-			sf := NewSourceFile(csm.fileName, c.compileSrc, c.addImport, csm.completeChannel, c.shutdown)
+			sf := NewSourceFile(csm.fileName, c.compileSrc, c.addImport, csm.completeChannel, csm.shutdown)
+			sf.symbols = csm.pkg.symbols
+			sf.pkg = csm.pkg
+			c.srcFilesMutex.Lock()
 			c.srcFiles[csm.fileName] = sf
+			c.srcFilesMutex.Unlock()
 
 			// start parsing the file
-			go c.compileFileAndComplete(sf)
+			go c.compileFileAndComplete(sf, csm.reader)
 
 		case _, running = <-c.shutdown:
 			// running is false if we're shutting down.
@@ -296,6 +734,36 @@ func (c *Compiler) compileSrcs() {
 			break
 		}
 	}
+
+	// anyone still waiting on a file which never got started needs to
+	// hear that it's not going to happen.
+	for {
+		select {
+		case csm := <-c.compileSrc:
+			c.abandonSrc(csm)
+
+		default:
+			return
+		}
+	}
+}
+
+// abandonSrc tells whoever asked for a file to be compiled that it's not
+// going to happen.
+func (c *Compiler) abandonSrc(csm compileSrcMessage) {
+	go func() {
+		csm.completeChannel <- completionMessage{"", "", csm.fileName, SrcSpan{}, nil, errAbandoned, nil}
+	}()
+}
+
+// isClosed returns true if a shutdown channel has been closed.
+func isClosed(shutdown chan bool) bool {
+	select {
+	case <-shutdown:
+		return true
+	default:
+		return false
+	}
 }
 
 // importPackages runs as a goroutine, accepting packages to import and
@@ -305,39 +773,52 @@ func (c *Compiler) importPackages() {
 
 	for {
 		// wait for something to happen.
-		var running bool
+		running := true
 
 		select {
 		case im := <-c.addImport:
 			// a new package to import. do we already know about it?
 			cp, ok := c.packages[im.packageName]
 			if ok {
-				// we're already importing this package.
-				if cp.status == compileStatusParsing {
-					// add to the list of clients to be informed when it's done.
-					cp.clientCompleteChannels = append(cp.clientCompleteChannels, im.completeChannel)
+				// we're already importing this package. completeMessage is
+				// only valid once the symbols are available, so until then
+				// the client has to queue up with everyone else.
+				if cp.status == compileStatusSymbolsAvailable {
+					// let the client know immediately that we're done.
+					c.sendCompletion(im, importCompletion(im, cp.completeMessage))
 				} else {
-					// let the client know immediate that we're done.
-					im.completeChannel <- cp.completeMessage
+					// add to the list of clients to be informed when it's done.
+					cp.clients = append(cp.clients, im)
 				}
 			} else {
-				// add to packages.
-				cp = NewCompilePackage(im.packageName, c.compileSrc, c.addImport, importComplete, c.shutdown)
-				c.packages[im.packageName] = cp
+				// find the files which make up the package.
+				fileNames, err := c.findPackageFiles(im)
+				if err != nil {
+					c.sendCompletion(im, completionMessage{im.packageName, "", "", SrcSpan{}, nil, err, nil})
+					break
+				}
+
+				// add to packages and start compiling it.
+				c.startPackage(im, fileNames, importComplete)
 			}
 
 		case cm := <-importComplete:
 			// we got a completion message from a package.
 			cp, ok := c.packages[cm.packageName]
-			if ok {
+			if ok && cm.err == errAbandoned {
+				// the compilation which asked for it gave up. anyone
+				// else who wants it has to start it again.
+				delete(c.packages, cm.packageName)
+				c.restartPackage(cp.clients, importComplete)
+			} else if ok {
 				// keep the completion message in case we need it for a later import.
 				cp.completeMessage = cm
 
 				// tell everyone who wants to know.
-				for _, client := range cp.clientCompleteChannels {
-					client <- cm
+				for _, client := range cp.clients {
+					c.sendCompletion(client, importCompletion(client, cm))
 				}
-				cp.clientCompleteChannels = nil
+				cp.clients = nil
 				cp.status = compileStatusSymbolsAvailable
 			}
 
@@ -351,3 +832,116 @@ func (c *Compiler) importPackages() {
 		}
 	}
 }
+
+// startPackage starts compiling a package for an import. It's compiled
+// as part of the compilation which asked for it, so it's abandoned if
+// that is.
+func (c *Compiler) startPackage(im importMessage, fileNames []string, importComplete chan completionMessage) {
+	cp := NewCompilePackage(im.packageName, c.universe, c.compileSrc, c.addImport, importComplete, im.shutdown, c.shutdown)
+	cp.clients = append(cp.clients, im)
+	c.packages[im.packageName] = cp
+	go cp.compile(fileNames)
+}
+
+// restartPackage starts an abandoned package again for the clients which
+// are still waiting for it.
+func (c *Compiler) restartPackage(clients []importMessage, importComplete chan completionMessage) {
+	var cp *compilePackage
+	for _, client := range clients {
+		switch {
+		case isClosed(client.shutdown):
+			// it's given up too.
+
+		case cp == nil:
+			fileNames, err := c.findPackageFiles(client)
+			if err != nil {
+				c.sendCompletion(client, completionMessage{client.packageName, "", "", SrcSpan{}, nil, err, nil})
+				continue
+			}
+
+			c.startPackage(client, fileNames, importComplete)
+			cp = c.packages[client.packageName]
+
+		default:
+			cp.clients = append(cp.clients, client)
+		}
+	}
+}
+
+// importCompletion gets a package's completion message ready to send to
+// a file which imported it. if the package failed the error says which
+// import it was so the file's error makes sense.
+func importCompletion(im importMessage, cm completionMessage) completionMessage {
+	if cm.err != nil {
+		cm.err = NewError(im.fromFileName, im.pos, fmt.Sprint("I can't import \"", im.packageName, "\": ", cm.err))
+	}
+
+	return cm
+}
+
+// sendCompletion sends a completion message to a client without blocking
+// importPackages(). The client may still be busy parsing and sending us
+// more imports so we can't wait for it to receive the message.
+func (c *Compiler) sendCompletion(client importMessage, cm completionMessage) {
+	go func() {
+		select {
+		case client.completeChannel <- cm:
+		case <-client.shutdown:
+		case <-c.shutdown:
+		}
+	}()
+}
+
+// SetImportRoots sets the directories which are searched for imported
+// packages. An import path is looked up relative to each of these in
+// turn. By default only the current directory is searched.
+func (c *Compiler) SetImportRoots(roots ...string) {
+	c.importRoots = roots
+}
+
+// SetBuildTags sets the tags which "//go:build" lines at the top of files
+// are checked against. Files whose constraints aren't satisfied are left
+// out. By default they're the DefaultBuildTags() of the operating system
+// and architecture we're running on.
+func (c *Compiler) SetBuildTags(tags ...string) {
+	c.buildTags = make(map[string]bool)
+	for _, tag := range tags {
+		c.buildTags[tag] = true
+	}
+}
+
+// SetImportTimeout makes files give up waiting for their imports if no
+// package arrives within the timeout, rather than hanging forever. The
+// error says which packages they were waiting for. By default there's
+// no timeout.
+func (c *Compiler) SetImportTimeout(timeout time.Duration) {
+	c.importTimeout = timeout
+}
+
+// findPackageFiles resolves an import path to the set of source files
+// which make up the package. The first import root which has a
+// directory matching the import path containing Go source files is used.
+func (c *Compiler) findPackageFiles(im importMessage) ([]string, error) {
+	for _, root := range c.importRoots {
+		dir := path.Join(root, im.packageName)
+		entries, err := fs.ReadDir(c.fileSystem, dir)
+		if err != nil {
+			continue
+		}
+
+		// get all the non-test go source files.
+		var fileNames []string
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+				fileNames = append(fileNames, path.Join(dir, name))
+			}
+		}
+
+		if len(fileNames) > 0 {
+			return fileNames, nil
+		}
+	}
+
+	return nil, NewError(im.fromFileName, im.pos, fmt.Sprint("I can't find the package \"", im.packageName, "\" to import it"))
+}
@@ -0,0 +1,605 @@
+package golightly
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCompileSource(t *testing.T) {
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader("package main;\n"))
+	if err != nil {
+		t.Error("error compiling: ", err)
+	}
+}
+
+func TestCompileSourceError(t *testing.T) {
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader("packag main;\n"))
+	if err == nil {
+		t.Error("expected an error compiling")
+		return
+	}
+
+	_, ok := err.(*Error)
+	if !ok {
+		t.Errorf("expected an *Error, got %T", err)
+		return
+	}
+
+	if !strings.HasPrefix(err.Error(), "test.go:1: ") {
+		t.Error("wrong error: ", err)
+	}
+}
+
+func TestCompileLineDirectiveErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		err string
+	}{
+		{"package main;\n//line gen.y:10\nvar a int = \"x\";\n", "gen.y:10: I can't use a untyped string as a int here"},
+		{"package main;\n//line gen.y:10\nvar a = ;\n", "gen.y:10: "},
+		{"package main;\nvar a int;\n//line :20\nvar b int = \"x\";\n", "test.go:20: I can't use a untyped string as a int here"},
+	}
+
+	for _, c := range cases {
+		err := NewCompiler().CompileSource("test.go", strings.NewReader(c.src))
+		if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("'%s' should give '%s', got %v", c.src, c.err, err)
+		}
+	}
+}
+
+func TestCompileFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main/main.go": &fstest.MapFile{Data: []byte("package main;\n")},
+		"util/util.go": &fstest.MapFile{Data: []byte("package util;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"main/main.go", "util/util.go"})
+	if err != nil {
+		t.Error("error compiling: ", err)
+	}
+}
+
+func TestCompileFSMissingFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main/main.go": &fstest.MapFile{Data: []byte("package main;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"main/other.go"})
+	if err == nil {
+		t.Error("expected an error compiling a missing file")
+	}
+}
+
+func TestCompileImport(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":        &fstest.MapFile{Data: []byte("package main;\nimport \"util\";\nvar u util.Thing;\n")},
+		"util/util.go":   &fstest.MapFile{Data: []byte("package util;\ntype Thing int;\n")},
+		"util/more.go":   &fstest.MapFile{Data: []byte("package util;\n")},
+		"util/x_test.go": &fstest.MapFile{Data: []byte("this isn't compiled")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"main.go"})
+	if err != nil {
+		t.Error("error compiling: ", err)
+	}
+}
+
+func TestCompileImportDeclaredName(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":                   &fstest.MapFile{Data: []byte("package main;\nimport \"gopkg.in/yaml.v2\";\nimport \"example.com/foo/v2\";\nimport \"lib/go-thing\";\nvar y yaml.Node;\nvar f foo.Bar;\nvar t thing.Thing;\n")},
+		"gopkg.in/yaml.v2/yaml.go":  &fstest.MapFile{Data: []byte("package yaml;\ntype Node int;\n")},
+		"example.com/foo/v2/foo.go": &fstest.MapFile{Data: []byte("package foo;\ntype Bar int;\n")},
+		"lib/go-thing/thing.go":     &fstest.MapFile{Data: []byte("package thing;\ntype Thing int;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"main.go"})
+	if err != nil {
+		t.Error("error compiling: ", err)
+	}
+}
+
+func TestCompileImportNotFound(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":      &fstest.MapFile{Data: []byte("package main;\n\nimport \"missing\";\n")},
+		"util/util.go": &fstest.MapFile{Data: []byte("package util;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"main.go"})
+	if err == nil {
+		t.Error("expected an error importing a missing package")
+		return
+	}
+
+	_, ok := err.(*Error)
+	if !ok {
+		t.Errorf("expected an *Error, got %T", err)
+		return
+	}
+
+	if !strings.HasPrefix(err.Error(), "main.go:3: ") {
+		t.Error("wrong error: ", err)
+	}
+}
+
+func TestCompileImportFailed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":     &fstest.MapFile{Data: []byte("package main;\n\nimport \"broken\";\nvar x = broken.X;\n")},
+		"broken/a.go": &fstest.MapFile{Data: []byte("package broken;\nvar X = ;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"main.go"})
+	if err == nil {
+		t.Fatal("expected an error importing a broken package")
+	}
+
+	expected := "main.go:3: I can't import \"broken\": broken/a.go:2: bad expression. bad."
+	if err.Error() != expected {
+		t.Errorf("got error '%v', expected '%s'", err, expected)
+	}
+}
+
+func TestCompileUnusedImport(t *testing.T) {
+	fsys := fstest.MapFS{
+		"fmt/fmt.go": &fstest.MapFile{Data: []byte("package fmt;\n")},
+		"os/os.go":   &fstest.MapFile{Data: []byte("package os;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.CompileSource("main.go", strings.NewReader("package main;\nimport \"fmt\";\nimport \"os\";\nvar s fmt.Stringer;\n"))
+	if err == nil {
+		t.Error("expected an error for an unused import")
+		return
+	}
+
+	if err.Error() != "main.go:3: \"os\" is imported but not used" {
+		t.Error("wrong error: ", err)
+	}
+}
+
+func TestCompileMismatchedPackageNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":        &fstest.MapFile{Data: []byte("package main;\nimport \"util\";\nvar u util.Thing;\n")},
+		"util/a.go":      &fstest.MapFile{Data: []byte("package util;\n")},
+		"util/b.go":      &fstest.MapFile{Data: []byte("\npackage other;\n")},
+		"util/c_test.go": &fstest.MapFile{Data: []byte("package util_test;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"main.go"})
+	if err == nil {
+		t.Error("expected an error for mismatched package names")
+		return
+	}
+
+	if err.Error() != "main.go:2: I can't import \"util\": util/b.go:2: this file is in package 'other' but util/a.go is in package 'util'. they should be the same" {
+		t.Error("wrong error: ", err)
+	}
+}
+
+func TestCompileAllMismatchedPackageNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go":      &fstest.MapFile{Data: []byte("package main;\n")},
+		"b.go":      &fstest.MapFile{Data: []byte("\npackage other;\n")},
+		"c_test.go": &fstest.MapFile{Data: []byte("package main_test;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"a.go", "b.go", "c_test.go"})
+	if err == nil || err.Error() != "b.go:2: this file is in package 'other' but a.go is in package 'main'. they should be the same" {
+		t.Error("wrong error: ", err)
+	}
+
+	result, err := c.CompileAll([]string{"a.go", "c_test.go", "a.go"})
+	if err != nil || len(result.Errors) != 0 {
+		t.Errorf("a test package shouldn't have to match, got %v", err)
+	}
+}
+
+func TestCompileMethodSet(t *testing.T) {
+	src := "package main;\n" +
+		"type Name string;\n" +
+		"func (n Name) String() string;\n" +
+		"func (n *Name) Set(s string);\n"
+
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader(src))
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	sym := c.sourceFile("test.go").symbols.Lookup("Name")
+	if sym == nil {
+		t.Fatal("can't find the Name type")
+	}
+
+	ts := c.dataTypeStore
+	named := sym.dataType.(*DataTypeNamed)
+	methods := ts.MethodSet(named)
+	if len(methods) != 1 || methods[0].name != "String" || methods[0].signature.String() != "func() string" {
+		t.Errorf("wrong method set for Name: %v", methods)
+	}
+
+	methods = ts.MethodSet(ts.MakePointer(named))
+	if len(methods) != 2 || methods[1].name != "Set" || !methods[1].pointerReceiver || methods[1].signature.String() != "func(string)" {
+		t.Errorf("wrong method set for *Name: %v", methods)
+	}
+}
+
+func TestCompileMethodNoType(t *testing.T) {
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader("package main;\nfunc (n Name) String() string;\n"))
+	if err == nil || !strings.Contains(err.Error(), "can't find a type called 'Name'") {
+		t.Error("expected an error for a method on an unknown type, got: ", err)
+	}
+}
+
+func TestCompileConcurrentImports(t *testing.T) {
+	fsys := fstest.MapFS{
+		"shared/a.go":  &fstest.MapFile{Data: []byte("package shared;\ntype Thing int;\nvar Count int;\n")},
+		"shared/b.go":  &fstest.MapFile{Data: []byte("package shared;\ntype Other []string;\n")},
+		"util/util.go": &fstest.MapFile{Data: []byte("package util;\nimport \"shared\";\nvar T shared.Thing;\n")},
+	}
+
+	var fileNames []string
+	for i := 0; i < 20; i++ {
+		suffix := string(rune('a' + i))
+		fileName := fmt.Sprint("main", i, ".go")
+		src := fmt.Sprint("package main;\nimport \"shared\";\nimport \"util\";\nvar v", suffix, " shared.Other;\nvar w", suffix, " = util.T;\n")
+		fsys[fileName] = &fstest.MapFile{Data: []byte(src)}
+		fileNames = append(fileNames, fileName)
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile(fileNames)
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	if len(c.Warnings()) != 0 {
+		t.Errorf("didn't expect any warnings, got %v", c.Warnings())
+	}
+}
+
+func TestCompileConcurrentBrokenImport(t *testing.T) {
+	fsys := fstest.MapFS{
+		"broken/a.go": &fstest.MapFile{Data: []byte("package broken;\nvar x = ;\n")},
+		"shared/a.go": &fstest.MapFile{Data: []byte("package shared;\ntype Thing int;\n")},
+	}
+
+	var fileNames []string
+	for i := 0; i < 20; i++ {
+		suffix := string(rune('a' + i))
+		fileName := fmt.Sprint("main", i, ".go")
+		src := fmt.Sprint("package main;\nimport \"shared\";\nimport \"broken\";\nimport \"more", suffix, "\";\nvar v", suffix, " shared.Thing;\nvar w", suffix, " = broken.X;\nvar x", suffix, " = more", suffix, ".Y;\n")
+		fsys[fileName] = &fstest.MapFile{Data: []byte(src)}
+		fsys[fmt.Sprint("more", suffix, "/more.go")] = &fstest.MapFile{Data: []byte("package more" + suffix + ";\nvar Y int;\n")}
+		fileNames = append(fileNames, fileName)
+	}
+
+	// every file waits on the broken package, so they should all give up
+	// rather than waiting forever.
+	c := NewCompilerFS(fsys)
+	err := c.Compile(fileNames)
+	if err == nil || !strings.HasPrefix(err.Error(), "main") || !strings.Contains(err.Error(), ":3: I can't import \"broken\": broken/a.go:2: ") {
+		t.Error("wrong error: ", err)
+	}
+}
+
+func TestCompileImportAfterComplete(t *testing.T) {
+	fsys := fstest.MapFS{
+		"one.go":      &fstest.MapFile{Data: []byte("package main;\nimport \"shared\";\nvar a shared.Thing;\n")},
+		"two.go":      &fstest.MapFile{Data: []byte("package main;\nimport \"shared\";\nvar b = shared.Count;\n")},
+		"shared/a.go": &fstest.MapFile{Data: []byte("package shared;\ntype Thing int;\nvar Count int;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"one.go"})
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	// shared is finished by now so the second import has to be told
+	// straight away.
+	err = c.Compile([]string{"two.go"})
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	if c.sourceFile("two.go").importedSymbols["shared"] == nil {
+		t.Error("two.go didn't get the symbols from shared")
+	}
+}
+
+func TestCompileAbandonedWithoutError(t *testing.T) {
+	// a file which was abandoned with nothing else going wrong mustn't
+	// look like it worked.
+	c := NewCompiler()
+	completeChannel := make(chan completionMessage, 1)
+	completeChannel <- completionMessage{"", "", "test.go", SrcSpan{}, nil, errAbandoned, nil}
+	errs, _ := c.waitCompletion(map[string]bool{"test.go": true}, completeChannel, make(chan bool))
+	if len(errs) != 1 || errs[0].Error() != "the compilation of test.go was abandoned" {
+		t.Errorf("expected the file to be abandoned, got %v", errs)
+	}
+}
+
+func TestCompileImportTimeout(t *testing.T) {
+	// a and b import each other so neither of them ever finishes.
+	fsys := fstest.MapFS{
+		"main.go": &fstest.MapFile{Data: []byte("package main;\nimport \"a\";\nvar x = a.X;\n")},
+		"a/a.go":  &fstest.MapFile{Data: []byte("package a;\nimport \"b\";\nvar X = b.Y;\n")},
+		"b/b.go":  &fstest.MapFile{Data: []byte("package b;\nimport \"a\";\nvar Y = a.X;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	c.SetImportTimeout(50 * time.Millisecond)
+	err := c.Compile([]string{"main.go"})
+	if err == nil {
+		t.Fatal("expected an error waiting for the imports")
+	}
+
+	if _, ok := err.(*Error); !ok {
+		t.Errorf("expected an *Error, got %T", err)
+	}
+
+	if !strings.Contains(err.Error(), ":2: I waited 50ms for \"") {
+		t.Error("wrong error: ", err)
+	}
+}
+
+func TestCompileAll(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":     &fstest.MapFile{Data: []byte("package main;\nimport \"shared\";\nvar a shared.Thing;\n")},
+		"other.go":    &fstest.MapFile{Data: []byte("package main;\ntype S struct { a int `bad`; };\n")},
+		"shared/a.go": &fstest.MapFile{Data: []byte("package shared;\ntype Thing int;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	result, err := c.CompileAll([]string{"main.go", "other.go"})
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	expectedFiles := []string{"main.go", "other.go", "shared/a.go"}
+	if fmt.Sprint(result.Files) != fmt.Sprint(expectedFiles) {
+		t.Errorf("got files %v, expected %v", result.Files, expectedFiles)
+	}
+
+	for _, fileName := range expectedFiles {
+		if top, ok := result.ASTs[fileName].(*ASTTopLevel); !ok || len(top.topLevelDecls) != 1 {
+			t.Errorf("%s has the wrong AST: %v", fileName, result.ASTs[fileName])
+		}
+	}
+
+	if fmt.Sprint(result.Packages["main"]) != "[main.go other.go]" || fmt.Sprint(result.Packages["shared"]) != "[shared/a.go]" {
+		t.Errorf("got the wrong packages: %v", result.Packages)
+	}
+
+	if len(result.Errors) != 0 || len(result.Warnings) != 1 {
+		t.Errorf("expected no errors and one warning, got %v and %v", result.Errors, result.Warnings)
+	}
+}
+
+func TestCompileAllTwice(t *testing.T) {
+	fsys := fstest.MapFS{
+		"one/main.go": &fstest.MapFile{Data: []byte("package main;\nimport \"shared\";\nvar a shared.Thing;\n")},
+		"one/bad.go":  &fstest.MapFile{Data: []byte("package main;\ntype S struct { a int `bad`; };\n")},
+		"two/main.go": &fstest.MapFile{Data: []byte("package main;\nimport \"shared\";\nvar b shared.Thing;\n")},
+		"shared/a.go": &fstest.MapFile{Data: []byte("package shared;\ntype Thing int;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	if _, err := c.CompileAll([]string{"one/main.go", "one/bad.go"}); err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	// the second compile only has its own files, and the package they
+	// share, which was already compiled by the first one.
+	result, err := c.CompileAll([]string{"two/main.go"})
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	if fmt.Sprint(result.Files) != "[shared/a.go two/main.go]" {
+		t.Errorf("got files %v, expected [shared/a.go two/main.go]", result.Files)
+	}
+
+	if len(result.Warnings) != 0 || len(result.Diagnostics) != 0 {
+		t.Errorf("the first compile's warning shouldn't be repeated, got %v", result.Diagnostics)
+	}
+}
+
+func TestCompileAllErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"one.go": &fstest.MapFile{Data: []byte("package main;\nvar a = ;\n")},
+		"two.go": &fstest.MapFile{Data: []byte("package main;\nvar b = );\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	result, err := c.CompileAll([]string{"one.go", "two.go"})
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+
+	// two.go is usually compiled too but it could be abandoned if one.go
+	// fails before it's started.
+	if len(result.Errors) == 0 || err.Error() != result.Errors.Error() {
+		t.Errorf("expected the error to list every problem, got %v", err)
+	}
+
+	for _, e := range result.Errors {
+		if !strings.HasPrefix(e.Error(), "one.go:2: ") && !strings.HasPrefix(e.Error(), "two.go:2: ") {
+			t.Errorf("unexpected error %v", e)
+		}
+	}
+
+	if len(result.ASTs) != 0 {
+		t.Errorf("neither file should have an AST, got %v", result.ASTs)
+	}
+}
+
+func TestCompileAfterError(t *testing.T) {
+	c := NewCompiler()
+	for i := 0; i < 3; i++ {
+		err := c.CompileSource("bad.go", strings.NewReader("package main;\nvar a = ;\n"))
+		if err == nil || !strings.HasPrefix(err.Error(), "bad.go:2: ") {
+			t.Errorf("compile %d gave the wrong error: %v", i, err)
+		}
+	}
+
+	if err := c.CompileSource("good.go", strings.NewReader("package main;\n")); err != nil {
+		t.Error("a clean file gave error ", err)
+	}
+}
+
+func TestCompileImportAfterAbandoned(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":   &fstest.MapFile{Data: []byte("package main;\nimport \"late\";\nvar x late.T;\n")},
+		"bad.go":    &fstest.MapFile{Data: []byte("package main;\nvar a = ;\n")},
+		"late/a.go": &fstest.MapFile{Data: []byte("package late;\nvar y T;\n")},
+		"late/b.go": &fstest.MapFile{Data: lateSibling("late")},
+	}
+
+	// the import is usually abandoned part way through when bad.go fails.
+	// it has to be started again for the next compilation.
+	c := NewCompilerFS(fsys)
+	if err := c.Compile([]string{"main.go", "bad.go"}); err == nil {
+		t.Error("expected an error from bad.go")
+	}
+
+	if err := c.Compile([]string{"main.go"}); err != nil {
+		t.Error("error compiling: ", err)
+	}
+}
+
+// lateSibling makes a file which takes a long time to get to declaring
+// T and f, so the other files in its package have to wait for it.
+func lateSibling(packageName string) []byte {
+	var sb strings.Builder
+	sb.WriteString("package " + packageName + ";\n")
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&sb, "var v%d int;\n", i)
+	}
+
+	sb.WriteString("type T int;\nfunc f() T { return 1; };\n")
+	return []byte(sb.String())
+}
+
+func TestCompileAllLateSibling(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go": &fstest.MapFile{Data: []byte("package main;\nvar y T;\nvar z T = f();\n")},
+		"b.go": &fstest.MapFile{Data: lateSibling("main")},
+	}
+
+	for i := 0; i < 10; i++ {
+		c := NewCompilerFS(fsys)
+		if _, err := c.CompileAll([]string{"a.go", "b.go"}); err != nil {
+			t.Fatal("error compiling: ", err)
+		}
+	}
+}
+
+func TestCompileImportLateSibling(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":   &fstest.MapFile{Data: []byte("package main;\nimport \"late\";\nvar x late.T;\n")},
+		"late/a.go": &fstest.MapFile{Data: []byte("package late;\nvar y T;\nvar z T = f();\n")},
+		"late/b.go": &fstest.MapFile{Data: lateSibling("late")},
+	}
+
+	for i := 0; i < 10; i++ {
+		c := NewCompilerFS(fsys)
+		if err := c.Compile([]string{"main.go"}); err != nil {
+			t.Fatal("error compiling: ", err)
+		}
+	}
+}
+
+// type panicReader gives some source then panics, like a buggy compiler
+// would part way through a file.
+type panicReader struct {
+	src  string
+	done bool
+}
+
+func (pr *panicReader) Read(buf []byte) (int, error) {
+	if pr.done {
+		panic("oh no")
+	}
+
+	pr.done = true
+	return copy(buf, pr.src), nil
+}
+
+func TestCompileRecoversFromPanic(t *testing.T) {
+	c := NewCompiler()
+	err := c.CompileSource("test.go", &panicReader{src: "package main;\nvar a = 1;\n"})
+	if err == nil {
+		t.Fatal("expected the panic to become an error")
+	}
+
+	if _, ok := err.(*Error); !ok {
+		t.Errorf("expected an *Error, got %T", err)
+	}
+
+	expected := "test.go:2: the compiler crashed here (oh no). sorry - that's a bug in the compiler"
+	if err.Error() != expected {
+		t.Errorf("expected '%s', got '%v'", expected, err)
+	}
+
+	// the compiler should still work afterwards, errors and all.
+	err = c.CompileSource("broken.go", strings.NewReader("package main;\nvar b = ;\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "broken.go:2: ") {
+		t.Errorf("expected an error from broken.go, got %v", err)
+	}
+
+	if err := c.CompileSource("other.go", strings.NewReader("package main;\nvar c = 1;\n")); err != nil {
+		t.Errorf("a clean file gave error %v", err)
+	}
+
+	if sf := c.sourceFile("other.go"); sf == nil || sf.ast == nil || sf.symbols.LookupLocal("c") == nil {
+		t.Error("a clean file didn't give a result")
+	}
+}
+
+func TestCompileWarningsAndErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go": &fstest.MapFile{Data: []byte("package main;\ntype S struct { a int `bad`; };\nvar x int = \"hello\";\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	result, err := c.CompileAll([]string{"main.go"})
+	if err == nil {
+		t.Fatal("expected the error to stop compilation")
+	}
+
+	if len(result.Diagnostics) != 2 {
+		t.Fatalf("expected an error and a warning, got %v", result.Diagnostics)
+	}
+
+	if len(result.Diagnostics.Errors()) != 1 || !strings.HasPrefix(result.Diagnostics.Errors()[0].Error(), "main.go:3: ") {
+		t.Errorf("expected an error on line 3, got %v", result.Diagnostics.Errors())
+	}
+
+	warnings := result.Diagnostics.Warnings()
+	if len(warnings) != 1 || warnings[0].(*Error).Severity() != SeverityWarning || !strings.HasPrefix(warnings[0].Error(), "main.go:2: ") {
+		t.Errorf("expected a warning on line 2, got %v", warnings)
+	}
+
+	// the warning on its own doesn't stop compilation.
+	fsys["main.go"] = &fstest.MapFile{Data: []byte("package main;\ntype S struct { a int `bad`; };\n")}
+	result, err = NewCompilerFS(fsys).CompileAll([]string{"main.go"})
+	if err != nil || result.Diagnostics.HasErrors() || len(result.Diagnostics.Warnings()) != 1 {
+		t.Errorf("expected just a warning, got %v and %v", err, result.Diagnostics)
+	}
+}
@@ -0,0 +1,619 @@
+package golightly
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"unicode/utf8"
+)
+
+// maxConstBits is how big an untyped integer constant can get. Go says
+// it has to be at least 256 bits.
+const maxConstBits = 512
+
+// type constEvaluator reduces constant expressions to values.
+type constEvaluator struct {
+	filename   string
+	lookup     func(ident *ASTIdentifier) *Symbol // finds what names refer to.
+	ts         *DataTypeStore
+	inProgress map[*Symbol]bool // constants we're in the middle of evaluating.
+	unknown    bool             // set if we gave up because something wasn't a constant we know the value of.
+	variable   bool             // set if it was because the expression uses a variable or calls a function.
+
+	// conversionType says if a called function is really a type, so the
+	// call is a conversion.
+	conversionType func(function AST) (DataType, bool, error)
+}
+
+// EvalConst evaluates a constant expression to get its value. Names are
+// looked up in the given scope. Anything which isn't constant gives an
+// error.
+func EvalConst(ast AST, syms *SymbolTable, ts *DataTypeStore) (Value, error) {
+	return evalConst("", ast, scopeLookup(syms), ts)
+}
+
+// evalConst evaluates a constant expression, reporting errors in the
+// given file. Names are looked up using the given function.
+func evalConst(filename string, ast AST, lookup func(ident *ASTIdentifier) *Symbol, ts *DataTypeStore) (Value, error) {
+	ev := constEvaluator{filename, lookup, ts, make(map[*Symbol]bool), false, false, nil}
+	ev.conversionType = ev.namedConversionType
+	return ev.eval(ast)
+}
+
+// eval evaluates an expression.
+func (ev *constEvaluator) eval(ast AST) (Value, error) {
+	switch a := ast.(type) {
+	case *ASTValue:
+		return a.val, nil
+
+	case *ASTIdentifier:
+		return ev.evalIdentifier(a)
+
+	case *ASTParen:
+		return ev.eval(a.expr)
+
+	case *ASTUnaryExpr:
+		param, err := ev.eval(a.param)
+		if err != nil {
+			return nil, err
+		}
+
+		return ev.evalUnary(a, param)
+
+	case *ASTBinaryExpr:
+		left, err := ev.eval(a.left)
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := ev.eval(a.right)
+		if err != nil {
+			return nil, err
+		}
+
+		return ev.evalBinary(a, left, right)
+
+	case *ASTCall:
+		return ev.evalCall(a)
+	}
+
+	return nil, ev.notConstantExpr(ast)
+}
+
+// evalCall evaluates a call, which is only a constant if it's a
+// conversion of a constant or the len() of a constant string.
+func (ev *constEvaluator) evalCall(call *ASTCall) (Value, error) {
+	if len(call.args) != 1 {
+		return nil, ev.notConstantExpr(call)
+	}
+
+	dt, isType, err := ev.conversionType(call.function)
+	if err != nil {
+		return nil, err
+	}
+
+	if isType {
+		val, err := ev.eval(call.args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		// only conversions between basic types give constants.
+		from := val.DataType(ev.ts)
+		switch {
+		case isNumeric(dt) && isNumeric(from):
+			return ev.convertExplicit(val, dt, call.args[0].Pos())
+
+		case isString(dt) && isString(from), isBoolean(dt) && isBoolean(from):
+			return val, nil
+
+		case isString(dt) && isInteger(from):
+			// it's the UTF-8 of the rune, or of "\uFFFD" if it's not a rune.
+			i, _ := constInt(val)
+			r := utf8.RuneError
+			if i.IsInt64() && utf8.ValidRune(rune(i.Int64())) && int64(rune(i.Int64())) == i.Int64() {
+				r = rune(i.Int64())
+			}
+
+			return ValueString{string(r)}, nil
+		}
+
+		return nil, ev.notConstantExpr(call)
+	}
+
+	if ident, ok := call.function.(*ASTIdentifier); ok && ev.isBuiltin(ident, builtinLen) {
+		val, err := ev.eval(call.args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if s, ok := val.(ValueString); ok {
+			return ValueInt{ev.ts.IntType(), int64(len(s.val))}, nil
+		}
+	}
+
+	return nil, ev.notConstantExpr(call)
+}
+
+// isBuiltin returns true if an identifier refers to a particular builtin.
+func (ev *constEvaluator) isBuiltin(ident *ASTIdentifier, b builtin) bool {
+	sym := ev.lookup(ident)
+	if sym == nil {
+		return false
+	}
+
+	decl, ok := sym.decl.(*builtinDecl)
+	return ok && decl.builtin == b
+}
+
+// namedConversionType says if a called function is a type, for when we
+// haven't got the inferrer to tell us. It only knows about types which
+// are named, like "int8(x)".
+func (ev *constEvaluator) namedConversionType(function AST) (DataType, bool, error) {
+	switch f := function.(type) {
+	case *ASTParen:
+		return ev.namedConversionType(f.expr)
+
+	case *ASTIdentifier:
+		sym := ev.lookup(f)
+		if sym == nil || sym.kind != SymbolKindType {
+			return nil, false, nil
+		}
+
+		dt, err := ev.ts.fromAST(ev.filename, f, ev.lookup)
+		return dt, true, err
+	}
+
+	return nil, false, nil
+}
+
+// notConstant reports something which we can't get a constant value
+// for. it's not necessarily wrong - it might just not be a constant.
+func (ev *constEvaluator) notConstant(pos SrcSpan, message string) error {
+	ev.unknown = true
+	return NewError(ev.filename, pos, message)
+}
+
+// notConstantExpr reports an expression we can't get a constant value
+// for. it can't possibly be a constant if it uses a variable or calls a
+// function.
+func (ev *constEvaluator) notConstantExpr(ast AST) error {
+	Walk(ast, func(node AST) bool {
+		if ident, ok := node.(*ASTIdentifier); ok {
+			if sym := ev.lookup(ident); sym != nil && (sym.kind == SymbolKindVar || sym.kind == SymbolKindFunc) {
+				ev.variable = true
+			}
+		}
+
+		return true
+	})
+
+	return ev.notConstant(ast.Pos(), "not a constant expression")
+}
+
+// evalIdentifier gets the value of a named constant.
+func (ev *constEvaluator) evalIdentifier(ident *ASTIdentifier) (Value, error) {
+	sym := ev.lookup(ident)
+	if sym == nil {
+		return nil, NewError(ev.filename, ident.pos, fmt.Sprint("undefined: ", ident.name))
+	}
+
+	decl, ok := sym.decl.(*ASTConstDecl)
+	if !ok {
+		return nil, ev.notConstantExpr(ident)
+	}
+
+	if decl.value == nil {
+		// it's one of the predeclared constants.
+		switch ident.name {
+		case "true":
+			return ValueBool{true}, nil
+		case "false":
+			return ValueBool{false}, nil
+		}
+
+		return nil, ev.notConstant(ident.pos, fmt.Sprint("I don't know the value of ", ident.name, " here"))
+	}
+
+	if ev.inProgress[sym] {
+		return nil, NewError(ev.filename, ident.pos, fmt.Sprint("'", ident.name, "' refers to itself in its own declaration"))
+	}
+
+	ev.inProgress[sym] = true
+	defer delete(ev.inProgress, sym)
+
+	val, err := ev.eval(decl.value)
+	if err != nil {
+		return nil, err
+	}
+
+	if decl.typ == nil {
+		return val, nil
+	}
+
+	// typed constants take on their declared type.
+	dt, err := ev.ts.fromAST(ev.filename, decl.typ, ev.lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	return ev.convert(val, dt, decl.value.Pos())
+}
+
+// convert gives a constant a new type.
+func (ev *constEvaluator) convert(val Value, dt DataType, pos SrcSpan) (Value, error) {
+	if !Assignable(val.DataType(ev.ts), dt, ev.ts) {
+		return nil, NewError(ev.filename, pos, fmt.Sprint("I can't use a ", val.DataType(ev.ts), " as a ", dt, " here"))
+	}
+
+	return ev.convertExplicit(val, dt, pos)
+}
+
+// convertExplicit converts a constant to a type for a conversion like
+// "int8(x)". unlike an assignment the types don't have to match, but an
+// integer still has to be a whole number which fits in the new type.
+func (ev *constEvaluator) convertExplicit(val Value, dt DataType, pos SrcSpan) (Value, error) {
+	if !isNumeric(val.DataType(ev.ts)) {
+		return val, nil
+	}
+
+	switch {
+	case isInteger(dt):
+		i, ok := constInt(val)
+		if !ok {
+			return nil, NewError(ev.filename, pos, fmt.Sprint("this constant isn't a whole number so it can't be a ", dt))
+		}
+
+		return ev.makeInt(dt, i, pos)
+
+	case isNumeric(dt):
+		f, _ := constFloat(val)
+		return ValueFloat{dt, f}, nil
+	}
+
+	return val, nil
+}
+
+// evalUnary evaluates a unary operator on a constant.
+func (ev *constEvaluator) evalUnary(expr *ASTUnaryExpr, param Value) (Value, error) {
+	dt := param.DataType(ev.ts)
+
+	switch expr.op {
+	case TokenKindAdd:
+		if isNumeric(dt) {
+			return param, nil
+		}
+
+	case TokenKindSubtract:
+		if i, ok := constInt(param); ok {
+			return ev.makeInt(dt, new(big.Int).Neg(i), expr.pos)
+		}
+
+		if f, ok := constFloat(param); ok {
+			return ValueFloat{dt, -f}, nil
+		}
+
+	case TokenKindBitwiseExor:
+		if i, ok := constInt(param); ok {
+			if isUnsigned(dt) {
+				// it only flips the bits the type has.
+				mask := new(big.Int).Lsh(big.NewInt(1), uint(intBits(dt)))
+				mask.Sub(mask, big.NewInt(1))
+				return ev.makeInt(dt, new(big.Int).Xor(i, mask), expr.pos)
+			}
+
+			return ev.makeInt(dt, new(big.Int).Not(i), expr.pos)
+		}
+
+	case TokenKindNot:
+		if b, ok := param.(ValueBool); ok {
+			return ValueBool{!b.val}, nil
+		}
+
+	default:
+		return nil, ev.notConstantExpr(expr)
+	}
+
+	return nil, NewError(ev.filename, expr.pos, fmt.Sprint("I can't use ", operatorNames[expr.op], " on a ", dt))
+}
+
+// evalBinary evaluates a binary operator on two constants.
+func (ev *constEvaluator) evalBinary(expr *ASTBinaryExpr, left Value, right Value) (Value, error) {
+	leftType := left.DataType(ev.ts)
+	rightType := right.DataType(ev.ts)
+
+	// shifts don't need the same type on both sides.
+	if expr.op == TokenKindShiftLeft || expr.op == TokenKindShiftRight {
+		l, lok := constInt(left)
+		r, rok := constInt(right)
+		if !lok || !rok {
+			return nil, NewError(ev.filename, expr.pos, "I can only shift integers")
+		}
+
+		if r.Sign() < 0 {
+			return nil, NewError(ev.filename, expr.pos, "I can't shift by a negative amount")
+		}
+
+		// a whole number float is shifted like an integer.
+		if leftType.DataTypeKind() == DataTypeKindUntypedFloat {
+			leftType = ev.ts.UntypedIntType()
+		}
+
+		// anything bigger than this would be too big a constant anyway,
+		// or would shift all the bits out.
+		shift := uint(maxConstBits + 1)
+		if r.IsUint64() && r.Uint64() < uint64(shift) {
+			shift = uint(r.Uint64())
+		}
+
+		if expr.op == TokenKindShiftLeft {
+			if l.Sign() != 0 && shift > maxConstBits {
+				return nil, NewError(ev.filename, expr.pos, fmt.Sprint("I can't shift by more than ", maxConstBits, " bits"))
+			}
+
+			return ev.makeInt(leftType, new(big.Int).Lsh(l, shift), expr.pos)
+		}
+
+		return ev.makeInt(leftType, new(big.Int).Rsh(l, shift), expr.pos)
+	}
+
+	dt, ok := unifyTypes(leftType, rightType, ev.ts)
+	if !ok {
+		return nil, NewError(ev.filename, expr.pos, fmt.Sprint("I can't use ", operatorNames[expr.op], " on a ", leftType, " and a ", rightType, " - they're different types"))
+	}
+
+	var result Value
+	var err error
+	switch {
+	case isBoolean(dt):
+		result, err = ev.evalBool(expr, left.(ValueBool).val, right.(ValueBool).val)
+
+	case isString(dt):
+		result, err = ev.evalString(expr, left.(ValueString).val, right.(ValueString).val)
+
+	case isInteger(dt):
+		l, lok := constInt(left)
+		r, rok := constInt(right)
+		if !lok || !rok {
+			return nil, NewError(ev.filename, expr.pos, fmt.Sprint("this constant isn't a whole number so it can't be a ", dt))
+		}
+
+		result, err = ev.evalInt(expr, dt, l, r)
+
+	case isNumeric(dt):
+		l, _ := constFloat(left)
+		r, _ := constFloat(right)
+		result, err = ev.evalFloat(expr, dt, l, r)
+
+	default:
+		return nil, ev.notConstant(expr.pos, "not a constant expression")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, NewError(ev.filename, expr.pos, fmt.Sprint("I can't use ", operatorNames[expr.op], " on a ", dt))
+	}
+
+	return result, nil
+}
+
+// evalBool evaluates an operator on two boolean constants. It returns
+// nil if the operator doesn't work on booleans.
+func (ev *constEvaluator) evalBool(expr *ASTBinaryExpr, l bool, r bool) (Value, error) {
+	switch expr.op {
+	case TokenKindLogicalAnd:
+		return ValueBool{l && r}, nil
+	case TokenKindLogicalOr:
+		return ValueBool{l || r}, nil
+	case TokenKindEquals:
+		return ValueBool{l == r}, nil
+	case TokenKindNotEqual:
+		return ValueBool{l != r}, nil
+	}
+
+	return nil, nil
+}
+
+// evalString evaluates an operator on two string constants. It returns
+// nil if the operator doesn't work on strings.
+func (ev *constEvaluator) evalString(expr *ASTBinaryExpr, l string, r string) (Value, error) {
+	switch expr.op {
+	case TokenKindAdd:
+		return ValueString{l + r}, nil
+	}
+
+	return evalComparison(expr.op, l < r, l == r), nil
+}
+
+// evalInt evaluates an operator on two integer constants. It returns nil
+// if the operator doesn't work on integers.
+func (ev *constEvaluator) evalInt(expr *ASTBinaryExpr, dt DataType, l *big.Int, r *big.Int) (Value, error) {
+	result := new(big.Int)
+	switch expr.op {
+	case TokenKindAdd:
+		result.Add(l, r)
+	case TokenKindSubtract:
+		result.Sub(l, r)
+	case TokenKindAsterisk:
+		result.Mul(l, r)
+	case TokenKindDivide, TokenKindModulus:
+		if r.Sign() == 0 {
+			return nil, NewError(ev.filename, expr.pos, "you can't divide by zero")
+		}
+
+		// Quo and Rem round towards zero like Go does.
+		if expr.op == TokenKindDivide {
+			result.Quo(l, r)
+		} else {
+			result.Rem(l, r)
+		}
+	case TokenKindBitwiseAnd:
+		result.And(l, r)
+	case TokenKindBitwiseOr:
+		result.Or(l, r)
+	case TokenKindBitwiseExor:
+		result.Xor(l, r)
+	case TokenKindBitClear:
+		result.AndNot(l, r)
+	default:
+		cmp := l.Cmp(r)
+		return evalComparison(expr.op, cmp < 0, cmp == 0), nil
+	}
+
+	return ev.makeInt(dt, result, expr.pos)
+}
+
+// evalFloat evaluates an operator on two float constants. It returns nil
+// if the operator doesn't work on floats.
+func (ev *constEvaluator) evalFloat(expr *ASTBinaryExpr, dt DataType, l float64, r float64) (Value, error) {
+	switch expr.op {
+	case TokenKindAdd:
+		return ValueFloat{dt, l + r}, nil
+	case TokenKindSubtract:
+		return ValueFloat{dt, l - r}, nil
+	case TokenKindAsterisk:
+		return ValueFloat{dt, l * r}, nil
+	case TokenKindDivide:
+		if r == 0 {
+			return nil, NewError(ev.filename, expr.pos, "you can't divide by zero")
+		}
+
+		return ValueFloat{dt, l / r}, nil
+	}
+
+	return evalComparison(expr.op, l < r, l == r), nil
+}
+
+// evalComparison works out a comparison from whether the left side is
+// less than or equal to the right. It returns nil if the operator isn't
+// a comparison.
+func evalComparison(op TokenKind, less bool, equal bool) Value {
+	switch op {
+	case TokenKindEquals:
+		return ValueBool{equal}
+	case TokenKindNotEqual:
+		return ValueBool{!equal}
+	case TokenKindLess:
+		return ValueBool{less}
+	case TokenKindLessEqual:
+		return ValueBool{less || equal}
+	case TokenKindGreater:
+		return ValueBool{!less && !equal}
+	case TokenKindGreaterEqual:
+		return ValueBool{!less}
+	}
+
+	return nil
+}
+
+// constInt gets the value of an integer constant. Floats which are whole
+// numbers count as integers too. The result mustn't be changed since it
+// might be the one in the constant.
+func constInt(v Value) (*big.Int, bool) {
+	switch val := v.(type) {
+	case ValueInt:
+		return big.NewInt(val.val), true
+	case ValueUint:
+		return new(big.Int).SetUint64(val.val), true
+	case ValueRune:
+		return big.NewInt(int64(val.val)), true
+	case ValueBigInt:
+		return val.val, true
+	case ValueFloat:
+		if math.IsInf(val.val, 0) || math.IsNaN(val.val) {
+			return nil, false
+		}
+
+		f := big.NewFloat(val.val)
+		if !f.IsInt() {
+			return nil, false
+		}
+
+		i, _ := f.Int(nil)
+		return i, true
+	}
+
+	return nil, false
+}
+
+// constFloat gets the value of a numeric constant as a float.
+func constFloat(v Value) (float64, bool) {
+	switch val := v.(type) {
+	case ValueInt:
+		return float64(val.val), true
+	case ValueUint:
+		return float64(val.val), true
+	case ValueRune:
+		return float64(val.val), true
+	case ValueBigInt:
+		f, _ := new(big.Float).SetInt(val.val).Float64()
+		return f, true
+	case ValueFloat:
+		return val.val, true
+	}
+
+	return 0, false
+}
+
+// makeInt makes an integer constant of a given type, with an error if it
+// doesn't fit.
+func (ev *constEvaluator) makeInt(dt DataType, i *big.Int, pos SrcSpan) (Value, error) {
+	val, ok := makeIntConst(dt, i)
+	if !ok {
+		if isUntyped(dt) {
+			return nil, NewError(ev.filename, pos, fmt.Sprint("this constant is too big for me - it's got more than ", maxConstBits, " bits"))
+		}
+
+		return nil, NewError(ev.filename, pos, fmt.Sprint("the constant ", i, " doesn't fit in a ", dt))
+	}
+
+	return val, nil
+}
+
+// makeIntConst makes an integer constant of a given type. Untyped
+// constants which won't fit in an int64 are kept as big integers. It
+// returns false if the value doesn't fit in the type.
+func makeIntConst(dt DataType, i *big.Int) (Value, bool) {
+	switch Underlying(dt).DataTypeKind() {
+	case DataTypeKindUntypedRune:
+		if i.IsInt64() && int64(rune(i.Int64())) == i.Int64() {
+			return ValueRune{rune(i.Int64())}, true
+		}
+
+		return ValueBigInt{dt, i}, i.BitLen() <= maxConstBits
+
+	case DataTypeKindUntypedInt:
+		if i.IsInt64() {
+			return ValueInt{dt, i.Int64()}, true
+		}
+
+		return ValueBigInt{dt, i}, i.BitLen() <= maxConstBits
+
+	case DataTypeKindUint, DataTypeKindUintptr:
+		if i.Sign() < 0 || i.BitLen() > intBits(dt) {
+			return nil, false
+		}
+
+		return ValueUint{dt, i.Uint64()}, true
+	}
+
+	// signed integers go from -2^(bits-1) to 2^(bits-1)-1.
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(intBits(dt)-1))
+	if i.Cmp(limit) >= 0 || i.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return nil, false
+	}
+
+	return ValueInt{dt, i.Int64()}, true
+}
+
+// intBits is how many bits an integer type has.
+func intBits(dt DataType) int {
+	if sized, ok := Underlying(dt).(DataTypeSized); ok {
+		return sized.size.Bits()
+	}
+
+	return wordBits
+}
@@ -0,0 +1,108 @@
+package golightly
+
+import (
+	"testing"
+)
+
+// evalTestConst parses and evaluates a constant expression.
+func evalTestConst(t *testing.T, src string, syms *SymbolTable, ts *DataTypeStore) (Value, error) {
+	expr, err := setupParserTest(src).parseExpression()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	return EvalConst(expr, syms, ts)
+}
+
+func TestEvalConst(t *testing.T) {
+	ts := NewDataTypeStore()
+	universe := NewUniverse(ts)
+
+	cases := []struct {
+		src string
+		val Value
+	}{
+		{"2 * 3 + 1", ValueInt{ts.UntypedIntType(), 7}},
+		{"(2 + 3) * -4", ValueInt{ts.UntypedIntType(), -20}},
+		{"7 / 2", ValueInt{ts.UntypedIntType(), 3}},
+		{"7 / 2.0", ValueFloat{ts.UntypedFloatType(), 3.5}},
+		{"1 << 4 | 1", ValueInt{ts.UntypedIntType(), 17}},
+		{"\"ab\" + \"cd\"", ValueString{"abcd"}},
+		{"3 > 2 && !false", ValueBool{true}},
+		{"\"a\" == \"b\"", ValueBool{false}},
+		{"'a' + 1", ValueRune{'b'}},
+		{"1 << 70 >> 68", ValueInt{ts.UntypedIntType(), 4}},
+		{"(1 << 100) / (1 << 98)", ValueInt{ts.UntypedIntType(), 4}},
+		{"1.0 << 2", ValueInt{ts.UntypedIntType(), 4}},
+		{"2.0 << 70 >> 69", ValueInt{ts.UntypedIntType(), 4}},
+		{"-7 / 2", ValueInt{ts.UntypedIntType(), -3}},
+		{"-7 % 2", ValueInt{ts.UntypedIntType(), -1}},
+		{"1 << 70 > 1 << 69", ValueBool{true}},
+	}
+
+	for _, c := range cases {
+		val, err := evalTestConst(t, c.src, universe, ts)
+		if err != nil {
+			t.Errorf("'%s' gave an error: %v", c.src, err)
+			continue
+		}
+
+		if val == nil || val.DataType(ts) != c.val.DataType(ts) || !val.Equals(c.val) {
+			t.Errorf("'%s' gave %#v, expected %#v", c.src, val, c.val)
+		}
+	}
+}
+
+func TestEvalConstBig(t *testing.T) {
+	ts := NewDataTypeStore()
+	universe := NewUniverse(ts)
+
+	val, err := evalTestConst(t, "1 << 70", universe, ts)
+	if err != nil {
+		t.Fatal("error evaluating: ", err)
+	}
+
+	if _, ok := val.(ValueBigInt); !ok || val.String() != "1180591620717411303424" || val.DataType(ts) != ts.UntypedIntType() {
+		t.Errorf("'1 << 70' gave %#v", val)
+	}
+
+	_, err = evalTestConst(t, "1 << 600", universe, ts)
+	if err == nil || err.(*Error).message != "I can't shift by more than 512 bits" {
+		t.Errorf("'1 << 600' gave error %v", err)
+	}
+
+	_, err = evalTestConst(t, "(1 << 500) * (1 << 500)", universe, ts)
+	if err == nil || err.(*Error).message != "this constant is too big for me - it's got more than 512 bits" {
+		t.Errorf("'(1 << 500) * (1 << 500)' gave error %v", err)
+	}
+}
+
+func TestEvalConstSymbols(t *testing.T) {
+	ts := NewDataTypeStore()
+	syms := NewSymbolTable(NewUniverse(ts))
+
+	ten, _ := setupParserTest("10").parseExpression()
+	syms.Add(&Symbol{"ten", SymbolKindConst, &ASTConstDecl{&ASTIdentifier{SrcSpan{}, "", "ten"}, nil, ten, ""}, nil})
+	syms.Add(&Symbol{"count", SymbolKindVar, &ASTVarDecl{&ASTIdentifier{SrcSpan{}, "", "count"}, &ASTIdentifier{SrcSpan{}, "", "int"}, nil, ""}, ts.IntType()})
+
+	val, err := evalTestConst(t, "ten * 2", syms, ts)
+	if err != nil {
+		t.Fatal("error evaluating: ", err)
+	}
+
+	if !val.Equals(ValueInt{ts.UntypedIntType(), 20}) {
+		t.Errorf("'ten * 2' gave %#v, expected 20", val)
+	}
+
+	for _, src := range []string{"count + 1", "f(1)"} {
+		_, err = evalTestConst(t, src, syms, ts)
+		if err == nil || err.(*Error).message != "not a constant expression" {
+			t.Errorf("'%s' should give 'not a constant expression' but gave %v", src, err)
+		}
+	}
+
+	_, err = evalTestConst(t, "ten / 0", syms, ts)
+	if err == nil {
+		t.Error("dividing by zero should give an error")
+	}
+}
@@ -1,6 +1,11 @@
 package golightly
 
-import "sync"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
 
 // DataTypeKind indicates which type of value this is
 type DataTypeKind int
@@ -9,19 +14,39 @@ const (
 	// basic types
 	DataTypeKindInt DataTypeKind = iota
 	DataTypeKindUint
+	DataTypeKindUintptr
 	DataTypeKindFloat
 	DataTypeKindString
-	DataTypeKindRune
 	DataTypeKindImaginary
+	DataTypeKindBool
 	DataTypeKindType
 
+	// untyped constants
+	DataTypeKindUntypedInt
+	DataTypeKindUntypedFloat
+	DataTypeKindUntypedRune
+	DataTypeKindUntypedString
+	DataTypeKindUntypedBool
+	DataTypeKindUntypedNil
+
 	// unary types
 	DataTypeKindArray
 	DataTypeKindSlice
 	DataTypeKindPointer
+	DataTypeKindChan
+
+	// map type
+	DataTypeKindMap
 
 	// struct type
 	DataTypeKindStruct
+
+	// function and interface types
+	DataTypeKindFunc
+	DataTypeKindInterface
+
+	// types declared with "type"
+	DataTypeKindNamed
 )
 
 // DataSize indicates which size value this is.
@@ -29,12 +54,36 @@ type DataSize int
 
 const (
 	// operators
-	DataSize16 DataSize = iota
+	DataSize8 DataSize = iota
+	DataSize16
 	DataSize32
 	DataSize64
+	DataSize128
 	DataSizeDefault
 )
 
+// wordBits is the number of bits in a machine word on the target.
+const wordBits = 64
+
+// Bits returns the number of bits in a value of this size. The default size
+// is the target's word size.
+func (ds DataSize) Bits() int {
+	switch ds {
+	case DataSize8:
+		return 8
+	case DataSize16:
+		return 16
+	case DataSize32:
+		return 32
+	case DataSize64:
+		return 64
+	case DataSize128:
+		return 128
+	}
+
+	return wordBits
+}
+
 // type DataType represents any Go type.
 // It's a "sum type" implemented using an interface.
 //
@@ -42,6 +91,17 @@ const (
 // eg. DataTypeSimple{DataTypeKindInt}
 type DataType interface {
 	DataTypeKind() DataTypeKind
+	Size(ts *DataTypeStore) int // size in bytes
+	Alignment() int             // alignment in bytes
+	String() string             // the type as it'd be written in Go
+}
+
+// wordBytes is the number of bytes in a machine word on the target.
+const wordBytes = wordBits / 8
+
+// alignTo rounds offset up to the next multiple of align.
+func alignTo(offset int, align int) int {
+	return (offset + align - 1) / align * align
 }
 
 // type DataTypeBasic is for "basic types" - ie. simple data types which have no sub-type.
@@ -53,6 +113,54 @@ func (dtb DataTypeBasic) DataTypeKind() DataTypeKind {
 	return dtb.kind
 }
 
+func (dtb DataTypeBasic) Size(ts *DataTypeStore) int {
+	switch dtb.kind {
+	case DataTypeKindBool:
+		return 1
+	case DataTypeKindString:
+		// a pointer and a length.
+		return 2 * wordBytes
+	}
+
+	return 0
+}
+
+func (dtb DataTypeBasic) String() string {
+	switch dtb.kind {
+	case DataTypeKindString:
+		return "string"
+	case DataTypeKindBool:
+		return "bool"
+	case DataTypeKindUntypedInt:
+		return "untyped int"
+	case DataTypeKindUntypedFloat:
+		return "untyped float"
+	case DataTypeKindUntypedRune:
+		return "untyped rune"
+	case DataTypeKindUntypedString:
+		return "untyped string"
+	case DataTypeKindUntypedBool:
+		return "untyped bool"
+	case DataTypeKindUntypedNil:
+		return "untyped nil"
+	}
+
+	return "type"
+}
+
+// IsUntyped returns true if this is the type of an untyped constant.
+func (dtb DataTypeBasic) IsUntyped() bool {
+	return dtb.kind >= DataTypeKindUntypedInt && dtb.kind <= DataTypeKindUntypedNil
+}
+
+func (dtb DataTypeBasic) Alignment() int {
+	if dtb.kind == DataTypeKindBool {
+		return 1
+	}
+
+	return wordBytes
+}
+
 // type DataTypeSized is for basic types which have a size - eg. int/int16/int32/int64.
 type DataTypeSized struct {
 	kind DataTypeKind
@@ -63,25 +171,359 @@ func (dts DataTypeSized) DataTypeKind() DataTypeKind {
 	return dts.kind
 }
 
-// type DataTypeUnary is for types which have a single sub-type.
+func (dts DataTypeSized) Size(ts *DataTypeStore) int {
+	return dts.size.Bits() / 8
+}
+
+func (dts DataTypeSized) String() string {
+	var name string
+	switch dts.kind {
+	case DataTypeKindInt:
+		name = "int"
+	case DataTypeKindUint:
+		name = "uint"
+	case DataTypeKindUintptr:
+		return "uintptr"
+	case DataTypeKindFloat:
+		name = "float"
+	case DataTypeKindImaginary:
+		name = "complex"
+	}
+
+	if dts.size == DataSizeDefault {
+		return name
+	}
+
+	return fmt.Sprint(name, dts.size.Bits())
+}
+
+func (dts DataTypeSized) Alignment() int {
+	if dts.kind == DataTypeKindImaginary {
+		// complex numbers are aligned like their real and imaginary parts.
+		return dts.size.Bits() / 16
+	}
+
+	return dts.size.Bits() / 8
+}
+
+// type DataTypeUnary is for types which have a single sub-type - ie. slices
+// and pointers.
 type DataTypeUnary struct {
 	kind    DataTypeKind
-	subType *DataType
+	subType DataType
 }
 
 func (dtu DataTypeUnary) DataTypeKind() DataTypeKind {
 	return dtu.kind
 }
 
+func (dtu DataTypeUnary) Size(ts *DataTypeStore) int {
+	if dtu.kind == DataTypeKindSlice {
+		// a pointer, a length and a capacity.
+		return 3 * wordBytes
+	}
+
+	return wordBytes
+}
+
+func (dtu DataTypeUnary) String() string {
+	if dtu.kind == DataTypeKindSlice {
+		return "[]" + dtu.subType.String()
+	}
+
+	return "*" + dtu.subType.String()
+}
+
+func (dtu DataTypeUnary) Alignment() int {
+	return wordBytes
+}
+
+// type DataTypeArray is a fixed length array of elements.
+type DataTypeArray struct {
+	length      int64
+	elementType DataType
+}
+
+func (dta DataTypeArray) DataTypeKind() DataTypeKind {
+	return DataTypeKindArray
+}
+
+func (dta DataTypeArray) Size(ts *DataTypeStore) int {
+	return int(dta.length) * dta.elementType.Size(ts)
+}
+
+func (dta DataTypeArray) String() string {
+	return fmt.Sprint("[", dta.length, "]", dta.elementType.String())
+}
+
+func (dta DataTypeArray) Alignment() int {
+	return dta.elementType.Alignment()
+}
+
+// type DataTypeChan is a channel which elements are sent on.
+type DataTypeChan struct {
+	dir         ChanDirection
+	elementType DataType
+}
+
+func (dtc DataTypeChan) DataTypeKind() DataTypeKind {
+	return DataTypeKindChan
+}
+
+func (dtc DataTypeChan) Size(ts *DataTypeStore) int {
+	return wordBytes
+}
+
+func (dtc DataTypeChan) String() string {
+	switch dtc.dir {
+	case ChanDirectionIn:
+		return "<-chan " + dtc.elementType.String()
+	case ChanDirectionOut:
+		return "chan<- " + dtc.elementType.String()
+	}
+
+	return "chan " + dtc.elementType.String()
+}
+
+func (dtc DataTypeChan) Alignment() int {
+	return wordBytes
+}
+
+// type DataTypeMap is a map from keys to values.
+type DataTypeMap struct {
+	keyType   DataType
+	valueType DataType
+}
+
+func (dtm DataTypeMap) DataTypeKind() DataTypeKind {
+	return DataTypeKindMap
+}
+
+func (dtm DataTypeMap) Size(ts *DataTypeStore) int {
+	return wordBytes
+}
+
+func (dtm DataTypeMap) String() string {
+	return "map[" + dtm.keyType.String() + "]" + dtm.valueType.String()
+}
+
+func (dtm DataTypeMap) Alignment() int {
+	return wordBytes
+}
+
 // type DataTypeStruct is a compound data type with named fields.
 type DataTypeStruct struct {
-	field map[string]*DataType
+	fields []DataTypeField
 }
 
-func (dtu DataTypeStruct) DataTypeKind() DataTypeKind {
+// type DataTypeField is a single field in a struct.
+type DataTypeField struct {
+	name     string
+	dataType DataType
+	tag      StructTag
+	embedded bool
+}
+
+func (dts DataTypeStruct) DataTypeKind() DataTypeKind {
 	return DataTypeKindStruct
 }
 
+func (dts DataTypeStruct) Size(ts *DataTypeStore) int {
+	size := 0
+	for _, field := range dts.fields {
+		size = alignTo(size, field.dataType.Alignment()) + field.dataType.Size(ts)
+	}
+
+	// pad the end so arrays of this struct stay aligned.
+	return alignTo(size, dts.Alignment())
+}
+
+func (dts DataTypeStruct) String() string {
+	var fields []string
+	for _, field := range dts.fields {
+		var fieldStr string
+		if field.embedded {
+			fieldStr = field.dataType.String()
+		} else {
+			fieldStr = field.name + " " + field.dataType.String()
+		}
+
+		if field.tag != "" {
+			fieldStr += fmt.Sprintf(" %q", field.tag)
+		}
+
+		fields = append(fields, fieldStr)
+	}
+
+	if len(fields) == 0 {
+		return "struct{}"
+	}
+
+	return "struct{ " + strings.Join(fields, "; ") + " }"
+}
+
+func (dts DataTypeStruct) Alignment() int {
+	align := 1
+	for _, field := range dts.fields {
+		if field.dataType.Alignment() > align {
+			align = field.dataType.Alignment()
+		}
+	}
+
+	return align
+}
+
+// FieldOffset returns the byte offset of a field from the start of the struct.
+func (dts DataTypeStruct) FieldOffset(ts *DataTypeStore, fieldIndex int) int {
+	offset := 0
+	for i, field := range dts.fields {
+		offset = alignTo(offset, field.dataType.Alignment())
+		if i == fieldIndex {
+			break
+		}
+
+		offset += field.dataType.Size(ts)
+	}
+
+	return offset
+}
+
+// type DataTypeFunc is a function signature.
+type DataTypeFunc struct {
+	params   []DataType
+	results  []DataType
+	variadic bool // the last parameter is "...T", its type is []T
+}
+
+func (dtf DataTypeFunc) DataTypeKind() DataTypeKind {
+	return DataTypeKindFunc
+}
+
+func (dtf DataTypeFunc) Size(ts *DataTypeStore) int {
+	return wordBytes
+}
+
+func (dtf DataTypeFunc) Alignment() int {
+	return wordBytes
+}
+
+func (dtf DataTypeFunc) String() string {
+	return "func" + dtf.signatureString()
+}
+
+// signatureString renders the parameters and results of a function without
+// the "func".
+func (dtf DataTypeFunc) signatureString() string {
+	var params []string
+	for i, param := range dtf.params {
+		if dtf.variadic && i == len(dtf.params)-1 {
+			params = append(params, "..."+param.(*DataTypeUnary).subType.String())
+		} else {
+			params = append(params, param.String())
+		}
+	}
+
+	sig := "(" + strings.Join(params, ", ") + ")"
+
+	switch len(dtf.results) {
+	case 0:
+		return sig
+	case 1:
+		return sig + " " + dtf.results[0].String()
+	}
+
+	var results []string
+	for _, result := range dtf.results {
+		results = append(results, result.String())
+	}
+
+	return sig + " (" + strings.Join(results, ", ") + ")"
+}
+
+// type DataTypeInterface is a set of methods.
+type DataTypeInterface struct {
+	methods []DataTypeMethod // sorted by name
+}
+
+// type DataTypeMethod is a method in an interface or a method set.
+type DataTypeMethod struct {
+	name            string
+	signature       *DataTypeFunc
+	pointerReceiver bool // true if the receiver is *T rather than T
+}
+
+func (dti DataTypeInterface) DataTypeKind() DataTypeKind {
+	return DataTypeKindInterface
+}
+
+func (dti DataTypeInterface) Size(ts *DataTypeStore) int {
+	// a type and a pointer.
+	return 2 * wordBytes
+}
+
+func (dti DataTypeInterface) Alignment() int {
+	return wordBytes
+}
+
+func (dti DataTypeInterface) String() string {
+	if len(dti.methods) == 0 {
+		return "interface{}"
+	}
+
+	var methods []string
+	for _, method := range dti.methods {
+		methods = append(methods, method.name+method.signature.signatureString())
+	}
+
+	return "interface{ " + strings.Join(methods, "; ") + " }"
+}
+
+// type DataTypeNamed is a type declared with "type". Each declaration makes
+// a new distinct type, even if the underlying types are identical.
+type DataTypeNamed struct {
+	packageName string
+	name        string
+	underlying  DataType
+}
+
+func (dtn DataTypeNamed) DataTypeKind() DataTypeKind {
+	return DataTypeKindNamed
+}
+
+func (dtn DataTypeNamed) Size(ts *DataTypeStore) int {
+	return dtn.underlying.Size(ts)
+}
+
+func (dtn DataTypeNamed) Alignment() int {
+	return dtn.underlying.Alignment()
+}
+
+func (dtn DataTypeNamed) String() string {
+	if dtn.packageName == "" {
+		return dtn.name
+	}
+
+	return dtn.packageName + "." + dtn.name
+}
+
+// Underlying returns the type this named type was declared as.
+func (dtn DataTypeNamed) Underlying() DataType {
+	return Underlying(dtn.underlying)
+}
+
+// Underlying gets the underlying type of any type. For most types this is
+// the type itself.
+func Underlying(dt DataType) DataType {
+	for {
+		named, ok := dt.(*DataTypeNamed)
+		if !ok {
+			return dt
+		}
+
+		dt = named.underlying
+	}
+}
+
 // type DataTypeStore is a store of all the data types in the system. Each
 // unique data type will be stored only once and a reference to it always
 // returns the same pointer so pointer comparison can be used on types.
@@ -90,12 +532,35 @@ type DataTypeStore struct {
 	nameMap      map[string]DataType
 	nameMapMutex sync.RWMutex
 
+	// composite types are interned here, keyed by their value. types which
+	// can't be map keys are keyed by a string made from the identities of
+	// the types inside them instead - two named types can have the same
+	// name so their names won't do.
+	composites      map[DataType]DataType
+	compositeKeys   map[string]DataType
+	typeIDs         map[DataType]int
+	compositesMutex sync.Mutex
+
+	// the methods declared on each named type.
+	methods      map[*DataTypeNamed][]DataTypeMethod
+	methodsMutex sync.RWMutex
+
+	// method sets we've already worked out, keyed by the named type or
+	// the pointer to it. types are interned so the keys are stable.
+	// they're thrown away whenever a method is added.
+	methodSets      map[DataType][]DataTypeMethod
+	methodSetHits   int // how many times the cache has saved us some work.
+	methodSetsMutex sync.Mutex
+
 	// standard types
 	intType    DataType
 	uintType   DataType
 	floatType  DataType
 	runeType   DataType
 	stringType DataType
+	boolType   DataType
+	byteType   DataType
+	errorType  DataType
 }
 
 // NewDataTypeStore creates a new data type store.
@@ -105,22 +570,92 @@ func NewDataTypeStore() *DataTypeStore {
 	// add the predefined data types
 	ts.intType = DataTypeSized{DataTypeKindInt, DataSizeDefault}
 	ts.uintType = DataTypeSized{DataTypeKindUint, DataSizeDefault}
-	ts.floatType = DataTypeSized{DataTypeKindFloat, DataSizeDefault}
-	ts.runeType = DataTypeBasic{DataTypeKindRune}
+	ts.floatType = DataTypeSized{DataTypeKindFloat, DataSize64}
+	ts.runeType = DataTypeSized{DataTypeKindInt, DataSize32}
 	ts.stringType = DataTypeBasic{DataTypeKindString}
+	ts.boolType = DataTypeBasic{DataTypeKindBool}
+	ts.byteType = DataTypeSized{DataTypeKindUint, DataSize8}
+
+	ts.composites = make(map[DataType]DataType)
+	ts.compositeKeys = make(map[string]DataType)
+	ts.typeIDs = make(map[DataType]int)
+	ts.methods = make(map[*DataTypeNamed][]DataTypeMethod)
+	ts.methodSets = make(map[DataType][]DataTypeMethod)
+
+	// error is a predeclared named interface type.
+	errorMethod := DataTypeMethod{"Error", ts.MakeFunc(nil, []DataType{ts.stringType}, false), false}
+	ts.errorType = ts.MakeNamed("", "error", ts.MakeInterface([]DataTypeMethod{errorMethod}))
 
 	ts.nameMapMutex.Lock()
 	ts.nameMap = make(map[string]DataType)
 	ts.nameMap["int"] = ts.intType
+	ts.nameMap["int8"] = DataTypeSized{DataTypeKindInt, DataSize8}
+	ts.nameMap["int16"] = DataTypeSized{DataTypeKindInt, DataSize16}
+	ts.nameMap["int32"] = ts.runeType
+	ts.nameMap["int64"] = DataTypeSized{DataTypeKindInt, DataSize64}
 	ts.nameMap["uint"] = ts.uintType
-	ts.nameMap["float"] = ts.floatType
-	ts.nameMap["rune"] = ts.runeType
+	ts.nameMap["uint8"] = ts.byteType
+	ts.nameMap["uint16"] = DataTypeSized{DataTypeKindUint, DataSize16}
+	ts.nameMap["uint32"] = DataTypeSized{DataTypeKindUint, DataSize32}
+	ts.nameMap["uint64"] = DataTypeSized{DataTypeKindUint, DataSize64}
+	ts.nameMap["uintptr"] = DataTypeSized{DataTypeKindUintptr, DataSizeDefault}
+	ts.nameMap["float32"] = DataTypeSized{DataTypeKindFloat, DataSize32}
+	ts.nameMap["float64"] = ts.floatType
+	ts.nameMap["complex64"] = DataTypeSized{DataTypeKindImaginary, DataSize64}
+	ts.nameMap["complex128"] = DataTypeSized{DataTypeKindImaginary, DataSize128}
 	ts.nameMap["string"] = ts.stringType
+	ts.nameMap["bool"] = ts.boolType
+	ts.nameMap["error"] = ts.errorType
+
+	// byte and rune are aliases - they're identical to uint8 and int32.
+	ts.nameMap["byte"] = ts.byteType
+	ts.nameMap["rune"] = ts.runeType
 	ts.nameMapMutex.Unlock()
 
 	return ts
 }
 
+// Lookup finds a data type by name. It returns nil if there's no such type.
+func (ts *DataTypeStore) Lookup(name string) DataType {
+	ts.nameMapMutex.RLock()
+	defer ts.nameMapMutex.RUnlock()
+
+	return ts.nameMap[name]
+}
+
+// PredeclaredTypes gets all the predeclared types by name.
+func (ts *DataTypeStore) PredeclaredTypes() map[string]DataType {
+	ts.nameMapMutex.RLock()
+	defer ts.nameMapMutex.RUnlock()
+
+	types := make(map[string]DataType)
+	for name, dt := range ts.nameMap {
+		types[name] = dt
+	}
+
+	return types
+}
+
+// methods to get the types of untyped constants.
+func (ts *DataTypeStore) UntypedIntType() DataType {
+	return DataTypeBasic{DataTypeKindUntypedInt}
+}
+func (ts *DataTypeStore) UntypedFloatType() DataType {
+	return DataTypeBasic{DataTypeKindUntypedFloat}
+}
+func (ts *DataTypeStore) UntypedRuneType() DataType {
+	return DataTypeBasic{DataTypeKindUntypedRune}
+}
+func (ts *DataTypeStore) UntypedStringType() DataType {
+	return DataTypeBasic{DataTypeKindUntypedString}
+}
+func (ts *DataTypeStore) UntypedBoolType() DataType {
+	return DataTypeBasic{DataTypeKindUntypedBool}
+}
+func (ts *DataTypeStore) UntypedNilType() DataType {
+	return DataTypeBasic{DataTypeKindUntypedNil}
+}
+
 // methods to get all the predefined types.
 func (ts *DataTypeStore) IntType() DataType {
 	return ts.intType
@@ -137,16 +672,444 @@ func (ts *DataTypeStore) RuneType() DataType {
 func (ts *DataTypeStore) StringType() DataType {
 	return ts.stringType
 }
+func (ts *DataTypeStore) BoolType() DataType {
+	return ts.boolType
+}
+func (ts *DataTypeStore) ByteType() DataType {
+	return ts.byteType
+}
+func (ts *DataTypeStore) ErrorType() DataType {
+	return ts.errorType
+}
 
-// methods to create types from other types
-func (ts *DataTypeStore) MakeSlice(subType DataType) DataType {
-	return nil
+// methods to create types from other types. each of these returns the
+// same DataType every time it's called with the same parameters.
+func (ts *DataTypeStore) MakeSlice(elementType DataType) DataType {
+	key := DataTypeUnary{DataTypeKindSlice, elementType}
+	return ts.intern(key, &key)
 }
 
-func (ts *DataTypeStore) MakeArray(arrayLength AST, subType DataType) DataType {
-	return nil
+func (ts *DataTypeStore) MakePointer(elementType DataType) DataType {
+	key := DataTypeUnary{DataTypeKindPointer, elementType}
+	return ts.intern(key, &key)
+}
+
+func (ts *DataTypeStore) MakeArray(length int64, elementType DataType) DataType {
+	key := DataTypeArray{length, elementType}
+	return ts.intern(key, &key)
 }
 
-func (ts *DataTypeStore) MakeASTType(ast AST) DataType {
+func (ts *DataTypeStore) MakeChan(dir ChanDirection, elementType DataType) DataType {
+	key := DataTypeChan{dir, elementType}
+	return ts.intern(key, &key)
+}
+
+func (ts *DataTypeStore) MakeMap(keyType DataType, valueType DataType) DataType {
+	key := DataTypeMap{keyType, valueType}
+	return ts.intern(key, &key)
+}
+
+func (ts *DataTypeStore) MakeStruct(fields []DataTypeField) DataType {
+	dt := &DataTypeStruct{fields}
+	return ts.internByKey(dt)
+}
+
+func (ts *DataTypeStore) MakeFunc(params []DataType, results []DataType, variadic bool) *DataTypeFunc {
+	dt := &DataTypeFunc{params, results, variadic}
+	return ts.internByKey(dt).(*DataTypeFunc)
+}
+
+func (ts *DataTypeStore) MakeInterface(methods []DataTypeMethod) *DataTypeInterface {
+	sorted := make([]DataTypeMethod, len(methods))
+	copy(sorted, methods)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	dt := &DataTypeInterface{sorted}
+	return ts.internByKey(dt).(*DataTypeInterface)
+}
+
+// MakeNamed creates a new named type. Unlike other types named types aren't
+// interned - every call creates a different type.
+func (ts *DataTypeStore) MakeNamed(packageName string, name string, underlying DataType) *DataTypeNamed {
+	return &DataTypeNamed{packageName, name, underlying}
+}
+
+// AddMethod adds a method to a named type. It returns false if the type
+// already has a method with that name.
+func (ts *DataTypeStore) AddMethod(named *DataTypeNamed, name string, signature *DataTypeFunc, pointerReceiver bool) bool {
+	ts.methodsMutex.Lock()
+	defer ts.methodsMutex.Unlock()
+
+	for _, method := range ts.methods[named] {
+		if method.name == name {
+			return false
+		}
+	}
+
+	ts.methods[named] = append(ts.methods[named], DataTypeMethod{name, signature, pointerReceiver})
+
+	// any method sets we've worked out might be missing this one now.
+	ts.methodSetsMutex.Lock()
+	ts.methodSets = make(map[DataType][]DataTypeMethod)
+	ts.methodSetsMutex.Unlock()
+
+	return true
+}
+
+// MethodSet gets all the methods which can be called on a type. Methods
+// with pointer receivers are only in the method set of a pointer to the
+// type, not the type itself.
+func (ts *DataTypeStore) MethodSet(dt DataType) []DataTypeMethod {
+	key := dt
+	pointer := false
+	if ptr, ok := dt.(*DataTypeUnary); ok && ptr.kind == DataTypeKindPointer {
+		dt = ptr.subType
+		pointer = true
+	}
+
+	switch t := dt.(type) {
+	case *DataTypeNamed:
+		if iface, ok := Underlying(t).(*DataTypeInterface); ok {
+			if pointer {
+				// pointers to interfaces don't have any methods.
+				return nil
+			}
+
+			return iface.methods
+		}
+
+		ts.methodsMutex.RLock()
+		defer ts.methodsMutex.RUnlock()
+
+		ts.methodSetsMutex.Lock()
+		defer ts.methodSetsMutex.Unlock()
+
+		if methods, ok := ts.methodSets[key]; ok {
+			ts.methodSetHits++
+			return methods
+		}
+
+		var methods []DataTypeMethod
+		for _, method := range ts.methods[t] {
+			if pointer || !method.pointerReceiver {
+				methods = append(methods, method)
+			}
+		}
+
+		ts.methodSets[key] = methods
+		return methods
+
+	case *DataTypeInterface:
+		if !pointer {
+			return t.methods
+		}
+	}
+
 	return nil
 }
+
+// intern returns the stored version of a composite data type. If this is
+// the first time we've seen the type, dt is stored and returned.
+func (ts *DataTypeStore) intern(key DataType, dt DataType) DataType {
+	ts.compositesMutex.Lock()
+	defer ts.compositesMutex.Unlock()
+
+	stored, ok := ts.composites[key]
+	if ok {
+		return stored
+	}
+
+	ts.composites[key] = dt
+	return dt
+}
+
+// internByKey is like intern but for types which can't be map keys.
+func (ts *DataTypeStore) internByKey(dt DataType) DataType {
+	ts.compositesMutex.Lock()
+	defer ts.compositesMutex.Unlock()
+
+	key := ts.compositeKey(dt)
+	stored, ok := ts.compositeKeys[key]
+	if ok {
+		return stored
+	}
+
+	ts.compositeKeys[key] = dt
+	return dt
+}
+
+// compositeKey makes a key for a struct, func or interface type which is
+// the same for identical types. the types inside it are represented by
+// their IDs. compositesMutex must be held.
+func (ts *DataTypeStore) compositeKey(dt DataType) string {
+	var sb strings.Builder
+	switch t := dt.(type) {
+	case *DataTypeStruct:
+		sb.WriteString("struct")
+		for _, field := range t.fields {
+			fmt.Fprintf(&sb, " %q %v %q %d", field.name, field.embedded, field.tag, ts.typeID(field.dataType))
+		}
+
+	case *DataTypeFunc:
+		fmt.Fprint(&sb, "func ", t.variadic)
+		for _, param := range t.params {
+			fmt.Fprint(&sb, " ", ts.typeID(param))
+		}
+
+		sb.WriteString(" results")
+		for _, result := range t.results {
+			fmt.Fprint(&sb, " ", ts.typeID(result))
+		}
+
+	case *DataTypeInterface:
+		sb.WriteString("interface")
+		for _, method := range t.methods {
+			fmt.Fprintf(&sb, " %q %d", method.name, ts.typeID(method.signature))
+		}
+	}
+
+	return sb.String()
+}
+
+// typeID gets a number which identifies a type. interned types are the
+// same value whenever they're identical so they get the same number.
+// compositesMutex must be held.
+func (ts *DataTypeStore) typeID(dt DataType) int {
+	id, ok := ts.typeIDs[dt]
+	if !ok {
+		id = len(ts.typeIDs)
+		ts.typeIDs[dt] = id
+	}
+
+	return id
+}
+
+// FromAST converts a data type's AST into a DataType. Type names are
+// looked up in the given scope first, then in the predeclared types. The
+// scope can be nil if there are no declared types.
+func (ts *DataTypeStore) FromAST(filename string, ast AST, scope *SymbolTable) (DataType, error) {
+	return ts.fromAST(filename, ast, scopeLookup(scope))
+}
+
+// scopeLookup makes a function which looks up unqualified type names in
+// a scope, for use with fromAST().
+func scopeLookup(scope *SymbolTable) func(ident *ASTIdentifier) *Symbol {
+	return func(ident *ASTIdentifier) *Symbol {
+		if scope == nil || ident.packageName != "" {
+			return nil
+		}
+
+		return scope.Lookup(ident.name)
+	}
+}
+
+// fromAST converts a data type's AST into a DataType, using a function
+// to find what each type name refers to. The function returns nil if
+// it doesn't know the name.
+func (ts *DataTypeStore) fromAST(filename string, ast AST, lookup func(ident *ASTIdentifier) *Symbol) (DataType, error) {
+	switch a := ast.(type) {
+	case *ASTIdentifier:
+		sym := lookup(a)
+		if sym != nil {
+			if sym.kind != SymbolKindType {
+				return nil, NewError(filename, a.pos, fmt.Sprint("'", a.name, "' isn't a type"))
+			}
+
+			return sym.dataType, nil
+		}
+
+		if a.packageName != "" {
+			return nil, NewError(filename, a.pos, fmt.Sprint("I don't know about the type ", a.packageName, ".", a.name, " yet"))
+		}
+
+		dt := ts.Lookup(a.name)
+		if dt == nil {
+			return nil, NewError(filename, a.pos, fmt.Sprint("'", a.name, "' isn't a type I know about"))
+		}
+
+		return dt, nil
+
+	case *ASTDataTypeSlice:
+		elementType, err := ts.fromAST(filename, a.elementType, lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		return ts.MakeSlice(elementType), nil
+
+	case *ASTDataTypePointer:
+		elementType, err := ts.fromAST(filename, a.elementType, lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		return ts.MakePointer(elementType), nil
+
+	case *ASTDataTypeArray:
+		length, err := ts.arrayLength(filename, a.arraySize, lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		elementType, err := ts.fromAST(filename, a.elementType, lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		return ts.MakeArray(length, elementType), nil
+
+	case *ASTDataTypeChan:
+		elementType, err := ts.fromAST(filename, a.elementType, lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		return ts.MakeChan(a.dir, elementType), nil
+
+	case *ASTDataTypeMap:
+		keyType, err := ts.fromAST(filename, a.keyType, lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		if !Comparable(keyType) {
+			return nil, NewError(filename, a.keyType.Pos(), fmt.Sprint("a ", keyType, " can't be a map key since it can't be compared with '=='"))
+		}
+
+		valueType, err := ts.fromAST(filename, a.valueType, lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		return ts.MakeMap(keyType, valueType), nil
+
+	case *ASTDataTypeStruct:
+		var fields []DataTypeField
+		for _, fieldAST := range a.fields {
+			field := fieldAST.(*ASTDataTypeField)
+			fieldType, err := ts.fromAST(filename, field.typ, lookup)
+			if err != nil {
+				return nil, err
+			}
+
+			if field.identifier != nil {
+				fields = append(fields, DataTypeField{field.identifier.(*ASTIdentifier).name, fieldType, field.tag, false})
+			} else {
+				// embedded fields are named after their type.
+				fields = append(fields, DataTypeField{embeddedFieldName(field.typ), fieldType, field.tag, true})
+			}
+		}
+
+		return ts.MakeStruct(fields), nil
+
+	case *ASTDataTypeFunc:
+		dt, err := ts.funcFromAST(filename, a.params, a.returns, lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		return dt, nil
+
+	case *ASTDataTypeInterface:
+		var methods []DataTypeMethod
+		for _, methodAST := range a.methods {
+			method, ok := methodAST.(*ASTDataTypeMethodSpec)
+			if !ok {
+				return nil, NewError(filename, methodAST.Pos(), "I can't embed interfaces in interfaces yet")
+			}
+
+			signature, err := ts.funcFromAST(filename, method.params, method.returns, lookup)
+			if err != nil {
+				return nil, err
+			}
+
+			methods = append(methods, DataTypeMethod{method.name, signature, false})
+		}
+
+		return ts.MakeInterface(methods), nil
+	}
+
+	return nil, NewError(filename, ast.Pos(), "I don't know how to make this kind of data type yet")
+}
+
+// arrayLength works out the length of an array type. It has to be a
+// constant integer which isn't negative.
+func (ts *DataTypeStore) arrayLength(filename string, lengthAST AST, lookup func(ident *ASTIdentifier) *Symbol) (int64, error) {
+	if _, ok := lengthAST.(*ASTEllipsis); ok {
+		// "[...]T" gets its length from a composite literal.
+		return 0, NewError(filename, lengthAST.Pos(), "I can only work out the length of a [...] array from its composite literal")
+	}
+
+	val, err := evalConst(filename, lengthAST, lookup, ts)
+	if err != nil {
+		return 0, err
+	}
+
+	length, ok := constInt(val)
+	if !ok || !isInteger(val.DataType(ts)) && val.DataType(ts).DataTypeKind() != DataTypeKindUntypedFloat {
+		return 0, NewError(filename, lengthAST.Pos(), "array lengths have to be whole numbers")
+	}
+
+	if length.Sign() < 0 {
+		return 0, NewError(filename, lengthAST.Pos(), "array lengths can't be negative")
+	}
+
+	if !length.IsInt64() {
+		return 0, NewError(filename, lengthAST.Pos(), "this array is way too big")
+	}
+
+	return length.Int64(), nil
+}
+
+// funcFromAST makes a function data type from its parameters and results.
+func (ts *DataTypeStore) funcFromAST(filename string, paramASTs []AST, resultASTs []AST, lookup func(ident *ASTIdentifier) *Symbol) (*DataTypeFunc, error) {
+	var params []DataType
+	variadic := false
+	for _, paramAST := range paramASTs {
+		param := paramAST.(*ASTParameterDecl)
+		paramType, err := ts.paramFromAST(filename, param, lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		variadic = param.ellipsis != nil
+		params = append(params, paramType)
+	}
+
+	var results []DataType
+	for _, resultAST := range resultASTs {
+		result := resultAST.(*ASTParameterDecl)
+		resultType, err := ts.fromAST(filename, result.typ, lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, resultType)
+	}
+
+	return ts.MakeFunc(params, results, variadic), nil
+}
+
+// paramFromAST gets the type a parameter has inside its function. The
+// AST of a "...T" parameter has the element type T but the parameter is
+// really a []T.
+func (ts *DataTypeStore) paramFromAST(filename string, param *ASTParameterDecl, lookup func(ident *ASTIdentifier) *Symbol) (DataType, error) {
+	paramType, err := ts.fromAST(filename, param.typ, lookup)
+	if err != nil || param.ellipsis == nil {
+		return paramType, err
+	}
+
+	return ts.MakeSlice(paramType), nil
+}
+
+// embeddedFieldName gets the name of an embedded field from its type.
+func embeddedFieldName(typ AST) string {
+	switch t := typ.(type) {
+	case *ASTIdentifier:
+		return t.name
+	case *ASTDataTypePointer:
+		return embeddedFieldName(t.elementType)
+	}
+
+	return ""
+}
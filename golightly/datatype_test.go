@@ -0,0 +1,311 @@
+package golightly
+
+import (
+	"strings"
+	"testing"
+)
+
+// resolveTestType parses a data type and converts it to a DataType.
+func resolveTestType(t *testing.T, ts *DataTypeStore, src string) DataType {
+	parser := setupDataTypeTest(src)
+	match, ast, err := parser.parseDataType()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+	if !match {
+		t.Fatal("doesn't match a data type: ", src)
+	}
+
+	dt, err := ts.FromAST("test.go", ast, nil)
+	if err != nil {
+		t.Fatal("error resolving type: ", err)
+	}
+
+	return dt
+}
+
+func TestDataTypeAliases(t *testing.T) {
+	ts := NewDataTypeStore()
+
+	uint8Type := DataTypeSized{DataTypeKindUint, DataSize8}
+	int32Type := DataTypeSized{DataTypeKindInt, DataSize32}
+
+	if resolveTestType(t, ts, "byte") != uint8Type || ts.Lookup("uint8") != uint8Type {
+		t.Error("byte isn't the same type as uint8")
+	}
+	if resolveTestType(t, ts, "rune") != int32Type || ts.Lookup("int32") != int32Type {
+		t.Error("rune isn't the same type as int32")
+	}
+	if resolveTestType(t, ts, "[]byte") != ts.MakeSlice(uint8Type) {
+		t.Error("[]byte isn't the same type as []uint8")
+	}
+	if resolveTestType(t, ts, "[]byte") == resolveTestType(t, ts, "[]rune") {
+		t.Error("[]byte shouldn't be the same type as []rune")
+	}
+}
+
+func TestDataTypeUnknown(t *testing.T) {
+	ts := NewDataTypeStore()
+	parser := setupDataTypeTest("wibble")
+	_, ast, err := parser.parseDataType()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	_, err = ts.FromAST("test.go", ast, nil)
+	if err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
+
+func TestDataTypePredeclared(t *testing.T) {
+	ts := NewDataTypeStore()
+
+	expected := map[string]DataType{
+		"int":        DataTypeSized{DataTypeKindInt, DataSizeDefault},
+		"int8":       DataTypeSized{DataTypeKindInt, DataSize8},
+		"int16":      DataTypeSized{DataTypeKindInt, DataSize16},
+		"int32":      DataTypeSized{DataTypeKindInt, DataSize32},
+		"int64":      DataTypeSized{DataTypeKindInt, DataSize64},
+		"uint":       DataTypeSized{DataTypeKindUint, DataSizeDefault},
+		"uint8":      DataTypeSized{DataTypeKindUint, DataSize8},
+		"uint16":     DataTypeSized{DataTypeKindUint, DataSize16},
+		"uint32":     DataTypeSized{DataTypeKindUint, DataSize32},
+		"uint64":     DataTypeSized{DataTypeKindUint, DataSize64},
+		"uintptr":    DataTypeSized{DataTypeKindUintptr, DataSizeDefault},
+		"float32":    DataTypeSized{DataTypeKindFloat, DataSize32},
+		"float64":    DataTypeSized{DataTypeKindFloat, DataSize64},
+		"complex64":  DataTypeSized{DataTypeKindImaginary, DataSize64},
+		"complex128": DataTypeSized{DataTypeKindImaginary, DataSize128},
+		"string":     DataTypeBasic{DataTypeKindString},
+		"bool":       DataTypeBasic{DataTypeKindBool},
+	}
+
+	for name, dt := range expected {
+		if ts.Lookup(name) != dt {
+			t.Errorf("%s resolved to %v, expected %v", name, ts.Lookup(name), dt)
+		}
+	}
+
+	if ts.Lookup("float") != nil {
+		t.Error("float isn't a Go type")
+	}
+}
+
+func TestDataSizeBits(t *testing.T) {
+	sizes := []struct {
+		size DataSize
+		bits int
+	}{
+		{DataSize8, 8},
+		{DataSize16, 16},
+		{DataSize32, 32},
+		{DataSize64, 64},
+		{DataSize128, 128},
+		{DataSizeDefault, wordBits},
+	}
+
+	for _, s := range sizes {
+		if s.size.Bits() != s.bits {
+			t.Errorf("size %d has %d bits, expected %d", s.size, s.size.Bits(), s.bits)
+		}
+	}
+}
+
+func TestDataTypeSize(t *testing.T) {
+	ts := NewDataTypeStore()
+
+	sizes := []struct {
+		src   string
+		size  int
+		align int
+	}{
+		{"bool", 1, 1},
+		{"int", 8, 8},
+		{"rune", 4, 4},
+		{"string", 16, 8},
+		{"*int", 8, 8},
+		{"[]byte", 24, 8},
+		{"chan int", 8, 8},
+		{"[3]rune", 12, 4},
+		{"struct { a byte; b int; c bool; }", 24, 8},
+		{"struct { a bool; b rune; c byte; }", 12, 4},
+		{"struct { a string; b []int; }", 40, 8},
+	}
+
+	for _, s := range sizes {
+		dt := resolveTestType(t, ts, s.src)
+		if dt.Size(ts) != s.size || dt.Alignment() != s.align {
+			t.Errorf("%s has size %d align %d, expected size %d align %d", s.src, dt.Size(ts), dt.Alignment(), s.size, s.align)
+		}
+	}
+
+	mapType := ts.MakeMap(ts.StringType(), ts.IntType())
+	if mapType.Size(ts) != 8 || mapType.Alignment() != 8 {
+		t.Errorf("map has size %d align %d, expected size 8 align 8", mapType.Size(ts), mapType.Alignment())
+	}
+}
+
+func TestDataTypeFieldOffset(t *testing.T) {
+	ts := NewDataTypeStore()
+	dt := resolveTestType(t, ts, "struct { a byte; b int; c bool; }").(*DataTypeStruct)
+
+	offsets := []int{0, 8, 16}
+	for i, offset := range offsets {
+		if dt.FieldOffset(ts, i) != offset {
+			t.Errorf("field %d is at offset %d, expected %d", i, dt.FieldOffset(ts, i), offset)
+		}
+	}
+}
+
+func TestDataTypeString(t *testing.T) {
+	ts := NewDataTypeStore()
+
+	types := []string{
+		"int",
+		"*string",
+		"[]byte",
+		"[4]rune",
+		"[][]*bool",
+		"func(a int, b string) bool",
+		"func(s string) (n int, err error)",
+		"interface{}",
+		"interface{ Read(p []byte) (n int, err error); Close() error; }",
+		"struct{}",
+		"struct{ a int; b []string; }",
+	}
+
+	expected := []string{
+		"int",
+		"*string",
+		"[]uint8",
+		"[4]int32",
+		"[][]*bool",
+		"func(int, string) bool",
+		"func(string) (int, error)",
+		"interface{}",
+		"interface{ Close() error; Read([]uint8) (int, error) }",
+		"struct{}",
+		"struct{ a int; b []string }",
+	}
+
+	for i, src := range types {
+		str := resolveTestType(t, ts, src).String()
+		if str != expected[i] {
+			t.Errorf("%s rendered as %s, expected %s", src, str, expected[i])
+		}
+	}
+
+	mapType := ts.MakeMap(ts.StringType(), ts.MakeSlice(ts.IntType()))
+	if mapType.String() != "map[string][]int" {
+		t.Errorf("map rendered as %s", mapType.String())
+	}
+
+	chanType := ts.MakeChan(ChanDirectionBi, ts.IntType())
+	if chanType.String() != "chan int" {
+		t.Errorf("channel rendered as %s", chanType.String())
+	}
+
+	chanType = ts.MakeChan(ChanDirectionIn, ts.IntType())
+	if chanType.String() != "<-chan int" {
+		t.Errorf("receive channel rendered as %s", chanType.String())
+	}
+
+	chanType = ts.MakeChan(ChanDirectionOut, ts.IntType())
+	if chanType.String() != "chan<- int" {
+		t.Errorf("send channel rendered as %s", chanType.String())
+	}
+}
+
+func TestDataTypeInterned(t *testing.T) {
+	ts := NewDataTypeStore()
+
+	if resolveTestType(t, ts, "struct{ a int; }") != resolveTestType(t, ts, "struct{ a int; }") {
+		t.Error("identical structs should be the same type")
+	}
+	if resolveTestType(t, ts, "func(a int) bool") != resolveTestType(t, ts, "func(b int) bool") {
+		t.Error("identical signatures should be the same type")
+	}
+}
+
+func TestDataTypeInternedNamed(t *testing.T) {
+	// two types can both be called "main.T" without being the same type,
+	// so types made from them mustn't be the same either.
+	ts := NewDataTypeStore()
+	t1 := ts.MakeNamed("main", "T", ts.IntType())
+	t2 := ts.MakeNamed("main", "T", ts.IntType())
+
+	if ts.MakeStruct([]DataTypeField{{"a", t1, "", false}}) == ts.MakeStruct([]DataTypeField{{"a", t2, "", false}}) {
+		t.Error("structs with different field types should be different types")
+	}
+	if ts.MakeFunc([]DataType{t1}, nil, false) == ts.MakeFunc([]DataType{t2}, nil, false) {
+		t.Error("signatures with different parameter types should be different types")
+	}
+
+	m1 := []DataTypeMethod{{"M", ts.MakeFunc(nil, []DataType{t1}, false), false}}
+	m2 := []DataTypeMethod{{"M", ts.MakeFunc(nil, []DataType{t2}, false), false}}
+	if ts.MakeInterface(m1) == ts.MakeInterface(m2) {
+		t.Error("interfaces with different method types should be different types")
+	}
+
+	if ts.MakeStruct([]DataTypeField{{"a", t1, "", false}}) != ts.MakeStruct([]DataTypeField{{"a", t1, "", false}}) {
+		t.Error("structs with the same field types should be the same type")
+	}
+	if ts.MakeFunc([]DataType{t1}, nil, false) == ts.MakeFunc([]DataType{t1}, nil, true) {
+		t.Error("a variadic signature should be a different type")
+	}
+}
+
+func TestDataTypeArrayLength(t *testing.T) {
+	cases := []struct {
+		src string
+		err string
+	}{
+		{"var a [3]int;", ""},
+		{"const n = 2; var a [n * 2]int;", ""},
+		{"var a [-1]int;", "test.go:2: array lengths can't be negative"},
+		{"var a [1.5]int;", "test.go:2: array lengths have to be whole numbers"},
+		{"var a [\"x\"]int;", "test.go:2: array lengths have to be whole numbers"},
+		{"var x int; var a [x]int;", "test.go:2: not a constant expression"},
+	}
+
+	for _, c := range cases {
+		compiler := NewCompiler()
+		err := compiler.CompileSource("test.go", strings.NewReader("package main;\n"+c.src))
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("'%s' gave an error: %v", c.src, err)
+			}
+		} else if err == nil || err.Error() != c.err {
+			t.Errorf("'%s' gave error '%v', expected '%s'", c.src, err, c.err)
+		}
+	}
+}
+
+func TestDataTypeMapKeys(t *testing.T) {
+	cases := []struct {
+		src string
+		err string
+	}{
+		{"var m map[string]int;", ""},
+		{"var m map[[2]int]bool;", ""},
+		{"var m map[*int]bool;", ""},
+		{"var m map[[]byte]int;", "test.go:2: a []uint8 can't be a map key since it can't be compared with '=='"},
+		{"var m map[map[int]int]int;", "test.go:2: a map[int]int can't be a map key since it can't be compared with '=='"},
+		{"var m map[[2]func()]int;", "test.go:2: a [2]func() can't be a map key since it can't be compared with '=='"},
+		{"var m map[struct { a int; b []int; }]int;", "test.go:2: a struct{ a int; b []int } can't be a map key since it can't be compared with '=='"},
+		{"type K []int; var m map[K]int;", "test.go:2: a main.K can't be a map key since it can't be compared with '=='"},
+	}
+
+	for _, c := range cases {
+		compiler := NewCompiler()
+		err := compiler.CompileSource("test.go", strings.NewReader("package main;\n"+c.src))
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("'%s' gave an error: %v", c.src, err)
+			}
+		} else if err == nil || err.Error() != c.err {
+			t.Errorf("'%s' gave error '%v', expected '%s'", c.src, err, c.err)
+		}
+	}
+}
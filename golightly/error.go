@@ -1,14 +1,35 @@
 package golightly
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+// type Severity says how bad a problem is.
+type Severity int
+
+const (
+	SeverityError   Severity = iota // compilation can't work.
+	SeverityWarning                 // it looks wrong but compilation can carry on.
+)
 
 type Error struct {
-	filename string
-	pos      SrcSpan
-	message  string
+	filename   string
+	pos        SrcSpan
+	message    string
+	severity   Severity
+	sourceLine string // the line of source the error's on, if we've got it.
+	haveSource bool   // true if sourceLine has been set.
 }
 
+// NewError creates an error at a position in a file. If a "//line"
+// comment has said the position's really in another file that's where
+// the error is reported.
 func NewError(filename string, pos SrcSpan, message string) *Error {
+	if pos.file != "" {
+		filename = pos.file
+	}
+
 	e := new(Error)
 	e.filename = filename
 	e.pos = pos
@@ -17,6 +38,118 @@ func NewError(filename string, pos SrcSpan, message string) *Error {
 	return e
 }
 
+// NewWarning creates an Error which is only a warning.
+func NewWarning(filename string, pos SrcSpan, message string) *Error {
+	e := NewError(filename, pos, message)
+	e.severity = SeverityWarning
+
+	return e
+}
+
+// Severity says whether it's a real error or just a warning.
+func (e *Error) Severity() Severity {
+	return e.severity
+}
+
 func (e *Error) Error() string {
 	return fmt.Sprint(e.filename, ":", e.pos.start.Line, ": ", e.message)
 }
+
+// AttachSource finds the line the error's on in the file's source and
+// keeps it so Detail() can show it.
+func (e *Error) AttachSource(src string) {
+	lines := strings.Split(src, "\n")
+	line := e.pos.start.Line
+	if line < 1 || line > len(lines) {
+		return
+	}
+
+	e.sourceLine = strings.TrimRight(lines[line-1], "\r")
+	e.haveSource = true
+}
+
+// Detail gives the error along with the line of source it's on and a
+// caret pointing at the column where it happened. If AttachSource()
+// hasn't been called it's just the same as Error(). The column has to
+// have been counted with a tab width of 1, but tabs before the caret are
+// kept so it lines up however wide tabs are shown.
+func (e *Error) Detail() string {
+	if !e.haveSource {
+		return e.Error()
+	}
+
+	var caret strings.Builder
+	for i, ch := range []rune(e.sourceLine) {
+		if i >= e.pos.start.Column-1 {
+			break
+		}
+
+		if ch == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+
+	return fmt.Sprint(e.Error(), "\n", e.sourceLine, "\n", caret.String())
+}
+
+// type ErrorList is a list of errors. It's an error itself so it can be
+// returned wherever one error could be.
+type ErrorList []error
+
+func (el ErrorList) Error() string {
+	var msgs []string
+	for _, err := range el {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// Errors gets just the real errors in the list, leaving out warnings.
+// Errors which aren't an *Error are always real errors.
+func (el ErrorList) Errors() ErrorList {
+	var errs ErrorList
+	for _, err := range el {
+		if !isWarning(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// Warnings gets just the warnings in the list.
+func (el ErrorList) Warnings() ErrorList {
+	var warnings ErrorList
+	for _, err := range el {
+		if isWarning(err) {
+			warnings = append(warnings, err)
+		}
+	}
+
+	return warnings
+}
+
+// HasErrors returns true if there's anything worse than a warning in the
+// list.
+func (el ErrorList) HasErrors() bool {
+	return len(el.Errors()) > 0
+}
+
+// isWarning returns true if the error is only a warning.
+func isWarning(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.severity == SeverityWarning
+}
+
+// first gets the first error in the list, or nil if it's empty.
+func (el ErrorList) first() error {
+	if len(el) == 0 {
+		return nil
+	}
+
+	return el[0]
+}
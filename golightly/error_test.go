@@ -0,0 +1,33 @@
+package golightly
+
+import (
+	"testing"
+)
+
+func TestErrorDetail(t *testing.T) {
+	cases := []struct {
+		src    string
+		detail string
+	}{
+		{"package main;\nvar a = );\n", "test.go:2: bad expression. bad.\nvar a = );\n        ^"},
+		{"package main;\r\n\t\tvar a = );\r\n", "test.go:2: bad expression. bad.\n\t\tvar a = );\n\t\t        ^"},
+	}
+
+	for _, c := range cases {
+		err := parseTestSource(c.src)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("'%s' should have given an *Error, got %v", c.src, err)
+			continue
+		}
+
+		if e.Detail() != e.Error() {
+			t.Errorf("without the source Detail() should just be the error, got '%s'", e.Detail())
+		}
+
+		e.AttachSource(c.src)
+		if e.Detail() != c.detail {
+			t.Errorf("'%s' gave detail:\n%s\nexpected:\n%s", c.src, e.Detail(), c.detail)
+		}
+	}
+}
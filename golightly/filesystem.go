@@ -0,0 +1,15 @@
+package golightly
+
+import (
+	"io/fs"
+	"os"
+)
+
+// type osFileSystem is the default file system used by the compiler. It
+// opens files from the operating system's file system using the paths
+// as given, so unlike os.DirFS it accepts absolute and relative paths.
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
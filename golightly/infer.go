@@ -0,0 +1,1257 @@
+package golightly
+
+import "fmt"
+
+// operatorNames are how operators are written in the source, for error
+// messages.
+var operatorNames = map[TokenKind]string{
+	TokenKindAdd:               "+",
+	TokenKindSubtract:          "-",
+	TokenKindAsterisk:          "*",
+	TokenKindDivide:            "/",
+	TokenKindModulus:           "%",
+	TokenKindBitwiseAnd:        "&",
+	TokenKindBitwiseOr:         "|",
+	TokenKindBitwiseExor:       "^",
+	TokenKindShiftLeft:         "<<",
+	TokenKindShiftRight:        ">>",
+	TokenKindBitClear:          "&^",
+	TokenKindAssign:            "=",
+	TokenKindAddAssign:         "+=",
+	TokenKindSubtractAssign:    "-=",
+	TokenKindMultiplyAssign:    "*=",
+	TokenKindDivideAssign:      "/=",
+	TokenKindModulusAssign:     "%=",
+	TokenKindBitwiseAndAssign:  "&=",
+	TokenKindBitwiseOrAssign:   "|=",
+	TokenKindBitwiseExorAssign: "^=",
+	TokenKindShiftLeftAssign:   "<<=",
+	TokenKindShiftRightAssign:  ">>=",
+	TokenKindBitClearAssign:    "&^=",
+	TokenKindLogicalAnd:        "&&",
+	TokenKindLogicalOr:         "||",
+	TokenKindChannelArrow:      "<-",
+	TokenKindIncrement:         "++",
+	TokenKindDecrement:         "--",
+	TokenKindEquals:            "==",
+	TokenKindLess:              "<",
+	TokenKindGreater:           ">",
+	TokenKindNot:               "!",
+	TokenKindNotEqual:          "!=",
+	TokenKindLessEqual:         "<=",
+	TokenKindGreaterEqual:      ">=",
+}
+
+// assignOperators maps each operator-assignment to the operator it uses.
+var assignOperators = map[TokenKind]TokenKind{
+	TokenKindAddAssign:         TokenKindAdd,
+	TokenKindSubtractAssign:    TokenKindSubtract,
+	TokenKindMultiplyAssign:    TokenKindAsterisk,
+	TokenKindDivideAssign:      TokenKindDivide,
+	TokenKindModulusAssign:     TokenKindModulus,
+	TokenKindBitwiseAndAssign:  TokenKindBitwiseAnd,
+	TokenKindBitwiseOrAssign:   TokenKindBitwiseOr,
+	TokenKindBitwiseExorAssign: TokenKindBitwiseExor,
+	TokenKindShiftLeftAssign:   TokenKindShiftLeft,
+	TokenKindShiftRightAssign:  TokenKindShiftRight,
+	TokenKindBitClearAssign:    TokenKindBitClear,
+}
+
+// type inferrer works out the data type of every expression in a file
+// and checks that the types are used properly.
+type inferrer struct {
+	sf           *sourceFile
+	ts           *DataTypeStore
+	inProgress   map[*Symbol]bool // symbols we're in the middle of working out, in any file.
+	results      []DataType       // the results of the function we're in.
+	namedResults bool             // true if the function we're in has named results.
+}
+
+// inferTypes works out the type of each expression in a file and records
+// it in sf.types. Expressions which use types in the wrong way are
+// reported as errors.
+func inferTypes(sf *sourceFile, ts *DataTypeStore) error {
+	inf := inferrer{sf, ts, make(map[*Symbol]bool), nil, false}
+
+	top := sf.ast.(*ASTTopLevel)
+	for _, decl := range top.topLevelDecls {
+		err := inf.inferDecl(decl)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// declaredBy returns true if a symbol was declared by a declaration.
+func declaredBy(sym *Symbol, decl AST) bool {
+	return sym != nil && sym.decl == decl
+}
+
+// inferDecl works out the types in a top level declaration.
+func (inf *inferrer) inferDecl(decl AST) error {
+	switch d := decl.(type) {
+	case *ASTConstDecl:
+		return inf.inferValueDecl(d.ident, decl, d.typ, d.value, true, inf.sf.symbols.LookupLocal)
+
+	case *ASTVarDecl:
+		return inf.inferValueDecl(d.ident, decl, d.typ, d.value, false, inf.sf.symbols.LookupLocal)
+
+	case *ASTFunctionDecl:
+		return inf.inferFunction(d)
+	}
+
+	return nil
+}
+
+// inferValueDecl works out the type of a const or var declaration. The
+// symbol is found using the given function.
+func (inf *inferrer) inferValueDecl(identAST AST, decl AST, typ AST, value AST, constant bool, find func(name string) *Symbol) error {
+	ident := identAST.(*ASTIdentifier)
+	if ident.name == "_" {
+		// there's no symbol but the value still has to make sense.
+		_, err := inf.valueDeclType(typ, value, constant)
+		return err
+	}
+
+	sym := find(ident.name)
+	if !declaredBy(sym, decl) {
+		return nil
+	}
+
+	_, err := inf.symbolType(sym, ident.pos)
+	return err
+}
+
+// inferFunction works out the types in a function body.
+func (inf *inferrer) inferFunction(fn *ASTFunctionDecl) error {
+	if fn.body == nil {
+		return nil
+	}
+
+	inf.results = nil
+	inf.namedResults = false
+	for _, resultAST := range fn.returns {
+		result := resultAST.(*ASTParameterDecl)
+		dt, err := inf.typeFromAST(result.typ)
+		if err != nil {
+			return err
+		}
+
+		inf.results = append(inf.results, dt)
+		if result.identifier != nil {
+			inf.namedResults = true
+		}
+	}
+
+	return inf.inferStatements(fn.body.(*ASTBlock).statements)
+}
+
+// inferStatements works out the types in a list of statements.
+func (inf *inferrer) inferStatements(statements []AST) error {
+	for _, stmt := range statements {
+		err := inf.inferStatement(stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inferStatement works out the types in a single statement.
+func (inf *inferrer) inferStatement(stmt AST) error {
+	switch s := stmt.(type) {
+	case *ASTConstDecl:
+		return inf.inferValueDecl(s.ident, s, s.typ, s.value, true, inf.findLocal(s.ident))
+
+	case *ASTVarDecl:
+		return inf.inferValueDecl(s.ident, s, s.typ, s.value, false, inf.findLocal(s.ident))
+
+	case *ASTDataTypeDecl:
+		// local types were made by the resolver.
+		return nil
+
+	case *ASTBlock:
+		return inf.inferStatements(s.statements)
+
+	case *ASTShortVarDecl:
+		return inf.inferShortVarDecl(s)
+
+	case *ASTAssign:
+		return inf.inferAssign(s)
+
+	case *ASTIncDec:
+		dt, err := inf.inferExpr(s.expr)
+		if err != nil {
+			return err
+		}
+
+		if !isNumeric(dt) {
+			return NewError(inf.sf.fileName, s.pos, fmt.Sprint("I can only use ", operatorNames[s.op], " on numbers, not on a ", dt))
+		}
+
+		return nil
+
+	case *ASTReturn:
+		return inf.inferReturn(s)
+
+	case *ASTIf:
+		if s.init != nil {
+			err := inf.inferStatement(s.init)
+			if err != nil {
+				return err
+			}
+		}
+
+		dt, err := inf.inferExpr(s.condition)
+		if err != nil {
+			return err
+		}
+
+		if !isBoolean(dt) {
+			return NewError(inf.sf.fileName, s.condition.Pos(), fmt.Sprint("an if condition has to be a bool, not a ", dt))
+		}
+
+		err = inf.inferStatement(s.then)
+		if err != nil {
+			return err
+		}
+
+		if s.otherwise != nil {
+			return inf.inferStatement(s.otherwise)
+		}
+
+		return nil
+
+	case *ASTFor:
+		if s.init != nil {
+			err := inf.inferStatement(s.init)
+			if err != nil {
+				return err
+			}
+		}
+
+		if s.condition != nil {
+			dt, err := inf.inferExpr(s.condition)
+			if err != nil {
+				return err
+			}
+
+			if !isBoolean(dt) {
+				return NewError(inf.sf.fileName, s.condition.Pos(), fmt.Sprint("a for condition has to be a bool, not a ", dt))
+			}
+		}
+
+		if s.post != nil {
+			err := inf.inferStatement(s.post)
+			if err != nil {
+				return err
+			}
+		}
+
+		return inf.inferStatement(s.body)
+	}
+
+	// it's an expression statement so it can have any number of results.
+	_, err := inf.inferMulti(stmt)
+	return err
+}
+
+// findLocal makes a function to find the symbol for a local declaration.
+func (inf *inferrer) findLocal(identAST AST) func(name string) *Symbol {
+	return func(name string) *Symbol {
+		return inf.sf.resolved[identAST]
+	}
+}
+
+// inferShortVarDecl works out the types of the variables in a ":="
+// declaration and checks the values can be assigned to any existing
+// variables.
+func (inf *inferrer) inferShortVarDecl(decl *ASTShortVarDecl) error {
+	valueTypes, err := inf.inferValues(decl.values, len(decl.idents), decl.pos)
+	if err != nil {
+		return err
+	}
+
+	for i, identAST := range decl.idents {
+		ident := identAST.(*ASTIdentifier)
+		sym := inf.sf.resolved[ident]
+		if sym == nil {
+			// it's "_".
+			continue
+		}
+
+		if declaredBy(sym, decl) {
+			// it's a new variable.
+			_, err = inf.symbolType(sym, ident.pos)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// it's an existing variable.
+		dt, err := inf.inferExpr(ident)
+		if err != nil {
+			return err
+		}
+
+		if err := inf.checkAssign(decl.values, i, valueTypes[i], dt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inferAssign checks the types in an assignment.
+func (inf *inferrer) inferAssign(assign *ASTAssign) error {
+	if op, ok := assignOperators[assign.op]; ok {
+		// "a += b" has to make sense as "a = a + b".
+		leftType, err := inf.inferExpr(assign.left[0])
+		if err != nil {
+			return err
+		}
+
+		rightType, err := inf.inferExpr(assign.right[0])
+		if err != nil {
+			return err
+		}
+
+		dt, err := inf.binaryType(op, assign.pos, assign.left[0], assign.right[0], leftType, rightType)
+		if err != nil {
+			return err
+		}
+
+		err = inf.checkShiftCount(op, assign.right[0], assign.pos)
+		if err != nil {
+			return err
+		}
+
+		if !Assignable(dt, leftType, inf.ts) {
+			return inf.assignError(assign.right, 0, dt, leftType)
+		}
+
+		return nil
+	}
+
+	valueTypes, err := inf.inferValues(assign.right, len(assign.left), assign.pos)
+	if err != nil {
+		return err
+	}
+
+	for i, left := range assign.left {
+		if ident, ok := left.(*ASTIdentifier); ok && ident.name == "_" {
+			if isUntypedNil(valueTypes[i]) {
+				return NewError(inf.sf.fileName, assign.right[i].Pos(), "I can't assign nil to '_' - nil needs a type")
+			}
+
+			continue
+		}
+
+		dt, err := inf.inferExpr(left)
+		if err != nil {
+			return err
+		}
+
+		if err := inf.checkAssign(assign.right, i, valueTypes[i], dt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inferReturn checks the values being returned match the function's results.
+func (inf *inferrer) inferReturn(ret *ASTReturn) error {
+	if len(ret.values) == 0 {
+		if len(inf.results) > 0 && !inf.namedResults {
+			return NewError(inf.sf.fileName, ret.pos, fmt.Sprint("this function needs to return ", len(inf.results), " values"))
+		}
+
+		return nil
+	}
+
+	valueTypes, err := inf.inferValues(ret.values, len(inf.results), ret.pos)
+	if err != nil {
+		return err
+	}
+
+	for i, dt := range valueTypes {
+		if err := inf.checkAssign(ret.values, i, dt, inf.results[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inferValues works out the types of a list of values which are being
+// assigned to a number of things. A single call can provide several
+// values.
+func (inf *inferrer) inferValues(values []AST, count int, pos SrcSpan) ([]DataType, error) {
+	if len(values) == 1 && count != 1 {
+		valueTypes, err := inf.inferMulti(values[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if len(valueTypes) != count {
+			return nil, NewError(inf.sf.fileName, pos, fmt.Sprint("there are ", count, " things to assign to but ", len(valueTypes), " values"))
+		}
+
+		return valueTypes, nil
+	}
+
+	if len(values) != count {
+		return nil, NewError(inf.sf.fileName, pos, fmt.Sprint("there are ", count, " things to assign to but ", len(values), " values"))
+	}
+
+	var valueTypes []DataType
+	for _, value := range values {
+		dt, err := inf.inferExpr(value)
+		if err != nil {
+			return nil, err
+		}
+
+		valueTypes = append(valueTypes, dt)
+	}
+
+	return valueTypes, nil
+}
+
+// checkAssign makes sure a value can be assigned to something of type
+// "to". Untyped constants get their type here so they have to fit in it.
+func (inf *inferrer) checkAssign(values []AST, i int, from DataType, to DataType) error {
+	if !Assignable(from, to, inf.ts) {
+		return inf.assignError(values, i, from, to)
+	}
+
+	if i >= len(values) {
+		// the values all came from one call so they're not constants.
+		return nil
+	}
+
+	return inf.checkConstFits(values[i], from, to)
+}
+
+// checkConstFits makes sure an untyped constant fits in the type it's
+// being given. Until then they can be any size.
+func (inf *inferrer) checkConstFits(value AST, from DataType, to DataType) error {
+	// an interface holds the constant as its default type.
+	if _, ok := Underlying(to).(*DataTypeInterface); ok {
+		to = defaultType(from, inf.ts)
+	}
+
+	if !isUntyped(from) || !isNumeric(to) || isUntyped(to) {
+		return nil
+	}
+
+	val, ok, err := inf.constValue(value)
+	if !ok {
+		return err
+	}
+
+	_, err = inf.constEvaluator().convert(val, to, value.Pos())
+	return err
+}
+
+// constValue gets the value of an expression if it's a constant. It
+// returns false if it isn't a constant we know the value of, with an
+// error if it's a constant which doesn't make sense.
+func (inf *inferrer) constValue(value AST) (Value, bool, error) {
+	ev := inf.constEvaluator()
+	val, err := ev.eval(value)
+	if err != nil {
+		if ev.unknown {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	return val, true, nil
+}
+
+// checkShiftCount makes sure a shift isn't by a negative constant. a
+// negative amount which isn't a constant is only caught when the program
+// runs.
+func (inf *inferrer) checkShiftCount(op TokenKind, count AST, pos SrcSpan) error {
+	if op != TokenKindShiftLeft && op != TokenKindShiftRight {
+		return nil
+	}
+
+	val, ok, err := inf.constValue(count)
+	if !ok {
+		return err
+	}
+
+	if i, ok := constInt(val); ok && i.Sign() < 0 {
+		return NewError(inf.sf.fileName, pos, "I can't shift by a negative amount")
+	}
+
+	return nil
+}
+
+// constEvaluator makes a constant evaluator which can see this file's
+// symbols.
+func (inf *inferrer) constEvaluator() *constEvaluator {
+	return &constEvaluator{inf.sf.fileName, inf.lookup, inf.ts, make(map[*Symbol]bool), false, false, inf.conversionType}
+}
+
+// lookup finds the symbol an identifier was resolved to.
+func (inf *inferrer) lookup(ident *ASTIdentifier) *Symbol {
+	return inf.sf.resolved[ident]
+}
+
+// assignError reports a value which can't be assigned. If a single call
+// provided all the values the error is reported on the call.
+func (inf *inferrer) assignError(values []AST, i int, from DataType, to DataType) error {
+	pos := values[0].Pos()
+	if i < len(values) {
+		pos = values[i].Pos()
+	}
+
+	return NewError(inf.sf.fileName, pos, fmt.Sprint("I can't use a ", from, " as a ", to, " here"))
+}
+
+// symbolType gets the data type of a symbol, working it out from its
+// declaration if we don't know it yet.
+func (inf *inferrer) symbolType(sym *Symbol, pos SrcSpan) (DataType, error) {
+	if sym.dataType != nil {
+		return sym.dataType, nil
+	}
+
+	// symbols declared in other files of this package are worked out in
+	// the context of their own file, so any problems are reported there.
+	if declFile := inf.sf.pkg.declFile[sym]; declFile != nil && declFile != inf.sf {
+		sibling := inferrer{declFile, inf.ts, inf.inProgress, nil, false}
+		return sibling.symbolType(sym, sym.decl.Pos())
+	}
+
+	if inf.inProgress[sym] {
+		return nil, NewError(inf.sf.fileName, pos, fmt.Sprint("'", sym.name, "' refers to itself in its own declaration"))
+	}
+
+	inf.inProgress[sym] = true
+	defer delete(inf.inProgress, sym)
+
+	var dt DataType
+	var err error
+	switch d := sym.decl.(type) {
+	case *ASTParameterDecl:
+		dt, err = inf.ts.paramFromAST(inf.sf.fileName, d, inf.lookup)
+
+	case *ASTReceiver:
+		typeSym := inf.sf.symbols.LookupLocal(d.typeName)
+		if typeSym == nil {
+			return nil, NewError(inf.sf.fileName, d.pos, fmt.Sprint("I can't find a type called '", d.typeName, "'"))
+		}
+
+		dt = typeSym.dataType
+		if d.pointer {
+			dt = inf.ts.MakePointer(dt)
+		}
+
+	case *ASTConstDecl:
+		dt, err = inf.valueDeclType(d.typ, d.value, true)
+
+	case *ASTVarDecl:
+		dt, err = inf.valueDeclType(d.typ, d.value, false)
+
+	case *ASTShortVarDecl:
+		var valueTypes []DataType
+		valueTypes, err = inf.inferValues(d.values, len(d.idents), d.pos)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, ident := range d.idents {
+			if ident.(*ASTIdentifier).name == sym.name {
+				dt, err = inf.variableType(valueTypes[i], d.values, i)
+			}
+		}
+
+	default:
+		return nil, NewError(inf.sf.fileName, pos, fmt.Sprint("I don't know what type '", sym.name, "' is"))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sym.dataType = dt
+	return dt, nil
+}
+
+// valueDeclType works out the type of a const or var from its declared
+// type and its value.
+func (inf *inferrer) valueDeclType(typ AST, value AST, constant bool) (DataType, error) {
+	if typ != nil {
+		dt, err := inf.typeFromAST(typ)
+		if err != nil {
+			return nil, err
+		}
+
+		if value != nil {
+			valueType, err := inf.inferExpr(value)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := inf.checkAssign([]AST{value}, 0, valueType, dt); err != nil {
+				return nil, err
+			}
+
+			if constant {
+				return dt, inf.foldConst(value, dt)
+			}
+		}
+
+		return dt, nil
+	}
+
+	valueType, err := inf.inferExpr(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if constant {
+		// constants stay untyped until they're used.
+		return valueType, inf.foldConst(value, nil)
+	}
+
+	return inf.variableType(valueType, []AST{value}, 0)
+}
+
+// foldConst works out the value of a constant declaration and records it
+// in sf.constants. If the constant has a declared type its value is
+// converted to it.
+func (inf *inferrer) foldConst(value AST, dt DataType) error {
+	ev := inf.constEvaluator()
+	val, err := ev.eval(value)
+	if err != nil {
+		if ev.unknown && !ev.variable {
+			// it might be a constant we can't work out the value of yet.
+			return nil
+		}
+
+		return err
+	}
+
+	if dt != nil {
+		val, err = ev.convert(val, dt, value.Pos())
+		if err != nil {
+			return err
+		}
+	}
+
+	inf.sf.constants[value] = val
+	return nil
+}
+
+// variableType gets the type a variable has when it's given a value
+// without a declared type.
+func (inf *inferrer) variableType(valueType DataType, values []AST, i int) (DataType, error) {
+	if isUntypedNil(valueType) {
+		pos := values[0].Pos()
+		if i < len(values) {
+			pos = values[i].Pos()
+		}
+
+		return nil, NewError(inf.sf.fileName, pos, "I can't tell what type this should be - nil needs a type")
+	}
+
+	dt := defaultType(valueType, inf.ts)
+	if i < len(values) {
+		if err := inf.checkConstFits(values[i], valueType, dt); err != nil {
+			return nil, err
+		}
+	}
+
+	return dt, nil
+}
+
+// typeFromAST converts a data type's AST to a DataType using the
+// identifiers we've already resolved.
+func (inf *inferrer) typeFromAST(typ AST) (DataType, error) {
+	return inf.ts.fromAST(inf.sf.fileName, typ, inf.lookup)
+}
+
+// inferExpr works out the type of an expression which has a single value.
+func (inf *inferrer) inferExpr(expr AST) (DataType, error) {
+	if call, ok := expr.(*ASTCall); ok {
+		results, err := inf.inferCall(call)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(results) != 1 {
+			return nil, NewError(inf.sf.fileName, call.pos, fmt.Sprint("this call gives ", len(results), " values but I need one here"))
+		}
+
+		return results[0], nil
+	}
+
+	dt, err := inf.exprType(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	inf.sf.types[expr] = dt
+	return dt, nil
+}
+
+// inferMulti works out the types of an expression which might be a call
+// with any number of results.
+func (inf *inferrer) inferMulti(expr AST) ([]DataType, error) {
+	if call, ok := expr.(*ASTCall); ok {
+		return inf.inferCall(call)
+	}
+
+	dt, err := inf.inferExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return []DataType{dt}, nil
+}
+
+// exprType works out the type of any expression other than a call.
+func (inf *inferrer) exprType(expr AST) (DataType, error) {
+	switch e := expr.(type) {
+	case *ASTValue:
+		return e.val.DataType(inf.ts), nil
+
+	case *ASTIdentifier:
+		sym := inf.sf.resolved[e]
+		if sym == nil {
+			return nil, NewError(inf.sf.fileName, e.pos, fmt.Sprint("undefined: ", e.name))
+		}
+
+		switch sym.kind {
+		case SymbolKindType:
+			return nil, NewError(inf.sf.fileName, e.pos, fmt.Sprint("'", e.name, "' is a type, not a value"))
+
+		case SymbolKindBuiltin:
+			return nil, NewError(inf.sf.fileName, e.pos, fmt.Sprint(e.name, "() is a builtin so it has to be called"))
+		}
+
+		return inf.symbolType(sym, e.pos)
+
+	case *ASTSelector:
+		return inf.selectorType(e)
+
+	case *ASTIndex:
+		return inf.indexType(e)
+
+	case *ASTTypeAssert:
+		return inf.typeAssertType(e)
+
+	case *ASTFuncLit:
+		return inf.funcLitType(e)
+
+	case *ASTParen:
+		return inf.inferExpr(e.expr)
+
+	case *ASTUnaryExpr:
+		param, err := inf.inferExpr(e.param)
+		if err != nil {
+			return nil, err
+		}
+
+		return inf.unaryType(e, param)
+
+	case *ASTBinaryExpr:
+		left, err := inf.inferExpr(e.left)
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := inf.inferExpr(e.right)
+		if err != nil {
+			return nil, err
+		}
+
+		dt, err := inf.binaryType(e.op, e.pos, e.left, e.right, left, right)
+		if err != nil {
+			return nil, err
+		}
+
+		err = inf.checkShiftCount(e.op, e.right, e.pos)
+		if err != nil {
+			return nil, err
+		}
+
+		// typed constants have to stay in range, like "int8(100) * 2".
+		if isNumeric(dt) && !isUntyped(dt) {
+			if _, _, err := inf.constValue(e); err != nil {
+				return nil, err
+			}
+		}
+
+		return dt, nil
+	}
+
+	return nil, NewError(inf.sf.fileName, expr.Pos(), "I don't know how to work out the type of this expression yet")
+}
+
+// inferCall works out the types of the results of a function call and
+// checks the arguments.
+func (inf *inferrer) inferCall(call *ASTCall) ([]DataType, error) {
+	if b, ok := inf.calledBuiltin(call); ok {
+		results, err := inf.inferBuiltin(b, call)
+		if err == nil && len(results) == 1 {
+			inf.sf.types[call] = results[0]
+		}
+
+		return results, err
+	}
+
+	// calling a type is really a conversion to that type.
+	target, isConversion, err := inf.conversionType(call.function)
+	if err != nil {
+		return nil, err
+	}
+
+	if isConversion {
+		return inf.inferConversion(call, target)
+	}
+
+	funcType, err := inf.inferExpr(call.function)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, ok := Underlying(funcType).(*DataTypeFunc)
+	if !ok {
+		return nil, NewError(inf.sf.fileName, call.function.Pos(), fmt.Sprint("I can't call a ", funcType, " - it's not a function"))
+	}
+
+	// a single call can provide all the arguments.
+	var argTypes []DataType
+	if len(call.args) == 1 && len(signature.params) > 1 {
+		argTypes, err = inf.inferMulti(call.args[0])
+	} else {
+		argTypes, err = inf.inferValues(call.args, len(call.args), call.pos)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fixedParams := len(signature.params)
+	if signature.variadic {
+		fixedParams--
+	}
+
+	if len(argTypes) < fixedParams || (!signature.variadic && len(argTypes) > fixedParams) {
+		return nil, NewError(inf.sf.fileName, call.pos, fmt.Sprint("this function needs ", len(signature.params), " arguments but it's getting ", len(argTypes)))
+	}
+
+	for i, argType := range argTypes {
+		var paramType DataType
+		if i < fixedParams {
+			paramType = signature.params[i]
+		} else {
+			// the rest of the arguments go in the variadic slice.
+			paramType = signature.params[fixedParams].(*DataTypeUnary).subType
+		}
+
+		if err := inf.checkAssign(call.args, i, argType, paramType); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(signature.results) == 1 {
+		inf.sf.types[call] = signature.results[0]
+	}
+
+	return signature.results, nil
+}
+
+// conversionType checks if the function in a call is really a type, in
+// which case the call is a conversion to that type.
+func (inf *inferrer) conversionType(function AST) (DataType, bool, error) {
+	switch f := function.(type) {
+	case *ASTIdentifier:
+		sym := inf.sf.resolved[f]
+		if sym == nil {
+			return nil, false, nil
+		}
+
+		if sym.kind != SymbolKindType {
+			return nil, false, nil
+		}
+
+	case *ASTSelector:
+		// it might be a type in an imported package.
+		if _, ok := f.expr.(*ASTIdentifier); !ok {
+			return nil, false, nil
+		}
+
+		sym := inf.sf.resolved[f]
+		if sym == nil {
+			return nil, false, nil
+		}
+
+		return sym.dataType, sym.kind == SymbolKindType, nil
+
+	case *ASTParen:
+		return inf.conversionType(f.expr)
+
+	case *ASTUnaryExpr:
+		// "*T" is a pointer type if T is a type.
+		if f.op != TokenKindAsterisk {
+			return nil, false, nil
+		}
+
+		elementType, isType, err := inf.conversionType(f.param)
+		if err != nil || !isType {
+			return nil, false, err
+		}
+
+		return inf.ts.MakePointer(elementType), true, nil
+
+	case *ASTDataTypeSlice, *ASTDataTypeArray, *ASTDataTypeMap, *ASTDataTypeChan, *ASTDataTypeStruct, *ASTDataTypeFunc, *ASTDataTypeInterface:
+
+	default:
+		return nil, false, nil
+	}
+
+	dt, err := inf.typeFromAST(function)
+	return dt, true, err
+}
+
+// inferConversion checks a value can be converted to a type.
+func (inf *inferrer) inferConversion(call *ASTCall, target DataType) ([]DataType, error) {
+	if len(call.args) != 1 {
+		return nil, NewError(inf.sf.fileName, call.pos, fmt.Sprint("converting to a ", target, " needs exactly one value"))
+	}
+
+	from, err := inf.inferExpr(call.args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if !Convertible(from, target, inf.ts) {
+		return nil, NewError(inf.sf.fileName, call.pos, fmt.Sprint("I can't convert a ", from, " to a ", target))
+	}
+
+	// constants have to fit in the type they're converted to. anything else
+	// just gets truncated when the program runs.
+	val, ok, err := inf.constValue(call.args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		if _, err := inf.constEvaluator().convertExplicit(val, target, call.args[0].Pos()); err != nil {
+			return nil, err
+		}
+	}
+
+	inf.sf.conversions[call] = target
+	inf.sf.types[call] = target
+	return []DataType{target}, nil
+}
+
+// selectorType works out the type of a selector - a symbol in another
+// package, a struct field or a method.
+func (inf *inferrer) selectorType(sel *ASTSelector) (DataType, error) {
+	if _, ok := sel.expr.(*ASTIdentifier); ok {
+		// it might be a symbol in an imported package.
+		sym := inf.sf.resolved[sel]
+		if sym != nil {
+			if sym.kind == SymbolKindType {
+				return nil, NewError(inf.sf.fileName, sel.pos, fmt.Sprint("'", sel.name, "' is a type, not a value"))
+			}
+
+			if sym.dataType == nil {
+				return nil, NewError(inf.sf.fileName, sel.pos, fmt.Sprint("I don't know what type '", sel.name, "' is"))
+			}
+
+			inf.sf.selections[sel] = SelectionQualified
+			return sym.dataType, nil
+		}
+	}
+
+	// selecting from a type gives a method expression.
+	recvType, isType, err := inf.conversionType(sel.expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if isType {
+		return inf.methodExprType(sel, recvType)
+	}
+
+	base, err := inf.inferExpr(sel.expr)
+	if err != nil {
+		return nil, err
+	}
+
+	// is it a method? methods with pointer receivers can be used on
+	// values too.
+	methods := inf.ts.MethodSet(base)
+	_, isPointer := Underlying(base).(*DataTypeUnary)
+	_, isInterface := Underlying(base).(*DataTypeInterface)
+	if !isPointer && !isInterface {
+		methods = inf.ts.MethodSet(inf.ts.MakePointer(base))
+	}
+
+	for _, method := range methods {
+		if method.name == sel.name {
+			inf.sf.selections[sel] = SelectionMethodValue
+			return method.signature, nil
+		}
+	}
+
+	// is it a field? fields can be selected through a pointer.
+	structType := Underlying(base)
+	if ptr, ok := structType.(*DataTypeUnary); ok && ptr.kind == DataTypeKindPointer {
+		structType = Underlying(ptr.subType)
+	}
+
+	if st, ok := structType.(*DataTypeStruct); ok {
+		for _, field := range st.fields {
+			if field.name == sel.name {
+				inf.sf.selections[sel] = SelectionField
+				return field.dataType, nil
+			}
+		}
+	}
+
+	return nil, NewError(inf.sf.fileName, sel.pos, fmt.Sprint("a ", base, " doesn't have a field or method called '", sel.name, "'"))
+}
+
+// methodExprType works out the type of a method expression like
+// "T.Method". It's the method as an ordinary function which takes the
+// receiver as its first parameter.
+func (inf *inferrer) methodExprType(sel *ASTSelector, recvType DataType) (DataType, error) {
+	for _, method := range inf.ts.MethodSet(recvType) {
+		if method.name == sel.name {
+			params := append([]DataType{recvType}, method.signature.params...)
+			inf.sf.selections[sel] = SelectionMethodExpr
+			return inf.ts.MakeFunc(params, method.signature.results, method.signature.variadic), nil
+		}
+	}
+
+	return nil, NewError(inf.sf.fileName, sel.pos, fmt.Sprint("a ", recvType, " doesn't have a method called '", sel.name, "'"))
+}
+
+// funcLitType works out the type of a function literal and the types in
+// its body.
+func (inf *inferrer) funcLitType(fl *ASTFuncLit) (DataType, error) {
+	dt, err := inf.typeFromAST(&ASTDataTypeFunc{fl.pos, fl.params, fl.returns})
+	if err != nil {
+		return nil, err
+	}
+
+	// the body returns its own results, not the ones of the function
+	// it's in.
+	results, namedResults := inf.results, inf.namedResults
+	err = inf.inferFunction(&ASTFunctionDecl{pos: fl.pos, params: fl.params, returns: fl.returns, body: fl.body})
+	inf.results, inf.namedResults = results, namedResults
+	if err != nil {
+		return nil, err
+	}
+
+	return dt, nil
+}
+
+// typeAssertType works out the type of a type assertion, which is the
+// type being asserted. Only interfaces can be asserted and a concrete
+// type has to be able to implement the interface.
+func (inf *inferrer) typeAssertType(ta *ASTTypeAssert) (DataType, error) {
+	base, err := inf.inferExpr(ta.expr)
+	if err != nil {
+		return nil, err
+	}
+
+	iface, ok := Underlying(base).(*DataTypeInterface)
+	if !ok {
+		return nil, NewError(inf.sf.fileName, ta.expr.Pos(), fmt.Sprint("I can only do type assertions on interfaces, not a ", base))
+	}
+
+	asserted, err := inf.typeFromAST(ta.typ)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, assertedIface := Underlying(asserted).(*DataTypeInterface); !assertedIface && !Implements(asserted, *iface, inf.ts) {
+		return nil, NewError(inf.sf.fileName, ta.typ.Pos(), fmt.Sprint("a ", asserted, " can never be a ", base, " - it's missing some methods"))
+	}
+
+	return asserted, nil
+}
+
+// indexType works out the type of an index expression.
+func (inf *inferrer) indexType(index *ASTIndex) (DataType, error) {
+	base, err := inf.inferExpr(index.expr)
+	if err != nil {
+		return nil, err
+	}
+
+	indexType, err := inf.inferExpr(index.index)
+	if err != nil {
+		return nil, err
+	}
+
+	// maps can be indexed by their key type.
+	if mapType, ok := Underlying(base).(*DataTypeMap); ok {
+		if !Assignable(indexType, mapType.keyType, inf.ts) {
+			return nil, NewError(inf.sf.fileName, index.index.Pos(), fmt.Sprint("I can't use a ", indexType, " as a ", mapType.keyType, " key"))
+		}
+
+		return mapType.valueType, nil
+	}
+
+	// everything else is indexed by an integer.
+	if !isInteger(indexType) {
+		return nil, NewError(inf.sf.fileName, index.index.Pos(), fmt.Sprint("indexes have to be integers, not a ", indexType))
+	}
+
+	switch dt := Underlying(base).(type) {
+	case *DataTypeArray:
+		return dt.elementType, nil
+
+	case *DataTypeUnary:
+		if dt.kind == DataTypeKindSlice {
+			return dt.subType, nil
+		}
+
+		// pointers to arrays can be indexed too.
+		if array, ok := Underlying(dt.subType).(*DataTypeArray); ok {
+			return array.elementType, nil
+		}
+
+	case DataTypeBasic:
+		if isString(dt) {
+			return inf.ts.ByteType(), nil
+		}
+	}
+
+	return nil, NewError(inf.sf.fileName, index.pos, fmt.Sprint("I can't index a ", base))
+}
+
+// unaryType works out the type of a unary expression.
+func (inf *inferrer) unaryType(expr *ASTUnaryExpr, param DataType) (DataType, error) {
+	switch expr.op {
+	case TokenKindAdd, TokenKindSubtract:
+		if isNumeric(param) {
+			return param, nil
+		}
+
+	case TokenKindNot:
+		if isBoolean(param) {
+			return param, nil
+		}
+
+	case TokenKindBitwiseExor:
+		if isInteger(param) {
+			return param, nil
+		}
+
+	case TokenKindAsterisk:
+		ptr, ok := Underlying(param).(*DataTypeUnary)
+		if !ok || ptr.kind != DataTypeKindPointer {
+			return nil, NewError(inf.sf.fileName, expr.pos, fmt.Sprint("I can't dereference a ", param, " - it's not a pointer"))
+		}
+
+		return ptr.subType, nil
+
+	case TokenKindBitwiseAnd:
+		if isUntyped(param) {
+			return nil, NewError(inf.sf.fileName, expr.pos, "I can't take the address of a constant")
+		}
+
+		return inf.ts.MakePointer(param), nil
+
+	case TokenKindChannelArrow:
+		ch, ok := Underlying(param).(*DataTypeChan)
+		if !ok || ch.dir == ChanDirectionOut {
+			return nil, NewError(inf.sf.fileName, expr.pos, fmt.Sprint("I can't receive from a ", param))
+		}
+
+		return ch.elementType, nil
+	}
+
+	return nil, NewError(inf.sf.fileName, expr.pos, fmt.Sprint("I can't use ", operatorNames[expr.op], " on a ", param))
+}
+
+// binaryType works out the type of a binary operation.
+func (inf *inferrer) binaryType(op TokenKind, pos SrcSpan, leftExpr AST, rightExpr AST, left DataType, right DataType) (DataType, error) {
+	opName := operatorNames[op]
+
+	// shifts have an integer on the left and an integer amount on the right.
+	if op == TokenKindShiftLeft || op == TokenKindShiftRight {
+		// an untyped float which is a whole number can be shifted like
+		// an integer.
+		if left.DataTypeKind() == DataTypeKindUntypedFloat {
+			if val, ok, _ := inf.constValue(leftExpr); ok {
+				if _, whole := constInt(val); whole {
+					left = inf.ts.UntypedIntType()
+				}
+			}
+		}
+
+		if !isInteger(left) {
+			return nil, NewError(inf.sf.fileName, pos, fmt.Sprint("I can only shift integers, not a ", left))
+		}
+
+		if !isInteger(right) {
+			return nil, NewError(inf.sf.fileName, pos, fmt.Sprint("the shift amount has to be an integer, not a ", right))
+		}
+
+		return left, nil
+	}
+
+	dt, ok := unifyTypes(left, right, inf.ts)
+	if !ok {
+		return nil, NewError(inf.sf.fileName, pos, fmt.Sprint("I can't use ", opName, " on a ", left, " and a ", right, " - they're different types"))
+	}
+
+	// an untyped constant has to fit in the type of the other side.
+	if err := inf.checkConstFits(leftExpr, left, dt); err != nil {
+		return nil, err
+	}
+
+	if err := inf.checkConstFits(rightExpr, right, dt); err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case TokenKindEquals, TokenKindNotEqual:
+		return inf.ts.UntypedBoolType(), nil
+
+	case TokenKindLess, TokenKindGreater, TokenKindLessEqual, TokenKindGreaterEqual:
+		if isNumeric(dt) || isString(dt) {
+			return inf.ts.UntypedBoolType(), nil
+		}
+
+	case TokenKindLogicalAnd, TokenKindLogicalOr:
+		if isBoolean(dt) {
+			return dt, nil
+		}
+
+	case TokenKindAdd:
+		if isNumeric(dt) || isString(dt) {
+			return dt, nil
+		}
+
+	case TokenKindSubtract, TokenKindAsterisk, TokenKindDivide:
+		if isNumeric(dt) {
+			return dt, nil
+		}
+
+	case TokenKindModulus, TokenKindBitwiseAnd, TokenKindBitwiseOr, TokenKindBitwiseExor, TokenKindBitClear:
+		if isInteger(dt) {
+			return dt, nil
+		}
+	}
+
+	return nil, NewError(inf.sf.fileName, pos, fmt.Sprint("I can't use ", opName, " on a ", dt))
+}
@@ -0,0 +1,307 @@
+package golightly
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// inferTestSource compiles some source and returns the type of the
+// package symbol called "result".
+func inferTestSource(t *testing.T, src string) DataType {
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader("package main;\n"+src))
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	sym := c.sourceFile("test.go").symbols.LookupLocal("result")
+	if sym == nil {
+		t.Fatal("there's no symbol called 'result'")
+	}
+
+	return sym.dataType
+}
+
+func TestInferTypes(t *testing.T) {
+	cases := []struct {
+		src string
+		typ string
+	}{
+		{"var a, b int; var result = a + b;", "int"},
+		{"var a int; var result = a * 2;", "int"},
+		{"const result = 1 + 2.5;", "untyped float"},
+		{"const result = 1 + 2;", "untyped int"},
+		{"var s string; var result = s + \"x\";", "string"},
+		{"var s string; var result = s[1];", "uint8"},
+		{"var a int; var result = a < 3;", "bool"},
+		{"var a int; var result = &a;", "*int"},
+		{"var a []string; var result = a[0];", "string"},
+		{"func f(a int) (r string) { return \"\"; }; var result = f(1);", "string"},
+		{"type P struct { x int; }; var p P; var result = p.x;", "int"},
+		{"type P struct { x string; }; var p *P; var result = p.x;", "string"},
+		{"type N int; func (n N) Get() (r bool) { return true; }; var n N; var result = n.Get();", "bool"},
+		{"var result = len(\"abc\");", "int"},
+		{"var result = make([]int, 3);", "[]int"},
+		{"var result = new(string);", "*string"},
+		{"var a []string; var result = append(a, \"x\", \"y\");", "[]string"},
+		{"var a []int; var result = cap(a);", "int"},
+		{"var result = int(3.0);", "int"},
+		{"var result = []byte(\"hi\");", "[]uint8"},
+		{"type Name string; var result = Name(\"bob\");", "main.Name"},
+		{"var s string; var result = []rune(s);", "[]int32"},
+		{"var a int; var result = (a + 1) * 2;", "int"},
+		{"var result = ([]byte)(\"hi\");", "[]uint8"},
+		{"var x interface { }; var result = x.(int);", "int"},
+		{"var x int; var p = &x; var result = *p * *p;", "int"},
+		{"type T int; var x int; var result = (*T)(&x);", "*main.T"},
+		{"var c int; var result = func(a, b int) int { return a + b + c; };", "func(int, int) int"},
+		{"func apply(f func(int) int, n int) (r int) { return f(n); }; var result = apply(func(x int) int { return x * 2; }, 3);", "int"},
+		{"type S interface { String() string; }; type N int; func (n N) String() (s string) { return \"\"; }; var s S; var result = s.(N);", "main.N"},
+		{"type E int; func (e E) Error() string { return \"e\"; }; var e E; var result error = e;", "error"},
+		{"func f() error { return nil; }; var result = f();", "error"},
+		{"var err error; var result = err.Error();", "string"},
+		{"const big = 1 << 70; const result = big;", "untyped int"},
+		{"const big = 1 << 70; var result int32 = big >> 50;", "int32"},
+		{"var result uint8 = ^uint8(0);", "uint8"},
+		{"func f(nums ...int) []int { return nums; }; var result = f(1, 2);", "[]int"},
+		{"func f(s string, nums ...int) int { return nums[0] + len(s); }; var result = f(\"a\", 1);", "int"},
+		{"var result = func(nums ...int) int { return len(nums); };", "func(...int) int"},
+		{"var c chan int; var result <-chan int = c;", "<-chan int"},
+		{"var x = 300; var result = int8(x);", "int8"},
+		{"var result = int8(127);", "int8"},
+		{"var result = uint8(-1 + 256);", "uint8"},
+		{"var result = float32(1 << 40);", "float32"},
+		{"var a uint8; var n int; var result = a << n;", "uint8"},
+		{"var result interface{} = 1;", "interface{}"},
+		{"func f(x interface{}) int { return 0; }; var result = f(1.5);", "int"},
+		{"type S interface { String() string; }; type N int; func (n N) String() (s string) { return \"\"; }; const c N = 1; var result S = c;", "main.S"},
+		{"var a int64; var n int8; var result = a >> n;", "int64"},
+		{"var result = string(65);", "string"},
+		{"var c chan int; var result chan<- int = c;", "chan<- int"},
+		{"const result = int8(1);", "int8"},
+		{"const result = 1.0 << 2;", "untyped int"},
+		{"const big = 1.0 << 70; const result = big >> 68;", "untyped int"},
+		{"var n uint; var result int = 2.0 << n;", "int"},
+		{"const result = len(\"abc\");", "int"},
+		{"const c = 3; var result [int8(c)]int;", "[3]int"},
+	}
+
+	for _, c := range cases {
+		dt := inferTestSource(t, c.src)
+		if dt == nil || dt.String() != c.typ {
+			t.Errorf("'%s' gave %v, expected %s", c.src, dt, c.typ)
+		}
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		err string
+	}{
+		{"var s string; var i int; var result = s + i;", "test.go:2: I can't use + on a string and a int - they're different types"},
+		{"var result = true + 1;", "test.go:2: I can't use + on a untyped bool and a untyped int - they're different types"},
+		{"var b bool; var result = b * b;", "test.go:2: I can't use * on a bool"},
+		{"var result int = \"hello\";", "test.go:2: I can't use a untyped string as a int here"},
+		{"func f() (r int) { return \"x\"; };", "test.go:2: I can't use a untyped string as a int here"},
+		{"func f(a int) { if a { }; };", "test.go:2: an if condition has to be a bool, not a int"},
+		{"func f(a int) { for ; a; a++ { }; };", "test.go:2: a for condition has to be a bool, not a int"},
+		{"var a int; var result = a.x;", "test.go:2: a int doesn't have a field or method called 'x'"},
+		{"var a int; var result = len(a);", "test.go:2: I can't get the len() of a int"},
+		{"var result = make(int);", "test.go:2: I can only make slices, maps and channels, not a int"},
+		{"var r <-chan int; var result chan int = r;", "test.go:2: I can't use a <-chan int as a chan int here"},
+		{"var result = int8(300);", "test.go:2: the constant 300 doesn't fit in a int8"},
+		{"var result = uint(-1);", "test.go:2: the constant -1 doesn't fit in a uint"},
+		{"const big = 1 << 40; var result = int32(big);", "test.go:2: the constant 1099511627776 doesn't fit in a int32"},
+		{"var result = int(2.5);", "test.go:2: this constant isn't a whole number so it can't be a int"},
+		{"var c chan<- int; var result = <-c;", "test.go:2: I can't receive from a chan<- int"},
+		{"var a []int; var result = append(a, \"x\");", "test.go:2: I can't use a untyped string as a int here"},
+		{"var result = len;", "test.go:2: len() is a builtin so it has to be called"},
+		{"var result = []int(\"hi\");", "test.go:2: I can't convert a untyped string to a []int"},
+		{"var b bool; var result = string(b);", "test.go:2: I can't convert a bool to a string"},
+		{"var result = int(1, 2);", "test.go:2: converting to a int needs exactly one value"},
+		{"func f() (r int) { var g = func() string { return 1; }; _ = g; return 0; };", "test.go:2: I can't use a untyped int as a string here"},
+		{"var a int; var result = a.(int);", "test.go:2: I can only do type assertions on interfaces, not a int"},
+		{"type S interface { String() string; }; var s S; var result = s.(int);", "test.go:2: a int can never be a main.S - it's missing some methods"},
+		{"type N int; var n N; var result error = n;", "test.go:2: I can't use a main.N as a error here"},
+		{"const big = 1 << 70; var result int32 = big;", "test.go:2: the constant 1180591620717411303424 doesn't fit in a int32"},
+		{"var result int8 = 100 + 28;", "test.go:2: the constant 128 doesn't fit in a int8"},
+		{"var result uint = -1;", "test.go:2: the constant -1 doesn't fit in a uint"},
+		{"const big = 1 << 70; var result = big;", "test.go:2: the constant 1180591620717411303424 doesn't fit in a int"},
+		{"func f(x uint8) { }; func g() { f(256); };", "test.go:2: the constant 256 doesn't fit in a uint8"},
+		{"var a int; var result = a << -1;", "test.go:2: I can't shift by a negative amount"},
+		{"type S interface { String() string; }; var result S = 1;", "test.go:2: I can't use a untyped int as a main.S here"},
+		{"const result int8 = 1 / 0;", "test.go:2: you can't divide by zero"},
+		{"var result int8 = 1 << 600;", "test.go:2: I can't shift by more than 512 bits"},
+		{"var result = int8(1 / 0);", "test.go:2: you can't divide by zero"},
+		{"const result = 1 << 600;", "test.go:2: I can't shift by more than 512 bits"},
+		{"var x int; const result = x;", "test.go:2: not a constant expression"},
+		{"func f() { var x = 1; const c = x + 1; _ = c; };", "test.go:2: not a constant expression"},
+		{"func f() int { return 1; }; const result = f();", "test.go:2: not a constant expression"},
+		{"var s []int; const result = len(s);", "test.go:2: not a constant expression"},
+		{"var x int8; var result = x + 300;", "test.go:2: the constant 300 doesn't fit in a int8"},
+		{"var x uint8; var result = x == -1;", "test.go:2: the constant -1 doesn't fit in a uint8"},
+		{"func f(x int8) { x += 200; };", "test.go:2: the constant 200 doesn't fit in a int8"},
+		{"var result = int8(100) * 2;", "test.go:2: the constant 200 doesn't fit in a int8"},
+		{"const result = int8(100) * 2;", "test.go:2: the constant 200 doesn't fit in a int8"},
+		{"const result = 1.5 << 2;", "test.go:2: I can only shift integers, not a untyped float"},
+		{"const big = 1 << 70; const result int64 = big;", "test.go:2: the constant 1180591620717411303424 doesn't fit in a int64"},
+		{"var result interface{} = 1 << 70;", "test.go:2: the constant 1180591620717411303424 doesn't fit in a int"},
+		{"func f(a int) { a >>= -2; };", "test.go:2: I can't shift by a negative amount"},
+		{"var a int; var result = a << 1.5;", "test.go:2: the shift amount has to be an integer, not a untyped float"},
+	}
+
+	for _, c := range cases {
+		compiler := NewCompiler()
+		err := compiler.CompileSource("test.go", strings.NewReader("package main;\n"+c.src))
+		if err == nil {
+			t.Errorf("'%s' should have given an error", c.src)
+			continue
+		}
+
+		if err.Error() != c.err {
+			t.Errorf("'%s' gave error '%s', expected '%s'", c.src, err, c.err)
+		}
+	}
+}
+
+func TestInferMethodSelections(t *testing.T) {
+	cases := []struct {
+		src  string
+		typ  string
+		kind SelectionKind
+	}{
+		{"type B struct { n int; }; func (b *B) Write(p []byte) (n int) { return 0; }; var b B; var result = b.Write;", "func([]uint8) int", SelectionMethodValue},
+		{"type B struct { n int; }; func (b B) Len() (n int) { return 0; }; var result = B.Len;", "func(main.B) int", SelectionMethodExpr},
+		{"type B struct { n int; }; func (b *B) Write(p []byte) (n int) { return 0; }; var result = (*B).Write;", "func(*main.B, []uint8) int", SelectionMethodExpr},
+		{"type B struct { n int; }; var b B; var result = b.n;", "int", SelectionField},
+	}
+
+	for _, c := range cases {
+		comp := NewCompiler()
+		err := comp.CompileSource("test.go", strings.NewReader("package main;\n"+c.src))
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		sf := comp.sourceFile("test.go")
+		if dt := sf.symbols.LookupLocal("result").dataType; dt == nil || dt.String() != c.typ {
+			t.Errorf("'%s' gave %v, expected %s", c.src, dt, c.typ)
+		}
+
+		var kinds []SelectionKind
+		for _, kind := range sf.selections {
+			kinds = append(kinds, kind)
+		}
+
+		if len(kinds) != 1 || kinds[0] != c.kind {
+			t.Errorf("'%s' has selections %v, expected %v", c.src, kinds, c.kind)
+		}
+	}
+}
+
+func TestInferAcrossFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go": &fstest.MapFile{Data: []byte("package main;\nvar y = Z;\nvar w = x;\n")},
+		"b.go": &fstest.MapFile{Data: lateSibling("main")},
+		"c.go": &fstest.MapFile{Data: []byte("package main;\nvar Z = 3;\nvar x = f();\n")},
+	}
+
+	for i := 0; i < 10; i++ {
+		c := NewCompilerFS(fsys)
+		_, err := c.CompileAll([]string{"a.go", "b.go", "c.go"})
+		if err != nil {
+			t.Fatal("error compiling: ", err)
+		}
+
+		symbols := c.sourceFile("a.go").symbols
+		if dt := symbols.LookupLocal("y").dataType; dt == nil || dt.String() != "int" {
+			t.Fatalf("y is a %v, expected int", dt)
+		}
+
+		if dt := symbols.LookupLocal("w").dataType; dt == nil || dt.String() != "main.T" {
+			t.Fatalf("w is a %v, expected main.T", dt)
+		}
+	}
+}
+
+func TestInferAcrossFilesLoop(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go": &fstest.MapFile{Data: []byte("package main;\nvar y = z;\n")},
+		"b.go": &fstest.MapFile{Data: []byte("package main;\nvar z = y;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	_, err := c.CompileAll([]string{"a.go", "b.go"})
+	if err == nil || !strings.Contains(err.Error(), "refers to itself in its own declaration") {
+		t.Error("expected a loop error, got ", err)
+	}
+}
+
+func TestInferConstValues(t *testing.T) {
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader("package main;\nconst a = 2 + 3;\nconst b int8 = a * -4;\nconst s = \"x\" + \"y\";\n"))
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	sf := c.sourceFile("test.go")
+	expected := []string{"5", "-20", "\"xy\""}
+	for i, decl := range sf.ast.(*ASTTopLevel).topLevelDecls {
+		val := sf.constants[decl.(*ASTConstDecl).value]
+		if val == nil || val.String() != expected[i] {
+			t.Errorf("constant %d is %v, expected %s", i, val, expected[i])
+		}
+	}
+
+	if dt := sf.constants[sf.ast.(*ASTTopLevel).topLevelDecls[1].(*ASTConstDecl).value].DataType(c.dataTypeStore); dt.String() != "int8" {
+		t.Errorf("b is a %v, expected int8", dt)
+	}
+}
+
+func TestInferConstCalls(t *testing.T) {
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader("package main;\nconst a = int8(1);\nconst b = len(\"abc\") * 2;\nconst d = float32(a) / 2;\nconst e = string(65);\nconst f = 1.0 << 70 >> 68;\n"))
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	sf := c.sourceFile("test.go")
+	expected := []string{"1", "6", "0.5", "\"A\"", "4"}
+	for i, decl := range sf.ast.(*ASTTopLevel).topLevelDecls {
+		val := sf.constants[decl.(*ASTConstDecl).value]
+		if val == nil || val.String() != expected[i] {
+			t.Errorf("constant %d is %v, expected %s", i, val, expected[i])
+		}
+	}
+}
+
+func TestInferSharedSpans(t *testing.T) {
+	// the "//line" comments make both calls look like they're in the same
+	// place but they're still different expressions.
+	src := "package main;\n" +
+		"func f() int { return 1; };\n" +
+		"func g() string { return \"\"; };\n" +
+		"//line gen.go:10\n" +
+		"var a = f();\n" +
+		"//line gen.go:10\n" +
+		"var b = g();\n"
+
+	c := NewCompiler()
+	if err := c.CompileSource("test.go", strings.NewReader(src)); err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	sf := c.sourceFile("test.go")
+	decls := sf.ast.(*ASTTopLevel).topLevelDecls
+	a, b := decls[2].(*ASTVarDecl).value, decls[3].(*ASTVarDecl).value
+	if a.Pos() != b.Pos() {
+		t.Fatalf("the calls should be in the same place, got %v and %v", a.Pos(), b.Pos())
+	}
+
+	if sf.types[a] == nil || sf.types[a].String() != "int" || sf.types[b] == nil || sf.types[b].String() != "string" {
+		t.Errorf("the calls have types %v and %v, expected int and string", sf.types[a], sf.types[b])
+	}
+}
@@ -2,11 +2,13 @@ package golightly
 
 import (
 	"bufio"
-	"errors"
+	"bytes"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // a map of keywords for quick lookup
@@ -37,54 +39,16 @@ var keywords map[string]TokenKind = map[string]TokenKind{
 	"type":        TokenKindTypeKeyword,
 	"var":         TokenKindVar,
 
-	// pre-declared identifiers - XXX move these to declarations in "universe" later.
-	"bool":       TokenKindBool,
-	"byte":       TokenKindByte,
-	"complex64":  TokenKindComplex64,
-	"complex128": TokenKindComplex128,
-	"error":      TokenKindError,
-	"float32":    TokenKindFloat32,
-	"float64":    TokenKindFloat64,
-	"int":        TokenKindInt,
-	"int8":       TokenKindInt8,
-	"int16":      TokenKindInt16,
-	"int32":      TokenKindInt32,
-	"int64":      TokenKindInt64,
-	"rune":       TokenKindRune,
-	"string":     TokenKindString,
-	"uint":       TokenKindUint,
-	"uint8":      TokenKindUint8,
-	"uint16":     TokenKindUint16,
-	"uint32":     TokenKindUint32,
-	"uint64":     TokenKindUint64,
-	"uintptr":    TokenKindUintPtr,
-	/*
-		"true":       TokenKindTrue,
-		"false":      TokenKindFalse,
-		"iota":       TokenKindIota,
-		"nil":        TokenKindNil,
-		"append":     TokenKindAppend,
-		"cap":        TokenKindCap,
-		"close":      TokenKindClose,
-		"complex":    TokenKindComplex,
-		"copy":       TokenKindCopy,
-		"delete":     TokenKindDelete,
-		"imag":       TokenKindImag,
-		"len":        TokenKindLen,
-		"make":       TokenKindMake,
-		"new":        TokenKindNew,
-		"panic":      TokenKindPanic,
-		"print":      TokenKindPrint,
-		"println":    TokenKindPrintln,
-		"real":       TokenKindReal,
-		"recover":    TokenKindRecover,
-	*/
+	// pre-declared identifiers such as "int", "true" and "len" aren't keywords.
+	// they're lexed as identifiers and resolved like any other name.
 }
 
 // the running state of the lexical analyser
 type Lexer struct {
 	sourceFile string  // name of the source file
-	pos        SrcSpan // where we are in the source file
+	lineFile   string  // the file a "//line" comment said we're in, or "" if there hasn't been one
+	pos        SrcSpan // the span of the token we're currently lexing
+	loc        SrcLoc  // where we are in the source file
 
 	reader          *bufio.Reader         // used to read the input file
 	nextRune        rune                  // the next rune in input
@@ -96,8 +60,53 @@ type Lexer struct {
 
 	nextTokens     [nextTokensSize]Token // the next tokens
 	nextTokenCount int                   // count of the number of items in nextTokens
+
+	closed bool  // true once Close() has been called
+	err    error // the first error lexing a token. it's given every time after that
+
+	stats *LexerStats // counts what we've done if EnableStats() has been called
+
+	tabWidth int // how many columns a tab moves to the next tab stop by
+
+	pastHeader          bool    // true once we've got past the comments at the top of the file
+	buildConstraint     string  // the expression in a "//go:build" comment at the top of the file
+	buildConstraintPos  SrcSpan // where the "//go:build" comment is
+	haveBuildConstraint bool    // true if there's a "//go:build" comment
+
+	wordBuf   []byte            // reused to build up words and numbers without allocating each time
+	stringBuf []rune            // reused to build up string literals
+	names     map[string]string // identifiers we've seen so repeats can share a string
+
+	lineStart         bool           // true if the last non-comment rune ended a line
+	lineBlank         bool           // true if there's only been spaces since the start of the line
+	lineDirective     *lineDirective // a "//line" comment which takes effect at the end of its line
+	lineDirectiveSkip int            // how many line ends come before the one the directive is on
+
+	docComments map[int]string // groups of "//" comments on their own lines, by the line just after them
 }
 
+// type lineDirective is a "//line file:line:column" comment. It says
+// where the next line really came from.
+type lineDirective struct {
+	filename string
+	line     int
+	column   int
+}
+
+// type LexerStats has counters for what the lexer has been doing. They're
+// mostly useful for checking the buffer sizes are sensible.
+type LexerStats struct {
+	Tokens       int // the number of tokens lexed.
+	Bytes        int // the number of bytes read from the source.
+	Comments     int // the number of comments stripped out.
+	Lines        int // the number of line endings passed.
+	MaxTokenPeek int // the furthest ahead PeekToken has had to buffer tokens.
+	MaxRunePeek  int // the furthest ahead we've had to buffer runes.
+}
+
+// the lexer is where the parser usually gets its tokens from.
+var _ DocCommentSource = (*Lexer)(nil)
+
 // the buffer size of the lexer output channel
 const lexerTokenChannelBuffers = 5
 const tokenBufSize = 64
@@ -105,37 +114,166 @@ const ncNextRunesSize = 3
 const nextTokensSize = 2
 const initialStringStorage = 80
 
+// the UTF-8 byte order mark which some editors put at the start of files.
+const byteOrderMark = '\uFEFF'
+
 // NewLexer creates a new lexer object
 func NewLexer() *Lexer {
 	l := new(Lexer)
+	l.tabWidth = 1
 	l.Init("-")
 	return l
 }
 
 // Init initialises the lexer before using LexLine.
 func (l *Lexer) Init(filename string) {
-	l.pos = SrcSpan{SrcLoc{1, 1}, SrcLoc{1, 1}}
+	l.pos = SrcSpan{SrcLoc{1, 1}, SrcLoc{1, 1}, ""}
+	l.loc = SrcLoc{1, 1}
 	l.sourceFile = filename
+	l.lineFile = ""
+	l.names = make(map[string]string)
 	l.nextTokenCount = 0
 	l.haveNextRune = false
 	l.ncNextRuneCount = 0
 	l.longComment = false
+	l.prevStar = false
+	l.nextTokens = [nextTokensSize]Token{}
+	l.closed = false
+	l.err = nil
+	l.pastHeader = false
+	l.buildConstraint = ""
+	l.buildConstraintPos = SrcSpan{}
+	l.haveBuildConstraint = false
+	l.lineStart = true
+	l.lineBlank = true
+	l.lineDirective = nil
+	l.lineDirectiveSkip = 0
+	l.docComments = nil
 }
 
+// Close lets go of the reader. The lexer doesn't close it since it
+// didn't open it. Getting tokens after this gives an error until it's
+// given a new reader with LexReader().
 func (l *Lexer) Close() {
+	l.reader = nil
+	l.nextTokenCount = 0
+	l.nextTokens = [nextTokensSize]Token{}
+	l.closed = true
+}
+
+// SetTabWidth sets how far apart tab stops are when counting columns.
+// It's 1 to start with so a tab is one column like any other character,
+// but if it's set to 8 then error positions line up with what most
+// editors show.
+func (l *Lexer) SetTabWidth(width int) {
+	l.tabWidth = width
+}
+
+// EnableStats starts the lexer counting what it does. The counts carry
+// on across calls to Reset() so they can cover lots of sources.
+func (l *Lexer) EnableStats() {
+	if l.stats == nil {
+		l.stats = new(LexerStats)
+	}
+}
+
+// Stats returns the counts since EnableStats() was called. They're all
+// zero if it hasn't been.
+func (l *Lexer) Stats() LexerStats {
+	if l.stats == nil {
+		return LexerStats{}
+	}
+
+	return *l.stats
 }
 
 // LexReader starts lexical analysis of a generalised Reader.
 // It creates its own buffering of the reader, so it's not necessary to
 // provide a buffered reader.
 func (l *Lexer) LexReader(r io.Reader, filename string) {
+	l.Reset(r, filename)
+}
+
+// Reset starts the lexer again on a new source. The lexer's buffers,
+// including the one for reading, are reused so it's cheap to lex lots of
+// small sources with the same lexer.
+func (l *Lexer) Reset(r io.Reader, filename string) {
 	// start afresh
 	l.Init(filename)
-	l.reader = bufio.NewReader(r)
+	if l.reader == nil {
+		l.reader = bufio.NewReader(r)
+	} else {
+		l.reader.Reset(r)
+	}
+
+	// a byte order mark at the very start is ignored like Go does.
+	if first, size, err := l.reader.ReadRune(); err == nil {
+		if first != byteOrderMark {
+			l.reader.UnreadRune()
+		} else if l.stats != nil {
+			l.stats.Bytes += size
+		}
+	}
+}
+
+// DumpTokens lexes to the end of the source and writes one line per
+// token to w, with where it is, its kind and its value if it has one.
+// It's for finding out whether a parse error is really the lexer
+// misreading something. The lexer can still be used afterwards as long
+// as nothing's been read from it yet - the source is lexed from a copy.
+func (l *Lexer) DumpTokens(w io.Writer) error {
+	// read the rest of the source so it can be lexed twice.
+	src, err := io.ReadAll(l.reader)
+	if err != nil {
+		return err
+	}
+
+	l.reader = bufio.NewReader(bytes.NewReader(src))
+
+	dump := NewLexer()
+	dump.SetTabWidth(l.tabWidth)
+	dump.LexReader(bytes.NewReader(src), l.sourceFile)
+	dump.loc = l.loc
+	for {
+		tok, err := dump.GetToken()
+		if err != nil {
+			return err
+		}
+
+		pos := tok.Pos()
+		line := fmt.Sprintf("%d:%d-%d:%d %v", pos.start.Line, pos.start.Column, pos.end.Line, pos.end.Column, tok.TokenKind())
+		switch t := tok.(type) {
+		case StringToken:
+			if t.TokenKind() == TokenKindLiteralString {
+				line += " " + strconv.Quote(t.strVal)
+			} else {
+				line += " " + t.strVal
+			}
+
+		case UintToken:
+			if t.TokenKind() == TokenKindLiteralRune {
+				line += " " + strconv.QuoteRune(rune(t.uintVal))
+			} else {
+				line += " " + strconv.FormatUint(t.uintVal, 10)
+			}
+
+		case FloatToken:
+			line += " " + strconv.FormatFloat(t.floatVal, 'g', -1, 64)
+		}
+
+		_, err = fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+
+		if tok.TokenKind() == TokenKindEndOfSource {
+			return nil
+		}
+	}
 }
 
 // getBufferedRune gets a rune from the source including comments etc..
-// it's designed to be called from getUntrackedRune() only.
+// it's designed to be called from getNonCommentRune() only.
 func (l *Lexer) getBufferedRune() (rune, error) {
 	if l.haveNextRune {
 		// get it from our buffer
@@ -143,7 +281,10 @@ func (l *Lexer) getBufferedRune() (rune, error) {
 		return l.nextRune, nil
 	} else {
 		// read it
-		r, _, err := l.reader.ReadRune()
+		r, size, err := l.reader.ReadRune()
+		if l.stats != nil {
+			l.stats.Bytes += size
+		}
 		return r, err
 	}
 }
@@ -157,7 +298,7 @@ func (l *Lexer) getUntrackedRune() (rune, error) {
 		r := l.ncNextRunes[0]
 
 		// remove it from the buffer
-		for i := l.ncNextRuneCount - 1; i > 0; i-- {
+		for i := 1; i < l.ncNextRuneCount; i++ {
 			l.ncNextRunes[i-1] = l.ncNextRunes[i]
 		}
 		l.ncNextRuneCount--
@@ -165,6 +306,14 @@ func (l *Lexer) getUntrackedRune() (rune, error) {
 		return r, nil
 	}
 
+	r, err := l.getNonCommentRune()
+	l.trackLineStart(r)
+	return r, err
+}
+
+// getNonCommentRune gets a rune from the source while removing comments.
+// it doesn't use the ncNextRunes buffer.
+func (l *Lexer) getNonCommentRune() (rune, error) {
 	// get a rune
 	r, err := l.getBufferedRune()
 	if err != nil {
@@ -186,9 +335,19 @@ func (l *Lexer) getUntrackedRune() (rune, error) {
 				}
 			}
 
+			if l.stats != nil && (r2 == '/' || r2 == '*') {
+				l.stats.Comments++
+			}
+
 			switch r2 {
 			case '/':
-				// comment until end of line, absorb the rest of the line
+				// comment until end of line, absorb the rest of the line.
+				// comments at the top of the file are kept in case they're
+				// build constraints, ones at the start of a line might be
+				// line directives and ones on a line of their own might be
+				// doc comments.
+				keep := !l.pastHeader || l.lineBlank
+				var comment []rune
 				for {
 					r, err = l.getBufferedRune()
 					if err != nil {
@@ -197,8 +356,21 @@ func (l *Lexer) getUntrackedRune() (rune, error) {
 
 					if r == '\n' {
 						// return end of line
+						if !l.pastHeader {
+							l.headerComment(string(comment))
+						}
+						if l.lineStart {
+							l.checkLineDirective(string(comment))
+						}
+						if l.lineBlank {
+							l.addDocComment(string(comment))
+						}
 						return r, nil
 					}
+
+					if keep {
+						comment = append(comment, r)
+					}
 				}
 
 			case '*':
@@ -249,20 +421,143 @@ func (l *Lexer) getUntrackedRune() (rune, error) {
 	return r, nil
 }
 
+// trackLineStart keeps track of whether we're at the start of a line, or
+// at least haven't seen anything but spaces on it yet.
+func (l *Lexer) trackLineStart(r rune) {
+	l.lineStart = r == '\n'
+	l.lineBlank = r == '\n' || (l.lineBlank && (r == ' ' || r == '\t' || r == '\r'))
+}
+
+// addDocComment remembers a line comment which is on a line of its own.
+// Comments on consecutive lines are joined up, so whatever's on the line
+// after them can find its doc comment.
+func (l *Lexer) addDocComment(comment string) {
+	comment = strings.TrimRight(comment, "\r")
+	comment = strings.TrimPrefix(comment, " ")
+
+	// any line ends we've read ahead come before the comment.
+	line := l.loc.Line
+	for _, r := range l.ncNextRunes[:l.ncNextRuneCount] {
+		if r == '\n' {
+			line++
+		}
+	}
+
+	if l.docComments == nil {
+		l.docComments = map[int]string{}
+	}
+
+	if prev, ok := l.docComments[line]; ok {
+		comment = prev + "\n" + comment
+		delete(l.docComments, line)
+	}
+
+	l.docComments[line+1] = comment
+}
+
+// DocComment gets the comment lines just before a line, if there are any.
+// A blank line in between means they're not its doc comment.
+func (l *Lexer) DocComment(line int) string {
+	return l.docComments[line]
+}
+
+// headerComment looks at a line comment from the top of the file to see
+// if it's a "//go:build" constraint. Only the first one counts.
+func (l *Lexer) headerComment(comment string) {
+	expr, ok := buildConstraintExpr(strings.TrimRight(comment, "\r"))
+	if !ok || l.haveBuildConstraint {
+		return
+	}
+
+	// we're at the start of the comment since it's before any tokens.
+	l.buildConstraint = expr
+	l.buildConstraintPos = SrcSpan{l.loc, l.loc, l.lineFile}
+	l.haveBuildConstraint = true
+}
+
+// checkLineDirective looks at a line comment from the start of a line to
+// see if it's a "//line file:line" or "//line file:line:column"
+// directive. If it is then the line after it is said to be at that
+// position, which lets generated code point errors at the source it was
+// generated from.
+func (l *Lexer) checkLineDirective(comment string) {
+	comment = strings.TrimRight(comment, "\r")
+	if !strings.HasPrefix(comment, "line ") {
+		return
+	}
+
+	// the filename can have colons in it so the numbers are found from
+	// the end.
+	ld := &lineDirective{column: 1}
+	rest := strings.TrimSpace(comment[len("line "):])
+	var numbers []int
+	for len(numbers) < 2 {
+		colon := strings.LastIndex(rest, ":")
+		if colon < 0 {
+			break
+		}
+
+		n, err := strconv.Atoi(rest[colon+1:])
+		if err != nil || n < 1 {
+			break
+		}
+
+		numbers = append([]int{n}, numbers...)
+		rest = rest[:colon]
+	}
+
+	switch len(numbers) {
+	case 0:
+		return
+	case 1:
+		ld.line = numbers[0]
+	case 2:
+		ld.line, ld.column = numbers[0], numbers[1]
+	}
+
+	ld.filename = rest
+
+	// any line ends we've already read ahead come before this one.
+	l.lineDirective = ld
+	l.lineDirectiveSkip = 0
+	for _, r := range l.ncNextRunes[:l.ncNextRuneCount] {
+		if r == '\n' {
+			l.lineDirectiveSkip++
+		}
+	}
+}
+
+// Filename is the name of the file we're lexing. It can be changed part
+// way through by a "//line" directive.
+func (l *Lexer) Filename() string {
+	return l.sourceFile
+}
+
+// BuildConstraint gets the expression from the "//go:build" comment at
+// the top of the file, if there is one. It's only known once the first
+// token has been peeked at.
+func (l *Lexer) BuildConstraint() (string, SrcSpan, bool) {
+	return l.buildConstraint, l.buildConstraintPos, l.haveBuildConstraint
+}
+
 // peekRune returns a rune from ahead while removing comments from the stream.
 // it doesn't change the line/column tracking.
 func (l *Lexer) peekRune(ahead int) (rune, error) {
 	// make sure the buffer is full enough
 	for l.ncNextRuneCount <= ahead {
 		// get a character
-		r, err := l.getRune()
+		r, err := l.getNonCommentRune()
 		if err != nil {
 			return 0, err
 		}
+		l.trackLineStart(r)
 
 		// buffer it
 		l.ncNextRunes[l.ncNextRuneCount] = r
 		l.ncNextRuneCount++
+		if l.stats != nil && l.ncNextRuneCount > l.stats.MaxRunePeek {
+			l.stats.MaxRunePeek = l.ncNextRuneCount
+		}
 	}
 
 	// return it
@@ -278,12 +573,35 @@ func (l *Lexer) getRune() (rune, error) {
 		return 0, err
 	}
 
+	// the token now extends to this character
+	l.pos.end = l.loc
+
 	// count columns and lines
 	if ch == '\n' {
-		l.pos.end.Line++
-		l.pos.end.Column = 1
+		l.loc.Line++
+		l.loc.Column = 1
+		if l.stats != nil {
+			l.stats.Lines++
+		}
+
+		if l.lineDirective != nil {
+			if l.lineDirectiveSkip > 0 {
+				l.lineDirectiveSkip--
+			} else {
+				// a "//line" directive says where the next line is.
+				l.loc = SrcLoc{l.lineDirective.line, l.lineDirective.column}
+				if l.lineDirective.filename != "" {
+					l.sourceFile = l.lineDirective.filename
+					l.lineFile = l.lineDirective.filename
+				}
+				l.lineDirective = nil
+			}
+		}
+	} else if ch == '\t' && l.tabWidth > 1 {
+		// move on to the next tab stop.
+		l.loc.Column += l.tabWidth - (l.loc.Column-1)%l.tabWidth
 	} else {
-		l.pos.end.Column++
+		l.loc.Column++
 	}
 
 	return ch, nil
@@ -331,13 +649,17 @@ func (l *Lexer) skipWhitespace() error {
 // GetToken gets the next token from the buffer.
 // returns the token and an error.
 func (l *Lexer) GetToken() (Token, error) {
+	if l.closed {
+		return nil, l.closedError()
+	}
+
 	// do we have a buffered token?
 	if l.nextTokenCount > 0 {
 		// get it from the buffer
 		t := l.nextTokens[0]
 
 		// remove it from the buffer
-		for i := l.nextTokenCount - 1; i > 0; i-- {
+		for i := 1; i < l.nextTokenCount; i++ {
 			l.nextTokens[i-1] = l.nextTokens[i]
 		}
 		l.nextTokens[l.nextTokenCount-1] = nil
@@ -346,16 +668,20 @@ func (l *Lexer) GetToken() (Token, error) {
 		return t, nil
 	}
 
-	return l.lexToken()
+	return l.lexNextToken()
 }
 
 // PeekToken returns the next token from the line buffer without removing it.
 // returns the token and an error.
 func (l *Lexer) PeekToken(ahead int) (Token, error) {
+	if l.closed {
+		return nil, l.closedError()
+	}
+
 	// make sure the nextTokens buffer is full enough
 	for l.nextTokenCount <= ahead {
 		// get a token
-		t, err := l.lexToken()
+		t, err := l.lexNextToken()
 		if err != nil {
 			return nil, err
 		}
@@ -363,27 +689,65 @@ func (l *Lexer) PeekToken(ahead int) (Token, error) {
 		// buffer it
 		l.nextTokens[l.nextTokenCount] = t
 		l.nextTokenCount++
+		if l.stats != nil && l.nextTokenCount > l.stats.MaxTokenPeek {
+			l.stats.MaxTokenPeek = l.nextTokenCount
+		}
 	}
 
 	// return it
 	return l.nextTokens[ahead], nil
 }
 
+// closedError is the error for trying to use a closed lexer.
+func (l *Lexer) closedError() error {
+	return NewError(l.sourceFile, l.pos, "I can't read any more tokens - the lexer's been closed")
+}
+
+// lexNextToken lexes the next token. Once there's been an error it keeps
+// giving the same error rather than trying to carry on lexing from
+// somewhere in the middle of the problem.
+func (l *Lexer) lexNextToken() (Token, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	t, err := l.lexToken()
+	if err != nil {
+		l.err = err
+	}
+
+	return t, err
+}
+
 // lexToken gets the next token from the line buffer.
 // adds the token to the token list.
 // returns success and an error. success is false at end of line.
 func (l *Lexer) lexToken() (Token, error) {
+	if l.stats != nil {
+		l.stats.Tokens++
+	}
+
 	// get a character
 	err := l.skipWhitespace()
 	if err != nil {
 		return nil, err
 	}
 
-	l.pos.start = l.pos.end
+	// comments after this aren't at the top of the file.
+	l.pastHeader = true
+
+	l.pos.start = l.loc
+	l.pos.end = l.loc
+	l.pos.file = l.lineFile
 
 	// get the next character
 	ch, err := l.peekRune(0)
 	if err != nil {
+		if err == io.EOF {
+			// we're at the end of the source
+			return SimpleToken{l.pos, TokenKindEndOfSource}, nil
+		}
+
 		return nil, err
 	}
 
@@ -392,14 +756,21 @@ func (l *Lexer) lexToken() (Token, error) {
 		// get the word
 		word := l.getWord()
 
-		// is it a keyword?
-		token, ok := keywords[word]
+		// is it a keyword? looking it up like this doesn't allocate.
+		token, ok := keywords[string(word)]
 		if ok {
 			return SimpleToken{l.pos, token}, nil
 		}
 
-		// it must be an identifier
-		return StringToken{SimpleToken{l.pos, TokenKindIdentifier}, word}, nil
+		// it must be an identifier. names get used over and over so they
+		// share a string.
+		name, ok := l.names[string(word)]
+		if !ok {
+			name = string(word)
+			l.names[name] = name
+		}
+
+		return StringToken{SimpleToken{l.pos, TokenKindIdentifier}, name}, nil
 	}
 
 	// is it a numeric literal?
@@ -431,201 +802,137 @@ func (l *Lexer) lexToken() (Token, error) {
 		return l.getStringLiteral()
 	}
 
-	return nil, errors.New(fmt.Sprintf("illegal character '%c' (0x%02x)", ch, ch))
+	if ch == byteOrderMark {
+		// LexReader() has already skipped one at the start of the file.
+		return nil, NewError(l.sourceFile, l.pos, "there's a byte order mark here but they're only allowed at the very start of a file")
+	}
+
+	return nil, NewError(l.sourceFile, l.pos, fmt.Sprintf("illegal character '%c' (0x%02x)", ch, ch))
 }
 
-// getOperator gets an operator token.
-// returns the token, the number of characters absorbed and success.
-func (l *Lexer) getOperator(ch rune) (TokenKind, int, bool) {
-	// operator lexing is performed as a hard-coded trie for speed.
-	switch ch {
-	case '+':
-		ch2, _ := l.peekRune(1)
-		switch ch2 {
-		case '=': // '+='
-			return TokenKindAddAssign, 2, true
-		case '+': // '++'
-			return TokenKindIncrement, 2, true
-		default: // '+'
-			return TokenKindAdd, 1, true
-		}
+// type operatorTrie is a node in a trie of all the operators. Following
+// an operator's characters down from the root gets to a node with its
+// kind. It's made from the operators in tokenKindNames so there's only
+// one list of them to keep up to date.
+type operatorTrie struct {
+	kind     TokenKind
+	isOp     bool                         // true if the characters which got here are an operator.
+	children [utf8.RuneSelf]*operatorTrie // operators are all ASCII.
+}
 
-	case '-':
-		ch2, _ := l.peekRune(1)
-		switch ch2 {
-		case '=': // '-='
-			return TokenKindSubtractAssign, 2, true
-		case '-': // '--'
-			return TokenKindDecrement, 2, true
-		default: // '-'
-			return TokenKindSubtract, 1, true
-		}
+var operators = makeOperatorTrie()
 
-	case '*':
-		ch2, _ := l.peekRune(1)
-		if ch2 == '=' { // '*='
-			return TokenKindMultiplyAssign, 2, true
-		} else { // '*'
-			return TokenKindAsterisk, 1, true
-		}
-
-	case '/':
-		ch2, _ := l.peekRune(1)
-		if ch2 == '=' { // '/='
-			return TokenKindDivideAssign, 2, true
-		} else { // '/'
-			return TokenKindDivide, 1, true
-		}
+// the longest operators are three characters, like "<<=" and "...".
+const maxOperatorLength = 3
 
-	case '%':
-		ch2, _ := l.peekRune(1)
-		if ch2 == '=' { // '%='
-			return TokenKindModulusAssign, 2, true
-		} else { // '%'
-			return TokenKindModulus, 1, true
+// makeOperatorTrie builds the trie from the names in tokenKindNames which
+// don't have any letters in them.
+func makeOperatorTrie() *operatorTrie {
+	root := new(operatorTrie)
+	for tk, name := range tokenKindNames {
+		if strings.IndexFunc(name, unicode.IsLetter) >= 0 {
+			continue
 		}
 
-	case '&':
-		ch2, _ := l.peekRune(1)
-		switch ch2 {
-		case '=': // '&='
-			return TokenKindBitwiseAndAssign, 2, true
-		case '&': // '&&'
-			return TokenKindLogicalAnd, 2, true
-		default: // '&'
-			return TokenKindBitwiseAnd, 1, true
+		node := root
+		for i := 0; i < len(name); i++ {
+			if node.children[name[i]] == nil {
+				node.children[name[i]] = new(operatorTrie)
+			}
+			node = node.children[name[i]]
 		}
 
-	case '|':
-		ch2, _ := l.peekRune(1)
-		switch ch2 {
-		case '=': // '|='
-			return TokenKindBitwiseOrAssign, 2, true
-		case '|': // '||'
-			return TokenKindLogicalOr, 2, true
-		default: // '|'
-			return TokenKindBitwiseOr, 1, true
-		}
+		node.kind = tk
+		node.isOp = true
+	}
 
-	case '^':
-		ch2, _ := l.peekRune(1)
-		if ch2 == '=' { // '^='
-			return TokenKindBitwiseExorAssign, 2, true
-		} else { // '^'
-			return TokenKindBitwiseExor, 1, true
-		}
+	return root
+}
 
-	case '<':
-		ch2, _ := l.peekRune(1)
-		switch ch2 {
-		case '<':
-			// look ahead another character
-			ch3, _ := l.peekRune(2)
-			if ch3 == '=' { // '<<='
-				return TokenKindShiftLeftAssign, 3, true
-			} else { // '<<'
-				return TokenKindShiftLeft, 2, true
+// getOperator gets an operator token. The longest operator which
+// matches wins so "<<=" isn't lexed as "<<" then "=".
+// returns the token, the number of characters absorbed and success.
+func (l *Lexer) getOperator(ch rune) (TokenKind, int, bool) {
+	var kind TokenKind
+	length := 0
+	node := operators
+	for i := 0; i < maxOperatorLength; i++ {
+		if i > 0 {
+			var err error
+			ch, err = l.peekRune(i)
+			if err != nil {
+				break
 			}
-		case '=': // '<='
-			return TokenKindLessEqual, 2, true
-		case '-': // '<-'
-			return TokenKindChannelArrow, 2, true
-		default: // '<'
-			return TokenKindLess, 1, true
 		}
 
-	case '>':
-		ch2, _ := l.peekRune(1)
-		switch ch2 {
-		case '>':
-			// look ahead another character
-			ch3, _ := l.peekRune(2)
-			if ch3 == '=' { // '>>='
-				return TokenKindShiftRightAssign, 3, true
-			} else { // '>>'
-				return TokenKindShiftRight, 2, true
-			}
-		case '=': // '>='
-			return TokenKindGreaterEqual, 2, true
-		default: // '>'
-			return TokenKindGreater, 1, true
+		if ch < 0 || ch >= utf8.RuneSelf || node.children[ch] == nil {
+			break
 		}
 
-	case '=':
-		ch2, _ := l.peekRune(1)
-		if ch2 == '=' { // '=='
-			return TokenKindEquals, 2, true
-		} else { // '='
-			return TokenKindAssign, 1, true
+		node = node.children[ch]
+		if node.isOp {
+			kind = node.kind
+			length = i + 1
 		}
+	}
 
-	case '!':
-		ch2, _ := l.peekRune(1)
-		if ch2 == '=' { // '!='
-			return TokenKindNotEqual, 2, true
-		} else { // '!'
-			return TokenKindNot, 1, true
-		}
+	return kind, length, length > 0
+}
 
-	case ':':
-		ch2, _ := l.peekRune(1)
-		if ch2 == '=' { // ':='
-			return TokenKindDeclareAssign, 2, true
-		} else { // ':'
-			return TokenKindColon, 1, true
-		}
-
-	case '.': // '.'
-		return TokenKindDot, 1, true
-	case ',': // ','
-		return TokenKindComma, 1, true
-	case '(': // '('
-		return TokenKindOpenBracket, 1, true
-	case ')': // ')'
-		return TokenKindCloseBracket, 1, true
-	case '[': // '['
-		return TokenKindOpenSquareBracket, 1, true
-	case ']': // ']'
-		return TokenKindCloseSquareBracket, 1, true
-	case '{': // '{'
-		return TokenKindOpenBrace, 1, true
-	case '}': // '}'
-		return TokenKindCloseBrace, 1, true
-	case ';': // ';'
-		return TokenKindSemicolon, 1, true
-	}
-
-	return 0, 0, false
-}
-
-// getWord gets an identifier. returns the word.
-func (l *Lexer) getWord() string {
+// getWord gets an identifier. returns the word, which is in a buffer
+// that's reused so it's only good until the next word.
+func (l *Lexer) getWord() []byte {
 	// get characters until the end
-	var word string
+	word := l.wordBuf[:0]
 	for {
 		// get the next rune
 		ch, err := l.peekRune(0)
 		if err != nil {
-			return word
+			break
 		}
 
-		// done at end of word
-		if !unicode.IsLetter(ch) && ch != '_' {
-			return word
+		// done at end of word. digits can go anywhere but the start.
+		if !unicode.IsLetter(ch) && ch != '_' && (len(word) == 0 || !unicode.IsDigit(ch)) {
+			break
 		}
 
 		// add the character to our word and move to the next character
-		word += string(ch)
+		word = utf8.AppendRune(word, ch)
 		l.getRune()
 	}
+
+	l.wordBuf = word
+	return word
 }
 
 // getNumeric gets a number.
 // XXX - this is currently a quickie version. This should be reimplemented fully according to spec later.
 func (l *Lexer) getNumeric() (Token, error) {
+	// is there a base prefix like "0x"?
+	wordBuf := l.wordBuf[:0]
+	base := 10
+	ch, _ := l.peekRune(0)
+	ch2, _ := l.peekRune(1)
+	if ch == '0' {
+		switch unicode.ToLower(ch2) {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+
+		if base != 10 {
+			wordBuf = utf8.AppendRune(wordBuf, ch)
+			wordBuf = utf8.AppendRune(wordBuf, ch2)
+			l.tossRunes(2)
+		}
+	}
+
 	// get characters until the end
-	var word string
 	var isFloat bool
+	var prev rune
 	for {
 		// get the next rune
 		ch, err := l.peekRune(0)
@@ -633,33 +940,59 @@ func (l *Lexer) getNumeric() (Token, error) {
 			break
 		}
 
-		// done at end of word
-		if !unicode.IsDigit(ch) && ch != '.' && ch != 'e' {
-			break
-		}
-
-		// take note if it looks like a float
-		if ch == '.' || ch == 'e' {
+		// done at end of word. digits which are too big for the base are
+		// included so they get reported. an exponent can have a sign.
+		if base == 10 && (ch == '.' || ch == 'e' || ch == 'E') {
+			// take note if it looks like a float
 			isFloat = true
+		} else if base == 10 && isFloat && (ch == '+' || ch == '-') && (prev == 'e' || prev == 'E') {
+			// it's the exponent's sign.
+		} else if !unicode.IsDigit(ch) && !isDigit(ch, base) && ch != '_' {
+			break
 		}
 
 		// add the character to our word and move to the next character
-		word += string(ch)
+		wordBuf = utf8.AppendRune(wordBuf, ch)
 		l.getRune()
+		prev = ch
 	}
 
+	l.wordBuf = wordBuf
+	word := string(wordBuf)
+
+	// underscores can only go between digits.
+	err := l.checkDigitSeparators(word, base)
+	if err != nil {
+		return nil, err
+	}
+
+	digits := strings.ReplaceAll(word, "_", "")
+
 	// is the next character a "." or "e"? If so, it's a float.
 	if isFloat {
 		// parse the float
-		v, err := strconv.ParseFloat(word, 128)
+		v, err := strconv.ParseFloat(digits, 128)
 		if err != nil {
 			return nil, NewError(l.sourceFile, l.pos, err.Error())
 		}
 
 		return FloatToken{SimpleToken{l.pos, TokenKindLiteralFloat}, v}, nil
 	} else {
+		if base != 10 {
+			digits = digits[2:]
+			if digits == "" {
+				return nil, NewError(l.sourceFile, l.pos, fmt.Sprint("there should be some digits after the '", word[:2], "'"))
+			}
+		} else if len(digits) > 1 && digits[0] == '0' {
+			// a leading zero is the old way of writing octal.
+			base = 8
+			if i := strings.IndexAny(digits, "89"); i >= 0 {
+				return nil, NewError(l.sourceFile, l.pos, fmt.Sprint("'", digits[i:i+1], "' isn't an octal digit - numbers starting with '0' are octal"))
+			}
+		}
+
 		// it's an int, parse it
-		v, err := strconv.ParseUint(word, 10, 64)
+		v, err := strconv.ParseUint(digits, base, 64)
 		if err != nil {
 			return nil, NewError(l.sourceFile, l.pos, err.Error())
 		}
@@ -668,6 +1001,46 @@ func (l *Lexer) getNumeric() (Token, error) {
 	}
 }
 
+// isDigit says if a rune is a digit in the given base.
+func isDigit(ch rune, base int) bool {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return int(ch-'0') < base
+	case ch >= 'a' && ch <= 'f':
+		return base == 16
+	case ch >= 'A' && ch <= 'F':
+		return base == 16
+	}
+
+	return false
+}
+
+// isDigitChar says if a character from a number in the given base is a
+// digit, even if it's too big for the base.
+func isDigitChar(ch byte, base int) bool {
+	return (ch >= '0' && ch <= '9') || (base == 16 && isDigit(rune(ch), 16))
+}
+
+// checkDigitSeparators makes sure any '_' in a number goes between two
+// digits, or between a base prefix like "0x" and a digit.
+func (l *Lexer) checkDigitSeparators(word string, base int) error {
+	for i, ch := range word {
+		if ch != '_' {
+			continue
+		}
+
+		afterPrefix := base != 10 && i == 2
+		if (!afterPrefix && (i == 0 || !isDigitChar(word[i-1], base))) || i+1 >= len(word) || !isDigitChar(word[i+1], base) {
+			pos := l.pos
+			pos.start.Column += i
+			pos.end = pos.start
+			return NewError(l.sourceFile, pos, "a '_' in a number has to go between two digits")
+		}
+	}
+
+	return nil
+}
+
 // getRuneLiteral gets a single character rune literal.
 func (l *Lexer) getRuneLiteral() (Token, error) {
 	// get it as a string literal
@@ -696,13 +1069,19 @@ func (l *Lexer) getStringLiteral() (Token, error) {
 }
 
 // getStringLiteralSimple gets a string literal, returning it as a []rune.
+// the runes are in a buffer which is reused for the next string.
 // XXX - this is currently a quickie version. This should be reimplemented fully according to spec later.
 func (l *Lexer) getStringLiteralSimple() ([]rune, error) {
 	// get the open quote
 	quote, _ := l.getRune()
 
-	// get characters until we find the closing quote
-	str := make([]rune, 0, initialStringStorage)
+	// get characters until we find the closing quote. the buffer's reused
+	// so the result is only good until the next string.
+	if l.stringBuf == nil {
+		l.stringBuf = make([]rune, 0, initialStringStorage)
+	}
+
+	str := l.stringBuf[:0]
 	for {
 		ch, err := l.getRune()
 		if err != nil {
@@ -712,6 +1091,7 @@ func (l *Lexer) getStringLiteralSimple() ([]rune, error) {
 
 		if ch == quote {
 			// we're at the end of the string
+			l.stringBuf = str
 			return str, nil
 		}
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"unicode"
 )
 
 func TestLexerLexLine(t *testing.T) {
@@ -29,7 +30,7 @@ k += 'X';`)
 		t.Error("wrong token kind")
 		return
 	}
-	if fmt.Sprint(tok.Pos()) != "{{1 1} {1 7}}" {
+	if tok.Pos() != (SrcSpan{SrcLoc{1, 1}, SrcLoc{1, 7}, ""}) {
 		t.Error("wrong token pos:", tok.Pos())
 		return
 	}
@@ -129,125 +130,741 @@ k += 'X';`)
 	*/
 }
 
-/*
 func TestLexerGetWord(t *testing.T) {
-	l := setupLexerTest("hello")
-	if l.getWord() != "hello" {
-		t.Error("getWord() failed")
+	for _, src := range []string{"hello", "hello ", "hello<"} {
+		l := setupLexerTest(src)
+		if word := string(l.getWord()); word != "hello" {
+			t.Errorf("getWord() on '%s' gave '%s'", src, word)
+		}
 	}
+}
 
-	l = setupLexerTest("hello ")
-	if l.getWord() != "hello" {
-		t.Error("getWord() failed")
+func TestLexerIdentifiers(t *testing.T) {
+	cases := []struct {
+		src  string
+		word string
+	}{
+		{"foo2bar", "foo2bar"},
+		{"x1+", "x1"},
+		{"_9 ", "_9"},
+		{"αβγ", "αβγ"},
+		{"π2;", "π2"},
+		{"日本語", "日本語"},
 	}
 
-	l = setupLexerTest("hello<")
-	if l.getWord() != "hello" {
-		t.Error("getWord() failed")
+	for _, c := range cases {
+		tok, err := setupLexerTest(c.src).GetToken()
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		if st, ok := tok.(StringToken); !ok || st.TokenKind() != TokenKindIdentifier || st.strVal != c.word {
+			t.Errorf("'%s' gave %#v, expected the identifier '%s'", c.src, tok, c.word)
+		}
+	}
+}
+
+func TestLexerIdentifierWithDigits(t *testing.T) {
+	l := setupLexerTest("v123 := 1")
+
+	tok, err := l.GetToken()
+	if st, ok := tok.(StringToken); err != nil || !ok || st.TokenKind() != TokenKindIdentifier || st.strVal != "v123" {
+		t.Fatalf("expected the identifier 'v123', got %#v, %v", tok, err)
+	}
+
+	for _, kind := range []TokenKind{TokenKindDeclareAssign, TokenKindLiteralInt, TokenKindEndOfSource} {
+		tok, err = l.GetToken()
+		if err != nil || tok.TokenKind() != kind {
+			t.Fatalf("expected %v, got %#v, %v", kind, tok, err)
+		}
 	}
 }
 
 func TestLexerGetNumericInteger(t *testing.T) {
-	// integer with no trailing character
-	l := setupLexerTest("12345")
-	err := l.getNumeric()
-	if err != nil {
-		t.Errorf("getNumeric() failed: %s", err)
+	// integer with and without a trailing character
+	for _, src := range []string{"12345", "12345;"} {
+		tok, err := setupLexerTest(src).getNumeric()
+		if err != nil {
+			t.Errorf("getNumeric() failed: %s", err)
+			continue
+		}
+
+		if tok.TokenKind() != TokenKindLiteralInt || tok.(UintToken).uintVal != 12345 {
+			t.Errorf("getNumeric() on '%s' gave %#v", src, tok)
+		}
 	}
+}
 
-	l.tokens.StartReading()
-	tok, _ := l.tokens.GetToken()
-	if tok != TokenKindUint || l.tokens.GetValueUint64() != 12345 {
-		t.Error("getNumeric() failed")
+func TestLexerGetNumericBases(t *testing.T) {
+	cases := []struct {
+		src string
+		val uint64
+	}{
+		{"1_000", 1000},
+		{"0x_1", 1},
+		{"0xFF_ff", 0xffff},
+		{"0b1_0", 2},
+		{"0o7_7;", 63},
+		{"0755", 0755},
+		{"0_17", 15},
+		{"00", 0},
+		{"0", 0},
 	}
 
-	// now with a trailing character
-	l = setupLexerTest("36212;")
-	err = l.getNumeric()
-	if err != nil {
-		t.Errorf("getNumeric() failed: %s", err)
+	for _, c := range cases {
+		tok, err := setupLexerTest(c.src).getNumeric()
+		if err != nil {
+			t.Errorf("getNumeric() on '%s' failed: %s", c.src, err)
+			continue
+		}
+
+		if tok.TokenKind() != TokenKindLiteralInt || tok.(UintToken).uintVal != c.val {
+			t.Errorf("getNumeric() on '%s' gave %#v", c.src, tok)
+		}
+	}
+
+	// a leading underscore makes it an identifier, like in Go.
+	tok, err := setupLexerTest("_100").GetToken()
+	if err != nil || tok.TokenKind() != TokenKindIdentifier {
+		t.Errorf("expected '_100' to be an identifier, got %#v, %v", tok, err)
+	}
+}
+
+func TestLexerDigitSeparatorErrors(t *testing.T) {
+	cases := []struct {
+		src    string
+		column int
+	}{
+		{"100_", 4},
+		{"1__0", 2},
+		{"1_.5", 2},
+		{"0x__1", 3},
+		{"0_x1", 2},
+		{"x := 0b_;", 8},
 	}
 
-	l.tokens.StartReading()
-	tok, _ = l.tokens.GetToken()
-	if tok != TokenKindUint || l.tokens.GetValueUint64() != 36212 {
-		t.Error("getNumeric() failed")
+	for _, c := range cases {
+		l := setupLexerTest(c.src)
+		var err error
+		for err == nil {
+			var tok Token
+			tok, err = l.GetToken()
+			if err == nil && tok.TokenKind() == TokenKindEndOfSource {
+				break
+			}
+		}
+
+		e, ok := err.(*Error)
+		if !ok || e.message != "a '_' in a number has to go between two digits" || e.pos.start.Column != c.column {
+			t.Errorf("'%s' gave error %v, expected a bad '_' at column %d", c.src, err, c.column)
+		}
 	}
 }
 
 func TestLexerGetNumericFloat(t *testing.T) {
-	// integer with no trailing character
-	l := setupLexerTest("12.345")
-	err := l.getNumeric()
-	if err != nil {
-		t.Errorf("getNumeric() failed: %s", err)
+	cases := []struct {
+		src string
+		val float64
+	}{
+		{"12.345", 12.345},
+		{"1.469e1;", 1.469e1},
+		{"1e-5", 1e-5},
+		{"2.5E+3;", 2.5e3},
+		{"1e5-2", 1e5},
+		{"09.5", 9.5},
 	}
 
-	l.tokens.StartReading()
-	tok, _ := l.tokens.GetToken()
-	if tok != TokenKindFloat64 || l.tokens.GetValueFloat64() != 12.345 {
-		t.Error("getNumeric() failed")
+	for _, c := range cases {
+		tok, err := setupLexerTest(c.src).getNumeric()
+		if err != nil {
+			t.Errorf("getNumeric() failed: %s", err)
+			continue
+		}
+
+		if tok.TokenKind() != TokenKindLiteralFloat || tok.(FloatToken).floatVal != c.val {
+			t.Errorf("getNumeric() on '%s' gave %#v", c.src, tok)
+		}
 	}
+}
 
-	// now with a trailing character
-	l = setupLexerTest("1.469e1;")
-	err = l.getNumeric()
-	if err != nil {
-		t.Errorf("getNumeric() failed: %s", err)
+func TestLexerGetNumericErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		err string
+	}{
+		{"0789", "-:1: '8' isn't an octal digit - numbers starting with '0' are octal"},
+		{"1e+", "-:1: strconv.ParseFloat: parsing \"1e+\": invalid syntax"},
 	}
 
-	l.tokens.StartReading()
-	tok, _ = l.tokens.GetToken()
-	if tok != TokenKindFloat64 || l.tokens.GetValueFloat64() != 1.469e1 {
-		t.Error("getNumeric() failed")
+	for _, c := range cases {
+		_, err := setupLexerTest(c.src).getNumeric()
+		if err == nil || err.Error() != c.err {
+			t.Errorf("getNumeric() on '%s' should give '%s', got %v", c.src, c.err, err)
+		}
+	}
+}
+
+func TestLexerHexNotExponent(t *testing.T) {
+	// an 'e' is a hex digit so a sign after it isn't an exponent.
+	cases := []struct {
+		src   string
+		left  uint64
+		op    TokenKind
+		right uint64
+	}{
+		{"0xe-1", 0xe, TokenKindSubtract, 1},
+		{"0x1e+2", 0x1e, TokenKindAdd, 2},
+		{"0xFE-1", 0xfe, TokenKindSubtract, 1},
+	}
+
+	for _, c := range cases {
+		l := setupLexerTest(c.src)
+		var toks []Token
+		for i := 0; i < 3; i++ {
+			tok, err := l.GetToken()
+			if err != nil {
+				t.Fatalf("'%s' gave error %v", c.src, err)
+			}
+
+			toks = append(toks, tok)
+		}
+
+		left, lok := toks[0].(UintToken)
+		right, rok := toks[2].(UintToken)
+		if !lok || !rok || left.uintVal != c.left || toks[1].TokenKind() != c.op || right.uintVal != c.right {
+			t.Errorf("'%s' gave %v, expected %d %v %d", c.src, toks, c.left, c.op, c.right)
+		}
 	}
 }
 
 func TestLexerGetRuneLiteral(t *testing.T) {
-	l := setupLexerTest("'a'")
-	err := l.getRuneLiteral()
+	tok, err := setupLexerTest("'a'").getRuneLiteral()
 	if err != nil {
-		t.Errorf("getRuneLiteral() failed: %s", err)
+		t.Fatalf("getRuneLiteral() failed: %s", err)
 	}
 
-	l.tokens.StartReading()
-	tok, _ := l.tokens.GetToken()
-	if tok != TokenKindRune || l.tokens.GetValueUint64() != uint64('a') {
-		t.Error("getRuneLiteral() failed")
+	if tok.TokenKind() != TokenKindLiteralRune || tok.(UintToken).uintVal != uint64('a') {
+		t.Errorf("getRuneLiteral() gave %#v", tok)
 	}
 }
 
 func TestLexerGetStringLiteral(t *testing.T) {
-	l := setupLexerTest("\"hello\"")
-	err := l.getStringLiteral()
-	if err != nil {
-		t.Errorf("getStringLiteral() failed: %s", err)
+	for _, src := range []string{"\"hello\"", "`hello`"} {
+		tok, err := setupLexerTest(src).getStringLiteral()
+		if err != nil {
+			t.Errorf("getStringLiteral() failed: %s", err)
+			continue
+		}
+
+		if tok.TokenKind() != TokenKindLiteralString || tok.(StringToken).strVal != "hello" {
+			t.Errorf("getStringLiteral() on '%s' gave %#v", src, tok)
+		}
+	}
+}
+
+func TestLexerLiteralKinds(t *testing.T) {
+	// literals get their own token kinds, separate from the type names.
+	l := setupLexerTest("x = 42 + int(7.5)")
+	expected := []TokenKind{TokenKindIdentifier, TokenKindAssign, TokenKindLiteralInt, TokenKindAdd, TokenKindIdentifier, TokenKindOpenBracket, TokenKindLiteralFloat, TokenKindCloseBracket}
+	for i, kind := range expected {
+		tok, err := l.GetToken()
+		if err != nil {
+			t.Fatal("error lexing: ", err)
+		}
+
+		if tok.TokenKind() != kind {
+			t.Errorf("token %d has kind %d, expected %d", i, tok.TokenKind(), kind)
+		}
+	}
+}
+
+func setupLexerTest(source string) *Lexer {
+	l := NewLexer()
+	l.LexReader(strings.NewReader(source), "-")
+
+	return l
+}
+
+func FuzzLexer(f *testing.F) {
+	f.Add("package main;\n\nimport \"fmt\";\n")
+	f.Add("func main() {\n\tx := 42 + 7.5;\n\tfmt.Println(\"hi\", 'x', `raw`);\n};\n")
+	f.Add("a &^= b << 2; c ... d /* long\ncomment */ e // short\n")
+	f.Add("type T struct { a, b int; c *[]map[string]chan<- int; };")
+
+	f.Fuzz(func(t *testing.T, src string) {
+		l := setupLexerTest(src)
+
+		// every token uses up at least one character, so we should get to
+		// the end well before this.
+		for i := 0; i <= len(src)+1; i++ {
+			tok, err := l.GetToken()
+			if err != nil || tok.TokenKind() == TokenKindEndOfSource {
+				return
+			}
+		}
+
+		t.Fatalf("the lexer didn't reach the end of '%q'", src)
+	})
+}
+
+func TestLexerEllipsis(t *testing.T) {
+	l := NewLexer()
+	l.LexReader(strings.NewReader("a ...int b.c .. ..."), "test.go")
+
+	expected := []TokenKind{TokenKindIdentifier, TokenKindEllipsis, TokenKindIdentifier, TokenKindIdentifier, TokenKindDot, TokenKindIdentifier, TokenKindDot, TokenKindDot, TokenKindEllipsis, TokenKindEndOfSource}
+	for i, kind := range expected {
+		tok, err := l.GetToken()
+		if err != nil {
+			t.Fatal("error lexing: ", err)
+		}
+
+		if tok.TokenKind() != kind {
+			t.Errorf("token %d is %v, expected %v", i, tok.TokenKind(), kind)
+		}
+	}
+}
+
+func TestLexerDumpTokens(t *testing.T) {
+	l := NewLexer()
+	l.LexReader(strings.NewReader("package main;\nvar x = f(\"hi\", 'c', 4.5) + 42;\n"), "test.go")
+
+	var sb strings.Builder
+	if err := l.DumpTokens(&sb); err != nil {
+		t.Fatal("error dumping tokens: ", err)
+	}
+
+	expected := `1:1-1:7 package
+1:9-1:12 identifier main
+1:13-1:13 ;
+2:1-2:3 var
+2:5-2:5 identifier x
+2:7-2:7 =
+2:9-2:9 identifier f
+2:10-2:10 (
+2:11-2:14 string literal "hi"
+2:15-2:15 ,
+2:17-2:19 rune literal 'c'
+2:20-2:20 ,
+2:22-2:24 float literal 4.5
+2:25-2:25 )
+2:27-2:27 +
+2:29-2:30 int literal 42
+2:31-2:31 ;
+3:1-3:1 end of source
+`
+	if sb.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", sb.String(), expected)
+	}
+
+	// the lexer should still work afterwards.
+	tok, err := l.GetToken()
+	if err != nil || tok.TokenKind() != TokenKindPackage {
+		t.Errorf("expected the lexer to start again at 'package', got %v, %v", tok, err)
+	}
+}
+
+func TestLexerDumpTokensTabWidth(t *testing.T) {
+	// the dump has the same columns as GetToken() gives.
+	l := NewLexer()
+	l.SetTabWidth(8)
+	l.LexReader(strings.NewReader("package main;\n\tvar x\t= 1;\n"), "test.go")
+
+	var sb strings.Builder
+	if err := l.DumpTokens(&sb); err != nil {
+		t.Fatal("error dumping tokens: ", err)
+	}
+
+	expected := `1:1-1:7 package
+1:9-1:12 identifier main
+1:13-1:13 ;
+2:9-2:11 var
+2:13-2:13 identifier x
+2:17-2:17 =
+2:19-2:19 int literal 1
+2:20-2:20 ;
+3:1-3:1 end of source
+`
+	if sb.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", sb.String(), expected)
+	}
+
+	for _, line := range []string{"1:1", "1:9", "1:13", "2:9", "2:13", "2:17", "2:19", "2:20"} {
+		tok, err := l.GetToken()
+		if err != nil {
+			t.Fatal("error lexing: ", err)
+		}
+
+		if pos := fmt.Sprintf("%d:%d", tok.Pos().start.Line, tok.Pos().start.Column); pos != line {
+			t.Errorf("%v is at %s but the dump says %s", tok.TokenKind(), pos, line)
+		}
+	}
+}
+
+func TestLexerClose(t *testing.T) {
+	l := setupLexerTest("package main;")
+	if _, err := l.PeekToken(1); err != nil {
+		t.Fatal("error lexing: ", err)
+	}
+
+	l.Close()
+	if tok, err := l.GetToken(); err == nil {
+		t.Errorf("expected an error getting a token after Close(), got %v", tok)
+	}
+
+	if tok, err := l.PeekToken(0); err == nil {
+		t.Errorf("expected an error peeking a token after Close(), got %v", tok)
+	}
+
+	// it can be used again with a new reader.
+	l.LexReader(strings.NewReader("var"), "-")
+	if tok, err := l.GetToken(); err != nil || tok.TokenKind() != TokenKindVar {
+		t.Errorf("expected 'var' after LexReader(), got %v, %v", tok, err)
+	}
+}
+
+func TestLexerReset(t *testing.T) {
+	l := NewLexer()
+	l.Reset(strings.NewReader("package /* half a comment"), "one.go")
+	if tok, err := l.PeekToken(0); err != nil || tok.TokenKind() != TokenKindPackage {
+		t.Fatalf("expected 'package', got %v, %v", tok, err)
+	}
+
+	// start again part way through the first source.
+	l.Reset(strings.NewReader("\n  x := 1"), "two.go")
+	tok, err := l.GetToken()
+	if st, ok := tok.(StringToken); err != nil || !ok || st.strVal != "x" {
+		t.Fatalf("expected 'x' from the second source, got %v, %v", tok, err)
 	}
 
-	l.tokens.StartReading()
-	tok, _ := l.tokens.GetToken()
-	if tok != TokenKindString || l.tokens.GetValueString() != "hello" {
-		t.Error("getStringLiteral() failed")
+	if tok.Pos().start != (SrcLoc{2, 3}) {
+		t.Errorf("expected 'x' at 2:3, got %v", tok.Pos().start)
 	}
 
-	l = setupLexerTest("`hello`")
-	err = l.getStringLiteral()
+	for _, kind := range []TokenKind{TokenKindDeclareAssign, TokenKindLiteralInt, TokenKindEndOfSource} {
+		tok, err = l.GetToken()
+		if err != nil || tok.TokenKind() != kind {
+			t.Fatalf("expected %v, got %v, %v", kind, tok, err)
+		}
+	}
+}
+
+func TestLexerInitClearsNames(t *testing.T) {
+	// the names from one file shouldn't hang around for the next.
+	l := NewLexer()
+	l.LexReader(strings.NewReader("alpha beta alpha"), "one.go")
+	for tok, err := l.GetToken(); err == nil && tok.TokenKind() != TokenKindEndOfSource; tok, err = l.GetToken() {
+	}
+
+	if len(l.names) != 2 {
+		t.Errorf("expected two names from the first file, got %v", l.names)
+	}
+
+	l.LexReader(strings.NewReader("gamma"), "two.go")
+	if tok, err := l.GetToken(); err != nil || tok.(StringToken).strVal != "gamma" {
+		t.Fatalf("expected 'gamma', got %v, %v", tok, err)
+	}
+
+	if len(l.names) != 1 || l.names["alpha"] != "" {
+		t.Errorf("expected just the second file's name, got %v", l.names)
+	}
+}
+
+func TestLexerByteOrderMark(t *testing.T) {
+	l := NewLexer()
+	l.LexReader(strings.NewReader("\xef\xbb\xbfpackage main;"), "test.go")
+
+	tok, err := l.GetToken()
 	if err != nil {
-		t.Errorf("getStringLiteral() failed: %s", err)
+		t.Fatal("error lexing: ", err)
 	}
 
-	l.tokens.StartReading()
-	tok, _ = l.tokens.GetToken()
-	if tok != TokenKindString || l.tokens.GetValueString() != "hello" {
-		t.Error("getStringLiteral() failed")
+	if tok.TokenKind() != TokenKindPackage || tok.Pos().start.Column != 1 {
+		t.Errorf("expected 'package' at column 1, got %v at %v", tok.TokenKind(), tok.Pos())
 	}
 }
 
-func setupLexerTest(source string) *Lexer {
+func TestLexerByteOrderMarkNotAtStart(t *testing.T) {
+	cases := []struct {
+		src    string
+		line   int
+		column int
+	}{
+		{"package main;\n  \xef\xbb\xbfvar x int;", 2, 3},
+		{"\xef\xbb\xbf\xef\xbb\xbfpackage main;", 1, 1},
+	}
+
+	for _, c := range cases {
+		l := NewLexer()
+		l.LexReader(strings.NewReader(c.src), "test.go")
+
+		var err error
+		for err == nil {
+			var tok Token
+			tok, err = l.GetToken()
+			if err == nil && tok.TokenKind() == TokenKindEndOfSource {
+				break
+			}
+		}
+
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%q should have given an error, got %v", c.src, err)
+			continue
+		}
+
+		if e.pos.start.Line != c.line || e.pos.start.Column != c.column || !strings.Contains(e.message, "byte order mark") {
+			t.Errorf("%q gave error %v at %v, expected a byte order mark error at %d:%d", c.src, err, e.pos.start, c.line, c.column)
+		}
+	}
+}
+
+func TestLexerStats(t *testing.T) {
+	src := "package main;\n// hello\nvar a = 1; /* there */\n"
+	l := setupLexerTest(src)
+	if stats := l.Stats(); stats != (LexerStats{}) {
+		t.Errorf("stats should be zero until they're turned on, got %+v", stats)
+	}
+
+	l.EnableStats()
+	if _, err := l.PeekToken(1); err != nil {
+		t.Fatal("error lexing: ", err)
+	}
+
+	for {
+		tok, err := l.GetToken()
+		if err != nil {
+			t.Fatal("error lexing: ", err)
+		}
+
+		if tok.TokenKind() == TokenKindEndOfSource {
+			break
+		}
+	}
+
+	// that's eight tokens plus the end of the source.
+	expected := LexerStats{Tokens: 9, Bytes: len(src), Comments: 2, Lines: 3, MaxTokenPeek: 2, MaxRunePeek: 2}
+	if stats := l.Stats(); stats != expected {
+		t.Errorf("expected stats %+v, got %+v", expected, stats)
+	}
+}
+
+func TestLexerTabWidth(t *testing.T) {
+	cases := []struct {
+		tabWidth int
+		columns  []int
+	}{
+		{1, []int{2, 4, 7, 9, 12}},
+		{8, []int{9, 11, 14, 17, 33}},
+	}
+
+	for _, c := range cases {
+		l := setupLexerTest("\tx := 1\t+\t\t2")
+		l.SetTabWidth(c.tabWidth)
+		var columns []int
+		for {
+			tok, err := l.GetToken()
+			if err != nil {
+				t.Fatal("error lexing: ", err)
+			}
+
+			if tok.TokenKind() == TokenKindEndOfSource {
+				break
+			}
+
+			columns = append(columns, tok.Pos().start.Column)
+		}
+
+		if fmt.Sprint(columns) != fmt.Sprint(c.columns) {
+			t.Errorf("with a tab width of %d expected columns %v, got %v", c.tabWidth, c.columns, columns)
+		}
+	}
+}
+
+func TestLexerRepeatsErrors(t *testing.T) {
+	l := setupLexerTest("a $ b")
+	if tok, err := l.GetToken(); err != nil || tok.TokenKind() != TokenKindIdentifier {
+		t.Fatalf("expected an identifier, got %v, %v", tok, err)
+	}
+
+	_, firstErr := l.PeekToken(0)
+	if firstErr == nil {
+		t.Fatal("expected an error for the illegal character")
+	}
+
+	// looking again shouldn't lex past the problem.
+	if tok, err := l.PeekToken(0); tok != nil || err != firstErr {
+		t.Errorf("peeking again gave %v, %v, expected %v", tok, err, firstErr)
+	}
+
+	if tok, err := l.GetToken(); tok != nil || err != firstErr {
+		t.Errorf("getting the token gave %v, %v, expected %v", tok, err, firstErr)
+	}
+
+	if tok, err := l.GetToken(); tok != nil || err != firstErr {
+		t.Errorf("getting another token gave %v, %v, expected %v", tok, err, firstErr)
+	}
+}
+
+func TestLexerLineDirectives(t *testing.T) {
+	l := setupLexerTest("a\n//line gen.go:100\nb c\n  //line not.go:5\nd /* x */ //line nor.go:6\ne\n//line C:\\src\\orig.go:20:8\nf")
+	expected := []struct {
+		name string
+		loc  SrcLoc
+	}{
+		{"a", SrcLoc{1, 1}},
+		{"b", SrcLoc{100, 1}},
+		{"c", SrcLoc{100, 3}},
+		{"d", SrcLoc{102, 1}},
+		{"e", SrcLoc{103, 1}},
+		{"f", SrcLoc{20, 8}},
+	}
+
+	for _, e := range expected {
+		tok, err := l.GetToken()
+		if err != nil {
+			t.Fatal("error lexing: ", err)
+		}
+
+		if st, ok := tok.(StringToken); !ok || st.strVal != e.name || tok.Pos().start != e.loc {
+			t.Errorf("expected '%s' at %v, got %v at %v", e.name, e.loc, tok, tok.Pos().start)
+		}
+	}
+
+	if l.Filename() != "C:\\src\\orig.go" {
+		t.Errorf("expected the filename to be C:\\src\\orig.go, got %s", l.Filename())
+	}
+}
+
+// benchmarkLexerSource is a chunk of fairly typical code to lex.
+var benchmarkLexerSource = strings.Repeat(`
+// Sum adds up some numbers.
+func Sum(values []int, scale float64) (total int) {
+	for i := 0; i < len(values); i++ {
+		total += values[i] * 0x10 + 'a';
+	}
+	if total > 1_000 && scale != 2.5 {
+		return total - 1;
+	}
+	name := "a longer string literal";
+	return len(name);
+}
+`, 100)
+
+func BenchmarkLexer(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkLexerSource)))
 	l := NewLexer()
-	l.Init("-")
-	l.lineBuf = []rune(" " + source)
+	for i := 0; i < b.N; i++ {
+		l.Reset(strings.NewReader(benchmarkLexerSource), "bench.go")
+		for {
+			tok, err := l.GetToken()
+			if err != nil {
+				b.Fatal("error lexing: ", err)
+			}
+
+			if tok.TokenKind() == TokenKindEndOfSource {
+				break
+			}
+		}
+	}
+}
 
-	return l
+func TestLexerMultiCharOperators(t *testing.T) {
+	count := 0
+	for tk, name := range tokenKindNames {
+		if len(name) < 2 || strings.IndexFunc(name, unicode.IsLetter) >= 0 {
+			continue
+		}
+
+		count++
+		l := setupLexerTest("a" + name + "b")
+		l.GetToken()
+		tok, err := l.GetToken()
+		if err != nil || tok.TokenKind() != tk || tok.Pos().start.Column != 2 || tok.Pos().end.Column != 1+len(name) {
+			t.Errorf("'%s' gave %v, %v", name, tok, err)
+		}
+	}
+
+	if count != 25 {
+		t.Errorf("expected 25 multi-character operators, found %d", count)
+	}
+
+	// the longest operator wins, and then the next longest.
+	cases := []struct {
+		src   string
+		kinds []TokenKind
+	}{
+		{"<<=<-", []TokenKind{TokenKindShiftLeftAssign, TokenKindChannelArrow}},
+		{"&^=&^&&", []TokenKind{TokenKindBitClearAssign, TokenKindBitClear, TokenKindLogicalAnd}},
+		{"!=!", []TokenKind{TokenKindNotEqual, TokenKindNot}},
+		{"....", []TokenKind{TokenKindEllipsis, TokenKindDot}},
+		{"..", []TokenKind{TokenKindDot, TokenKindDot}},
+		{"+++", []TokenKind{TokenKindIncrement, TokenKindAdd}},
+	}
+
+	for _, c := range cases {
+		l := setupLexerTest(c.src)
+		var kinds []TokenKind
+		for {
+			tok, err := l.GetToken()
+			if err != nil {
+				t.Fatal("error lexing: ", err)
+			}
+
+			if tok.TokenKind() == TokenKindEndOfSource {
+				break
+			}
+
+			kinds = append(kinds, tok.TokenKind())
+		}
+
+		if fmt.Sprint(kinds) != fmt.Sprint(c.kinds) {
+			t.Errorf("'%s' gave %v, expected %v", c.src, kinds, c.kinds)
+		}
+	}
+}
+
+func TestLexerTokenSpans(t *testing.T) {
+	l := setupLexerTest(`x <<= y := z... "hello, wörld" >>= 'q'`)
+	expected := []struct {
+		kind       TokenKind
+		start, end int
+	}{
+		{TokenKindIdentifier, 1, 1},
+		{TokenKindShiftLeftAssign, 3, 5},
+		{TokenKindIdentifier, 7, 7},
+		{TokenKindDeclareAssign, 9, 10},
+		{TokenKindIdentifier, 12, 12},
+		{TokenKindEllipsis, 13, 15},
+		{TokenKindLiteralString, 17, 30},
+		{TokenKindShiftRightAssign, 32, 34},
+		{TokenKindLiteralRune, 36, 38},
+	}
+
+	for _, e := range expected {
+		tok, err := l.GetToken()
+		if err != nil {
+			t.Fatal("error lexing: ", err)
+		}
+
+		pos := tok.Pos()
+		if tok.TokenKind() != e.kind || pos.start != (SrcLoc{1, e.start}) || pos.end != (SrcLoc{1, e.end}) {
+			t.Errorf("expected %v at 1:%d-1:%d, got %v at %d:%d-%d:%d", e.kind, e.start, e.end, tok.TokenKind(), pos.start.Line, pos.start.Column, pos.end.Line, pos.end.Column)
+		}
+	}
+}
+
+func TestLexerShiftAssignSpan(t *testing.T) {
+	l := setupLexerTest("a>>=b")
+	l.GetToken()
+	tok, err := l.GetToken()
+	if err != nil {
+		t.Fatal("error lexing: ", err)
+	}
+
+	pos := tok.Pos()
+	if tok.TokenKind() != TokenKindShiftRightAssign || pos.end.Column-pos.start.Column+1 != 3 {
+		t.Errorf("'>>=' gave %v at %d:%d-%d:%d", tok.TokenKind(), pos.start.Line, pos.start.Column, pos.end.Line, pos.end.Column)
+	}
 }
-*/
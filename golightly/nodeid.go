@@ -0,0 +1,35 @@
+package golightly
+
+// type NodeIDs is a number for every node in an AST. The numbers go up
+// in the order Walk finds the nodes, so they stay the same as long as the
+// source does. They're handy for caching things about nodes and for
+// cross-referencing them from diagnostics.
+//
+// Nodes are pointers so they're identified by the node itself. The same
+// node is only found twice when the parser shares it between two places,
+// like the type in "a, b int", and then it really is the same bit of
+// source so it only gets one number.
+type NodeIDs map[AST]int
+
+// AssignNodeIDs walks an AST giving each node a number, starting from
+// zero. It's not part of compilation - it's for anything which wants to
+// refer to nodes later.
+func AssignNodeIDs(ast AST) NodeIDs {
+	ids := make(NodeIDs)
+	Walk(ast, func(node AST) bool {
+		if _, ok := ids[node]; !ok {
+			ids[node] = len(ids)
+		}
+
+		return true
+	})
+
+	return ids
+}
+
+// ID gets the number of a node. It returns false if the node wasn't in
+// the AST the numbers came from.
+func (ids NodeIDs) ID(ast AST) (int, bool) {
+	id, ok := ids[ast]
+	return id, ok
+}
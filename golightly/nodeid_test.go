@@ -0,0 +1,80 @@
+package golightly
+
+import (
+	"testing"
+)
+
+func TestAssignNodeIDs(t *testing.T) {
+	src := "package main;\n" +
+		"import \"fmt\";\n" +
+		"type P struct { x, y int; s []string; };\n" +
+		"func (p *P) f(a, b int, c ...string) (int, error) {\n" +
+		"  if x := p.x; x > 0 { return -x, nil; } else { g := func(int) int { return 1; }; _ = g; };\n" +
+		"  return p.y.(int), nil;\n" +
+		"};\n" +
+		"var v = (1 + 2) * -f(x)[i].y;\n" +
+		"type I interface { M(int) string; fmt.Stringer; };\n" +
+		"var ch <-chan chan<- int;\n"
+
+	p := setupParserTest(src)
+	if err := p.Parse(); err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	ids := AssignNodeIDs(p.TopLevel())
+
+	// every node has an ID and different nodes have different IDs. shared
+	// nodes like the "int" in "x, y int" are found twice but they're the
+	// same node so they've got the same ID.
+	nodeWithID := make(map[int]AST)
+	nodes := 0
+	Walk(p.TopLevel(), func(node AST) bool {
+		nodes++
+		id, ok := ids.ID(node)
+		if !ok {
+			t.Errorf("%s at %v hasn't got an ID", SExpr(node), node.Pos())
+			return true
+		}
+
+		if other, ok := nodeWithID[id]; ok && !other.Equals(node) {
+			t.Errorf("%s and %s both have ID %d", SExpr(other), SExpr(node), id)
+		}
+
+		nodeWithID[id] = node
+		return true
+	})
+
+	// the "int"s in "x, y int" and "a, b int" are the only shared nodes.
+	if len(nodeWithID) != len(ids) || len(ids) != nodes-2 {
+		t.Errorf("%d nodes got %d IDs, %d of them used", nodes, len(ids), len(nodeWithID))
+	}
+
+	for id := 0; id < len(ids); id++ {
+		if _, ok := nodeWithID[id]; !ok {
+			t.Errorf("the IDs aren't sequential, there's no %d", id)
+		}
+	}
+
+	// the IDs go in the order the nodes are walked so they're the same
+	// every time.
+	if id, _ := ids.ID(p.TopLevel()); id != 0 {
+		t.Errorf("the top level is %d, expected 0", id)
+	}
+
+	again := AssignNodeIDs(p.TopLevel())
+	for node, id := range ids {
+		if again[node] != id {
+			t.Errorf("%s changed from %d to %d", SExpr(node), id, again[node])
+		}
+	}
+
+	if _, ok := ids.ID(&ASTIdentifier{SrcSpan{SrcLoc{99, 1}, SrcLoc{99, 2}, ""}, "", "zz"}); ok {
+		t.Error("a node from somewhere else got an ID")
+	}
+
+	// a copy of a node is a different node.
+	copied := *p.TopLevel()
+	if _, ok := ids.ID(&copied); ok {
+		t.Error("a copy of the top level got an ID")
+	}
+}
@@ -7,12 +7,17 @@ package golightly
 //             SliceType | MapType | ChannelType .
 // TypeName  = identifier | QualifiedIdent .
 func (p *Parser) parseDataType() (bool, AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataType"))
+	}
+
 	// what token do we have?
-	tok, _ := p.lexer.PeekToken(0)
+	tok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return false, nil, err
+	}
 
 	var ast AST
-	var err error
-
 	switch tok.TokenKind() {
 	case TokenKindIdentifier:
 		ast, err = p.parseOptionallyQualifiedIdentifier()
@@ -54,6 +59,10 @@ func (p *Parser) parseDataType() (bool, AST, error) {
 // ElementType = Type .
 // SliceType = "[" "]" ElementType .
 func (p *Parser) parseDataTypeArray() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataTypeArray"))
+	}
+
 	// we already know is starts with '['
 	startToken, _ := p.lexer.GetToken()
 
@@ -63,7 +72,11 @@ func (p *Parser) parseDataTypeArray() (AST, error) {
 		return nil, err
 	}
 	var arrayLength AST
-	if tok.TokenKind() != TokenKindCloseSquareBracket {
+	if tok.TokenKind() == TokenKindEllipsis {
+		// it's a "[...]" array which gets its length from a literal
+		p.lexer.GetToken()
+		arrayLength = &ASTEllipsis{tok.Pos()}
+	} else if tok.TokenKind() != TokenKindCloseSquareBracket {
 		// it's an array length
 		arrayLength, err = p.parseExpression()
 		if err != nil {
@@ -98,10 +111,10 @@ func (p *Parser) parseDataTypeArray() (AST, error) {
 	var ast AST
 	if arrayLength == nil {
 		// it's a slice
-		ast = ASTDataTypeSlice{startToken.Pos().Add(endSpan), elementType}
+		ast = &ASTDataTypeSlice{startToken.Pos().Add(endSpan), elementType}
 	} else {
 		// it's an array
-		ast = ASTDataTypeArray{startToken.Pos().Add(endSpan), arrayLength, elementType}
+		ast = &ASTDataTypeArray{startToken.Pos().Add(endSpan), arrayLength, elementType}
 	}
 
 	return ast, nil
@@ -110,6 +123,10 @@ func (p *Parser) parseDataTypeArray() (AST, error) {
 // parseDataTypeStruct parses a struct data type.
 // StructType     = "struct" "{" { FieldDecl ";" } "}" .
 func (p *Parser) parseDataTypeStruct() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataTypeStruct"))
+	}
+
 	// get the 'struct' token
 	structTok, _ := p.lexer.GetToken()
 
@@ -140,6 +157,15 @@ func (p *Parser) parseDataTypeStruct() (AST, error) {
 
 		fields = append(fields, newFields...)
 
+		// the semicolon can be left out before the '}'.
+		tok, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+		if tok.TokenKind() == TokenKindCloseBrace {
+			break
+		}
+
 		// get a semicolon
 		err = p.expectToken(TokenKindSemicolon, "semicolon expected between struct fields")
 		if err != nil {
@@ -153,7 +179,7 @@ func (p *Parser) parseDataTypeStruct() (AST, error) {
 		return nil, err
 	}
 
-	return ASTDataTypeStruct{structTok.Pos().Add(endPos), fields}, nil
+	return &ASTDataTypeStruct{structTok.Pos().Add(endPos), fields}, nil
 }
 
 // parseDataTypeField parses a struct field declaration.
@@ -161,12 +187,20 @@ func (p *Parser) parseDataTypeStruct() (AST, error) {
 // AnonymousField = [ "*" ] TypeName .
 // Tag            = string_lit .
 func (p *Parser) parseDataTypeField() ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataTypeField"))
+	}
+
 	// what do we have here?
 	tok, err := p.lexer.PeekToken(0)
 	if err != nil {
 		return nil, err
 	}
 
+	if tok.TokenKind() == TokenKindSemicolon {
+		return nil, NewError(p.filename, tok.Pos(), "empty struct field - there's nothing before this ';'")
+	}
+
 	var idents []AST
 	if tok.TokenKind() == TokenKindIdentifier {
 		// try parsing it as an identifier list
@@ -191,25 +225,25 @@ func (p *Parser) parseDataTypeField() ([]AST, error) {
 	}
 
 	// get a trailing tag if one exists
-	var tag string
+	var tag StructTag
 	tagTok, err := p.lexer.PeekToken(0)
 	if err != nil {
 		return nil, err
 	}
 	if tagTok.TokenKind() == TokenKindLiteralString {
-		tag = tagTok.(StringToken).strVal
+		tag = StructTag(tagTok.(StringToken).strVal)
 		p.lexer.GetToken()
 	}
 
 	// make the result
 	if idents == nil {
 		// just return a single anonymous field
-		return []AST{ASTDataTypeField{nil, typ, tag}}, nil
+		return []AST{&ASTDataTypeField{nil, typ, tag}}, nil
 	} else {
 		// return a set of struct fields
 		fields := make([]AST, len(idents))
 		for i, ident := range idents {
-			fields[i] = ASTDataTypeField{ident, typ, tag}
+			fields[i] = &ASTDataTypeField{ident, typ, tag}
 		}
 
 		return fields, nil
@@ -220,6 +254,10 @@ func (p *Parser) parseDataTypeField() ([]AST, error) {
 // PointerType = "*" BaseType .
 // BaseType = Type .
 func (p *Parser) parseDataTypePointer() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataTypePointer"))
+	}
+
 	// get the '*' token
 	tok, _ := p.lexer.GetToken()
 
@@ -237,7 +275,7 @@ func (p *Parser) parseDataTypePointer() (AST, error) {
 		return nil, NewError(p.filename, tok2.Pos(), "by my reckoning this part of a pointer definition should have been a data type")
 	}
 
-	return ASTDataTypePointer{tok.Pos(), elementType}, nil
+	return &ASTDataTypePointer{tok.Pos(), elementType}, nil
 }
 
 // parseDataTypeFunction parses a function data type.
@@ -245,6 +283,10 @@ func (p *Parser) parseDataTypePointer() (AST, error) {
 // Signature      = Parameters [ Result ] .
 // Result         = Parameters | Type .
 func (p *Parser) parseDataTypeFunction() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataTypeFunction"))
+	}
+
 	// get the "func" token
 	funcTok, _ := p.lexer.GetToken()
 
@@ -254,7 +296,7 @@ func (p *Parser) parseDataTypeFunction() (AST, error) {
 		return nil, err
 	}
 
-	return ASTDataTypeFunc{funcTok.Pos(), params, returns}, nil
+	return &ASTDataTypeFunc{funcTok.Pos(), params, returns}, nil
 }
 
 // parseDataTypeInterface parses an interface data type.
@@ -263,6 +305,10 @@ func (p *Parser) parseDataTypeFunction() (AST, error) {
 // MethodName         = identifier .
 // InterfaceTypeName  = TypeName .
 func (p *Parser) parseDataTypeInterface() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataTypeInterface"))
+	}
+
 	// get the 'interface' token
 	interfaceToken, _ := p.lexer.GetToken()
 
@@ -293,6 +339,15 @@ func (p *Parser) parseDataTypeInterface() (AST, error) {
 
 		methods = append(methods, method)
 
+		// the semicolon can be left out before the '}'.
+		tok, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+		if tok.TokenKind() == TokenKindCloseBrace {
+			break
+		}
+
 		// get a semicolon
 		err = p.expectToken(TokenKindSemicolon, "semicolon expected between interface methods")
 		if err != nil {
@@ -306,7 +361,7 @@ func (p *Parser) parseDataTypeInterface() (AST, error) {
 		return nil, err
 	}
 
-	return ASTDataTypeInterface{interfaceToken.Pos(), methods}, nil
+	return &ASTDataTypeInterface{interfaceToken.Pos(), methods}, nil
 }
 
 // parseDataTypeMethodSpec parses an interface data type.
@@ -314,6 +369,10 @@ func (p *Parser) parseDataTypeInterface() (AST, error) {
 // MethodName         = identifier .
 // InterfaceTypeName  = TypeName .
 func (p *Parser) parseDataTypeMethodSpec() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataTypeMethodSpec"))
+	}
+
 	// if it's a method name the second token will be '(' to start the signature.
 	tok2, err := p.lexer.PeekToken(1)
 	if err != nil {
@@ -337,7 +396,7 @@ func (p *Parser) parseDataTypeMethodSpec() (AST, error) {
 			return nil, err
 		}
 
-		return ASTDataTypeMethodSpec{methodName.Pos(), methodName.(StringToken).strVal, params, returns}, nil
+		return &ASTDataTypeMethodSpec{methodName.Pos(), methodName.(StringToken).strVal, params, returns}, nil
 	} else {
 		// it must be an interface type name
 		return p.parseOptionallyQualifiedIdentifier()
@@ -348,6 +407,10 @@ func (p *Parser) parseDataTypeMethodSpec() (AST, error) {
 // MapType     = "map" "[" KeyType "]" ElementType .
 // KeyType     = Type .
 func (p *Parser) parseDataTypeMap() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataTypeMap"))
+	}
+
 	// get the 'map' token
 	mapToken, _ := p.lexer.GetToken()
 
@@ -356,7 +419,7 @@ func (p *Parser) parseDataTypeMap() (AST, error) {
 	if err != nil {
 		return nil, err
 	}
-	if openSquareBracketToken.TokenKind() == TokenKindOpenSquareBracket {
+	if openSquareBracketToken.TokenKind() != TokenKindOpenSquareBracket {
 		return nil, NewError(p.filename, mapToken.Pos().Add(openSquareBracketToken.Pos()), "map types should look like 'map[key_type]element_type'")
 	}
 
@@ -379,7 +442,7 @@ func (p *Parser) parseDataTypeMap() (AST, error) {
 	if err != nil {
 		return nil, err
 	}
-	if closeSquareBracketToken.TokenKind() == TokenKindCloseSquareBracket {
+	if closeSquareBracketToken.TokenKind() != TokenKindCloseSquareBracket {
 		return nil, NewError(p.filename, closeSquareBracketToken.Pos(), "map types should look like 'map[key_type]element_type'")
 	}
 
@@ -392,13 +455,17 @@ func (p *Parser) parseDataTypeMap() (AST, error) {
 		return nil, NewError(p.filename, closeSquareBracketToken.Pos(), "by my reckoning this should have been followed by a data type. map types should look like 'map[key_type]element_type'")
 	}
 
-	return ASTDataTypeMap{mapToken.Pos().Add(closeSquareBracketToken.Pos()), keyType, elementType}, nil
+	return &ASTDataTypeMap{mapToken.Pos().Add(closeSquareBracketToken.Pos()), keyType, elementType}, nil
 }
 
 // parseDataTypeChannel parses a channel data type.
 // ChannelType = ( "chan" [ "<-" ] | "<-" "chan" ) ElementType .
 func (p *Parser) parseDataTypeChannel() (AST, error) {
-	var dir ChanDirection
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataTypeChannel"))
+	}
+
+	dir := ChanDirectionBi
 	tok, _ := p.lexer.GetToken()
 	chanSpan := tok.Pos()
 	if tok.TokenKind() == TokenKindChan {
@@ -409,14 +476,14 @@ func (p *Parser) parseDataTypeChannel() (AST, error) {
 		}
 
 		if tok2.TokenKind() == TokenKindChannelArrow {
-			// it's 'chan <-'
-			dir = ChanDirectionIn
+			// it's 'chan <-', which can only be sent to.
+			dir = ChanDirectionOut
 			chanSpan.end = tok2.Pos().end
 			p.lexer.GetToken()
 		}
 	} else {
-		// starts with '<-', we need a 'chan' now
-		p.lexer.GetToken()
+		// starts with '<-', we need a 'chan' now. it can only be received from.
+		dir = ChanDirectionIn
 		tok2pos, err := p.expectTokenPos(TokenKindChan, "channels should look like 'chan', '<- chan' or 'chan <-'")
 		if err != nil {
 			return nil, err
@@ -439,11 +506,15 @@ func (p *Parser) parseDataTypeChannel() (AST, error) {
 		return nil, NewError(p.filename, tok.Pos(), "by my reckoning this part of a chan definition should have been a data type")
 	}
 
-	return ASTDataTypeChan{chanSpan, dir, elementType}, nil
+	return &ASTDataTypeChan{chanSpan, dir, elementType}, nil
 }
 
 // parseDataTypeBracketed parses a data type enclosed by brackets.
 func (p *Parser) parseDataTypeBracketed() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDataTypeBracketed"))
+	}
+
 	// absorb the open bracket
 	p.lexer.GetToken()
 
@@ -10,36 +10,291 @@ func setupDataTypeTest(src string) *Parser {
 	reader := strings.NewReader(src)
 	lex.LexReader(reader, "test.go")
 	ts := NewDataTypeStore()
-	addSrcFile := make(chan string)
-	parser := NewParser(lex, ts, addSrcFile)
-
-	// just throw away anything we get on the addSrcFile channel.
-	go func() {
-		for {
-			<-addSrcFile
-		}
-	}()
+	sf := NewSourceFile("test.go", nil, nil, nil, nil)
+	parser := NewParser(lex, ts, sf)
 
 	return parser
 }
 
+// compareAST checks two ASTs have the same structure. Positions aren't
+// compared so the expected ASTs don't need them.
 func compareAST(a, b AST) bool {
-	return true
+	return SExpr(a) == SExpr(b)
 }
 
 func TestParseDataType(t *testing.T) {
-	parser := setupDataTypeTest("int")
-	match, ast, err := parser.parseDataType()
-	if err != nil {
-		t.Error("error parsing: ", err)
-		return
-	}
-	if !match {
-		t.Error("doesn't match a data type")
-		return
-	}
-	if !compareAST(ast, ASTIdentifier{SrcSpan{SrcLoc{1, 1}, SrcLoc{1, 3}}, "", "int"}) {
-		t.Errorf("parse failed: %s", ast)
-		return
+	ts := NewDataTypeStore()
+	ident := func(name string) AST { return &ASTIdentifier{SrcSpan{}, "", name} }
+	param := func(name string, typ AST) AST {
+		if name == "" {
+			return &ASTParameterDecl{nil, nil, typ}
+		}
+		return &ASTParameterDecl{ident(name), nil, typ}
+	}
+
+	cases := []struct {
+		src      string
+		expected AST
+	}{
+		{"int", ident("int")},
+		{"fmt.Stringer", &ASTIdentifier{SrcSpan{}, "fmt", "Stringer"}},
+		{"[]string", &ASTDataTypeSlice{SrcSpan{}, ident("string")}},
+		{"*int", &ASTDataTypePointer{SrcSpan{}, ident("int")}},
+		{"[4]byte", &ASTDataTypeArray{SrcSpan{}, &ASTValue{SrcSpan{}, ValueUint{ts.UntypedIntType(), 4}}, ident("byte")}},
+		{"[n]byte", &ASTDataTypeArray{SrcSpan{}, ident("n"), ident("byte")}},
+		{"map[string]int", &ASTDataTypeMap{SrcSpan{}, ident("string"), ident("int")}},
+		{"map[string][]*int", &ASTDataTypeMap{SrcSpan{}, ident("string"), &ASTDataTypeSlice{SrcSpan{}, &ASTDataTypePointer{SrcSpan{}, ident("int")}}}},
+		{"chan int", &ASTDataTypeChan{SrcSpan{}, ChanDirectionBi, ident("int")}},
+		{"<-chan int", &ASTDataTypeChan{SrcSpan{}, ChanDirectionIn, ident("int")}},
+		{"chan<- int", &ASTDataTypeChan{SrcSpan{}, ChanDirectionOut, ident("int")}},
+		{"chan <- int", &ASTDataTypeChan{SrcSpan{}, ChanDirectionOut, ident("int")}},
+		{"chan<- <-chan int", &ASTDataTypeChan{SrcSpan{}, ChanDirectionOut, &ASTDataTypeChan{SrcSpan{}, ChanDirectionIn, ident("int")}}},
+		{"(int)", ident("int")},
+		{"[][]*int", &ASTDataTypeSlice{SrcSpan{}, &ASTDataTypeSlice{SrcSpan{}, &ASTDataTypePointer{SrcSpan{}, ident("int")}}}},
+		{"struct { a, b int; c string \"tag\"; }", &ASTDataTypeStruct{SrcSpan{}, []AST{
+			&ASTDataTypeField{ident("a"), ident("int"), ""},
+			&ASTDataTypeField{ident("b"), ident("int"), ""},
+			&ASTDataTypeField{ident("c"), ident("string"), "tag"},
+		}}},
+		{"struct{ X int }", &ASTDataTypeStruct{SrcSpan{}, []AST{&ASTDataTypeField{ident("X"), ident("int"), ""}}}},
+		{"struct{}", &ASTDataTypeStruct{SrcSpan{}, nil}},
+		{"func(int) int", &ASTDataTypeFunc{SrcSpan{}, []AST{param("", ident("int"))}, []AST{param("", ident("int"))}}},
+		{"func(a int, b ...string) error", &ASTDataTypeFunc{SrcSpan{},
+			[]AST{param("a", ident("int")), &ASTParameterDecl{ident("b"), &ASTEllipsis{SrcSpan{}}, ident("string")}},
+			[]AST{param("", ident("error"))},
+		}},
+		{"interface { String() string; }", &ASTDataTypeInterface{SrcSpan{}, []AST{
+			&ASTDataTypeMethodSpec{SrcSpan{}, "String", nil, []AST{param("", ident("string"))}},
+		}}},
+		{"interface{ String() string }", &ASTDataTypeInterface{SrcSpan{}, []AST{
+			&ASTDataTypeMethodSpec{SrcSpan{}, "String", nil, []AST{param("", ident("string"))}},
+		}}},
+		{"interface{}", &ASTDataTypeInterface{SrcSpan{}, nil}},
+	}
+
+	for _, c := range cases {
+		match, ast, err := setupDataTypeTest(c.src).parseDataType()
+		if err != nil || !match {
+			t.Errorf("'%s' didn't parse: %v", c.src, err)
+			continue
+		}
+
+		if !compareAST(ast, c.expected) {
+			t.Errorf("'%s' parsed as %s, expected %s", c.src, SExpr(ast), SExpr(c.expected))
+		}
+	}
+
+	// make sure the comparison can actually fail.
+	if compareAST(ident("int"), ident("string")) || compareAST(ident("int"), &ASTDataTypePointer{SrcSpan{}, ident("int")}) {
+		t.Error("compareAST says different ASTs are the same")
+	}
+}
+
+func FuzzParseDataType(f *testing.F) {
+	f.Add("map[string][]*int")
+	f.Add("struct { a, b int; c *fmt.Stringer \"tag\"; }")
+	f.Add("func(a int, b ...string) (r bool)")
+	f.Add("interface { Read(p []byte) (n int, err error); }")
+	f.Add("[4]chan<- <-chan pkg.Thing")
+	f.Add("pkg#")
+	f.Add("struct #")
+
+	f.Fuzz(func(t *testing.T, src string) {
+		_, _, err := setupDataTypeTest(src).parseDataType()
+		if _, ok := err.(*Error); err != nil && !ok {
+			t.Errorf("'%q' gave an error which isn't an *Error: %#v", src, err)
+		}
+	})
+}
+
+func TestParseDataTypeFuncResults(t *testing.T) {
+	cases := []struct {
+		src   string
+		names []string
+		types []string
+	}{
+		{"func()", nil, nil},
+		{"func() int", []string{""}, []string{"int"}},
+		{"func() (int)", []string{""}, []string{"int"}},
+		{"func() (int, error)", []string{"", ""}, []string{"int", "error"}},
+		{"func() (n int)", []string{"n"}, []string{"int"}},
+		{"func() (n int, err error)", []string{"n", "err"}, []string{"int", "error"}},
+		{"func() (a, b int, c string)", []string{"a", "b", "c"}, []string{"int", "int", "string"}},
+		{"func() (*int, []string)", []string{"", ""}, []string{"", ""}},
+	}
+
+	for _, c := range cases {
+		match, ast, err := setupDataTypeTest(c.src).parseDataType()
+		if err != nil || !match {
+			t.Errorf("'%s' didn't parse: %v", c.src, err)
+			continue
+		}
+
+		returns := ast.(*ASTDataTypeFunc).returns
+		if len(returns) != len(c.names) {
+			t.Errorf("'%s' has %d results, expected %d", c.src, len(returns), len(c.names))
+			continue
+		}
+
+		for i, r := range returns {
+			result := r.(*ASTParameterDecl)
+			name := ""
+			if result.identifier != nil {
+				name = result.identifier.(*ASTIdentifier).name
+			}
+
+			typ := ""
+			if ident, ok := result.typ.(*ASTIdentifier); ok {
+				typ = ident.name
+			}
+
+			if name != c.names[i] || typ != c.types[i] {
+				t.Errorf("'%s' result %d is '%s %s', expected '%s %s'", c.src, i, name, typ, c.names[i], c.types[i])
+			}
+		}
+	}
+}
+
+func TestParseDataTypeFuncMixedResults(t *testing.T) {
+	sources := []string{
+		"func() (n int, error)",
+		"func() ([]int, err error)",
+		"func() (n int, []string)",
+	}
+
+	for _, src := range sources {
+		_, _, err := setupDataTypeTest(src).parseDataType()
+		if err == nil || !strings.Contains(err.Error(), "either all the parameters here should have names or none of them should") {
+			t.Errorf("'%s' gave error %v", src, err)
+		}
+	}
+}
+
+func TestParseDataTypeFuncParamNames(t *testing.T) {
+	cases := []struct {
+		src   string
+		count int
+	}{
+		{"func(a int, b string)", 2},
+		{"func(a, b int, c string)", 3},
+		{"func(int, string)", 2},
+		{"func(int, []string, *fmt.Stringer)", 3},
+	}
+
+	for _, c := range cases {
+		_, ast, err := setupDataTypeTest(c.src).parseDataType()
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		if params := ast.(*ASTDataTypeFunc).params; len(params) != c.count {
+			t.Errorf("'%s' has %d parameters, expected %d", c.src, len(params), c.count)
+		}
+	}
+}
+
+func TestParseDataTypeFuncMixedParams(t *testing.T) {
+	cases := []struct {
+		src    string
+		column int
+	}{
+		{"func(a int, string)", 13},
+		{"func(a int, b)", 13},
+		{"func(*int, b string)", 6},
+		{"func(a, b int, c string, []int)", 26},
+	}
+
+	for _, c := range cases {
+		_, _, err := setupDataTypeTest(c.src).parseDataType()
+		e, ok := err.(*Error)
+		if !ok || !strings.Contains(e.message, "either all the parameters here should have names or none of them should") {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		if e.pos.start.Column != c.column {
+			t.Errorf("'%s' gave an error at column %d, expected %d", c.src, e.pos.start.Column, c.column)
+		}
+	}
+}
+
+func TestParseDataTypeFuncVariadic(t *testing.T) {
+	sources := []string{
+		"func(...int)",
+		"func(a int, b ...string)",
+		"func(format string, args ...interface{}) (n int)",
+	}
+
+	for _, src := range sources {
+		_, ast, err := setupDataTypeTest(src).parseDataType()
+		if err != nil {
+			t.Errorf("'%s' gave error %v", src, err)
+			continue
+		}
+
+		params := ast.(*ASTDataTypeFunc).params
+		if params[len(params)-1].(*ASTParameterDecl).ellipsis == nil {
+			t.Errorf("'%s' should be variadic", src)
+		}
+	}
+}
+
+func TestParseDataTypeFuncVariadicErrors(t *testing.T) {
+	cases := []struct {
+		src    string
+		err    string
+		column int
+	}{
+		{"func(a ...int, b string)", "only the last parameter can have a '...'", 8},
+		{"func(...int, string)", "only the last parameter can have a '...'", 6},
+		{"func(a, b ...int)", "only the last parameter can have a '...'", 11},
+		{"func() (n ...int)", "results can't have a '...' - only parameters can", 11},
+	}
+
+	for _, c := range cases {
+		_, _, err := setupDataTypeTest(c.src).parseDataType()
+		e, ok := err.(*Error)
+		if !ok || e.message != c.err {
+			t.Errorf("'%s' gave error %v, expected '%s'", c.src, err, c.err)
+			continue
+		}
+
+		if e.pos.start.Column != c.column {
+			t.Errorf("'%s' gave an error at column %d, expected %d", c.src, e.pos.start.Column, c.column)
+		}
+	}
+}
+
+func TestParseDataTypeStructEmptyField(t *testing.T) {
+	cases := []struct {
+		src    string
+		fields int
+		err    string
+	}{
+		{"struct { }", 0, ""},
+		{"struct { a int; }", 1, ""},
+		{"struct { ; }", 0, "test.go:1: empty struct field - there's nothing before this ';'"},
+		{"struct { a int; ; }", 0, "test.go:1: empty struct field - there's nothing before this ';'"},
+	}
+
+	for _, c := range cases {
+		_, ast, err := setupDataTypeTest(c.src).parseDataType()
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("'%s' gave error %v, expected '%s'", c.src, err, c.err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		if fields := ast.(*ASTDataTypeStruct).fields; len(fields) != c.fields {
+			t.Errorf("'%s' has %d fields, expected %d", c.src, len(fields), c.fields)
+		}
 	}
 }
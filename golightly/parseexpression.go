@@ -3,6 +3,10 @@ package golightly
 // parseExpressionList parses a comma-separated list of expressions.
 // ExpressionList = Expression { "," Expression } .
 func (p *Parser) parseExpressionList() ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseExpressionList"))
+	}
+
 	// get an expression
 	expr, err := p.parseExpression()
 	if err != nil {
@@ -39,12 +43,343 @@ func (p *Parser) parseExpressionList() ([]AST, error) {
 	return asts, nil
 }
 
+// binaryPrecedence is the precedence of each binary operator. Higher
+// numbers bind more tightly.
+var binaryPrecedence = map[TokenKind]int{
+	TokenKindLogicalOr:    1,
+	TokenKindLogicalAnd:   2,
+	TokenKindEquals:       3,
+	TokenKindNotEqual:     3,
+	TokenKindLess:         3,
+	TokenKindLessEqual:    3,
+	TokenKindGreater:      3,
+	TokenKindGreaterEqual: 3,
+	TokenKindAdd:          4,
+	TokenKindSubtract:     4,
+	TokenKindBitwiseOr:    4,
+	TokenKindBitwiseExor:  4,
+	TokenKindAsterisk:     5,
+	TokenKindDivide:       5,
+	TokenKindModulus:      5,
+	TokenKindShiftLeft:    5,
+	TokenKindShiftRight:   5,
+	TokenKindBitwiseAnd:   5,
+	TokenKindBitClear:     5,
+}
+
+// IsShortCircuit returns true for "&&" and "||", which only evaluate their
+// right hand side if they need to. code generation has to branch around
+// the right hand side of these rather than evaluating both sides first.
+func IsShortCircuit(op TokenKind) bool {
+	return op == TokenKindLogicalAnd || op == TokenKindLogicalOr
+}
+
 // parseExpression parses an expression.
+// Expression = UnaryExpr | Expression binary_op Expression .
 func (p *Parser) parseExpression() (AST, error) {
-	tok, _ := p.lexer.GetToken()
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseExpression"))
+	}
+
+	return p.parseBinaryExpr(1)
+}
+
+// parseBinaryExpr parses a sequence of binary operations which have
+// operators with at least the given precedence.
+func (p *Parser) parseBinaryExpr(minPrecedence int) (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseBinaryExpr"))
+	}
+
+	left, err := p.parseUnaryExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		// is there an operator with high enough precedence next?
+		opTok, err := p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+
+		precedence, ok := binaryPrecedence[opTok.TokenKind()]
+		if !ok || precedence < minPrecedence {
+			return left, nil
+		}
+
+		// get the right hand side. anything with higher precedence binds to
+		// it first.
+		p.lexer.GetToken()
+		right, err := p.parseBinaryExpr(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		left = &ASTBinaryExpr{left.Pos().Add(right.Pos()), opTok.TokenKind(), left, right}
+	}
+}
+
+// parseUnaryExpr parses an expression with optional unary operators.
+// UnaryExpr  = PrimaryExpr | unary_op UnaryExpr .
+// unary_op   = "+" | "-" | "!" | "^" | "*" | "&" | "<-" .
+func (p *Parser) parseUnaryExpr() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseUnaryExpr"))
+	}
+
+	opTok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opTok.TokenKind() {
+	case TokenKindAdd, TokenKindSubtract, TokenKindNot, TokenKindBitwiseExor, TokenKindAsterisk, TokenKindBitwiseAnd, TokenKindChannelArrow:
+		p.lexer.GetToken()
+		param, err := p.parseUnaryExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		return &ASTUnaryExpr{opTok.Pos().Add(param.Pos()), opTok.TokenKind(), param}, nil
+	}
+
+	return p.parsePrimaryExpr()
+}
+
+// parsePrimaryExpr parses an operand followed by any number of selectors,
+// indexes and calls.
+// PrimaryExpr = Operand | PrimaryExpr Selector | PrimaryExpr Index | PrimaryExpr Arguments .
+// Selector    = "." identifier .
+// Index       = "[" Expression "]" .
+// Arguments   = "(" [ ExpressionList [ "," ] ] ")" .
+func (p *Parser) parsePrimaryExpr() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parsePrimaryExpr"))
+	}
+
+	expr, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, err := p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok.TokenKind() {
+		case TokenKindDot:
+			p.lexer.GetToken()
+			nextTok, err := p.lexer.PeekToken(0)
+			if err != nil {
+				return nil, err
+			}
+
+			if nextTok.TokenKind() == TokenKindOpenBracket {
+				expr, err = p.parseTypeAssertion(expr)
+				if err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			nameTok, err := p.lexer.GetToken()
+			if err != nil {
+				return nil, err
+			}
+
+			if nameTok.TokenKind() != TokenKindIdentifier {
+				return nil, NewError(p.filename, nameTok.Pos(), "I was hoping for a name after this '.'")
+			}
+
+			expr = &ASTSelector{expr.Pos().Add(nameTok.Pos()), expr, nameTok.(StringToken).strVal}
+
+		case TokenKindOpenSquareBracket:
+			p.lexer.GetToken()
+			index, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+
+			closePos, err := p.expectTokenPos(TokenKindCloseSquareBracket, "this index needs a ']' at the end")
+			if err != nil {
+				return nil, err
+			}
+
+			expr = &ASTIndex{expr.Pos().Add(closePos), expr, index}
+
+		case TokenKindOpenBracket:
+			p.lexer.GetToken()
+			args, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+
+			closePos, err := p.expectTokenPos(TokenKindCloseBracket, "I need a ')' at the end of this function call")
+			if err != nil {
+				return nil, err
+			}
+
+			expr = &ASTCall{expr.Pos().Add(closePos), expr, args}
+
+		default:
+			return expr, nil
+		}
+	}
+}
+
+// parseFuncLit parses a function literal. Without a body it's just a
+// function type, which can be used as a value in some places too.
+// FunctionLit = "func" Signature FunctionBody .
+func (p *Parser) parseFuncLit() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseFuncLit"))
+	}
+
+	funcTok, _ := p.lexer.GetToken()
+	params, returns, err := p.parseSignature()
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.TokenKind() != TokenKindOpenBrace {
+		return &ASTDataTypeFunc{funcTok.Pos(), params, returns}, nil
+	}
+
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ASTFuncLit{funcTok.Pos().Add(body.Pos()), params, returns, body}, nil
+}
+
+// parseTypeAssertion parses the type part of a type assertion. We've
+// already had the expression and the '.'.
+// TypeAssertion = "." "(" Type ")" .
+func (p *Parser) parseTypeAssertion(expr AST) (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseTypeAssertion"))
+	}
+
+	p.lexer.GetToken()
+	tok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.TokenKind() == TokenKindTypeKeyword {
+		return nil, NewError(p.filename, tok.Pos(), "'.(type)' only works at the top of a type switch")
+	}
+
+	found, typ, err := p.parseDataType()
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, NewError(p.filename, tok.Pos(), "I was expecting a type in this type assertion")
+	}
+
+	closePos, err := p.expectTokenPos(TokenKindCloseBracket, "this type assertion needs a ')' at the end")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ASTTypeAssert{expr.Pos().Add(closePos), expr, typ}, nil
+}
+
+// parseArguments parses the arguments of a function call, up to but not
+// including the closing ')'.
+func (p *Parser) parseArguments() ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseArguments"))
+	}
+
+	var args []AST
+	for {
+		tok, err := p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.TokenKind() == TokenKindCloseBracket {
+			return args, nil
+		}
+
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+
+		// arguments are separated by commas.
+		tok, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.TokenKind() != TokenKindComma {
+			return args, nil
+		}
+
+		p.lexer.GetToken()
+	}
+}
+
+// parseOperand parses a literal, a name, a type or a bracketed expression.
+// Operand     = Literal | OperandName | "(" Expression ")" .
+// OperandName = identifier .
+func (p *Parser) parseOperand() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseOperand"))
+	}
+
+	tok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok.TokenKind() {
+	case TokenKindLiteralInt, TokenKindLiteralFloat, TokenKindLiteralRune, TokenKindLiteralString:
+		p.lexer.GetToken()
+		return NewASTValueFromToken(tok, p.ts), nil
+
+	case TokenKindIdentifier:
+		p.lexer.GetToken()
+		return &ASTIdentifier{tok.Pos(), "", tok.(StringToken).strVal}, nil
+
+	case TokenKindOpenBracket:
+		p.lexer.GetToken()
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		closePos, err := p.expectTokenPos(TokenKindCloseBracket, "this bracketed expression needs a ')' to finish it")
+		if err != nil {
+			return nil, err
+		}
+
+		return &ASTParen{tok.Pos().Add(closePos), expr}, nil
+
+	case TokenKindFunc:
+		return p.parseFuncLit()
 
-	if tok.TokenKind() == TokenKindLiteralInt {
-		return ASTValue{tok.Pos(), NewValueFromToken(tok, p.ts)}, nil
+	case TokenKindOpenSquareBracket, TokenKindStruct, TokenKindMap, TokenKindChan, TokenKindInterface:
+		// type literals can be used as values in some places - eg. as
+		// the argument to make().
+		_, typ, err := p.parseDataType()
+		return typ, err
 	}
 
 	return nil, NewError(p.filename, tok.Pos(), "bad expression. bad.")
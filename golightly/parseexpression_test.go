@@ -0,0 +1,265 @@
+package golightly
+
+import (
+	"testing"
+)
+
+func TestParseExpressionPrecedence(t *testing.T) {
+	expr, err := setupParserTest("a + b * c == d").parseExpression()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	// it should be ((a + (b * c)) == d)
+	eq, ok := expr.(*ASTBinaryExpr)
+	if !ok || eq.op != TokenKindEquals {
+		t.Fatalf("expected '==' at the top, got %v", expr)
+	}
+
+	add, ok := eq.left.(*ASTBinaryExpr)
+	if !ok || add.op != TokenKindAdd {
+		t.Fatalf("expected '+' on the left of '==', got %v", eq.left)
+	}
+
+	mul, ok := add.right.(*ASTBinaryExpr)
+	if !ok || mul.op != TokenKindAsterisk {
+		t.Fatalf("expected '*' on the right of '+', got %v", add.right)
+	}
+}
+
+func TestParseShiftPrecedence(t *testing.T) {
+	cases := []sexprCase{
+		{"1 + 2 << 3", "(binary + (value 1) (binary << (value 2) (value 3)))"},
+		{"a & b == c", "(binary == (binary & (identifier a) (identifier b)) (identifier c))"},
+		{"a &^ b + c", "(binary + (binary &^ (identifier a) (identifier b)) (identifier c))"},
+		{"a >> 1 | b", "(binary | (binary >> (identifier a) (value 1)) (identifier b))"},
+	}
+
+	checkParsesAs(t, cases, (*Parser).parseExpression)
+}
+
+func TestParseLogicalPrecedence(t *testing.T) {
+	cases := []sexprCase{
+		{"a || b && c", "(binary || (identifier a) (binary && (identifier b) (identifier c)))"},
+		{"a && b || c && d", "(binary || (binary && (identifier a) (identifier b)) (binary && (identifier c) (identifier d)))"},
+		{"a || b || c", "(binary || (binary || (identifier a) (identifier b)) (identifier c))"},
+	}
+
+	checkParsesAs(t, cases, (*Parser).parseExpression)
+}
+
+func TestIsShortCircuit(t *testing.T) {
+	cases := []struct {
+		src          string
+		shortCircuit bool
+	}{
+		{"a && b", true},
+		{"a || b", true},
+		{"a & b", false},
+		{"a | b", false},
+		{"a == b", false},
+	}
+
+	for _, c := range cases {
+		expr, err := setupParserTest(c.src).parseExpression()
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		binary, ok := expr.(*ASTBinaryExpr)
+		if !ok {
+			t.Errorf("'%s' parsed as %s, expected a binary expression", c.src, SExpr(expr))
+			continue
+		}
+
+		if IsShortCircuit(binary.op) != c.shortCircuit {
+			t.Errorf("'%s' short circuit is %v, expected %v", c.src, IsShortCircuit(binary.op), c.shortCircuit)
+		}
+	}
+}
+
+func TestParsePrimaryExpression(t *testing.T) {
+	expr, err := setupParserTest("-f(x, 2)[i].name").parseExpression()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	neg, ok := expr.(*ASTUnaryExpr)
+	if !ok || neg.op != TokenKindSubtract {
+		t.Fatalf("expected a unary '-', got %v", expr)
+	}
+
+	sel, ok := neg.param.(*ASTSelector)
+	if !ok || sel.name != "name" {
+		t.Fatalf("expected a selector, got %v", neg.param)
+	}
+
+	index, ok := sel.expr.(*ASTIndex)
+	if !ok {
+		t.Fatalf("expected an index, got %v", sel.expr)
+	}
+
+	call, ok := index.expr.(*ASTCall)
+	if !ok || len(call.args) != 2 {
+		t.Fatalf("expected a call with two arguments, got %v", index.expr)
+	}
+}
+
+func TestParseBracketedExpression(t *testing.T) {
+	expr, err := setupParserTest("(1 + 2) * 3").parseExpression()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	// the brackets should make it ((1 + 2) * 3)
+	mul, ok := expr.(*ASTBinaryExpr)
+	if !ok || mul.op != TokenKindAsterisk {
+		t.Fatalf("expected '*' at the top, got %v", expr)
+	}
+
+	paren, ok := mul.left.(*ASTParen)
+	if !ok || paren.pos.start.Column != 1 || paren.pos.end.Column != 7 {
+		t.Fatalf("expected brackets from 1 to 7 on the left of '*', got %v", mul.left)
+	}
+
+	add, ok := paren.expr.(*ASTBinaryExpr)
+	if !ok || add.op != TokenKindAdd {
+		t.Fatalf("expected '+' in the brackets, got %v", paren.expr)
+	}
+
+	if _, ok := mul.right.(*ASTValue); !ok {
+		t.Fatalf("expected a value on the right of '*', got %v", mul.right)
+	}
+}
+
+func TestParseBracketedExpressionErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		err string
+	}{
+		{"(1 + 2", "test.go:1: this bracketed expression needs a ')' to finish it"},
+		{"()", "test.go:1: bad expression. bad."},
+	}
+
+	for _, c := range cases {
+		_, err := setupParserTest(c.src).parseExpression()
+		if err == nil || err.Error() != c.err {
+			t.Errorf("'%s' gave error %v, expected '%s'", c.src, err, c.err)
+		}
+	}
+}
+
+func TestStripParens(t *testing.T) {
+	expr, err := setupParserTest("((a)) + f((b))").parseExpression()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	outer, ok := expr.(*ASTBinaryExpr).left.(*ASTParen)
+	if !ok {
+		t.Fatalf("expected brackets, got %v", expr.(*ASTBinaryExpr).left)
+	}
+
+	if _, ok := outer.expr.(*ASTParen); !ok {
+		t.Fatalf("expected nested brackets, got %v", outer.expr)
+	}
+
+	stripped := StripParens(expr)
+	Walk(stripped, func(ast AST) bool {
+		if _, ok := ast.(*ASTParen); ok {
+			t.Errorf("there are still brackets at %v", ast.Pos())
+		}
+
+		return true
+	})
+
+	add := stripped.(*ASTBinaryExpr)
+	if ident, ok := add.left.(*ASTIdentifier); !ok || ident.name != "a" {
+		t.Errorf("expected 'a' on the left, got %v", add.left)
+	}
+
+	if ident, ok := add.right.(*ASTCall).args[0].(*ASTIdentifier); !ok || ident.name != "b" {
+		t.Errorf("expected 'b' as the argument, got %v", add.right.(*ASTCall).args[0])
+	}
+}
+
+func TestParseMethodSelectors(t *testing.T) {
+	cases := []sexprCase{
+		{"buf.Write", "(selector (identifier buf) Write)"},
+		{"bytes.Buffer.Write", "(selector (selector (identifier bytes) Buffer) Write)"},
+		{"bytes.Buffer.Write(b, x)", "(call (selector (selector (identifier bytes) Buffer) Write) ((identifier b) (identifier x)))"},
+	}
+
+	checkParsesAs(t, cases, (*Parser).parseExpression)
+}
+
+func TestParseTypeAssertion(t *testing.T) {
+	cases := []sexprCase{
+		{"x.(int)", "(typeassert (identifier x) (identifier int))"},
+		{"x.(io.Reader)", "(typeassert (identifier x) (identifier io.Reader))"},
+		{"x.(*T).name", "(selector (typeassert (identifier x) (pointer (identifier T))) name)"},
+	}
+
+	checkParsesAs(t, cases, (*Parser).parseExpression)
+}
+
+func TestParseTypeAssertionErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		err string
+	}{
+		{"x.(type)", "test.go:1: '.(type)' only works at the top of a type switch"},
+		{"x.(1)", "test.go:1: I was expecting a type in this type assertion"},
+		{"x.(int", "test.go:1: this type assertion needs a ')' at the end"},
+	}
+
+	for _, c := range cases {
+		_, err := setupParserTest(c.src).parseExpression()
+		if err == nil || err.Error() != c.err {
+			t.Errorf("'%s' gave error %v, expected '%s'", c.src, err, c.err)
+		}
+	}
+}
+
+func TestParseAsterisk(t *testing.T) {
+	// in a type '*' is always a pointer.
+	_, typ, err := setupParserTest("*int").parseDataType()
+	if err != nil || SExpr(typ) != "(pointer (identifier int))" {
+		t.Errorf("'*int' as a type gave %s, %v", SExpr(typ), err)
+	}
+
+	// in an expression it's a multiply between operands and a dereference
+	// before them.
+	cases := []sexprCase{
+		{"a * b", "(binary * (identifier a) (identifier b))"},
+		{"*p", "(unary * (identifier p))"},
+		{"*p * *q", "(binary * (unary * (identifier p)) (unary * (identifier q)))"},
+		{"a**b", "(binary * (identifier a) (unary * (identifier b)))"},
+		{"**pp", "(unary * (unary * (identifier pp)))"},
+		{"(*T)(x)", "(call (paren (unary * (identifier T))) ((identifier x)))"},
+		{"make([]*int, n)", "(call (identifier make) ((slice (pointer (identifier int))) (identifier n)))"},
+	}
+
+	checkParsesAs(t, cases, (*Parser).parseExpression)
+}
+
+func TestParseFuncLit(t *testing.T) {
+	cases := []sexprCase{
+		{"func(x int) int { return x; }", "(funclit ((param (identifier x) (identifier int))) ((param () (identifier int))) (block ((return ((identifier x))))))"},
+		{"sort(a, func(i, j int) bool { return a[i] < a[j]; })", "(call (identifier sort) ((identifier a) (funclit ((param (identifier i) (identifier int)) (param (identifier j) (identifier int))) ((param () (identifier bool))) (block ((return ((binary < (index (identifier a) (identifier i)) (index (identifier a) (identifier j))))))))))"},
+		{"func() { n++; }()", "(call (funclit () () (block ((incdec ++ (identifier n))))) ())"},
+		{"func(int) bool", "(functype ((param () (identifier int))) ((param () (identifier bool))))"},
+	}
+
+	checkParsesAs(t, cases, (*Parser).parseExpression)
+
+	stmts, err := setupParserTest("add := func(a, b int) int { return a + b + c; }").parseStatement()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	if _, ok := stmts[0].(*ASTShortVarDecl).values[0].(*ASTFuncLit); !ok {
+		t.Errorf("expected a function literal to be assigned, got %s", SExpr(stmts[0]))
+	}
+}
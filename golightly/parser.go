@@ -2,36 +2,173 @@ package golightly
 
 import (
 	"fmt"
+	"io"
+	"strings"
+	"time"
 )
 
 // type Parser controls parsing of a token stream into an AST.
 type Parser struct {
-	lexer         *Lexer         // the lexical analyser.
+	lexer         TokenSource    // where the tokens come from - usually the lexical analyser.
 	ts            *DataTypeStore // the data type store.
 	sf            *sourceFile    // handy info about this source file.
 
-	filename    string // the name of the file being parsed.
-	packageName string // the name of the package this file is a part of.
+	filename    string      // the name of the file being parsed.
+	packageName string      // the name of the package this file is a part of.
+	topLevel    *ASTTopLevel // the AST of the whole file once it's parsed.
+
+	trace      io.Writer // if it's set we say what we're doing here.
+	traceDepth int       // how deep in the parse functions we are.
+
+	stats *ParserStats // counts what we've done if EnableStats() has been called.
+}
+
+// type ParserStats has counters for what the parser has been doing. The
+// lexer keeps its own counts of tokens and lines in LexerStats.
+type ParserStats struct {
+	Files     int           // the number of files parsed.
+	Nodes     int           // the number of AST nodes in the files which parsed successfully.
+	Decls     int           // the number of top level declarations in them.
+	ParseTime time.Duration // how long parsing took, including the lexing it waited for.
 }
 
 // NewParser creates a new parser object.
-func NewParser(lexer *Lexer, ts *DataTypeStore, sf *sourceFile) *Parser {
+func NewParser(lexer TokenSource, ts *DataTypeStore, sf *sourceFile) *Parser {
 	p := new(Parser)
 	p.lexer = lexer
 	p.ts = ts
 	p.sf = sf
+	p.filename = sf.fileName
 
 	return p
 }
 
+// SetTrace makes the parser write a line to w every time it goes in or
+// out of one of its parse functions, with the token it's looking at.
+// It's handy for working out why the parser did something strange. Set
+// it to nil to turn tracing off again, which is how it starts.
+func (p *Parser) SetTrace(w io.Writer) {
+	p.trace = w
+	p.traceDepth = 0
+}
+
+// EnableStats starts the parser counting what it does. The counts carry
+// on across calls to Parse() so they can cover lots of files.
+func (p *Parser) EnableStats() {
+	if p.stats == nil {
+		p.stats = new(ParserStats)
+	}
+}
+
+// Stats returns the counts since EnableStats() was called. They're all
+// zero if it hasn't been.
+func (p *Parser) Stats() ParserStats {
+	if p.stats == nil {
+		return ParserStats{}
+	}
+
+	return *p.stats
+}
+
+// traceIn notes that we've gone into a parse function. It returns the
+// name so it can be used like this:
+//
+//	defer p.traceOut(p.traceIn("parseBlock"))
+func (p *Parser) traceIn(name string) string {
+	p.traceLine(name, " (")
+	p.traceDepth++
+	return name
+}
+
+// traceOut notes that we've come back out of a parse function.
+func (p *Parser) traceOut(name string) {
+	p.traceDepth--
+	p.traceLine(") ", name)
+}
+
+// traceLine writes an indented line of trace output along with where we
+// are in the token stream.
+func (p *Parser) traceLine(strs ...string) {
+	at := "nowhere"
+	tok, err := p.lexer.PeekToken(0)
+	if err == nil {
+		pos := tok.Pos()
+		at = fmt.Sprintf("%d:%d %v", pos.start.Line, pos.start.Column, tok.TokenKind())
+	}
+
+	fmt.Fprintf(p.trace, "%-40s %s\n", strings.Repeat(". ", p.traceDepth)+strings.Join(strs, ""), at)
+}
+
+// ScanImports reads just the package clause and import declarations of
+// a source file and returns the paths of the packages it imports. It
+// stops before the rest of the file so it's fast and it doesn't mind if
+// the rest of the file is broken.
+func ScanImports(r io.Reader, filename string) ([]string, error) {
+	lex := NewLexer()
+	lex.LexReader(r, filename)
+	p := NewParser(lex, NewDataTypeStore(), NewSourceFile(filename, nil, nil, nil, nil))
+
+	// get the package declaration.
+	_, err := p.parsePackage()
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.expectToken(TokenKindSemicolon, "I'm gonna be needing a semicolon after this 'package' declaration")
+	if err != nil {
+		return nil, err
+	}
+
+	// get the imports.
+	imports, err := p.parseImports()
+	if err != nil {
+		return nil, err
+	}
+
+	importPaths := make([]string, len(imports))
+	for i, ast := range imports {
+		importPaths[i] = ast.(*ASTImport).ImportPath()
+	}
+
+	return importPaths, nil
+}
+
 // Parse runs the parser and breaks the program down into an Abstract Syntax Tree.
 func (p *Parser) Parse() error {
-	return p.parseSourceFile()
+	if p.stats == nil {
+		return p.parseSourceFile()
+	}
+
+	start := time.Now()
+	err := p.parseSourceFile()
+	p.stats.ParseTime += time.Since(start)
+	p.stats.Files++
+	if err != nil {
+		return err
+	}
+
+	p.stats.Decls += len(p.topLevel.topLevelDecls)
+	Walk(p.topLevel, func(ast AST) bool {
+		p.stats.Nodes++
+		return true
+	})
+
+	return nil
+}
+
+// TopLevel returns the AST of the whole source file. It's only valid
+// after Parse has succeeded.
+func (p *Parser) TopLevel() *ASTTopLevel {
+	return p.topLevel
 }
 
 // parseSourceFile parses the contents of an entire source file.
 // SourceFile       = PackageClause ";" { ImportDecl ";" } { TopLevelDecl ";" } .
 func (p *Parser) parseSourceFile() error {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseSourceFile"))
+	}
+
 	// get the package declaration.
 	ast := new(ASTTopLevel)
 	packageName, err := p.parsePackage()
@@ -39,6 +176,8 @@ func (p *Parser) parseSourceFile() error {
 		return err
 	}
 	ast.packageName = packageName
+	p.packageName = packageName
+	p.sf.packageName = packageName
 
 	// get a semicolon separator.
 	err = p.expectToken(TokenKindSemicolon, "I'm gonna be needing a semicolon after this 'package' declaration")
@@ -47,35 +186,18 @@ func (p *Parser) parseSourceFile() error {
 	}
 
 	// get a number of import declarations.
-	tok, err := p.lexer.PeekToken(0)
+	ast.imports, err = p.parseImports()
 	if err != nil {
 		return err
 	}
 
-	if tok.TokenKind() == TokenKindImport {
-		for {
-			// get an import.
-			imports, err := p.parseImport()
-			if err != nil {
-				return err
-			}
-
-			ast.imports = append(ast.imports, imports...)
-
-			// get a semicolon separator.
-			err = p.expectToken(TokenKindSemicolon, "I'm gonna be needing a semicolon after this 'import' declaration")
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	// get a number of top-level declarations.
-	tok, err = p.lexer.PeekToken(0)
+	// the same package can't be imported twice.
+	err = p.checkDuplicateImports(ast.imports)
 	if err != nil {
 		return err
 	}
 
+	// get a number of top-level declarations.
 	for {
 		// get a top-level declaration.
 		match, topLevelDecls, err := p.parseTopLevelDecl()
@@ -102,12 +224,53 @@ func (p *Parser) parseSourceFile() error {
 		return err
 	}
 
+	p.topLevel = ast
+	p.sf.ast = ast
 	return nil
 }
 
+// parseImports parses all the import declarations at the start of a file.
+func (p *Parser) parseImports() ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseImports"))
+	}
+
+	var asts []AST
+	for {
+		tok, err := p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.TokenKind() != TokenKindImport {
+			break
+		}
+
+		// get an import.
+		imports, err := p.parseImport()
+		if err != nil {
+			return nil, err
+		}
+
+		asts = append(asts, imports...)
+
+		// get a semicolon separator.
+		err = p.expectToken(TokenKindSemicolon, "I'm gonna be needing a semicolon after this 'import' declaration")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return asts, nil
+}
+
 // parsePackage parses a package declaration.
 // PackageClause  = "package" PackageName .
 func (p *Parser) parsePackage() (string, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parsePackage"))
+	}
+
 	// get the package declaration
 	err := p.expectToken(TokenKindPackage, "the file should start with 'package <package name>'")
 	if err != nil {
@@ -123,6 +286,11 @@ func (p *Parser) parsePackage() (string, error) {
 	}
 
 	strPackageName := packageNameToken.(StringToken)
+	if strPackageName.strVal == "_" {
+		return "", NewError(p.filename, packageNameToken.Pos(), "the package name can't be '_' - it needs a real name")
+	}
+
+	p.sf.packagePos = packageNameToken.Pos()
 
 	return strPackageName.strVal, nil
 }
@@ -130,6 +298,10 @@ func (p *Parser) parsePackage() (string, error) {
 // parseImport parses an import declaration.
 // ImportDecl       = "import" ( ImportSpec | "(" { ImportSpec ";" } ")" ) .
 func (p *Parser) parseImport() ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseImport"))
+	}
+
 	// get the import declaration
 	importToken, err := p.lexer.PeekToken(0)
 	if err != nil {
@@ -169,6 +341,10 @@ func (p *Parser) parseImport() ([]AST, error) {
 // parseImportSpec parses import specifications as part of an import statement.
 // ImportSpec       = [ "." | PackageName ] ImportPath .
 func (p *Parser) parseImportSpec() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseImportSpec"))
+	}
+
 	// what kind of thing are we looking at?
 	nextToken, err := p.lexer.PeekToken(0)
 	if err != nil {
@@ -176,45 +352,100 @@ func (p *Parser) parseImportSpec() (AST, error) {
 	}
 
 	switch nextToken.TokenKind() {
-	case TokenKindIdentifier:
-		// it's of the form 'import fred "frod"' - get a package name first.
-		strPackageName := nextToken.(StringToken)
-		p.lexer.GetToken()
+	case TokenKindIdentifier, TokenKindDot:
+		// it's of the form 'import fred "frod"' or 'import . "frod"' - get
+		// the name to import the package as first.
+		nameToken, _ := p.lexer.GetToken()
+		alias := &ASTIdentifier{nameToken.Pos(), "", "."}
+		if nameTok, ok := nameToken.(StringToken); ok {
+			alias.name = nameTok.strVal
+		}
 
 		// get an import path.
 		pathToken, err := p.lexer.GetToken()
 		if err != nil {
 			return nil, err
 		}
-		if pathToken.TokenKind() != TokenKindString {
+		if pathToken.TokenKind() != TokenKindLiteralString {
 			return nil, NewError(p.filename, pathToken.Pos(), "this should have been a string. eg. 'import fred \"github.com/fred/thefredpackage\"'")
 		}
 
 		// tell the compiler to read the imported file
-		p.sf.addImport <- importMessage{pathToken.(StringToken).strVal, p.filename, pathToken.Pos(), nil} // XXX - need to give a completion channel.
+		p.importPackage(pathToken.(StringToken).strVal, pathToken.Pos())
 
 		// return the import spec
-		return ASTImport{pathToken.Pos(), ASTIdentifier{nextToken.Pos(), "", strPackageName.strVal}, NewASTValueFromToken(pathToken, p.ts)}, nil
+		return &ASTImport{pathToken.Pos(), alias, NewASTValueFromToken(pathToken, p.ts), ""}, nil
 
-	case TokenKindString:
+	case TokenKindLiteralString:
 		// it's of the form 'import "frod"' - just get the import path.
 		p.lexer.GetToken()
 
 		// tell the compiler to read the imported file
-		p.sf.addImport <- importMessage{nextToken.(StringToken).strVal, p.filename, nextToken.Pos(), nil} // XXX - need to give a completion channel.
+		p.importPackage(nextToken.(StringToken).strVal, nextToken.Pos())
 
 		// return the import spec
-		return ASTImport{nextToken.Pos(), nil, NewASTValueFromToken(nextToken, p.ts)}, nil
+		return &ASTImport{nextToken.Pos(), nil, NewASTValueFromToken(nextToken, p.ts), ""}, nil
 
 	default:
 		return nil, NewError(p.filename, nextToken.Pos(), "this import makes no sense. It should be like 'import [cool] \"coolpackage\"'")
 	}
 }
 
+// checkDuplicateImports makes sure that no import path or package name
+// is imported more than once in a file. Blank imports are only there for
+// their side effects so they can be repeated.
+func (p *Parser) checkDuplicateImports(imports []AST) error {
+	paths := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, ast := range imports {
+		imp := ast.(*ASTImport)
+		name := imp.LocalName()
+		if name == "_" {
+			continue
+		}
+
+		if paths[imp.ImportPath()] {
+			return NewError(p.filename, imp.Pos(), fmt.Sprint("\"", imp.ImportPath(), "\" has already been imported"))
+		}
+		paths[imp.ImportPath()] = true
+
+		if name != "." {
+			if names[name] {
+				return NewError(p.filename, imp.Pos(), fmt.Sprint("there's already a package imported as '", name, "'"))
+			}
+			names[name] = true
+		}
+	}
+
+	return nil
+}
+
+// importPackage asks the compiler to import a package. The source file
+// will wait for the package's symbols to be available before it goes on
+// to semantic analysis.
+func (p *Parser) importPackage(importPath string, pos SrcSpan) {
+	if p.sf.addImport == nil || p.sf.waitingPackageComplete[importPath] {
+		// we're only parsing or we've already asked for this package.
+		return
+	}
+
+	// importPackages() stops listening once the compiler's shutting down so
+	// we can't wait on it forever. waitImports() notices the shutdown later.
+	p.sf.waitingPackageComplete[importPath] = true
+	select {
+	case p.sf.addImport <- importMessage{importPath, p.filename, pos, p.sf.packageComplete, p.sf.shutdown}:
+	case <-p.sf.shutdown:
+	}
+}
+
 // parseTopLevelDecl parses a top-level declaration.
 // TopLevelDecl  = Declaration | FunctionDecl | MethodDecl .
 // Declaration   = ConstDecl | TypeDecl | VarDecl .
 func (p *Parser) parseTopLevelDecl() (bool, []AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseTopLevelDecl"))
+	}
+
 	// what kind of thing are we looking at?
 	nextToken, err := p.lexer.PeekToken(0)
 	if err != nil {
@@ -239,6 +470,10 @@ func (p *Parser) parseTopLevelDecl() (bool, []AST, error) {
 		ast, err := p.parseFunctionDecl()
 		return true, []AST{ast}, err
 
+	case TokenKindEndOfSource:
+		// there are no more declarations.
+		return false, nil, nil
+
 	default:
 		return false, nil, NewError(p.filename, nextToken.Pos(), "so I wanted a top level thing like a type, a func, a const or a var, but no... you had to be different")
 	}
@@ -250,6 +485,10 @@ func (p *Parser) parseTopLevelDecl() (bool, []AST, error) {
 // TypeDecl       = "type"  ( TypeSpec  | "(" { TypeSpec  ";" } ")" ) .
 // VarDecl        = "var"   ( VarSpec   | "(" { VarSpec   ";" } ")" ) .
 func (p *Parser) parseDecl(parseSpec func() ([]AST, error), verbName string) ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseDecl"))
+	}
+
 	// we already know it starts with the verb, so skip that
 	p.lexer.GetToken()
 
@@ -280,6 +519,16 @@ func (p *Parser) parseDecl(parseSpec func() ([]AST, error), verbName string) ([]
 // parseConstSpec parses a constant spec.
 // ConstSpec      = IdentifierList [ [ Type ] "=" ExpressionList ] .
 func (p *Parser) parseConstSpec() ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseConstSpec"))
+	}
+
+	// a comment just before the names documents them.
+	doc, err := p.peekDocComment()
+	if err != nil {
+		return nil, err
+	}
+
 	// get the identifier list
 	identList, err := p.parseIdentifierList("constant")
 	if err != nil {
@@ -300,9 +549,9 @@ func (p *Parser) parseConstSpec() ([]AST, error) {
 
 	// handle optional part.
 	var exprList []AST
-	if matchTyp || equalsToken.TokenKind() == TokenKindEquals {
+	if matchTyp || equalsToken.TokenKind() == TokenKindAssign {
 		// there must be an '=' and expression list after a type.
-		if equalsToken.TokenKind() != TokenKindEquals {
+		if equalsToken.TokenKind() != TokenKindAssign {
 			return nil, NewError(p.filename, equalsToken.Pos(), "after a data type I expected to see '=' here")
 		}
 
@@ -325,26 +574,44 @@ func (p *Parser) parseConstSpec() ([]AST, error) {
 	// make a set of consts out of all this.
 	asts := make([]AST, len(identList))
 	for i := 0; i < len(identList); i++ {
-		asts[i] = ASTConstDecl{identList[i], typeAST, exprList[i]}
+		asts[i] = &ASTConstDecl{identList[i], typeAST, exprList[i], doc}
 	}
 
 	return asts, nil
 }
 
 // parseTypeSpec parses a type declaration specification.
-// TypeSpec     = identifier Type .
+// TypeSpec     = AliasDecl | TypeDef .
+// AliasDecl    = identifier "=" Type .
+// TypeDef      = identifier Type .
 func (p *Parser) parseTypeSpec() ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseTypeSpec"))
+	}
+
 	// get an identifier
 	ident, err := p.lexer.GetToken()
 	if err != nil {
 		return nil, err
 	}
 
+	doc := p.docComment(ident)
 	if ident.TokenKind() != TokenKindIdentifier {
 		return nil, NewError(p.filename, ident.Pos(), fmt.Sprint("this should have been a name for a type, but it's not"))
 	}
 
-	identAST := ASTIdentifier{ident.Pos(), "", ident.(StringToken).strVal}
+	identAST := &ASTIdentifier{ident.Pos(), "", ident.(StringToken).strVal}
+
+	// an '=' makes it an alias.
+	equalsToken, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	alias := equalsToken.TokenKind() == TokenKindAssign
+	if alias {
+		p.lexer.GetToken()
+	}
 
 	// get the data type
 	matchTyp, typeAST, err := p.parseDataType()
@@ -362,12 +629,22 @@ func (p *Parser) parseTypeSpec() ([]AST, error) {
 		return nil, NewError(p.filename, fail.Pos(), fmt.Sprint("this should have been a name for a type, but it's not"))
 	}
 
-	return []AST{ASTDataTypeDecl{identAST, typeAST}}, nil
+	return []AST{&ASTDataTypeDecl{identAST, typeAST, alias, doc}}, nil
 }
 
 // parseVarSpec parses a variable declaration specification.
 // VarSpec     = IdentifierList ( Type [ "=" ExpressionList ] | "=" ExpressionList ) .
 func (p *Parser) parseVarSpec() ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseVarSpec"))
+	}
+
+	// a comment just before the names documents them.
+	doc, err := p.peekDocComment()
+	if err != nil {
+		return nil, err
+	}
+
 	// get the identifier list
 	identList, err := p.parseIdentifierList("variable")
 	if err != nil {
@@ -388,7 +665,7 @@ func (p *Parser) parseVarSpec() ([]AST, error) {
 			return nil, err
 		}
 
-		if equalsToken.TokenKind() == TokenKindEquals {
+		if equalsToken.TokenKind() == TokenKindAssign {
 			// get the expression list.
 			p.lexer.GetToken()
 			exprList, err = p.parseExpressionList()
@@ -398,13 +675,12 @@ func (p *Parser) parseVarSpec() ([]AST, error) {
 		}
 	} else {
 		// required equals.
-		err := p.expectToken(TokenKindEquals, "I was expecting to see an '=' here")
+		err := p.expectToken(TokenKindAssign, "I was expecting to see an '=' here")
 		if err != nil {
 			return nil, err
 		}
 
 		// get the expression list.
-		p.lexer.GetToken()
 		exprList, err = p.parseExpressionList()
 		if err != nil {
 			return nil, err
@@ -425,15 +701,44 @@ func (p *Parser) parseVarSpec() ([]AST, error) {
 	// make a set of variable declarations out of all this.
 	asts := make([]AST, len(identList))
 	for i := 0; i < len(identList); i++ {
-		asts[i] = ASTVarDecl{identList[i], typeAST, exprList[i]}
+		var value AST
+		if exprList != nil {
+			value = exprList[i]
+		}
+		asts[i] = &ASTVarDecl{identList[i], typeAST, value, doc}
 	}
 
 	return asts, nil
 }
 
+// docComment gets the comment just before the line a token's on, if the
+// token source keeps track of them.
+func (p *Parser) docComment(tok Token) string {
+	dcs, ok := p.lexer.(DocCommentSource)
+	if !ok {
+		return ""
+	}
+
+	return dcs.DocComment(tok.Pos().start.Line)
+}
+
+// peekDocComment gets the comment just before the next token.
+func (p *Parser) peekDocComment() (string, error) {
+	tok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return "", err
+	}
+
+	return p.docComment(tok), nil
+}
+
 // parseIdentifierList parses a comma-separated list of identifiers.
 // IdentifierList = identifier { "," identifier } .
 func (p *Parser) parseIdentifierList(identDesc string) ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseIdentifierList"))
+	}
+
 	var asts []AST
 
 	for {
@@ -448,7 +753,7 @@ func (p *Parser) parseIdentifierList(identDesc string) ([]AST, error) {
 		}
 
 		// add the identifier to our list of identifiers.
-		asts = append(asts, ASTIdentifier{ident.Pos(), "", ident.(StringToken).strVal})
+		asts = append(asts, &ASTIdentifier{ident.Pos(), "", ident.(StringToken).strVal})
 
 		// look for a comma after it.
 		comma, err := p.lexer.PeekToken(0)
@@ -471,6 +776,10 @@ func (p *Parser) parseIdentifierList(identDesc string) ([]AST, error) {
 // FunctionName or receiver.
 // FunctionDecl = "func" FunctionName ( Function | Signature ) .
 func (p *Parser) parseFunctionDecl() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseFunctionDecl"))
+	}
+
 	// we already know it starts with "func"
 	funcToken, _ := p.lexer.GetToken()
 
@@ -484,6 +793,9 @@ func (p *Parser) parseFunctionDecl() (AST, error) {
 	if tok.TokenKind() == TokenKindOpenBracket {
 		// it's a receiver.
 		receiver, err = p.parseReceiver()
+		if err != nil {
+			return nil, err
+		}
 
 		// take a look at the next token.
 		tok, err = p.lexer.PeekToken(0)
@@ -506,6 +818,10 @@ func (p *Parser) parseFunctionDecl() (AST, error) {
 
 	// this might be followed by a function body.
 	bodyToken, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
 	var body AST
 	if bodyToken.TokenKind() == TokenKindOpenBrace {
 		// parse a function body.
@@ -515,13 +831,17 @@ func (p *Parser) parseFunctionDecl() (AST, error) {
 		}
 	}
 
-	return ASTFunctionDecl{funcToken.Pos().Add(tok.Pos()), funcName, receiver, params, returns, body}, nil
+	return &ASTFunctionDecl{funcToken.Pos().Add(tok.Pos()), funcName, receiver, params, returns, body, p.docComment(funcToken)}, nil
 }
 
 // parseReceiver parses a method receiver.
 // Receiver     = "(" [ identifier ] [ "*" ] BaseTypeName ")" .
 // BaseTypeName = identifier .
 func (p *Parser) parseReceiver() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseReceiver"))
+	}
+
 	// get the opening bracket
 	bracketPos, err := p.expectTokenPos(TokenKindOpenBracket, "receivers start with an open bracket, but that's not what I'm seeing")
 	if err != nil {
@@ -534,7 +854,7 @@ func (p *Parser) parseReceiver() (AST, error) {
 	if err != nil {
 		return nil, err
 	}
-	tok2, err := p.lexer.PeekToken(1)
+	tok2, err := p.lexer.PeekToken(0)
 	if err != nil {
 		return nil, err
 	}
@@ -569,20 +889,26 @@ func (p *Parser) parseReceiver() (AST, error) {
 
 	// now get the closing bracket.
 	endBracketPos, err := p.expectTokenPos(TokenKindCloseBracket, "I'd like a ')' to finish this receiver... thanks")
+	if err != nil {
+		return nil, err
+	}
 
-	return ASTReceiver{bracketPos.Add(endBracketPos), ident, pointer, baseTypeName}, nil
+	return &ASTReceiver{bracketPos.Add(endBracketPos), ident, pointer, baseTypeName}, nil
 }
 
 // parseGroupSingle parses a group of some other clause, surrounded by brackets and
-// with semicolons after each entry.
+// with semicolons between each entry.
 func (p *Parser) parseGroupSingle(parseClause func() (AST, error), verbName string) ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseGroupSingle"))
+	}
+
 	err := p.expectToken(TokenKindOpenBracket, "there should be a '(' here")
 	if err != nil {
 		return nil, err
 	}
 
 	// get a series of sub-clauses.
-	p.lexer.GetToken()
 	var asts []AST
 	semiErrorMessage := fmt.Sprint("I really wanted a semicolon between these '", verbName, "'s")
 	for {
@@ -601,28 +927,46 @@ func (p *Parser) parseGroupSingle(parseClause func() (AST, error), verbName stri
 			return nil, err
 		}
 
+		asts = append(asts, newClause)
+
+		// the semicolon can be left out before the ')'.
+		closeBracketToken, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+		if closeBracketToken.TokenKind() == TokenKindCloseBracket {
+			break
+		}
+
 		// get a semicolon separator.
 		err = p.expectToken(TokenKindSemicolon, semiErrorMessage)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		asts = append(asts, newClause)
+	// get the closing ')'.
+	err = p.expectToken(TokenKindCloseBracket, "there should be a ')' here")
+	if err != nil {
+		return nil, err
 	}
 
 	return asts, nil
 }
 
 // parseGroupMulti parses a group of some other clause, surrounded by brackets and
-// with semicolons after each entry.
+// with semicolons between each entry.
 func (p *Parser) parseGroupMulti(parseClause func() ([]AST, error), verbName string) ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseGroupMulti"))
+	}
+
 	err := p.expectToken(TokenKindOpenBracket, "there should be a '(' here")
 	if err != nil {
 		return nil, err
 	}
 
 	// get a series of sub-clauses.
-	p.lexer.GetToken()
 	var asts []AST
 	semiErrorMessage := fmt.Sprint("I really wanted a semicolon between these '", verbName, "'s")
 	for {
@@ -641,13 +985,28 @@ func (p *Parser) parseGroupMulti(parseClause func() ([]AST, error), verbName str
 			return nil, err
 		}
 
+		asts = append(asts, newClauses...)
+
+		// the semicolon can be left out before the ')'.
+		closeBracketToken, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+		if closeBracketToken.TokenKind() == TokenKindCloseBracket {
+			break
+		}
+
 		// get a semicolon separator.
 		err = p.expectToken(TokenKindSemicolon, semiErrorMessage)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		asts = append(asts, newClauses...)
+	// get the closing ')'.
+	err = p.expectToken(TokenKindCloseBracket, "there should be a ')' here")
+	if err != nil {
+		return nil, err
 	}
 
 	return asts, nil
@@ -657,6 +1016,10 @@ func (p *Parser) parseGroupMulti(parseClause func() ([]AST, error), verbName str
 // OptionallyQualifiedIdent = identifier | QualifiedIdent .
 // QualifiedIdent = PackageName "." identifier .
 func (p *Parser) parseOptionallyQualifiedIdentifier() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseOptionallyQualifiedIdentifier"))
+	}
+
 	// check that it's an identifier of some sort
 	tok, err := p.lexer.GetToken()
 	if err != nil {
@@ -666,18 +1029,27 @@ func (p *Parser) parseOptionallyQualifiedIdentifier() (AST, error) {
 		return nil, NewError(p.filename, tok.Pos(), "if you could just put an identifier here that'd be greeeat")
 	}
 
-	ast := ASTIdentifier{tok.Pos(), "", tok.(StringToken).strVal}
+	ast := &ASTIdentifier{tok.Pos(), "", tok.(StringToken).strVal}
 
 	// might be followed by a '.'
 	tok, err = p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
 	if tok.TokenKind() == TokenKindDot {
 		p.lexer.GetToken()
 
 		// get a following identifier.
+		tok, err = p.lexer.GetToken()
+		if err != nil {
+			return nil, err
+		}
 		if tok.TokenKind() != TokenKindIdentifier {
-			return nil, NewError(p.filename, tok.Pos(), "if you could just put an identifier here that'd be greeeat")
+			return nil, NewError(p.filename, tok.Pos(), fmt.Sprint("I need the name of something in package ", ast.name, " after the '.'"))
 		}
 
+		ast.pos = ast.pos.Add(tok.Pos())
 		ast.packageName = ast.name
 		ast.name = tok.(StringToken).strVal
 	}
@@ -689,8 +1061,12 @@ func (p *Parser) parseOptionallyQualifiedIdentifier() (AST, error) {
 // Signature      = Parameters [ Result ] .
 // Result         = Parameters | Type .
 func (p *Parser) parseSignature() ([]AST, []AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseSignature"))
+	}
+
 	// get a bracket-enclosed parameter list
-	params, err := p.parseBracketedParameterList()
+	params, err := p.parseBracketedParameterList(true)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -704,7 +1080,7 @@ func (p *Parser) parseSignature() ([]AST, []AST, error) {
 	var returns []AST
 	if returnTok.TokenKind() == TokenKindOpenBracket {
 		// it's a bracketed return list.
-		returns, err = p.parseBracketedParameterList()
+		returns, err = p.parseBracketedParameterList(false)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -716,7 +1092,7 @@ func (p *Parser) parseSignature() ([]AST, []AST, error) {
 		}
 		if match {
 			// yes, set this return type.
-			returns = []AST{ASTParameterDecl{nil, returnType}}
+			returns = []AST{&ASTParameterDecl{nil, nil, returnType}}
 		}
 	}
 
@@ -726,8 +1102,13 @@ func (p *Parser) parseSignature() ([]AST, []AST, error) {
 // parseBracketedParameterList parses a parameter list surrounded by brackets.
 // Parameters     = "(" [ ParameterList [ "," ] ] ")" .
 // ParameterList  = ParameterDecl { "," ParameterDecl } .
-// ParameterDecl  = [ IdentifierList ] [ "..." ] Type .
-func (p *Parser) parseBracketedParameterList() ([]AST, error) {
+// Only parameters can be variadic, not results, so variadic says whether
+// a "..." is allowed.
+func (p *Parser) parseBracketedParameterList(variadic bool) ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseBracketedParameterList"))
+	}
+
 	// get the open bracket
 	err := p.expectToken(TokenKindOpenBracket, "parameter lists should start with '('")
 	if err != nil {
@@ -735,45 +1116,121 @@ func (p *Parser) parseBracketedParameterList() ([]AST, error) {
 	}
 
 	// get a series of parameter declarations.
-	var params []AST
+	var params []*ASTParameterDecl
 	for {
+		// is it a terminating ')'?
+		tok, err := p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+		if tok.TokenKind() == TokenKindCloseBracket {
+			break
+		}
+
 		// get a parameter declaration.
-		newParams, err := p.parseParameterDecl()
+		param, err := p.parseParameterDecl()
 		if err != nil {
 			return nil, err
 		}
 
-		params = append(params, newParams...)
+		params = append(params, param)
+
+		// parameters are separated by commas.
+		tok, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+		if tok.TokenKind() != TokenKindComma {
+			break
+		}
+		p.lexer.GetToken()
 	}
 
-	return params, nil
-}
+	// get the close bracket
+	err = p.expectToken(TokenKindCloseBracket, "parameter lists should end with ')'")
+	if err != nil {
+		return nil, err
+	}
 
-// parseBracketedParameterList parses a parameter list surrounded by brackets.
-// ParameterDecl  = [ IdentifierList ] [ "..." ] Type .
-func (p *Parser) parseParameterDecl() ([]AST, error) {
-	// get a list of identifiers
-	idents, err := p.parseIdentifierList("parameter")
+	asts, err := p.nameParameters(params)
 	if err != nil {
 		return nil, err
 	}
 
-	// see if there's a "...".
+	// only the last parameter can be variadic.
+	for i, param := range asts {
+		ellipsis := param.(*ASTParameterDecl).ellipsis
+		if ellipsis == nil {
+			continue
+		}
+
+		if !variadic {
+			return nil, NewError(p.filename, ellipsis.Pos(), "results can't have a '...' - only parameters can")
+		}
+
+		if i != len(asts)-1 {
+			return nil, NewError(p.filename, ellipsis.Pos(), "only the last parameter can have a '...'")
+		}
+	}
+
+	return asts, nil
+}
+
+// parseParameterDecl parses a single parameter declaration. A name on its
+// own could be either a parameter name or a type, so it's returned as a
+// type with no name and sorted out later by nameParameters.
+// ParameterDecl  = [ IdentifierList ] [ "..." ] Type .
+func (p *Parser) parseParameterDecl() (*ASTParameterDecl, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseParameterDecl"))
+	}
+
 	tok, err := p.lexer.PeekToken(0)
 	if err != nil {
 		return nil, err
 	}
 
-	if tok.TokenKind() == TokenKindEllipsis {
-		idents = append(idents, ASTEllipsis{tok.Pos()})
+	var ident AST
+	if tok.TokenKind() == TokenKindIdentifier {
+		next, err := p.lexer.PeekToken(1)
+		if err != nil {
+			return nil, err
+		}
+
+		switch next.TokenKind() {
+		case TokenKindComma, TokenKindCloseBracket:
+			// a name on its own.
+			p.lexer.GetToken()
+			return &ASTParameterDecl{nil, nil, &ASTIdentifier{tok.Pos(), "", tok.(StringToken).strVal}}, nil
+
+		case TokenKindDot:
+			// it's a type from another package.
+
+		default:
+			// it's a name followed by a type.
+			p.lexer.GetToken()
+			ident = &ASTIdentifier{tok.Pos(), "", tok.(StringToken).strVal}
+		}
 	}
 
-	// the next thing should be a type declaration.
+	// see if there's a "...".
 	typeToken, err := p.lexer.PeekToken(0)
 	if err != nil {
 		return nil, err
 	}
 
+	var ellipsis AST
+	if typeToken.TokenKind() == TokenKindEllipsis {
+		p.lexer.GetToken()
+		ellipsis = &ASTEllipsis{typeToken.Pos()}
+
+		typeToken, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the next thing should be a type declaration.
 	match, typ, err := p.parseDataType()
 	if err != nil {
 		return nil, err
@@ -782,13 +1239,48 @@ func (p *Parser) parseParameterDecl() ([]AST, error) {
 		return nil, NewError(p.filename, typeToken.Pos(), "there's a missing type in this parameter list")
 	}
 
-	// return all the parameters, expanded.
-	params := make([]AST, len(idents))
-	for i, ident := range idents {
-		params[i] = ASTParameterDecl{ident, typ}
+	return &ASTParameterDecl{ident, ellipsis, typ}, nil
+}
+
+// nameParameters sorts out which parameters have names. Either they all
+// have names or none of them do. If some of them do then any names on
+// their own share the type of the next parameter, like "a, b int".
+func (p *Parser) nameParameters(params []*ASTParameterDecl) ([]AST, error) {
+	named := false
+	for _, param := range params {
+		if param.identifier != nil {
+			named = true
+		}
+	}
+
+	asts := make([]AST, len(params))
+	if !named {
+		for i, param := range params {
+			asts[i] = param
+		}
+
+		return asts, nil
 	}
 
-	return params, nil
+	// work backwards so we know the type each name will get.
+	var typed *ASTParameterDecl
+	for i := len(params) - 1; i >= 0; i-- {
+		param := params[i]
+		if param.identifier != nil {
+			typed = params[i]
+			asts[i] = param
+			continue
+		}
+
+		ident, ok := param.typ.(*ASTIdentifier)
+		if !ok || ident.packageName != "" || param.ellipsis != nil || typed == nil {
+			return nil, NewError(p.filename, param.Pos(), "either all the parameters here should have names or none of them should")
+		}
+
+		asts[i] = &ASTParameterDecl{ident, typed.ellipsis, typed.typ}
+	}
+
+	return asts, nil
 }
 
 // expectToken parses a required token.
@@ -803,7 +1295,7 @@ func (p *Parser) expectTokenPos(tk TokenKind, message string) (SrcSpan, error) {
 	// get a token
 	tok, err := p.lexer.GetToken()
 	if err != nil {
-		return tok.Pos(), err
+		return SrcSpan{}, err
 	}
 	if tok.TokenKind() != tk {
 		return tok.Pos(), NewError(p.filename, tok.Pos(), message)
@@ -0,0 +1,556 @@
+package golightly
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func setupParserTest(src string) *Parser {
+	lex := NewLexer()
+	lex.LexReader(strings.NewReader(src), "test.go")
+	sf := NewSourceFile("test.go", nil, nil, nil, nil)
+
+	return NewParser(lex, NewDataTypeStore(), sf)
+}
+
+// type sexprCase is some source and the s-expression it should parse as.
+type sexprCase struct {
+	src  string
+	expr string
+}
+
+// checkParsesAs parses the source of each case and checks that it gives
+// the expected s-expression.
+func checkParsesAs(t *testing.T, cases []sexprCase, parse func(p *Parser) (AST, error)) {
+	t.Helper()
+
+	for _, c := range cases {
+		ast, err := parse(setupParserTest(c.src))
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		if SExpr(ast) != c.expr {
+			t.Errorf("'%s' parsed as %s, expected %s", c.src, SExpr(ast), c.expr)
+		}
+	}
+}
+
+// parseOneStatement parses a single statement for checkParsesAs().
+func parseOneStatement(p *Parser) (AST, error) {
+	stmts, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	return stmts[0], nil
+}
+
+func parseTestSource(src string) error {
+	return setupParserTest(src).Parse()
+}
+
+func TestParsePackageName(t *testing.T) {
+	parser := setupParserTest("package horatio;\n")
+	err := parser.Parse()
+	if err != nil {
+		t.Error("error parsing: ", err)
+		return
+	}
+
+	if parser.TopLevel().PackageName() != "horatio" {
+		t.Error("wrong package name: ", parser.TopLevel().PackageName())
+	}
+}
+
+func TestParseDuplicateImport(t *testing.T) {
+	err := parseTestSource("package main;\nimport (\n\t\"fmt\";\n\t\"fmt\";\n);\n")
+	if err == nil {
+		t.Error("expected an error for a duplicate import")
+		return
+	}
+
+	if !strings.HasPrefix(err.Error(), "test.go:4: ") {
+		t.Error("wrong error: ", err)
+	}
+
+	err = parseTestSource("package main;\nimport f \"fmt\";\nimport f \"os\";\n")
+	if err == nil {
+		t.Error("expected an error for a duplicate import name")
+	}
+}
+
+func TestParseRepeatedBlankImport(t *testing.T) {
+	err := parseTestSource("package main;\nimport (\n\t_ \"fmt\";\n\t_ \"fmt\";\n\t\"fmt\";\n);\n")
+	if err != nil {
+		t.Error("error parsing: ", err)
+	}
+}
+
+func TestScanImports(t *testing.T) {
+	src := `package main;
+import "fmt";
+import (
+	sys "os";
+	_ "strings";
+);
+
+func main() { this is { not go ] at all
+`
+	imports, err := ScanImports(strings.NewReader(src), "test.go")
+	if err != nil {
+		t.Error("error scanning imports: ", err)
+		return
+	}
+
+	if strings.Join(imports, " ") != "fmt os strings" {
+		t.Error("wrong imports: ", imports)
+	}
+}
+
+func TestParseBlankPackageName(t *testing.T) {
+	err := parseTestSource("package _;\n")
+	if err == nil {
+		t.Error("expected an error for a blank package name")
+		return
+	}
+
+	if err.Error() != "test.go:1: the package name can't be '_' - it needs a real name" {
+		t.Error("wrong error: ", err)
+	}
+}
+
+func TestParseOptionallyQualifiedIdentifier(t *testing.T) {
+	ast, err := setupParserTest("pkg.Name").parseOptionallyQualifiedIdentifier()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	ident := ast.(*ASTIdentifier)
+	if ident.packageName != "pkg" || ident.name != "Name" {
+		t.Errorf("'pkg.Name' gave package '%s' and name '%s'", ident.packageName, ident.name)
+	}
+
+	ast, err = setupParserTest("Name;").parseOptionallyQualifiedIdentifier()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	ident = ast.(*ASTIdentifier)
+	if ident.packageName != "" || ident.name != "Name" {
+		t.Errorf("'Name' gave package '%s' and name '%s'", ident.packageName, ident.name)
+	}
+
+	// a '.' at the end of the source needs a name after it.
+	_, err = setupParserTest("pkg.").parseOptionallyQualifiedIdentifier()
+	if err == nil || err.Error() != "test.go:1: I need the name of something in package pkg after the '.'" {
+		t.Errorf("'pkg.' gave error %v", err)
+	}
+
+	// lexer errors are passed on, both before and after the '.'.
+	for _, src := range []string{"pkg#", "pkg.#"} {
+		_, err = setupParserTest(src).parseOptionallyQualifiedIdentifier()
+		if err == nil || !strings.Contains(err.Error(), "illegal character '#'") {
+			t.Errorf("'%s' gave error %v", src, err)
+		}
+	}
+}
+
+func TestImportPathName(t *testing.T) {
+	cases := []struct {
+		path string
+		name string
+	}{
+		{"fmt", "fmt"},
+		{"a/z", "z"},
+		{"example.com/foo/v2", "foo"},
+		{"gopkg.in/yaml.v2", "yaml"},
+		{"gopkg.in/yaml.v3", "yaml"},
+		{"v2", "v2"},
+		{"example.com/v2x", "v2x"},
+		{"example.com/foo.bar", "foo.bar"},
+	}
+
+	for _, c := range cases {
+		if name := importPathName(c.path); name != c.name {
+			t.Errorf("\"%s\" should be called '%s', got '%s'", c.path, c.name, name)
+		}
+	}
+}
+
+func TestParseImportAlias(t *testing.T) {
+	p := setupParserTest("package main;\nimport fred \"x\";\nimport . \"y\";\nimport \"a/z\";\n")
+	err := p.Parse()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	expected := []struct {
+		localName string
+		path      string
+	}{
+		{"fred", "x"},
+		{".", "y"},
+		{"z", "a/z"},
+	}
+
+	imports := p.TopLevel().imports
+	if len(imports) != len(expected) {
+		t.Fatalf("expected %d imports, got %d", len(expected), len(imports))
+	}
+
+	for i, e := range expected {
+		imp := imports[i].(*ASTImport)
+		if imp.LocalName() != e.localName || imp.ImportPath() != e.path {
+			t.Errorf("import %d is '%s' \"%s\", expected '%s' \"%s\"", i, imp.LocalName(), imp.ImportPath(), e.localName, e.path)
+		}
+	}
+
+	alias := imports[0].(*ASTImport).packageName.(*ASTIdentifier)
+	if alias.name != "fred" || alias.pos.start.Line != 2 || alias.pos.start.Column != 8 {
+		t.Errorf("the alias should be 'fred' at 2:8, got '%s' at %v", alias.name, alias.pos)
+	}
+}
+
+func TestParseDeclPos(t *testing.T) {
+	cases := []struct {
+		src   string
+		start SrcLoc
+		end   SrcLoc
+	}{
+		{"const x int = 1 + 22;", SrcLoc{2, 7}, SrcLoc{2, 20}},
+		{"const x = 7;", SrcLoc{2, 7}, SrcLoc{2, 11}},
+		{"var y int = 3;", SrcLoc{2, 5}, SrcLoc{2, 13}},
+		{"var y = \"abc\";", SrcLoc{2, 5}, SrcLoc{2, 13}},
+		{"var y string;", SrcLoc{2, 5}, SrcLoc{2, 12}},
+	}
+
+	for _, c := range cases {
+		p := setupParserTest("package main;\n" + c.src)
+		err := p.Parse()
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		pos := p.TopLevel().topLevelDecls[0].Pos()
+		if !pos.start.Equals(c.start) || !pos.end.Equals(c.end) {
+			t.Errorf("'%s' has span %v, expected %v to %v", c.src, pos, c.start, c.end)
+		}
+	}
+}
+
+func TestParseTypeAlias(t *testing.T) {
+	cases := []struct {
+		src   string
+		alias bool
+	}{
+		{"type A int;", false},
+		{"type A = int;", true},
+		{"type A = []string;", true},
+		{"type A struct { x int; };", false},
+	}
+
+	for _, c := range cases {
+		p := setupParserTest("package main;\n" + c.src)
+		err := p.Parse()
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		decl := p.TopLevel().topLevelDecls[0].(*ASTDataTypeDecl)
+		if decl.alias != c.alias || decl.typ == nil {
+			t.Errorf("'%s' parsed as %v", c.src, decl)
+		}
+	}
+}
+
+func TestParseGroupedTypes(t *testing.T) {
+	p := setupParserTest("package main;\ntype (\n\tA int;\n\tB struct { x A; };\n\tC = B\n);\n")
+	err := p.Parse()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	expected := []struct {
+		name  string
+		alias bool
+	}{
+		{"A", false},
+		{"B", false},
+		{"C", true},
+	}
+
+	decls := p.TopLevel().topLevelDecls
+	if len(decls) != len(expected) {
+		t.Fatalf("expected %d type declarations, got %d", len(expected), len(decls))
+	}
+
+	for i, e := range expected {
+		decl, ok := decls[i].(*ASTDataTypeDecl)
+		if !ok {
+			t.Errorf("declaration %d should be a type, got %v", i, decls[i])
+			continue
+		}
+
+		if name := decl.ident.(*ASTIdentifier).name; name != e.name || decl.alias != e.alias {
+			t.Errorf("declaration %d is '%s' with alias %v, expected '%s' with alias %v", i, name, decl.alias, e.name, e.alias)
+		}
+	}
+
+	if _, ok := decls[1].(*ASTDataTypeDecl).typ.(*ASTDataTypeStruct); !ok {
+		t.Errorf("B should be a struct, got %v", decls[1].(*ASTDataTypeDecl).typ)
+	}
+}
+
+func TestParseGroupedTypesNoSemicolon(t *testing.T) {
+	err := parseTestSource("package main;\ntype (\n\tA int\n\tB int\n);\n")
+	if err == nil || err.Error() != "test.go:4: I really wanted a semicolon between these 'type's" {
+		t.Errorf("got error %v", err)
+	}
+}
+
+// packageVarTokens makes tokens for "package main; var x int;" on one line.
+func packageVarTokens() []Token {
+	at := func(from, to int) SrcSpan { return SrcSpan{SrcLoc{1, from}, SrcLoc{1, to}, ""} }
+	return []Token{
+		SimpleToken{at(1, 7), TokenKindPackage},
+		StringToken{SimpleToken{at(9, 12), TokenKindIdentifier}, "main"},
+		SimpleToken{at(13, 13), TokenKindSemicolon},
+		SimpleToken{at(15, 17), TokenKindVar},
+		StringToken{SimpleToken{at(19, 19), TokenKindIdentifier}, "x"},
+		StringToken{SimpleToken{at(21, 23), TokenKindIdentifier}, "int"},
+		SimpleToken{at(24, 24), TokenKindSemicolon},
+	}
+}
+
+func TestParseTokenSources(t *testing.T) {
+	tokens := make(chan Token, 10)
+	for _, tok := range packageVarTokens() {
+		tokens <- tok
+	}
+	close(tokens)
+
+	sources := map[string]TokenSource{
+		"replay":  NewReplayTokenSource(packageVarTokens()),
+		"channel": NewChannelTokenSource(tokens),
+	}
+
+	for name, source := range sources {
+		p := NewParser(source, NewDataTypeStore(), NewSourceFile("test.go", nil, nil, nil, nil))
+		if err := p.Parse(); err != nil {
+			t.Errorf("%s: error parsing: %v", name, err)
+			continue
+		}
+
+		top := p.sf.ast.(*ASTTopLevel)
+		if top.packageName != "main" || len(top.topLevelDecls) != 1 {
+			t.Errorf("%s: got %s", name, SExpr(top))
+			continue
+		}
+
+		if decl, ok := top.topLevelDecls[0].(*ASTVarDecl); !ok || decl.ident.(*ASTIdentifier).name != "x" {
+			t.Errorf("%s: expected 'var x int', got %s", name, SExpr(top.topLevelDecls[0]))
+		}
+	}
+}
+
+// type mockTokenSource gives out some tokens and then an error, and
+// keeps track of how many tokens were taken.
+type mockTokenSource struct {
+	tokens []Token
+	err    error
+	taken  int
+}
+
+func (mts *mockTokenSource) GetToken() (Token, error) {
+	tok, err := mts.PeekToken(0)
+	if err == nil {
+		mts.taken++
+	}
+
+	return tok, err
+}
+
+func (mts *mockTokenSource) PeekToken(ahead int) (Token, error) {
+	if mts.taken+ahead >= len(mts.tokens) {
+		return nil, mts.err
+	}
+
+	return mts.tokens[mts.taken+ahead], nil
+}
+
+func TestParsePackageMockTokens(t *testing.T) {
+	mock := &mockTokenSource{tokens: packageVarTokens()[:2], err: errors.New("out of tokens")}
+	p := NewParser(mock, NewDataTypeStore(), NewSourceFile("test.go", nil, nil, nil, nil))
+
+	name, err := p.parsePackage()
+	if err != nil || name != "main" {
+		t.Fatalf("expected package main, got '%s', %v", name, err)
+	}
+
+	if mock.taken != 2 {
+		t.Errorf("the package clause should take 2 tokens, it took %d", mock.taken)
+	}
+
+	// errors from the token source come straight through.
+	if err := p.Parse(); err != mock.err {
+		t.Errorf("expected the token source's error, got %v", err)
+	}
+}
+
+func TestParseReplayTokens(t *testing.T) {
+	at := func(from, to int) SrcSpan { return SrcSpan{SrcLoc{1, from}, SrcLoc{1, to}, ""} }
+	source := NewReplayTokenSource([]Token{
+		SimpleToken{at(1, 3), TokenKindVar},
+		StringToken{SimpleToken{at(5, 5), TokenKindIdentifier}, "x"},
+		StringToken{SimpleToken{at(7, 9), TokenKindIdentifier}, "int"},
+	})
+
+	// it can look as far ahead as it likes, even past the end.
+	if tok, _ := source.PeekToken(5); tok.TokenKind() != TokenKindEndOfSource || tok.Pos() != at(9, 9) {
+		t.Errorf("expected the end of source at 1:9, got %v", tok)
+	}
+
+	p := NewParser(source, NewDataTypeStore(), NewSourceFile("test.go", nil, nil, nil, nil))
+	stmts, err := p.parseStatement()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	if sexpr := SExpr(stmts[0]); sexpr != "(var (identifier x) (identifier int) ())" {
+		t.Errorf("got %s", sexpr)
+	}
+
+	if tok, _ := source.GetToken(); tok.TokenKind() != TokenKindEndOfSource {
+		t.Errorf("expected all the tokens to be used, got %v", tok)
+	}
+}
+
+func TestParseTrace(t *testing.T) {
+	var trace strings.Builder
+	p := setupParserTest("-a")
+	p.SetTrace(&trace)
+	if _, err := p.parseExpression(); err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	expected := strings.Join([]string{
+		"parseExpression (                        1:1 -",
+		". parseBinaryExpr (                      1:1 -",
+		". . parseUnaryExpr (                     1:1 -",
+		". . . parseUnaryExpr (                   1:2 identifier",
+		". . . . parsePrimaryExpr (               1:2 identifier",
+		". . . . . parseOperand (                 1:2 identifier",
+		". . . . . ) parseOperand                 1:3 end of source",
+		". . . . ) parsePrimaryExpr               1:3 end of source",
+		". . . ) parseUnaryExpr                   1:3 end of source",
+		". . ) parseUnaryExpr                     1:3 end of source",
+		". ) parseBinaryExpr                      1:3 end of source",
+		") parseExpression                        1:3 end of source",
+		"",
+	}, "\n")
+	if trace.String() != expected {
+		t.Errorf("expected trace:\n%s\ngot:\n%s", expected, trace.String())
+	}
+}
+
+func TestParseDocComments(t *testing.T) {
+	src := `package main;
+
+// Double doubles a number.
+// It's not very clever.
+func Double(x int) int { return x * 2; };
+
+// this one's separated by a blank line.
+
+func Half(x int) int { return x / 2; };
+
+func Triple(x int) int { return x * 3; }; // not a doc comment.
+
+// T is a type.
+type T int;
+
+var (
+	// a is first.
+	a int;
+	b int;
+);
+
+  // c is indented.
+const c = 1;
+`
+	p := setupParserTest(src)
+	err := p.Parse()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	expected := []string{
+		"Double doubles a number.\nIt's not very clever.",
+		"",
+		"",
+		"T is a type.",
+		"a is first.",
+		"",
+		"c is indented.",
+	}
+
+	decls := p.TopLevel().topLevelDecls
+	if len(decls) != len(expected) {
+		t.Fatal("wrong number of declarations: ", len(decls))
+	}
+
+	for i, decl := range decls {
+		var doc string
+		switch d := decl.(type) {
+		case *ASTFunctionDecl:
+			doc = d.doc
+		case *ASTDataTypeDecl:
+			doc = d.doc
+		case *ASTVarDecl:
+			doc = d.doc
+		case *ASTConstDecl:
+			doc = d.doc
+		}
+
+		if doc != expected[i] {
+			t.Errorf("declaration %d has doc %q, expected %q", i, doc, expected[i])
+		}
+	}
+}
+
+func TestParserStats(t *testing.T) {
+	p := setupParserTest("package main;\nimport \"fmt\";\nvar a = 1;\nfunc f() { a++; };\n")
+	if stats := p.Stats(); stats != (ParserStats{}) {
+		t.Errorf("stats should be zero until they're turned on, got %+v", stats)
+	}
+
+	p.EnableStats()
+	err := p.Parse()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	// the nodes are the top level, the import and its path, the var with
+	// its name and value, and the func with its body, statement and the
+	// 'a' in it.
+	stats := p.Stats()
+	if stats.Files != 1 || stats.Decls != 2 || stats.Nodes != 10 || stats.ParseTime <= 0 {
+		t.Errorf("expected 1 file, 2 declarations and 10 nodes with some parse time, got %+v", stats)
+	}
+
+	// a file which doesn't parse still counts as a file but has no nodes.
+	p = setupParserTest("packag main;\n")
+	p.EnableStats()
+	if err := p.Parse(); err == nil {
+		t.Fatal("expected an error parsing")
+	}
+
+	if stats := p.Stats(); stats.Files != 1 || stats.Nodes != 0 {
+		t.Errorf("expected 1 file and no nodes, got %+v", stats)
+	}
+}
@@ -1,21 +1,390 @@
 package golightly
 
-// parseStatement parses a statement.
+// parseStatement parses a statement. Declarations can declare several
+// things at once so this can return more than one statement.
 // Statement =
 // Declaration | LabeledStmt | SimpleStmt |
 // GoStmt | ReturnStmt | BreakStmt | ContinueStmt | GotoStmt |
 // FallthroughStmt | Block | IfStmt | SwitchStmt | SelectStmt | ForStmt |
 // DeferStmt .
 // SimpleStmt = EmptyStmt | ExpressionStmt | SendStmt | IncDecStmt | Assignment | ShortVarDecl .
-func (p *Parser) parseStatement() (AST, error) {
-	tok, _ := p.lexer.GetToken()
-	return nil, NewError(p.filename, tok.Pos(), "unimplemented")
+// EmptyStmt = .
+func (p *Parser) parseStatement() ([]AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseStatement"))
+	}
+
+	tok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmt AST
+	switch tok.TokenKind() {
+	case TokenKindSemicolon, TokenKindCloseBrace:
+		// it's an empty statement so there's nothing to return.
+		return nil, nil
+
+	case TokenKindConst:
+		return p.parseDecl(p.parseConstSpec, "const")
+
+	case TokenKindTypeKeyword:
+		return p.parseDecl(p.parseTypeSpec, "type")
+
+	case TokenKindVar:
+		return p.parseDecl(p.parseVarSpec, "var")
+
+	case TokenKindReturn:
+		stmt, err = p.parseReturnStmt()
+
+	case TokenKindIf:
+		stmt, err = p.parseIfStmt()
+
+	case TokenKindFor:
+		stmt, err = p.parseForStmt()
+
+	case TokenKindOpenBrace:
+		stmt, err = p.parseBlock()
+
+	default:
+		stmt, err = p.parseSimpleStmt()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []AST{stmt}, nil
 }
 
 // parseBlock parses a statement block
 // Block = "{" StatementList "}" .
 // StatementList = { Statement ";" } .
 func (p *Parser) parseBlock() (AST, error) {
-	tok, _ := p.lexer.GetToken()
-	return nil, NewError(p.filename, tok.Pos(), "unimplemented")
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseBlock"))
+	}
+
+	openPos, err := p.expectTokenPos(TokenKindOpenBrace, "blocks need to start with a '{'")
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []AST
+	for {
+		// is it the end of the block?
+		tok, err := p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.TokenKind() == TokenKindCloseBrace {
+			break
+		}
+
+		stmts, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+
+		statements = append(statements, stmts...)
+
+		// the semicolon can be left out before the '}'.
+		tok, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.TokenKind() == TokenKindCloseBrace {
+			break
+		}
+
+		err = p.expectToken(TokenKindSemicolon, "I need a semicolon here to finish the statement")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	closePos, err := p.expectTokenPos(TokenKindCloseBrace, "blocks need to end with a '}'")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ASTBlock{openPos.Add(closePos), statements}, nil
+}
+
+// parseReturnStmt parses a return statement.
+// ReturnStmt = "return" [ ExpressionList ] .
+func (p *Parser) parseReturnStmt() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseReturnStmt"))
+	}
+
+	returnTok, _ := p.lexer.GetToken()
+
+	// is there anything being returned?
+	tok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.TokenKind() == TokenKindSemicolon || tok.TokenKind() == TokenKindCloseBrace {
+		return &ASTReturn{returnTok.Pos(), nil}, nil
+	}
+
+	values, err := p.parseExpressionList()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ASTReturn{returnTok.Pos().Add(values[len(values)-1].Pos()), values}, nil
+}
+
+// parseIfStmt parses an if statement.
+// IfStmt = "if" [ SimpleStmt ";" ] Expression Block [ "else" ( IfStmt | Block ) ] .
+func (p *Parser) parseIfStmt() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseIfStmt"))
+	}
+
+	ifTok, _ := p.lexer.GetToken()
+
+	// the init statement can be empty.
+	tok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmt AST
+	if tok.TokenKind() != TokenKindSemicolon {
+		// get the init statement or the condition - we can't tell which yet.
+		stmt, err = p.parseSimpleStmt()
+		if err != nil {
+			return nil, err
+		}
+
+		tok, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var init AST
+	condition := stmt
+	if tok.TokenKind() == TokenKindSemicolon {
+		// it was an init statement. now get the condition.
+		p.lexer.GetToken()
+		init = stmt
+		condition, err = p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch condition.(type) {
+	case *ASTAssign, *ASTShortVarDecl, *ASTIncDec:
+		return nil, NewError(p.filename, condition.Pos(), "this if needs a condition, not a statement")
+	}
+
+	then, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// is there an else?
+	tok, err = p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.TokenKind() != TokenKindElse {
+		return &ASTIf{ifTok.Pos().Add(then.Pos()), init, condition, then, nil}, nil
+	}
+
+	p.lexer.GetToken()
+	tok, err = p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var otherwise AST
+	if tok.TokenKind() == TokenKindIf {
+		otherwise, err = p.parseIfStmt()
+	} else {
+		otherwise, err = p.parseBlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ASTIf{ifTok.Pos().Add(otherwise.Pos()), init, condition, then, otherwise}, nil
+}
+
+// parseForStmt parses a for statement. Range clauses aren't supported yet.
+// ForStmt   = "for" [ Condition | ForClause ] Block .
+// ForClause = [ InitStmt ] ";" [ Condition ] ";" [ PostStmt ] .
+func (p *Parser) parseForStmt() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseForStmt"))
+	}
+
+	forTok, _ := p.lexer.GetToken()
+
+	// get the init statement or the condition - we can't tell which yet.
+	// either can be empty.
+	tok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmt AST
+	if tok.TokenKind() != TokenKindSemicolon && tok.TokenKind() != TokenKindOpenBrace {
+		stmt, err = p.parseSimpleStmt()
+		if err != nil {
+			return nil, err
+		}
+
+		tok, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var init, post AST
+	condition := stmt
+	if tok.TokenKind() == TokenKindSemicolon {
+		// it's a for clause.
+		p.lexer.GetToken()
+		init = stmt
+		condition = nil
+
+		tok, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.TokenKind() != TokenKindSemicolon {
+			condition, err = p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = p.expectToken(TokenKindSemicolon, "I need a semicolon after the condition in this for")
+		if err != nil {
+			return nil, err
+		}
+
+		tok, err = p.lexer.PeekToken(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.TokenKind() != TokenKindOpenBrace {
+			post, err = p.parseSimpleStmt()
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := post.(*ASTShortVarDecl); ok {
+				return nil, NewError(p.filename, post.Pos(), "the statement at the end of a for clause can't declare variables")
+			}
+		}
+	}
+
+	switch condition.(type) {
+	case *ASTAssign, *ASTShortVarDecl, *ASTIncDec:
+		return nil, NewError(p.filename, condition.Pos(), "this for needs a condition, not a statement")
+	}
+
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ASTFor{forTok.Pos().Add(body.Pos()), init, condition, post, body}, nil
+}
+
+// assignOps are all the operators which can be used in an assignment.
+var assignOps = map[TokenKind]bool{
+	TokenKindAssign:            true,
+	TokenKindAddAssign:         true,
+	TokenKindSubtractAssign:    true,
+	TokenKindMultiplyAssign:    true,
+	TokenKindDivideAssign:      true,
+	TokenKindModulusAssign:     true,
+	TokenKindBitwiseAndAssign:  true,
+	TokenKindBitwiseOrAssign:   true,
+	TokenKindBitwiseExorAssign: true,
+	TokenKindShiftLeftAssign:   true,
+	TokenKindShiftRightAssign:  true,
+	TokenKindBitClearAssign:    true,
+}
+
+// parseSimpleStmt parses a simple statement.
+// ExpressionStmt = Expression .
+// IncDecStmt     = Expression ( "++" | "--" ) .
+// Assignment     = ExpressionList assign_op ExpressionList .
+// ShortVarDecl   = IdentifierList ":=" ExpressionList .
+func (p *Parser) parseSimpleStmt() (AST, error) {
+	if p.trace != nil {
+		defer p.traceOut(p.traceIn("parseSimpleStmt"))
+	}
+
+	left, err := p.parseExpressionList()
+	if err != nil {
+		return nil, err
+	}
+
+	leftPos := left[0].Pos().Add(left[len(left)-1].Pos())
+
+	opTok, err := p.lexer.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opTok.TokenKind() == TokenKindDeclareAssign:
+		p.lexer.GetToken()
+		for _, ident := range left {
+			if _, ok := ident.(*ASTIdentifier); !ok {
+				return nil, NewError(p.filename, ident.Pos(), "only names can go on the left of a ':='")
+			}
+		}
+
+		right, err := p.parseExpressionList()
+		if err != nil {
+			return nil, err
+		}
+
+		return &ASTShortVarDecl{leftPos.Add(right[len(right)-1].Pos()), left, right}, nil
+
+	case assignOps[opTok.TokenKind()]:
+		p.lexer.GetToken()
+		right, err := p.parseExpressionList()
+		if err != nil {
+			return nil, err
+		}
+
+		if opTok.TokenKind() != TokenKindAssign && (len(left) != 1 || len(right) != 1) {
+			return nil, NewError(p.filename, opTok.Pos(), "assignments like this only work on a single value")
+		}
+
+		return &ASTAssign{leftPos.Add(right[len(right)-1].Pos()), opTok.TokenKind(), left, right}, nil
+
+	case opTok.TokenKind() == TokenKindIncrement || opTok.TokenKind() == TokenKindDecrement:
+		p.lexer.GetToken()
+		if len(left) != 1 {
+			return nil, NewError(p.filename, opTok.Pos(), "you can only increment or decrement one thing at a time")
+		}
+
+		return &ASTIncDec{leftPos.Add(opTok.Pos()), opTok.TokenKind(), left[0]}, nil
+	}
+
+	// it's just an expression.
+	if len(left) != 1 {
+		return nil, NewError(p.filename, opTok.Pos(), "I was expecting an assignment after this list of expressions")
+	}
+
+	return left[0], nil
 }
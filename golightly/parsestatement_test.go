@@ -0,0 +1,76 @@
+package golightly
+
+import (
+	"testing"
+)
+
+func TestParseEmptyStatements(t *testing.T) {
+	cases := []struct {
+		src   string
+		count int
+	}{
+		{"{ }", 0},
+		{"{ ; }", 0},
+		{"{ ; ; }", 0},
+		{"{ ;;; a++; ;; b++ }", 2},
+		{"{ { ; }; }", 1},
+	}
+
+	for _, c := range cases {
+		block, err := setupParserTest(c.src).parseBlock()
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		if statements := block.(*ASTBlock).statements; len(statements) != c.count {
+			t.Errorf("'%s' has %d statements, expected %d", c.src, len(statements), c.count)
+		}
+	}
+}
+
+func TestParseIfEmptyInit(t *testing.T) {
+	stmts, err := setupParserTest("if ; a { }").parseStatement()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	ifStmt := stmts[0].(*ASTIf)
+	if ifStmt.init != nil {
+		t.Errorf("the init statement should be empty, got %v", ifStmt.init)
+	}
+
+	if ident, ok := ifStmt.condition.(*ASTIdentifier); !ok || ident.name != "a" {
+		t.Errorf("the condition should be 'a', got %v", ifStmt.condition)
+	}
+}
+
+func TestParseFor(t *testing.T) {
+	cases := []sexprCase{
+		{"for { }", "(for () () () (block ()))"},
+		{"for ; ; { }", "(for () () () (block ()))"},
+		{"for ; ; { ; }", "(for () () () (block ()))"},
+		{"for a < b { a++; }", "(for () (binary < (identifier a) (identifier b)) () (block ((incdec ++ (identifier a)))))"},
+		{"for i := 0; i < 10; i++ { }", "(for (define ((identifier i)) ((value 0))) (binary < (identifier i) (value 10)) (incdec ++ (identifier i)) (block ()))"},
+		{"for ; a; { }", "(for () (identifier a) () (block ()))"},
+		{"for i = 0; ; i += 2 { }", "(for (assign = ((identifier i)) ((value 0))) () (assign += ((identifier i)) ((value 2))) (block ()))"},
+	}
+
+	checkParsesAs(t, cases, parseOneStatement)
+}
+
+func TestParseForErrors(t *testing.T) {
+	cases := []string{
+		"for a = b { }",
+		"for a++ { }",
+		"for ; ; a := 1 { }",
+		"for a; b { }",
+	}
+
+	for _, src := range cases {
+		_, err := setupParserTest(src).parseStatement()
+		if err == nil {
+			t.Errorf("'%s' should have given an error", src)
+		}
+	}
+}
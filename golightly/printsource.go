@@ -0,0 +1,370 @@
+package golightly
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// type sourcePrinter turns an AST back into Go source.
+type sourcePrinter struct {
+	sb     strings.Builder
+	indent int // how many tabs statements are indented by.
+}
+
+// PrintSource turns an AST back into Go source. The layout isn't the
+// same as the original but parsing it again gives the same AST, apart
+// from the positions. Statements all end with explicit semicolons.
+func PrintSource(node AST) string {
+	var sp sourcePrinter
+	sp.print(node)
+	return sp.sb.String()
+}
+
+// print writes a single node and all its children.
+func (sp *sourcePrinter) print(ast AST) {
+	switch a := ast.(type) {
+	case nil:
+		// nothing to print.
+
+	case *ASTTopLevel:
+		sp.write("package ", a.packageName, ";\n")
+		if len(a.imports) > 0 {
+			sp.write("\n")
+		}
+		for _, imp := range a.imports {
+			sp.print(imp)
+			sp.write(";\n")
+		}
+		for _, decl := range a.topLevelDecls {
+			sp.write("\n")
+			sp.print(decl)
+			sp.write(";\n")
+		}
+
+	case *ASTImport:
+		sp.write("import ")
+		if a.packageName != nil {
+			sp.print(a.packageName)
+			sp.write(" ")
+		}
+		sp.print(a.importPath)
+
+	case *ASTUnaryExpr:
+		sp.write(operatorNames[a.op])
+		switch a.param.(type) {
+		case *ASTBinaryExpr:
+			sp.write("(")
+			sp.print(a.param)
+			sp.write(")")
+		case *ASTUnaryExpr:
+			// keep "- -x" from turning into "--x".
+			sp.write(" ")
+			sp.print(a.param)
+		default:
+			sp.print(a.param)
+		}
+
+	case *ASTBinaryExpr:
+		sp.printOperand(a.left, binaryPrecedence[a.op])
+		sp.write(" ", operatorNames[a.op], " ")
+		sp.printOperand(a.right, binaryPrecedence[a.op]+1)
+
+	case *ASTParen:
+		sp.write("(")
+		sp.print(a.expr)
+		sp.write(")")
+
+	case *ASTValue:
+		sp.write(a.val.String())
+
+	case *ASTIdentifier:
+		if a.packageName != "" {
+			sp.write(a.packageName, ".")
+		}
+		sp.write(a.name)
+
+	case *ASTConstDecl:
+		sp.printDecl("const ", a.ident, a.typ, a.value)
+
+	case *ASTVarDecl:
+		sp.printDecl("var ", a.ident, a.typ, a.value)
+
+	case *ASTFunctionDecl:
+		sp.write("func ")
+		if a.receiver != nil {
+			sp.print(a.receiver)
+			sp.write(" ")
+		}
+		sp.write(a.name)
+		sp.printSignature(a.params, a.returns)
+		if a.body != nil {
+			sp.write(" ")
+			sp.print(a.body)
+		}
+
+	case *ASTReceiver:
+		sp.write("(")
+		if a.name != "" {
+			sp.write(a.name, " ")
+		}
+		if a.pointer {
+			sp.write("*")
+		}
+		sp.write(a.typeName, ")")
+
+	case *ASTDataTypeDecl:
+		sp.write("type ")
+		sp.print(a.ident)
+		if a.alias {
+			sp.write(" =")
+		}
+		sp.write(" ")
+		sp.print(a.typ)
+
+	case *ASTDataTypeSlice:
+		sp.write("[]")
+		sp.print(a.elementType)
+
+	case *ASTDataTypeArray:
+		sp.write("[")
+		sp.print(a.arraySize)
+		sp.write("]")
+		sp.print(a.elementType)
+
+	case *ASTDataTypePointer:
+		sp.write("*")
+		sp.print(a.elementType)
+
+	case *ASTDataTypeMap:
+		sp.write("map[")
+		sp.print(a.keyType)
+		sp.write("]")
+		sp.print(a.valueType)
+
+	case *ASTDataTypeChan:
+		switch a.dir {
+		case ChanDirectionIn:
+			sp.write("<-chan ")
+		case ChanDirectionOut:
+			sp.write("chan<- ")
+		default:
+			sp.write("chan ")
+		}
+		sp.print(a.elementType)
+
+	case *ASTDataTypeStruct:
+		sp.write("struct {")
+		for _, field := range a.fields {
+			sp.write(" ")
+			sp.print(field)
+			sp.write(";")
+		}
+		sp.write(" }")
+
+	case *ASTDataTypeField:
+		if a.identifier != nil {
+			sp.print(a.identifier)
+			sp.write(" ")
+		}
+		sp.print(a.typ)
+		if a.tag != "" {
+			// tags usually have quotes in them so a raw string reads better.
+			if strings.Contains(string(a.tag), "`") {
+				sp.write(" ", strconv.Quote(string(a.tag)))
+			} else {
+				sp.write(" `", string(a.tag), "`")
+			}
+		}
+
+	case *ASTDataTypeFunc:
+		sp.write("func")
+		sp.printSignature(a.params, a.returns)
+
+	case *ASTParameterDecl:
+		if a.identifier != nil {
+			sp.print(a.identifier)
+			sp.write(" ")
+		}
+		if a.ellipsis != nil {
+			sp.write("...")
+		}
+		sp.print(a.typ)
+
+	case *ASTEllipsis:
+		sp.write("...")
+
+	case *ASTDataTypeInterface:
+		sp.write("interface {")
+		for _, method := range a.methods {
+			sp.write(" ")
+			sp.print(method)
+			sp.write(";")
+		}
+		sp.write(" }")
+
+	case *ASTDataTypeMethodSpec:
+		sp.write(a.name)
+		sp.printSignature(a.params, a.returns)
+
+	case *ASTBlock:
+		sp.write("{\n")
+		sp.indent++
+		for _, stmt := range a.statements {
+			sp.write(strings.Repeat("\t", sp.indent))
+			sp.print(stmt)
+			sp.write(";\n")
+		}
+		sp.indent--
+		sp.write(strings.Repeat("\t", sp.indent), "}")
+
+	case *ASTSelector:
+		sp.print(a.expr)
+		sp.write(".", a.name)
+
+	case *ASTCall:
+		sp.print(a.function)
+		sp.write("(")
+		sp.printList(a.args)
+		sp.write(")")
+
+	case *ASTIndex:
+		sp.print(a.expr)
+		sp.write("[")
+		sp.print(a.index)
+		sp.write("]")
+
+	case *ASTFuncLit:
+		sp.write("func")
+		sp.printSignature(a.params, a.returns)
+		sp.write(" ")
+		sp.print(a.body)
+
+	case *ASTTypeAssert:
+		sp.print(a.expr)
+		sp.write(".(")
+		sp.print(a.typ)
+		sp.write(")")
+
+	case *ASTReturn:
+		sp.write("return")
+		if len(a.values) > 0 {
+			sp.write(" ")
+			sp.printList(a.values)
+		}
+
+	case *ASTIf:
+		sp.write("if ")
+		if a.init != nil {
+			sp.print(a.init)
+			sp.write("; ")
+		}
+		sp.print(a.condition)
+		sp.write(" ")
+		sp.print(a.then)
+		if a.otherwise != nil {
+			sp.write(" else ")
+			sp.print(a.otherwise)
+		}
+
+	case *ASTFor:
+		sp.write("for ")
+		if a.init != nil || a.post != nil {
+			sp.print(a.init)
+			sp.write("; ")
+			sp.print(a.condition)
+			sp.write("; ")
+			sp.print(a.post)
+			if a.post != nil {
+				sp.write(" ")
+			}
+		} else if a.condition != nil {
+			sp.print(a.condition)
+			sp.write(" ")
+		}
+		sp.print(a.body)
+
+	case *ASTAssign:
+		sp.printList(a.left)
+		sp.write(" ", operatorNames[a.op], " ")
+		sp.printList(a.right)
+
+	case *ASTShortVarDecl:
+		sp.printList(a.idents)
+		sp.write(" := ")
+		sp.printList(a.values)
+
+	case *ASTIncDec:
+		sp.print(a.expr)
+		sp.write(operatorNames[a.op])
+
+	default:
+		sp.write(fmt.Sprintf("/* I don't know how to print a %T */", ast))
+	}
+}
+
+// write adds some text to the output.
+func (sp *sourcePrinter) write(strs ...string) {
+	for _, str := range strs {
+		sp.sb.WriteString(str)
+	}
+}
+
+// printOperand writes one side of a binary expression, bracketing it if
+// it wouldn't otherwise bind tightly enough.
+func (sp *sourcePrinter) printOperand(operand AST, minPrecedence int) {
+	if bin, ok := operand.(*ASTBinaryExpr); ok && binaryPrecedence[bin.op] < minPrecedence {
+		sp.write("(")
+		sp.print(operand)
+		sp.write(")")
+		return
+	}
+
+	sp.print(operand)
+}
+
+// printDecl writes a const or var declaration.
+func (sp *sourcePrinter) printDecl(keyword string, ident AST, typ AST, value AST) {
+	sp.write(keyword)
+	sp.print(ident)
+	if typ != nil {
+		sp.write(" ")
+		sp.print(typ)
+	}
+	if value != nil {
+		sp.write(" = ")
+		sp.print(value)
+	}
+}
+
+// printSignature writes the parameters and results of a function.
+func (sp *sourcePrinter) printSignature(params []AST, returns []AST) {
+	sp.write("(")
+	sp.printList(params)
+	sp.write(")")
+
+	if len(returns) == 0 {
+		return
+	}
+
+	// a single unnamed result doesn't need brackets.
+	if result, ok := returns[0].(*ASTParameterDecl); ok && len(returns) == 1 && result.identifier == nil {
+		sp.write(" ")
+		sp.print(result)
+		return
+	}
+
+	sp.write(" (")
+	sp.printList(returns)
+	sp.write(")")
+}
+
+// printList writes a comma separated list.
+func (sp *sourcePrinter) printList(asts []AST) {
+	for i, ast := range asts {
+		if i > 0 {
+			sp.write(", ")
+		}
+		sp.print(ast)
+	}
+}
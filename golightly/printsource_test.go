@@ -0,0 +1,63 @@
+package golightly
+
+import (
+	"testing"
+)
+
+func TestPrintSourceRoundTrip(t *testing.T) {
+	src := "package main;\n" +
+		"import \"fmt\";\n" +
+		"import str \"strings\";\n" +
+		"type T struct { a []int `json:\"a\"`; b *T; s fmt.Stringer; };\n" +
+		"type I interface { M(x int, y ...string) (ok bool, err error); N() int; };\n" +
+		"type A = [4]T;\n" +
+		"type F func(int, string) bool;\n" +
+		"const C = (1 + 2) * 3;\n" +
+		"const D int = -C - -C;\n" +
+		"var V = str.ToUpper(\"hi\");\n" +
+		"var W float;\n" +
+		"func (t *T) Get(i int) int { return t.a[i] };\n" +
+		"func (T) Nothing() { };\n" +
+		"func main() { x := 1; var y = 2; x += y; x++; if x > 1 && !(y < 2) { x = x * 2 } else if x == 0 { return } else { fmt.Println(x, 'a', 1.5) } };\n"
+
+	p := setupParserTest(src)
+	if err := p.Parse(); err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	printed := PrintSource(p.sf.ast)
+	p2 := setupParserTest(printed)
+	if err := p2.Parse(); err != nil {
+		t.Fatalf("error parsing the printed source: %v\n%s", err, printed)
+	}
+
+	// positions are different so compare the S-expressions.
+	if SExpr(p.sf.ast) != SExpr(p2.sf.ast) {
+		t.Errorf("the printed source parses differently:\n%s\n%s\n%s", printed, SExpr(p.sf.ast), SExpr(p2.sf.ast))
+	}
+}
+
+func TestPrintSourceExpression(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected string
+	}{
+		{"a+b*c", "a + b * c"},
+		{"(a+b)*c", "(a + b) * c"},
+		{"f(x,y)[0].z", "f(x, y)[0].z"},
+		{"x.( io.Reader ).Read", "x.(io.Reader).Read"},
+		{"- -a", "- -a"},
+	}
+
+	for _, c := range cases {
+		expr, err := setupParserTest(c.src).parseExpression()
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		if printed := PrintSource(expr); printed != c.expected {
+			t.Errorf("'%s' printed as '%s', expected '%s'", c.src, printed, c.expected)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package golightly
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// relexBackoff is how many tokens before an edit get lexed again. The
+// lexer looks a few runes ahead so a token just before an edit can change
+// too - "a.." followed by an inserted "." becomes "a...", for example.
+// every token is at least one rune so this many is always enough.
+const relexBackoff = maxOperatorLength
+
+// RelexRange lexes a source again after an edit, reusing as many of the
+// old tokens as it can. It's for editors which want to re-lex on every
+// keystroke without going through the whole file each time.
+//
+// The old tokens must be everything lexed from oldSrc, including the end
+// of source token, and the edit replaces oldLen bytes at offset with
+// newText. Tokens well before the edit are kept as they are. Lexing starts
+// again a few tokens before the edit and stops as soon as it's back in step
+// with the old tokens after the edit, which are moved to their new
+// positions. The result is the same as lexing the edited source from the
+// start.
+//
+// The lexer is left part way through the edited source so it needs a
+// Reset() before it's used for anything else. Doc comments and build
+// constraints are only found in the parts which were lexed again.
+func (l *Lexer) RelexRange(old []Token, oldSrc string, offset, oldLen int, newText string) ([]Token, error) {
+	if offset < 0 || oldLen < 0 || offset+oldLen > len(oldSrc) {
+		return nil, errors.New(fmt.Sprint("the edit at ", offset, " for ", oldLen, " bytes doesn't fit in a ", len(oldSrc), " byte source"))
+	}
+
+	newSrc := oldSrc[:offset] + newText + oldSrc[offset+oldLen:]
+
+	// "//line" directives make positions jump around so they're too hard
+	// to keep track of. just lex it all again.
+	if len(old) == 0 || strings.Contains(oldSrc, "//line ") || strings.Contains(newSrc, "//line ") {
+		return l.lexAll(newSrc)
+	}
+
+	// work out where the edit is in lines and columns.
+	editStart := l.advanceLoc(SrcLoc{1, 1}, skipByteOrderMark(oldSrc[:offset]))
+	oldEnd := l.advanceLoc(editStart, oldSrc[offset:offset+oldLen])
+	newEnd := l.advanceLoc(editStart, newText)
+
+	// find the first token which the edit touches, then back off a bit.
+	first := 0
+	for first < len(old)-1 && locBefore(old[first].Pos().end, SrcLoc{editStart.Line, editStart.Column - 1}) {
+		first++
+	}
+
+	first -= relexBackoff
+	if first <= 0 {
+		// it's so close to the start that we may as well start from scratch.
+		return l.lexAll(newSrc)
+	}
+
+	restartLoc := old[first].Pos().start
+	restartOffset := l.offsetOf(oldSrc, restartLoc)
+	if restartOffset < 0 || restartOffset > offset {
+		return l.lexAll(newSrc)
+	}
+
+	// lex from the restart point until we're back in step with the old tokens.
+	tokens := append([]Token{}, old[:first]...)
+	l.Reset(strings.NewReader(newSrc[restartOffset:]), l.sourceFile)
+	l.loc = restartLoc
+	l.pastHeader = true
+
+	next := first
+	for {
+		tok, err := l.GetToken()
+		if err != nil {
+			return nil, err
+		}
+
+		// once we're past the edit, a token starting where an old token
+		// has moved to means the rest of the source lexes the same as
+		// before.
+		start := tok.Pos().start
+		if !locBefore(start, newEnd) && (l.tabWidth <= 1 || start.Line > newEnd.Line) {
+			for next < len(old) && (locBefore(old[next].Pos().start, oldEnd) || locBefore(shiftLoc(old[next].Pos().start, oldEnd, newEnd), start)) {
+				next++
+			}
+
+			if next < len(old) && shiftLoc(old[next].Pos().start, oldEnd, newEnd) == start {
+				for _, oldTok := range old[next:] {
+					pos := oldTok.Pos()
+					tokens = append(tokens, moveToken(oldTok, SrcSpan{shiftLoc(pos.start, oldEnd, newEnd), shiftLoc(pos.end, oldEnd, newEnd), pos.file}))
+				}
+
+				return tokens, nil
+			}
+		}
+
+		tokens = append(tokens, tok)
+		if tok.TokenKind() == TokenKindEndOfSource {
+			return tokens, nil
+		}
+	}
+}
+
+// lexAll lexes all the tokens from a source.
+func (l *Lexer) lexAll(src string) ([]Token, error) {
+	l.Reset(strings.NewReader(src), l.sourceFile)
+
+	var tokens []Token
+	for {
+		tok, err := l.GetToken()
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, tok)
+		if tok.TokenKind() == TokenKindEndOfSource {
+			return tokens, nil
+		}
+	}
+}
+
+// advanceLoc works out where we'd be after some text, counting lines and
+// columns the same way getRune() does.
+func (l *Lexer) advanceLoc(loc SrcLoc, text string) SrcLoc {
+	for _, ch := range text {
+		loc = l.nextLoc(loc, ch)
+	}
+
+	return loc
+}
+
+// nextLoc is where the rune after ch is.
+func (l *Lexer) nextLoc(loc SrcLoc, ch rune) SrcLoc {
+	switch {
+	case ch == '\n':
+		return SrcLoc{loc.Line + 1, 1}
+	case ch == '\t' && l.tabWidth > 1:
+		return SrcLoc{loc.Line, loc.Column + l.tabWidth - (loc.Column-1)%l.tabWidth}
+	default:
+		return SrcLoc{loc.Line, loc.Column + 1}
+	}
+}
+
+// offsetOf finds the byte offset of a location in a source, or -1 if it's
+// not in there.
+func (l *Lexer) offsetOf(src string, want SrcLoc) int {
+	offset := len(src) - len(skipByteOrderMark(src))
+	loc := SrcLoc{1, 1}
+	for offset < len(src) {
+		if loc == want {
+			return offset
+		}
+
+		ch, size := utf8.DecodeRuneInString(src[offset:])
+		loc = l.nextLoc(loc, ch)
+		offset += size
+	}
+
+	if loc == want {
+		return offset
+	}
+
+	return -1
+}
+
+// skipByteOrderMark skips a byte order mark at the start of a source,
+// since it doesn't take up a column.
+func skipByteOrderMark(src string) string {
+	return strings.TrimPrefix(src, string(byteOrderMark))
+}
+
+// locBefore returns true if a is before b.
+func locBefore(a, b SrcLoc) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// shiftLoc moves a location from after an edit which used to end at
+// oldEnd to where it is now the edit ends at newEnd.
+func shiftLoc(loc, oldEnd, newEnd SrcLoc) SrcLoc {
+	if loc.Line == oldEnd.Line {
+		return SrcLoc{newEnd.Line, loc.Column - oldEnd.Column + newEnd.Column}
+	}
+
+	return SrcLoc{loc.Line + newEnd.Line - oldEnd.Line, loc.Column}
+}
+
+// moveToken makes a copy of a token at a different position.
+func moveToken(tok Token, pos SrcSpan) Token {
+	switch t := tok.(type) {
+	case SimpleToken:
+		t.pos = pos
+		return t
+	case StringToken:
+		t.s.pos = pos
+		return t
+	case UintToken:
+		t.s.pos = pos
+		return t
+	case FloatToken:
+		t.s.pos = pos
+		return t
+	}
+
+	return tok
+}
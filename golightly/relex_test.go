@@ -0,0 +1,103 @@
+package golightly
+
+import (
+	"strings"
+	"testing"
+)
+
+const relexTestSource = `package main;
+
+import "fmt";
+
+// Double doubles a number.
+func Double(x int) int {
+	return x * 2;
+};
+
+func main() {
+	a := Double(21);
+	b := "hello, world";
+	/* a long
+	   comment */
+	fmt.Println(a, b, 3.5, 'x');
+};
+`
+
+// lexAllForTest lexes a whole source in one go.
+func lexAllForTest(t *testing.T, src string) []Token {
+	tokens, err := NewLexer().lexAll(src)
+	if err != nil {
+		t.Fatal("error lexing: ", err)
+	}
+
+	return tokens
+}
+
+func TestLexerRelexRange(t *testing.T) {
+	cases := []struct {
+		name    string
+		find    string // the edit goes where this is.
+		oldLen  int
+		newText string
+	}{
+		{"insert in an identifier", "Double(21)", 3, "ble"},
+		{"rename", "Double(21)", 6, "Triple"},
+		{"delete a statement", "a := Double(21);", 16, ""},
+		{"add lines", "b := ", 0, "c := 1;\n\tc++;\n\t"},
+		{"join lines", ";\n\tb :=", 3, "; "},
+		{"change a string", "hello", 5, "goodbye\\n"},
+		{"open a string", "3.5", 0, "\""},
+		{"grow an operator", "x * 2", 4, "x *= 2"},
+		{"comment out", "fmt.Println", 0, "// "},
+		{"end a comment early", "a long", 0, "*/ "},
+		{"change a number", "3.5", 3, "35"},
+		{"at the end", "};\n", 3, "};\n\nvar z int;\n"},
+	}
+
+	for _, c := range cases {
+		offset := strings.LastIndex(relexTestSource, c.find)
+		if offset < 0 {
+			t.Fatalf("%s: can't find '%s'", c.name, c.find)
+		}
+
+		newSrc := relexTestSource[:offset] + c.newText + relexTestSource[offset+c.oldLen:]
+		old := lexAllForTest(t, relexTestSource)
+
+		l := NewLexer()
+		l.EnableStats()
+		got, err := l.RelexRange(old, relexTestSource, offset, c.oldLen, c.newText)
+		if err != nil {
+			// the edited source might not lex at all, but then it
+			// shouldn't lex from scratch either.
+			if _, fullErr := NewLexer().lexAll(newSrc); fullErr == nil {
+				t.Errorf("%s: error relexing: %v", c.name, err)
+			}
+			continue
+		}
+
+		expected := lexAllForTest(t, newSrc)
+		if len(got) != len(expected) {
+			t.Errorf("%s: got %d tokens, expected %d", c.name, len(got), len(expected))
+			continue
+		}
+
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Errorf("%s: token %d is %#v, expected %#v", c.name, i, got[i], expected[i])
+				break
+			}
+		}
+
+		if l.Stats().Tokens >= len(expected) {
+			t.Errorf("%s: lexed %d tokens, which is no better than starting again", c.name, l.Stats().Tokens)
+		}
+	}
+}
+
+func TestLexerRelexRangeBadEdit(t *testing.T) {
+	old := lexAllForTest(t, "package main;")
+	_, err := NewLexer().RelexRange(old, "package main;", 10, 10, "x")
+	if err == nil {
+		t.Error("expected an error for an edit past the end of the source")
+	}
+}
@@ -0,0 +1,578 @@
+package golightly
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// type resolver works out which declaration each identifier in a file
+// refers to. It keeps track of scopes as it walks through the AST.
+type resolver struct {
+	sf         *sourceFile
+	ts         *DataTypeStore
+	imports    map[string]*SymbolTable // the imported packages' symbols, by the name they're imported as.
+	dotImports []*SymbolTable          // packages imported with ".".
+	used       map[*Symbol]bool        // symbols which have been read somewhere.
+	locals     []localVar              // local variables in the functions we're in, in the order they're declared.
+}
+
+// type localVar is a variable declared in a function, which has to be used
+// somewhere.
+type localVar struct {
+	ident *ASTIdentifier
+	sym   *Symbol
+}
+
+// resolveIdentifiers finds the declaration of every identifier referenced
+// in a file and records it in sf.resolved. Identifiers which don't refer
+// to anything are reported as errors, and so are local variables which
+// are never used.
+func resolveIdentifiers(sf *sourceFile, ts *DataTypeStore) error {
+	r := resolver{sf, ts, make(map[string]*SymbolTable), nil, make(map[*Symbol]bool), nil}
+
+	top := sf.ast.(*ASTTopLevel)
+	for _, ast := range top.imports {
+		imp := ast.(*ASTImport)
+		symbols := sf.importedSymbols[imp.ImportPath()]
+		if imp.LocalName() == "." {
+			r.dotImports = append(r.dotImports, symbols)
+		} else {
+			r.imports[imp.LocalName()] = symbols
+		}
+	}
+
+	for _, decl := range top.topLevelDecls {
+		err := r.resolveDecl(decl, sf.symbols)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveDecl resolves the identifiers in a declaration.
+func (r *resolver) resolveDecl(decl AST, scope *SymbolTable) error {
+	switch d := decl.(type) {
+	case *ASTConstDecl:
+		return r.resolveValueDecl(d.typ, d.value, scope)
+
+	case *ASTVarDecl:
+		return r.resolveValueDecl(d.typ, d.value, scope)
+
+	case *ASTDataTypeDecl:
+		return r.resolveType(d.typ, scope)
+
+	case *ASTFunctionDecl:
+		return r.resolveFunction(d, scope)
+	}
+
+	return nil
+}
+
+// resolveValueDecl resolves the type and value of a const or var declaration.
+func (r *resolver) resolveValueDecl(typ AST, value AST, scope *SymbolTable) error {
+	if typ != nil {
+		err := r.resolveType(typ, scope)
+		if err != nil {
+			return err
+		}
+	}
+
+	if value != nil {
+		return r.resolveExpr(value, scope)
+	}
+
+	return nil
+}
+
+// resolveFunction resolves a function's signature and body. The receiver,
+// parameters and results are in the same scope as the top level of the body.
+func (r *resolver) resolveFunction(fn *ASTFunctionDecl, scope *SymbolTable) error {
+	funcScope := NewSymbolTable(scope)
+
+	if fn.receiver != nil {
+		receiver := fn.receiver.(*ASTReceiver)
+		if receiver.name != "" && receiver.name != "_" {
+			funcScope.Add(&Symbol{receiver.name, SymbolKindVar, receiver, nil})
+		}
+	}
+
+	return r.resolveFunctionBody(fn.params, fn.returns, fn.body, funcScope)
+}
+
+// resolveFunctionBody resolves a function's parameters and body. The
+// scope is the function's own, with the receiver in it if there is one.
+// function literals can see the variables around them so their scope's
+// parent is wherever they are.
+func (r *resolver) resolveFunctionBody(paramASTs []AST, returns []AST, body AST, funcScope *SymbolTable) error {
+	scope := funcScope.parent
+	params := append(append([]AST{}, paramASTs...), returns...)
+	for _, paramAST := range params {
+		param := paramAST.(*ASTParameterDecl)
+		err := r.resolveType(param.typ, scope)
+		if err != nil {
+			return err
+		}
+
+		ident, ok := param.identifier.(*ASTIdentifier)
+		if ok && ident.name != "_" && !funcScope.Add(&Symbol{ident.name, SymbolKindVar, param, nil}) {
+			return NewError(r.sf.fileName, ident.pos, fmt.Sprint("there's already a parameter called '", ident.name, "'"))
+		}
+	}
+
+	if body == nil {
+		return nil
+	}
+
+	// function literals inside this one have their own locals but they can
+	// use ours too, so ours are only checked once the whole body is done.
+	firstLocal := len(r.locals)
+	err := r.resolveStatements(body.(*ASTBlock).statements, funcScope)
+	if err != nil {
+		return err
+	}
+
+	locals := r.locals[firstLocal:]
+	r.locals = r.locals[:firstLocal]
+	for _, local := range locals {
+		if !r.used[local.sym] {
+			return NewError(r.sf.fileName, local.ident.pos, fmt.Sprint("'", local.ident.name, "' is declared but not used"))
+		}
+	}
+
+	return nil
+}
+
+// resolveStatements resolves a list of statements in a scope.
+func (r *resolver) resolveStatements(statements []AST, scope *SymbolTable) error {
+	for _, stmt := range statements {
+		err := r.resolveStatement(stmt, scope)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveStatement resolves a single statement.
+func (r *resolver) resolveStatement(stmt AST, scope *SymbolTable) error {
+	switch s := stmt.(type) {
+	case *ASTConstDecl:
+		return r.resolveLocalDecl(s.ident.(*ASTIdentifier), SymbolKindConst, s, s.typ, s.value, scope)
+
+	case *ASTVarDecl:
+		return r.resolveLocalDecl(s.ident.(*ASTIdentifier), SymbolKindVar, s, s.typ, s.value, scope)
+
+	case *ASTDataTypeDecl:
+		ident := s.ident.(*ASTIdentifier)
+		if s.alias {
+			// an alias is just another name for the same type.
+			err := r.resolveType(s.typ, scope)
+			if err != nil {
+				return err
+			}
+
+			dt, err := r.ts.FromAST(r.sf.fileName, s.typ, scope)
+			if err != nil {
+				return err
+			}
+
+			return r.declare(ident, &Symbol{ident.name, SymbolKindType, s, dt}, scope)
+		}
+
+		// the type is in scope inside its own declaration so types can
+		// refer to themselves.
+		named := r.ts.MakeNamed(r.sf.packageName, ident.name, nil)
+		err := r.declare(ident, &Symbol{ident.name, SymbolKindType, s, named}, scope)
+		if err != nil {
+			return err
+		}
+
+		err = r.resolveType(s.typ, scope)
+		if err != nil {
+			return err
+		}
+
+		named.underlying, err = r.ts.FromAST(r.sf.fileName, s.typ, scope)
+		return err
+
+	case *ASTBlock:
+		return r.resolveStatements(s.statements, NewSymbolTable(scope))
+
+	case *ASTShortVarDecl:
+		return r.resolveShortVarDecl(s, scope)
+
+	case *ASTAssign:
+		for _, left := range s.left {
+			ident, ok := left.(*ASTIdentifier)
+			if ok && ident.name == "_" {
+				// assigning to '_' discards the value.
+				continue
+			}
+
+			if ok {
+				// assigning to a variable doesn't count as using it, even
+				// with "op=".
+				err := r.resolveIdentifier(ident, scope)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			err := r.resolveExpr(left, scope)
+			if err != nil {
+				return err
+			}
+		}
+
+		return r.resolveExprs(s.right, scope)
+
+	case *ASTIncDec:
+		// neither does incrementing or decrementing it.
+		if ident, ok := s.expr.(*ASTIdentifier); ok {
+			return r.resolveIdentifier(ident, scope)
+		}
+
+		return r.resolveExpr(s.expr, scope)
+
+	case *ASTReturn:
+		return r.resolveExprs(s.values, scope)
+
+	case *ASTIf:
+		ifScope := NewSymbolTable(scope)
+		if s.init != nil {
+			err := r.resolveStatement(s.init, ifScope)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := r.resolveExpr(s.condition, ifScope)
+		if err != nil {
+			return err
+		}
+
+		err = r.resolveStatement(s.then, ifScope)
+		if err != nil {
+			return err
+		}
+
+		if s.otherwise != nil {
+			return r.resolveStatement(s.otherwise, ifScope)
+		}
+
+		return nil
+
+	case *ASTFor:
+		forScope := NewSymbolTable(scope)
+		for _, part := range []AST{s.init, s.condition, s.post, s.body} {
+			if part == nil {
+				continue
+			}
+
+			err := r.resolveStatement(part, forScope)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// it's an expression statement.
+	return r.resolveExpr(stmt, scope)
+}
+
+// resolveLocalDecl resolves a const or var declared inside a function. The
+// new symbol's scope starts after its declaration, so it can't refer to
+// itself.
+func (r *resolver) resolveLocalDecl(ident *ASTIdentifier, kind SymbolKind, decl AST, typ AST, value AST, scope *SymbolTable) error {
+	err := r.resolveValueDecl(typ, value, scope)
+	if err != nil {
+		return err
+	}
+
+	sym := &Symbol{ident.name, kind, decl, nil}
+	err = r.declare(ident, sym, scope)
+	if err != nil || kind != SymbolKindVar || ident.name == "_" {
+		return err
+	}
+
+	r.locals = append(r.locals, localVar{ident, sym})
+	return nil
+}
+
+// resolveShortVarDecl resolves a ":=" declaration. Variables which are
+// already declared in the same scope are just assigned to, but there has
+// to be at least one new one.
+func (r *resolver) resolveShortVarDecl(decl *ASTShortVarDecl, scope *SymbolTable) error {
+	err := r.resolveExprs(decl.values, scope)
+	if err != nil {
+		return err
+	}
+
+	newVars := 0
+	for _, identAST := range decl.idents {
+		ident := identAST.(*ASTIdentifier)
+		if ident.name == "_" {
+			continue
+		}
+
+		sym := scope.LookupLocal(ident.name)
+		if sym != nil {
+			r.sf.resolved[ident] = sym
+			continue
+		}
+
+		sym = &Symbol{ident.name, SymbolKindVar, decl, nil}
+		r.declare(ident, sym, scope)
+		r.locals = append(r.locals, localVar{ident, sym})
+		newVars++
+	}
+
+	if newVars == 0 {
+		return NewError(r.sf.fileName, decl.pos, "there are no new variables on the left of this ':='")
+	}
+
+	return nil
+}
+
+// declare adds a new symbol to a scope.
+func (r *resolver) declare(ident *ASTIdentifier, sym *Symbol, scope *SymbolTable) error {
+	if ident.name == "_" {
+		return nil
+	}
+
+	if !scope.Add(sym) {
+		return NewError(r.sf.fileName, ident.pos, fmt.Sprint("'", ident.name, "' has already been declared"))
+	}
+
+	r.sf.resolved[ident] = sym
+	return nil
+}
+
+// resolveExprs resolves a list of expressions.
+func (r *resolver) resolveExprs(exprs []AST, scope *SymbolTable) error {
+	for _, expr := range exprs {
+		err := r.resolveExpr(expr, scope)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveExpr resolves the identifiers in an expression.
+func (r *resolver) resolveExpr(expr AST, scope *SymbolTable) error {
+	switch e := expr.(type) {
+	case *ASTIdentifier:
+		err := r.resolveIdentifier(e, scope)
+		if err != nil {
+			return err
+		}
+
+		r.used[r.sf.resolved[e]] = true
+		return nil
+
+	case *ASTSelector:
+		// "pkg.Name" refers to a symbol in an imported package, unless
+		// pkg has been declared as something else.
+		base, ok := e.expr.(*ASTIdentifier)
+		if ok && base.packageName == "" && scope.Lookup(base.name) == nil {
+			if _, imported := r.imports[base.name]; imported {
+				return r.resolveQualified(e, base.name, e.name, e.pos)
+			}
+		}
+
+		// field and method names depend on the type so they're worked
+		// out later.
+		return r.resolveExpr(e.expr, scope)
+
+	case *ASTCall:
+		err := r.resolveExpr(e.function, scope)
+		if err != nil {
+			return err
+		}
+
+		return r.resolveExprs(e.args, scope)
+
+	case *ASTIndex:
+		err := r.resolveExpr(e.expr, scope)
+		if err != nil {
+			return err
+		}
+
+		return r.resolveExpr(e.index, scope)
+
+	case *ASTFuncLit:
+		return r.resolveFunctionBody(e.params, e.returns, e.body, NewSymbolTable(scope))
+
+	case *ASTTypeAssert:
+		err := r.resolveExpr(e.expr, scope)
+		if err != nil {
+			return err
+		}
+
+		return r.resolveType(e.typ, scope)
+
+	case *ASTUnaryExpr:
+		return r.resolveExpr(e.param, scope)
+
+	case *ASTParen:
+		return r.resolveExpr(e.expr, scope)
+
+	case *ASTBinaryExpr:
+		err := r.resolveExpr(e.left, scope)
+		if err != nil {
+			return err
+		}
+
+		return r.resolveExpr(e.right, scope)
+
+	case *ASTDataTypeSlice, *ASTDataTypeArray, *ASTDataTypeMap, *ASTDataTypeChan, *ASTDataTypeStruct, *ASTDataTypeFunc, *ASTDataTypeInterface:
+		// types can be used as values in some places.
+		return r.resolveType(expr, scope)
+	}
+
+	return nil
+}
+
+// resolveIdentifier finds what a single identifier refers to.
+func (r *resolver) resolveIdentifier(ident *ASTIdentifier, scope *SymbolTable) error {
+	if ident.packageName != "" {
+		return r.resolveQualified(ident, ident.packageName, ident.name, ident.pos)
+	}
+
+	if ident.name == "_" {
+		return NewError(r.sf.fileName, ident.pos, "'_' can only be assigned to, it doesn't have a value")
+	}
+
+	sym := scope.Lookup(ident.name)
+	if sym == nil {
+		// it might be from a package imported with ".".
+		for _, symbols := range r.dotImports {
+			if isExported(ident.name) {
+				sym = symbols.LookupLocal(ident.name)
+				if sym != nil {
+					break
+				}
+			}
+		}
+	}
+
+	if sym == nil {
+		return NewError(r.sf.fileName, ident.pos, fmt.Sprint("undefined: ", ident.name))
+	}
+
+	r.sf.resolved[ident] = sym
+	return nil
+}
+
+// resolveQualified finds a symbol in an imported package.
+func (r *resolver) resolveQualified(ast AST, packageName string, name string, pos SrcSpan) error {
+	symbols, ok := r.imports[packageName]
+	if !ok {
+		return NewError(r.sf.fileName, pos, fmt.Sprint("undefined: ", packageName))
+	}
+
+	sym := symbols.LookupLocal(name)
+	if sym == nil {
+		return NewError(r.sf.fileName, pos, fmt.Sprint("undefined: ", packageName, ".", name))
+	}
+
+	if !isExported(name) {
+		return NewError(r.sf.fileName, pos, fmt.Sprint("'", name, "' isn't exported from package ", packageName))
+	}
+
+	r.sf.resolved[ast] = sym
+	return nil
+}
+
+// resolveType resolves the type names in a data type.
+func (r *resolver) resolveType(typ AST, scope *SymbolTable) error {
+	switch t := typ.(type) {
+	case *ASTIdentifier:
+		return r.resolveIdentifier(t, scope)
+
+	case *ASTDataTypeSlice:
+		return r.resolveType(t.elementType, scope)
+
+	case *ASTDataTypeArray:
+		err := r.resolveExpr(t.arraySize, scope)
+		if err != nil {
+			return err
+		}
+
+		return r.resolveType(t.elementType, scope)
+
+	case *ASTDataTypePointer:
+		return r.resolveType(t.elementType, scope)
+
+	case *ASTDataTypeMap:
+		err := r.resolveType(t.keyType, scope)
+		if err != nil {
+			return err
+		}
+
+		return r.resolveType(t.valueType, scope)
+
+	case *ASTDataTypeChan:
+		return r.resolveType(t.elementType, scope)
+
+	case *ASTDataTypeStruct:
+		for _, field := range t.fields {
+			err := r.resolveType(field.(*ASTDataTypeField).typ, scope)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ASTDataTypeFunc:
+		return r.resolveParams(append(append([]AST{}, t.params...), t.returns...), scope)
+
+	case *ASTDataTypeInterface:
+		for _, method := range t.methods {
+			spec, ok := method.(*ASTDataTypeMethodSpec)
+			if !ok {
+				// it's an embedded interface.
+				err := r.resolveType(method, scope)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			err := r.resolveParams(append(append([]AST{}, spec.params...), spec.returns...), scope)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveParams resolves the types in a parameter list.
+func (r *resolver) resolveParams(params []AST, scope *SymbolTable) error {
+	for _, param := range params {
+		err := r.resolveType(param.(*ASTParameterDecl).typ, scope)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isExported returns true if a name starts with an upper case letter.
+func isExported(name string) bool {
+	ch, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(ch)
+}
@@ -0,0 +1,330 @@
+package golightly
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// findResolved finds the symbol an identifier with the given name at the
+// given line was resolved to.
+func findResolved(sf *sourceFile, line int, name string) *Symbol {
+	for ast, sym := range sf.resolved {
+		switch a := ast.(type) {
+		case *ASTIdentifier:
+			if a.pos.start.Line == line && a.name == name {
+				return sym
+			}
+		case *ASTSelector:
+			if a.pos.start.Line == line && a.name == name {
+				return sym
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestResolveLocal(t *testing.T) {
+	src := "package main;\n" +
+		"var count int;\n" +
+		"func f(a int) int {\n" +
+		"  b := a + count;\n" +
+		"  if c := b; c > 0 {\n" +
+		"    return c;\n" +
+		"  };\n" +
+		"  return b;\n" +
+		"};\n"
+
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader(src))
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	sf := c.sourceFile("test.go")
+	checks := []struct {
+		line int
+		name string
+		decl string
+	}{
+		{4, "a", "ASTParameterDecl"},
+		{4, "count", "ASTVarDecl"},
+		{5, "b", "ASTShortVarDecl"},
+		{6, "c", "ASTShortVarDecl"},
+		{8, "b", "ASTShortVarDecl"},
+		{2, "int", "ASTDataTypeDecl"},
+	}
+
+	for _, check := range checks {
+		sym := findResolved(sf, check.line, check.name)
+		if sym == nil {
+			t.Errorf("'%s' on line %d wasn't resolved", check.name, check.line)
+			continue
+		}
+
+		if declType := strings.TrimPrefix(fmt.Sprintf("%T", sym.decl), "*golightly."); declType != check.decl {
+			t.Errorf("'%s' on line %d resolved to a %s, expected a %s", check.name, check.line, declType, check.decl)
+		}
+	}
+}
+
+func TestResolveAnnotatesTreeNodes(t *testing.T) {
+	src := "package main;\n" +
+		"func f(a int) string {\n" +
+		"  b := a + 1;\n" +
+		"  b++;\n" +
+		"  _ = b;\n" +
+		"  return \"\";\n" +
+		"};\n"
+
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader(src))
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	// everything the resolver found out is attached to nodes which are
+	// still in the tree after all the passes, not to copies of them.
+	sf := c.sourceFile("test.go")
+	inTree := make(map[AST]bool)
+	Walk(sf.ast, func(node AST) bool {
+		inTree[node] = true
+		return true
+	})
+
+	for node := range sf.resolved {
+		if !inTree[node] {
+			t.Errorf("%s was resolved but it's not in the tree", SExpr(node))
+		}
+	}
+
+	// so a node from the tree finds what later passes worked out about it.
+	var found *ASTIdentifier
+	Walk(sf.ast, func(node AST) bool {
+		if ident, ok := node.(*ASTIdentifier); ok && ident.name == "b" && ident.pos.start.Line == 4 {
+			found = ident
+		}
+
+		return true
+	})
+
+	if found == nil {
+		t.Fatal("can't find 'b' on line 4")
+	}
+
+	sym := sf.resolved[found]
+	if sym == nil || sym.dataType != c.dataTypeStore.IntType() {
+		t.Errorf("'b' on line 4 should be an int, got %v", sym)
+	}
+
+	// an identical node which isn't in the tree hasn't been resolved.
+	copied := *found
+	if sf.resolved[&copied] != nil {
+		t.Error("a copy of 'b' was resolved")
+	}
+}
+
+func TestResolvePackageSymbol(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":      &fstest.MapFile{Data: []byte("package main;\nimport \"util\";\nvar x = util.Count + 1;\n")},
+		"util/util.go": &fstest.MapFile{Data: []byte("package util;\nvar Count int;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"main.go"})
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	sym := findResolved(c.sourceFile("main.go"), 3, "Count")
+	if sym == nil || sym.name != "Count" {
+		t.Fatal("util.Count wasn't resolved")
+	}
+
+	if _, ok := sym.decl.(*ASTVarDecl); !ok {
+		t.Errorf("util.Count resolved to %v", sym.decl)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	sources := []struct {
+		src string
+		err string
+	}{
+		{"package main;\nfunc f() int {\n  return x;\n};\n", "test.go:3: undefined: x"},
+		{"package main;\nfunc f() {\n  { a := 1; };\n  a = 2;\n};\n", "test.go:4: undefined: a"},
+		{"package main;\nfunc f() {\n  a := 1;\n  a := 2;\n};\n", "test.go:4: there are no new variables on the left of this ':='"},
+		{"package main;\nvar y = z;\n", "test.go:2: undefined: z"},
+		{"package main;\nfunc f() {\n  x = 1;\n  var x int;\n};\n", "test.go:3: undefined: x"},
+		{"package main;\nfunc f() {\n  y := x + 1;\n  x := 2;\n};\n", "test.go:3: undefined: x"},
+		{"package main;\nfunc f() {\n  var x = x;\n};\n", "test.go:3: undefined: x"},
+	}
+
+	for _, s := range sources {
+		c := NewCompiler()
+		err := c.CompileSource("test.go", strings.NewReader(s.src))
+		if err == nil || err.Error() != s.err {
+			t.Errorf("expected error '%s', got '%v'", s.err, err)
+		}
+	}
+}
+
+func TestResolveDeclarationOrder(t *testing.T) {
+	// package level declarations can be in any order but locals have to be
+	// declared before they're used. before then the name refers to whatever
+	// it is outside the block.
+	src := "package main;\n" +
+		"var a = b;\n" +
+		"var b = 1;\n" +
+		"func f() int {\n" +
+		"  c := a;\n" +
+		"  a := c + 1;\n" +
+		"  return a;\n" +
+		"};\n"
+
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader(src))
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	sf := c.sourceFile("test.go")
+	checks := []struct {
+		line int
+		name string
+		decl string
+	}{
+		{2, "b", "ASTVarDecl"},
+		{5, "a", "ASTVarDecl"},
+		{7, "a", "ASTShortVarDecl"},
+	}
+
+	for _, check := range checks {
+		sym := findResolved(sf, check.line, check.name)
+		if sym == nil {
+			t.Errorf("'%s' on line %d wasn't resolved", check.name, check.line)
+			continue
+		}
+
+		if declType := strings.TrimPrefix(fmt.Sprintf("%T", sym.decl), "*golightly."); declType != check.decl {
+			t.Errorf("'%s' on line %d resolved to a %s, expected a %s", check.name, check.line, declType, check.decl)
+		}
+	}
+}
+
+func TestResolveUnusedLocals(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go": &fstest.MapFile{Data: []byte("package main;\n" +
+			"var global int;\n" +
+			"func f(param int, _ string) int {\n" +
+			"  used := 1;\n" +
+			"  unused := 2;\n" +
+			"  var _ = 3;\n" +
+			"  return used;\n" +
+			"};\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	result, _ := c.CompileAll([]string{"main.go"})
+	if len(result.Errors) != 1 || result.Errors[0].Error() != "main.go:5: 'unused' is declared but not used" {
+		t.Errorf("expected just one error for 'unused', got %v", result.Errors)
+	}
+}
+
+func TestResolveUnusedLocalErrors(t *testing.T) {
+	sources := []struct {
+		src string
+		err string
+	}{
+		{"package main;\nfunc f() {\n  var x int;\n  x = 1;\n};\n", "test.go:3: 'x' is declared but not used"},
+		{"package main;\nfunc f() {\n  a, b := 1, 2;\n  a = b;\n};\n", "test.go:3: 'a' is declared but not used"},
+		{"package main;\nfunc f() {\n  g := func() { y := 1; };\n  g();\n};\n", "test.go:3: 'y' is declared but not used"},
+		{"package main;\nfunc f() {\n  if z := 1; true {\n  };\n};\n", "test.go:3: 'z' is declared but not used"},
+		{"package main;\nfunc f() {\n  x := 1;\n  x++;\n};\n", "test.go:3: 'x' is declared but not used"},
+		{"package main;\nfunc f() {\n  x := 1;\n  x--;\n};\n", "test.go:3: 'x' is declared but not used"},
+		{"package main;\nfunc f() {\n  x := 1;\n  x += 2;\n};\n", "test.go:3: 'x' is declared but not used"},
+		{"package main;\nfunc f() (r int) {\n  x := 1;\n  x <<= 2;\n  return x;\n};\n", ""},
+		{"package main;\nfunc f() {\n  p := new(int);\n  *p += 1;\n};\n", ""},
+		{"package main;\nfunc f() {\n  x := 1;\n  func() { x = x + 1; }();\n};\n", ""},
+		{"package main;\nfunc f() {\n  const c = 1;\n};\n", ""},
+	}
+
+	for _, s := range sources {
+		c := NewCompiler()
+		err := c.CompileSource("test.go", strings.NewReader(s.src))
+		if (err == nil && s.err != "") || (err != nil && err.Error() != s.err) {
+			t.Errorf("expected error '%s', got '%v'", s.err, err)
+		}
+	}
+}
+
+func TestResolveUnexported(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":      &fstest.MapFile{Data: []byte("package main;\nimport \"util\";\nvar x = util.count;\n")},
+		"util/util.go": &fstest.MapFile{Data: []byte("package util;\nvar count int;\n")},
+	}
+
+	c := NewCompilerFS(fsys)
+	err := c.Compile([]string{"main.go"})
+	if err == nil || err.Error() != "main.go:3: 'count' isn't exported from package util" {
+		t.Error("expected an unexported error, got: ", err)
+	}
+}
+
+func TestResolveTypeAlias(t *testing.T) {
+	src := "package main;\n" +
+		"type List = []Name;\n" +
+		"type Name = string;\n" +
+		"type Defined int;\n" +
+		"func f() { type Local = Defined; var x Local; var y Defined = x; _ = y; };\n"
+
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader(src))
+	if err != nil {
+		t.Fatal("error compiling: ", err)
+	}
+
+	ts := c.dataTypeStore
+	symbols := c.sourceFile("test.go").symbols
+
+	// aliases are the same type as what they refer to.
+	if dt := symbols.LookupLocal("Name").dataType; dt != ts.StringType() {
+		t.Errorf("Name should be string, got %v", dt)
+	}
+
+	if dt := symbols.LookupLocal("List").dataType; dt != ts.MakeSlice(ts.StringType()) {
+		t.Errorf("List should be []string, got %v", dt)
+	}
+
+	// defined types are new types.
+	defined := symbols.LookupLocal("Defined").dataType
+	if defined == ts.IntType() || defined.String() != "main.Defined" {
+		t.Errorf("Defined should be a new type, got %v", defined)
+	}
+
+	local := findResolved(c.sourceFile("test.go"), 5, "Local")
+	if local == nil || local.dataType != defined {
+		t.Errorf("Local should be main.Defined, got %v", local)
+	}
+}
+
+func TestResolveTypeAliasErrors(t *testing.T) {
+	sources := []struct {
+		src string
+		err string
+	}{
+		{"package main;\ntype A = A;\n", "test.go:2: 'A' refers to itself in its own declaration"},
+		{"package main;\ntype A = B;\ntype B = []A;\n", "test.go:2: 'A' refers to itself in its own declaration"},
+		{"package main;\ntype N int;\nvar n N;\nvar i int = n;\n", "test.go:4: I can't use a main.N as a int here"},
+	}
+
+	for _, s := range sources {
+		c := NewCompiler()
+		err := c.CompileSource("test.go", strings.NewReader(s.src))
+		if err == nil || err.Error() != s.err {
+			t.Errorf("expected error '%s', got '%v'", s.err, err)
+		}
+	}
+}
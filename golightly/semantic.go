@@ -0,0 +1,168 @@
+package golightly
+
+import "fmt"
+
+// checkUnusedImports makes sure that every package imported by a file is
+// referred to by at least one qualified identifier in the file. Blank
+// and dot imports aren't referred to by name so they're not checked.
+func checkUnusedImports(filename string, top *ASTTopLevel) error {
+	// find all the package names which are referred to.
+	used := make(map[string]bool)
+	for _, decl := range top.topLevelDecls {
+		Walk(decl, func(ast AST) bool {
+			switch a := ast.(type) {
+			case *ASTIdentifier:
+				if a.packageName != "" {
+					used[a.packageName] = true
+				}
+
+			case *ASTSelector:
+				// in an expression "pkg.Name" is parsed as a selector.
+				if ident, ok := a.expr.(*ASTIdentifier); ok && ident.packageName == "" {
+					used[ident.name] = true
+				}
+			}
+
+			return true
+		})
+	}
+
+	// check each import against them.
+	for _, ast := range top.imports {
+		imp := ast.(*ASTImport)
+		name := imp.LocalName()
+		if name != "_" && name != "." && !used[name] {
+			return NewError(filename, imp.Pos(), fmt.Sprint("\"", imp.ImportPath(), "\" is imported but not used"))
+		}
+	}
+
+	return nil
+}
+
+// resolveTypes works out the types of the type declarations, functions
+// and methods in a file, and attaches methods to their receiver's type.
+// Every file in the package has to have declared its symbols first.
+func resolveTypes(sf *sourceFile, ts *DataTypeStore) error {
+	top := sf.ast.(*ASTTopLevel)
+
+	// do the type declarations first since everything else can refer to them.
+	ar := aliasResolver{sf, ts, make(map[*Symbol]bool), nil}
+	for _, decl := range top.topLevelDecls {
+		typeDecl, ok := decl.(*ASTDataTypeDecl)
+		if !ok {
+			continue
+		}
+
+		sym := sf.symbols.LookupLocal(typeDecl.ident.(*ASTIdentifier).name)
+		if sym == nil {
+			// it's called "_".
+			continue
+		}
+
+		if typeDecl.alias {
+			if sym.dataType == nil {
+				err := ar.resolve(sym, typeDecl)
+				if err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		underlying, err := ts.fromAST(sf.fileName, typeDecl.typ, ar.lookup)
+		if ar.err != nil {
+			return ar.err
+		}
+		if err != nil {
+			return err
+		}
+
+		sym.dataType.(*DataTypeNamed).underlying = underlying
+	}
+
+	// now the functions and methods.
+	for _, decl := range top.topLevelDecls {
+		funcDecl, ok := decl.(*ASTFunctionDecl)
+		if !ok {
+			continue
+		}
+
+		signature, err := ts.funcFromAST(sf.fileName, funcDecl.params, funcDecl.returns, scopeLookup(sf.symbols))
+		if err != nil {
+			return err
+		}
+
+		if funcDecl.receiver == nil {
+			sym := sf.symbols.LookupLocal(funcDecl.name)
+			if sym != nil {
+				sym.dataType = signature
+			}
+
+			continue
+		}
+
+		// it's a method. find the type it belongs to.
+		receiver := funcDecl.receiver.(*ASTReceiver)
+		sym := sf.symbols.Lookup(receiver.typeName)
+		var named *DataTypeNamed
+		if sym != nil {
+			named, _ = sym.dataType.(*DataTypeNamed)
+		}
+
+		if named == nil {
+			return NewError(sf.fileName, receiver.pos, fmt.Sprint("I can't find a type called '", receiver.typeName, "' in this package for this method to belong to"))
+		}
+
+		if !ts.AddMethod(named, funcDecl.name, signature, receiver.pointer) {
+			return NewError(sf.fileName, funcDecl.pos, fmt.Sprint("'", receiver.typeName, "' already has a method called '", funcDecl.name, "'"))
+		}
+	}
+
+	return nil
+}
+
+// type aliasResolver works out the types of aliases as they're needed, so
+// aliases can be used before they're declared.
+type aliasResolver struct {
+	sf         *sourceFile
+	ts         *DataTypeStore
+	inProgress map[*Symbol]bool // aliases we're in the middle of resolving.
+	err        error            // the first error found while looking up.
+}
+
+// lookup finds a type name, resolving it first if it's an alias we
+// haven't got to yet.
+func (ar *aliasResolver) lookup(ident *ASTIdentifier) *Symbol {
+	sym := scopeLookup(ar.sf.symbols)(ident)
+	if sym == nil || sym.dataType != nil || ar.err != nil {
+		return sym
+	}
+
+	if decl, ok := sym.decl.(*ASTDataTypeDecl); ok && decl.alias {
+		ar.err = ar.resolve(sym, decl)
+	}
+
+	return sym
+}
+
+// resolve works out the type an alias refers to.
+func (ar *aliasResolver) resolve(sym *Symbol, decl *ASTDataTypeDecl) error {
+	if ar.inProgress[sym] {
+		return NewError(ar.sf.fileName, decl.ident.Pos(), fmt.Sprint("'", sym.name, "' refers to itself in its own declaration"))
+	}
+
+	ar.inProgress[sym] = true
+	defer delete(ar.inProgress, sym)
+
+	dt, err := ar.ts.fromAST(ar.sf.fileName, decl.typ, ar.lookup)
+	if ar.err != nil {
+		return ar.err
+	}
+	if err != nil {
+		return err
+	}
+
+	sym.dataType = dt
+	return nil
+}
@@ -0,0 +1,166 @@
+package golightly
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SExpr renders an AST as a compact Lisp-style S-expression like
+// (binary + (value 1) (value 2)). It's handy for tests and for eyeballing
+// what the parser did. Missing optional children are shown as ().
+func SExpr(node AST) string {
+	var sb strings.Builder
+	writeSExpr(&sb, node, false)
+	return sb.String()
+}
+
+// SExprPos is like SExpr but every node says where it is in the source,
+// like (value@1:5-1:5 2).
+func SExprPos(node AST) string {
+	var sb strings.Builder
+	writeSExpr(&sb, node, true)
+	return sb.String()
+}
+
+// writeSExpr writes a node and all its children.
+func writeSExpr(sb *strings.Builder, ast AST, withPos bool) {
+	if ast == nil {
+		sb.WriteString("()")
+		return
+	}
+
+	// items are written in order with spaces between them. strings are
+	// atoms, ASTs are nested nodes and lists of ASTs are grouped in
+	// brackets.
+	var kind string
+	var items []interface{}
+	switch a := ast.(type) {
+	case *ASTTopLevel:
+		kind = "toplevel"
+		items = []interface{}{a.packageName, a.imports, a.topLevelDecls}
+	case *ASTImport:
+		kind, items = "import", []interface{}{a.packageName, a.importPath}
+	case *ASTUnaryExpr:
+		kind, items = "unary", []interface{}{operatorNames[a.op], a.param}
+	case *ASTBinaryExpr:
+		kind, items = "binary", []interface{}{operatorNames[a.op], a.left, a.right}
+	case *ASTParen:
+		kind, items = "paren", []interface{}{a.expr}
+	case *ASTValue:
+		kind, items = "value", []interface{}{a.val.String()}
+	case *ASTIdentifier:
+		name := a.name
+		if a.packageName != "" {
+			name = a.packageName + "." + name
+		}
+		kind, items = "identifier", []interface{}{name}
+	case *ASTConstDecl:
+		kind, items = "const", []interface{}{a.ident, a.typ, a.value}
+	case *ASTVarDecl:
+		kind, items = "var", []interface{}{a.ident, a.typ, a.value}
+	case *ASTFunctionDecl:
+		kind, items = "func", []interface{}{a.name, a.receiver, a.params, a.returns, a.body}
+	case *ASTReceiver:
+		typeName := a.typeName
+		if a.pointer {
+			typeName = "*" + typeName
+		}
+		kind, items = "receiver", []interface{}{a.name, typeName}
+	case *ASTDataTypeDecl:
+		kind = "type"
+		if a.alias {
+			kind = "alias"
+		}
+		items = []interface{}{a.ident, a.typ}
+	case *ASTDataTypeSlice:
+		kind, items = "slice", []interface{}{a.elementType}
+	case *ASTDataTypeArray:
+		kind, items = "array", []interface{}{a.arraySize, a.elementType}
+	case *ASTDataTypePointer:
+		kind, items = "pointer", []interface{}{a.elementType}
+	case *ASTDataTypeMap:
+		kind, items = "map", []interface{}{a.keyType, a.valueType}
+	case *ASTDataTypeChan:
+		kind, items = "chan", []interface{}{chanDirectionNames[a.dir], a.elementType}
+	case *ASTDataTypeStruct:
+		kind, items = "struct", []interface{}{a.fields}
+	case *ASTDataTypeField:
+		kind, items = "field", []interface{}{a.identifier, a.typ}
+		if a.tag != "" {
+			items = append(items, strconv.Quote(string(a.tag)))
+		}
+	case *ASTDataTypeFunc:
+		kind, items = "functype", []interface{}{a.params, a.returns}
+	case *ASTParameterDecl:
+		kind, items = "param", []interface{}{a.identifier, a.typ}
+		if a.ellipsis != nil {
+			kind = "param..."
+		}
+	case *ASTEllipsis:
+		kind = "ellipsis"
+	case *ASTDataTypeInterface:
+		kind, items = "interface", []interface{}{a.methods}
+	case *ASTDataTypeMethodSpec:
+		kind, items = "method", []interface{}{a.name, a.params, a.returns}
+	case *ASTBlock:
+		kind, items = "block", []interface{}{a.statements}
+	case *ASTSelector:
+		kind, items = "selector", []interface{}{a.expr, a.name}
+	case *ASTCall:
+		kind, items = "call", []interface{}{a.function, a.args}
+	case *ASTIndex:
+		kind, items = "index", []interface{}{a.expr, a.index}
+	case *ASTTypeAssert:
+		kind, items = "typeassert", []interface{}{a.expr, a.typ}
+	case *ASTFuncLit:
+		kind, items = "funclit", []interface{}{a.params, a.returns, a.body}
+	case *ASTReturn:
+		kind, items = "return", []interface{}{a.values}
+	case *ASTIf:
+		kind, items = "if", []interface{}{a.init, a.condition, a.then, a.otherwise}
+	case *ASTFor:
+		kind, items = "for", []interface{}{a.init, a.condition, a.post, a.body}
+	case *ASTAssign:
+		kind, items = "assign", []interface{}{operatorNames[a.op], a.left, a.right}
+	case *ASTShortVarDecl:
+		kind, items = "define", []interface{}{a.idents, a.values}
+	case *ASTIncDec:
+		kind, items = "incdec", []interface{}{operatorNames[a.op], a.expr}
+	default:
+		kind = fmt.Sprintf("unknown %T", ast)
+	}
+
+	sb.WriteString("(")
+	sb.WriteString(kind)
+	if withPos {
+		pos := ast.Pos()
+		fmt.Fprintf(sb, "@%d:%d-%d:%d", pos.start.Line, pos.start.Column, pos.end.Line, pos.end.Column)
+	}
+
+	for _, item := range items {
+		sb.WriteString(" ")
+		switch it := item.(type) {
+		case string:
+			if it == "" {
+				it = `""`
+			}
+			sb.WriteString(it)
+		case []AST:
+			sb.WriteString("(")
+			for i, child := range it {
+				if i > 0 {
+					sb.WriteString(" ")
+				}
+				writeSExpr(sb, child, withPos)
+			}
+			sb.WriteString(")")
+		default:
+			// it's an AST, or nil if it's a missing child.
+			child, _ := item.(AST)
+			writeSExpr(sb, child, withPos)
+		}
+	}
+
+	sb.WriteString(")")
+}
@@ -0,0 +1,54 @@
+package golightly
+
+import (
+	"testing"
+)
+
+func TestSExpr(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected string
+	}{
+		{"1 + 2", "(binary + (value 1) (value 2))"},
+		{"(1 + 2) * -x", "(binary * (paren (binary + (value 1) (value 2))) (unary - (identifier x)))"},
+		{"f(a, \"s\")[i].name", "(selector (index (call (identifier f) ((identifier a) (value \"s\"))) (identifier i)) name)"},
+		{"g()", "(call (identifier g) ())"},
+	}
+
+	for _, c := range cases {
+		expr, err := setupParserTest(c.src).parseExpression()
+		if err != nil {
+			t.Errorf("'%s' gave error %v", c.src, err)
+			continue
+		}
+
+		if sexpr := SExpr(expr); sexpr != c.expected {
+			t.Errorf("'%s' gave %s, expected %s", c.src, sexpr, c.expected)
+		}
+	}
+}
+
+func TestSExprPos(t *testing.T) {
+	expr, err := setupParserTest("a + 2").parseExpression()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	expected := "(binary@1:1-1:5 + (identifier@1:1-1:1 a) (value@1:5-1:5 2))"
+	if sexpr := SExprPos(expr); sexpr != expected {
+		t.Errorf("got %s, expected %s", sexpr, expected)
+	}
+}
+
+func TestSExprStatements(t *testing.T) {
+	stmts, err := setupParserTest("if x := f(); x > 1 { x += 2; return x } else { x-- }").parseStatement()
+	if err != nil {
+		t.Fatal("error parsing: ", err)
+	}
+
+	expected := "(if (define ((identifier x)) ((call (identifier f) ()))) (binary > (identifier x) (value 1)) " +
+		"(block ((assign += ((identifier x)) ((value 2))) (return ((identifier x))))) (block ((incdec -- (identifier x)))))"
+	if sexpr := SExpr(stmts[0]); sexpr != expected {
+		t.Errorf("got %s\nexpected %s", sexpr, expected)
+	}
+}
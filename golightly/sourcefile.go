@@ -2,30 +2,94 @@ package golightly
 
 // type sourceFile is a single file which has to be compiled.
 type sourceFile struct {
-	packageName            string                 // the package name of this file.
-	fileName               string                 // the name of this file. unique system-wide.
-	ast                    AST                    // the AST result of parsing.
-	symbols                SymbolTable            // the symbols in this file.
-	waitingPackageComplete map[string]bool        // the import packages we're waiting on before we can do symbol resolution.
-	packageComplete        chan completionMessage // packages tell us they're complete with a message on this channel.
-	compileSrc             chan compileSrcMessage // we can request files to be compiled here.
-	addImport              chan importMessage     // we can request imports here.
-	completeChannel        chan completionMessage // a channel to notify when our symbols are complete.
-	shutdown               chan bool              // closed when the compiler is shutting down.
-
-	// the following are used by Compiler.parseSrcs().
-	status				compileStatus            // where we are in the compilation process.
+	packageName            string                  // the package name of this file.
+	packagePos             SrcSpan                 // where the package name is declared.
+	fileName               string                  // the name of this file. unique system-wide.
+	ast                    AST                     // the AST result of parsing.
+	symbols                *SymbolTable            // the symbols in this file's package.
+	pkg                    *packageFiles           // what this file shares with the other files in its package.
+	importedSymbols        map[string]*SymbolTable // the symbols of each imported package, by import path.
+	importedFiles          map[string][]string     // the files of each imported package, by import path.
+	resolved               map[AST]*Symbol         // what each identifier refers to, once they're resolved.
+	types                  map[AST]DataType        // the type of each expression.
+	conversions            map[AST]DataType        // calls which are really type conversions, and the type they convert to.
+	selections             map[AST]SelectionKind   // what sort of thing each selector picks out.
+	constants              map[AST]Value           // the value of each constant declaration, by its value expression.
+	warnings               []error                 // problems which don't stop the file compiling.
+	buildConstraint        BuildConstraint         // the file's "//go:build" line, or nil if it hasn't got one.
+	excluded               bool                    // true if the build constraint left this file out.
+	waitingPackageComplete map[string]bool         // the import packages we're waiting on before we can do symbol resolution.
+	packageComplete        chan completionMessage  // packages tell us they're complete with a message on this channel.
+	compileSrc             chan compileSrcMessage  // we can request files to be compiled here.
+	addImport              chan importMessage      // we can request imports here.
+	completeChannel        chan completionMessage  // a channel to notify when our symbols are complete.
+	shutdown               chan bool               // closed if this file's compilation is abandoned.
+
+	// the following are used by Compiler.compileSrcs().
+	status compileStatus // where we are in the compilation process.
+
+	// the following are only used by the goroutine compiling the file.
+	declared   bool // true once we've arrived at pkg.declared.
+	typed      bool // true once we've arrived at pkg.typed.
+	identified bool // true once we've arrived at pkg.identified.
 }
 
 // NewSourceFile creates a new sourceFile.
 func NewSourceFile(fileName string, compileSrc chan compileSrcMessage, addImport chan importMessage, completeChannel chan completionMessage, shutdown chan bool) *sourceFile {
 	sf := new(sourceFile)
 	sf.fileName = fileName
+	sf.symbols = NewSymbolTable(nil)
+	sf.importedSymbols = make(map[string]*SymbolTable)
+	sf.importedFiles = make(map[string][]string)
+	sf.resolved = make(map[AST]*Symbol)
+	sf.types = make(map[AST]DataType)
+	sf.conversions = make(map[AST]DataType)
+	sf.selections = make(map[AST]SelectionKind)
+	sf.constants = make(map[AST]Value)
 	sf.waitingPackageComplete = make(map[string]bool)
 	sf.packageComplete = make(chan completionMessage)
+	sf.compileSrc = compileSrc
 	sf.addImport = addImport
 	sf.completeChannel = completeChannel
 	sf.shutdown = shutdown
 
 	return sf
 }
+
+// arriveDeclared tells the other files in the package that this one has
+// declared its symbols.
+func (sf *sourceFile) arriveDeclared() {
+	if !sf.declared {
+		sf.declared = true
+		sf.pkg.declared.arrive()
+	}
+}
+
+// arriveTyped tells the other files in the package that this one has
+// resolved its types.
+func (sf *sourceFile) arriveTyped() {
+	if !sf.typed {
+		sf.typed = true
+		sf.pkg.typed.arrive()
+	}
+}
+
+// arriveIdentified tells the other files in the package that this one
+// has resolved its identifiers.
+func (sf *sourceFile) arriveIdentified() {
+	if !sf.identified {
+		sf.identified = true
+		sf.pkg.identified.arrive()
+	}
+}
+
+// setImportName tells this file's imports of a package what the package
+// calls itself, now that it's been compiled.
+func (sf *sourceFile) setImportName(importPath string, declaredName string) {
+	for _, ast := range sf.ast.(*ASTTopLevel).imports {
+		imp := ast.(*ASTImport)
+		if imp.ImportPath() == importPath {
+			imp.declaredName = declaredName
+		}
+	}
+}
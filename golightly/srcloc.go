@@ -10,11 +10,12 @@ type SrcLoc struct {
 type SrcSpan struct {
 	start SrcLoc
 	end   SrcLoc
+	file  string // the file a "//line" comment says it's in, or "" for the file being compiled.
 }
 
 // Add adds two source spans to make a wider span. They must be in order.
 func (ss SrcSpan) Add(to SrcSpan) SrcSpan {
-	return SrcSpan{ss.start, to.end}
+	return SrcSpan{ss.start, to.end, ss.file}
 }
 
 // Equals compares two source spans.
@@ -0,0 +1,119 @@
+package golightly
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// type StructTag is the tag on a struct field. By convention it's a list
+// of key:"value" pairs separated by spaces, like `json:"name" xml:"n"`.
+type StructTag string
+
+// type structTagPair is a single key:"value" pair from a struct tag.
+type structTagPair struct {
+	key   string
+	value string
+}
+
+// Get returns the value for a key in the tag, or "" if it's not there.
+func (tag StructTag) Get(key string) string {
+	value, _ := tag.Lookup(key)
+	return value
+}
+
+// Lookup returns the value for a key in the tag and whether it was there
+// at all. Anything after a badly formed part of the tag is ignored.
+func (tag StructTag) Lookup(key string) (string, bool) {
+	pairs, _ := tag.parse()
+	for _, pair := range pairs {
+		if pair.key == key {
+			return pair.value, true
+		}
+	}
+
+	return "", false
+}
+
+// parse splits a tag into its key:"value" pairs. If the tag isn't in the
+// usual format it returns the pairs before the problem and says what's
+// wrong.
+func (tag StructTag) parse() ([]structTagPair, string) {
+	var pairs []structTagPair
+	s := string(tag)
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return pairs, ""
+		}
+
+		// the key goes up to the ':'.
+		i := 0
+		for i < len(s) && s[i] > ' ' && s[i] != ':' && s[i] != '"' && s[i] != 0x7f {
+			i++
+		}
+
+		if i == 0 {
+			return pairs, "there's a value without a key"
+		}
+
+		key := s[:i]
+		if i >= len(s) || s[i] != ':' {
+			return pairs, fmt.Sprint("'", key, "' needs a ':' after it")
+		}
+
+		if i+1 >= len(s) || s[i+1] != '"' {
+			return pairs, fmt.Sprint("the value for '", key, "' should be in double quotes")
+		}
+
+		// the value's a quoted string.
+		s = s[i+1:]
+		i = 1
+		for i < len(s) && s[i] != '"' {
+			if s[i] == '\\' {
+				i++
+			}
+			i++
+		}
+
+		if i >= len(s) {
+			return pairs, fmt.Sprint("the value for '", key, "' is missing its closing '\"'")
+		}
+
+		value, err := strconv.Unquote(s[:i+1])
+		if err != nil {
+			return pairs, fmt.Sprint("the value for '", key, "' isn't a proper string")
+		}
+
+		pairs = append(pairs, structTagPair{key, value})
+
+		s = s[i+1:]
+		if s != "" && s[0] != ' ' {
+			return pairs, fmt.Sprint("there should be a space after the value for '", key, "'")
+		}
+	}
+}
+
+// checkStructTags makes sure the tags on struct fields follow the
+// key:"value" convention. Tags can be anything as far as the language is
+// concerned, so problems are only warnings.
+func checkStructTags(filename string, top *ASTTopLevel) []error {
+	var warnings []error
+	for _, decl := range top.topLevelDecls {
+		Walk(decl, func(ast AST) bool {
+			field, ok := ast.(*ASTDataTypeField)
+			if !ok || field.tag == "" {
+				return true
+			}
+
+			_, problem := field.tag.parse()
+			if problem != "" {
+				warnings = append(warnings, NewWarning(filename, field.Pos(), fmt.Sprint("this struct tag doesn't look like key:\"value\" pairs - ", problem)))
+			}
+
+			return true
+		})
+	}
+
+	return warnings
+}
@@ -0,0 +1,77 @@
+package golightly
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStructTagGet(t *testing.T) {
+	tag := StructTag(`json:"name,omitempty" xml:"n"`)
+
+	cases := []struct {
+		key   string
+		value string
+		found bool
+	}{
+		{"json", "name,omitempty", true},
+		{"xml", "n", true},
+		{"yaml", "", false},
+	}
+
+	for _, c := range cases {
+		value, found := tag.Lookup(c.key)
+		if value != c.value || found != c.found {
+			t.Errorf("'%s' gave '%s', %v, expected '%s', %v", c.key, value, found, c.value, c.found)
+		}
+
+		if tag.Get(c.key) != c.value {
+			t.Errorf("Get('%s') gave '%s', expected '%s'", c.key, tag.Get(c.key), c.value)
+		}
+	}
+}
+
+func TestStructTagParse(t *testing.T) {
+	cases := []struct {
+		tag     StructTag
+		problem string
+	}{
+		{`json:"name,omitempty" xml:"n"`, ""},
+		{`a:"\"quoted\""`, ""},
+		{`json`, "'json' needs a ':' after it"},
+		{`json:name`, "the value for 'json' should be in double quotes"},
+		{`json:"name`, "the value for 'json' is missing its closing '\"'"},
+		{`json:"a"xml:"b"`, "there should be a space after the value for 'json'"},
+		{`:"x"`, "there's a value without a key"},
+	}
+
+	for _, c := range cases {
+		_, problem := c.tag.parse()
+		if problem != c.problem {
+			t.Errorf("`%s` gave '%s', expected '%s'", c.tag, problem, c.problem)
+		}
+	}
+}
+
+func TestCheckStructTags(t *testing.T) {
+	src := "package main;\n" +
+		"type Good struct { a int `json:\"a,omitempty\" xml:\"n\"`; };\n" +
+		"type Bad struct {\n" +
+		"  b int `json:b`;\n" +
+		"};\n"
+
+	c := NewCompiler()
+	err := c.CompileSource("test.go", strings.NewReader(src))
+	if err != nil {
+		t.Fatal("a bad struct tag shouldn't stop compilation: ", err)
+	}
+
+	warnings := c.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("expected one warning, got %v", warnings)
+	}
+
+	expected := "test.go:4: this struct tag doesn't look like key:\"value\" pairs - the value for 'json' should be in double quotes"
+	if warnings[0].Error() != expected {
+		t.Errorf("got warning '%s', expected '%s'", warnings[0], expected)
+	}
+}
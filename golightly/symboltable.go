@@ -1,5 +1,157 @@
 package golightly
 
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// SymbolKind says what sort of thing a symbol is. It's what tells a
+// conversion like "T(x)" apart from a call like "f(x)".
+type SymbolKind int
+
+const (
+	SymbolKindConst SymbolKind = iota
+	SymbolKindVar
+	SymbolKindType
+	SymbolKindFunc
+	SymbolKindPackage
+	SymbolKindBuiltin // builtin functions, which aren't declared anywhere.
+)
+
+// symbolKindNames are how each kind of symbol is described.
+var symbolKindNames = map[SymbolKind]string{
+	SymbolKindConst:   "const",
+	SymbolKindVar:     "var",
+	SymbolKindType:    "type",
+	SymbolKindFunc:    "func",
+	SymbolKindPackage: "package",
+	SymbolKindBuiltin: "builtin",
+}
+
+func (sk SymbolKind) String() string {
+	name, ok := symbolKindNames[sk]
+	if !ok {
+		return fmt.Sprint("symbol kind ", int(sk))
+	}
+
+	return name
+}
+
+// type Symbol is something which has been declared with a name - a type,
+// a variable, a constant or a function.
+type Symbol struct {
+	name     string
+	kind     SymbolKind
+	decl     AST      // where it was declared
+	dataType DataType // its data type, once we know it
+}
+
+// type SymbolTable is a scope containing symbols. Scopes are nested - if
+// a symbol isn't found in a scope we look in its parent.
 type SymbolTable struct {
-	syms map[string]DataType
+	parent  *SymbolTable
+	symbols map[string]*Symbol
+	mutex   sync.RWMutex
+}
+
+// NewSymbolTable creates a new scope inside a parent scope. The parent can
+// be nil for the outermost scope.
+func NewSymbolTable(parent *SymbolTable) *SymbolTable {
+	st := new(SymbolTable)
+	st.parent = parent
+	st.symbols = make(map[string]*Symbol)
+
+	return st
+}
+
+// NewUniverse creates the outermost scope, which contains all the
+// predeclared types, constants and functions.
+func NewUniverse(ts *DataTypeStore) *SymbolTable {
+	universe := NewSymbolTable(nil)
+	for name, dt := range ts.PredeclaredTypes() {
+		universe.Add(&Symbol{name, SymbolKindType, &ASTDataTypeDecl{&ASTIdentifier{SrcSpan{}, "", name}, nil, false, ""}, dt})
+	}
+
+	universe.Add(&Symbol{"true", SymbolKindConst, &ASTConstDecl{&ASTIdentifier{SrcSpan{}, "", "true"}, nil, nil, ""}, ts.UntypedBoolType()})
+	universe.Add(&Symbol{"false", SymbolKindConst, &ASTConstDecl{&ASTIdentifier{SrcSpan{}, "", "false"}, nil, nil, ""}, ts.UntypedBoolType()})
+	universe.Add(&Symbol{"iota", SymbolKindConst, &ASTConstDecl{&ASTIdentifier{SrcSpan{}, "", "iota"}, nil, nil, ""}, ts.UntypedIntType()})
+	universe.Add(&Symbol{"nil", SymbolKindConst, nil, ts.UntypedNilType()})
+
+	for name, b := range builtinNames {
+		universe.Add(&Symbol{name, SymbolKindBuiltin, &builtinDecl{b}, nil})
+	}
+
+	return universe
+}
+
+// Add adds a symbol to this scope. It returns false if there's already a
+// symbol with that name in this scope.
+func (st *SymbolTable) Add(sym *Symbol) bool {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	_, found := st.symbols[sym.name]
+	if found {
+		return false
+	}
+
+	st.symbols[sym.name] = sym
+	return true
+}
+
+// LookupLocal finds a symbol in this scope only. It returns nil if
+// it's not found.
+func (st *SymbolTable) LookupLocal(name string) *Symbol {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+
+	return st.symbols[name]
+}
+
+// Lookup finds a symbol in this scope or any of its parents. It returns
+// nil if it's not found.
+func (st *SymbolTable) Lookup(name string) *Symbol {
+	for scope := st; scope != nil; scope = scope.parent {
+		sym := scope.LookupLocal(name)
+		if sym != nil {
+			return sym
+		}
+	}
+
+	return nil
+}
+
+// Dump writes out every scope from the outermost one in to this one, with
+// each symbol's kind and type. It's for seeing what's in scope when
+// resolution goes wrong. Types which haven't been worked out yet are shown
+// as "?".
+func (st *SymbolTable) Dump(w io.Writer) {
+	var scopes []*SymbolTable
+	for scope := st; scope != nil; scope = scope.parent {
+		scopes = append([]*SymbolTable{scope}, scopes...)
+	}
+
+	for level, scope := range scopes {
+		fmt.Fprintf(w, "scope %d:\n", level)
+
+		scope.mutex.RLock()
+		names := make([]string, 0, len(scope.symbols))
+		for name := range scope.symbols {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		for _, name := range names {
+			sym := scope.symbols[name]
+			typeName := "?"
+			if sym.dataType != nil {
+				typeName = sym.dataType.String()
+			}
+
+			fmt.Fprintf(w, "  %s %v %s\n", name, sym.kind, typeName)
+		}
+		scope.mutex.RUnlock()
+	}
 }
@@ -0,0 +1,84 @@
+package golightly
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSymbolKinds(t *testing.T) {
+	ts := NewDataTypeStore()
+	st := NewSymbolTable(NewUniverse(ts))
+
+	symbols := []*Symbol{
+		{"limit", SymbolKindConst, nil, ts.UntypedIntType()},
+		{"count", SymbolKindVar, nil, ts.IntType()},
+		{"Point", SymbolKindType, nil, ts.MakeNamed("main", "Point", ts.IntType())},
+		{"main", SymbolKindFunc, nil, nil},
+		{"fmt", SymbolKindPackage, nil, nil},
+	}
+
+	for _, sym := range symbols {
+		if !st.Add(sym) {
+			t.Fatalf("couldn't add '%s'", sym.name)
+		}
+	}
+
+	for _, sym := range symbols {
+		found := st.Lookup(sym.name)
+		if found == nil {
+			t.Errorf("'%s' wasn't found", sym.name)
+		} else if found.kind != sym.kind {
+			t.Errorf("'%s' is kind %d, expected %d", sym.name, found.kind, sym.kind)
+		}
+	}
+
+	// the predeclared ones come from the universe.
+	universe := []struct {
+		name string
+		kind SymbolKind
+	}{
+		{"int", SymbolKindType},
+		{"error", SymbolKindType},
+		{"true", SymbolKindConst},
+		{"nil", SymbolKindConst},
+		{"len", SymbolKindBuiltin},
+	}
+
+	for _, u := range universe {
+		found := st.Lookup(u.name)
+		if found == nil {
+			t.Errorf("'%s' wasn't found", u.name)
+		} else if found.kind != u.kind {
+			t.Errorf("'%s' is kind %d, expected %d", u.name, found.kind, u.kind)
+		}
+	}
+}
+
+func TestSymbolTableDump(t *testing.T) {
+	ts := NewDataTypeStore()
+	outer := NewSymbolTable(nil)
+	outer.Add(&Symbol{"count", SymbolKindVar, nil, ts.IntType()})
+	outer.Add(&Symbol{"Point", SymbolKindType, nil, ts.MakeNamed("main", "Point", ts.IntType())})
+	outer.Add(&Symbol{"f", SymbolKindFunc, nil, nil})
+
+	middle := NewSymbolTable(outer)
+	inner := NewSymbolTable(middle)
+	inner.Add(&Symbol{"limit", SymbolKindConst, nil, ts.UntypedIntType()})
+	inner.Add(&Symbol{"b", SymbolKindVar, nil, ts.MakeSlice(ts.ByteType())})
+
+	var sb strings.Builder
+	inner.Dump(&sb)
+
+	expected := `scope 0:
+  Point type main.Point
+  count var int
+  f func ?
+scope 1:
+scope 2:
+  b var []uint8
+  limit const untyped int
+`
+	if sb.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", sb.String(), expected)
+	}
+}
@@ -1,5 +1,7 @@
 package golightly
 
+import "fmt"
+
 // TokenKind indicate which type of symbol this lexical item is
 type TokenKind int
 
@@ -80,28 +82,6 @@ const (
 	TokenKindTypeKeyword
 	TokenKindVar
 
-	// data type keywords
-	TokenKindBool
-	TokenKindUint
-	TokenKindUint8
-	TokenKindUint16
-	TokenKindUint32
-	TokenKindUint64
-	TokenKindUintPtr
-	TokenKindInt
-	TokenKindInt8
-	TokenKindInt16
-	TokenKindInt32
-	TokenKindInt64
-	TokenKindFloat32
-	TokenKindFloat64
-	TokenKindComplex64
-	TokenKindComplex128
-	TokenKindByte
-	TokenKindRune
-	TokenKindString
-	TokenKindError
-
 	// identifiers
 	TokenKindIdentifier
 
@@ -115,6 +95,98 @@ const (
 	TokenKindEndOfSource
 )
 
+// tokenKindNames are how each kind of token is written in the source, or
+// a description of it if it can be written lots of ways.
+var tokenKindNames = map[TokenKind]string{
+	TokenKindAdd:                "+",
+	TokenKindSubtract:           "-",
+	TokenKindAsterisk:           "*",
+	TokenKindDivide:             "/",
+	TokenKindModulus:            "%",
+	TokenKindBitwiseAnd:         "&",
+	TokenKindBitwiseOr:          "|",
+	TokenKindBitwiseExor:        "^",
+	TokenKindShiftLeft:          "<<",
+	TokenKindShiftRight:         ">>",
+	TokenKindBitClear:           "&^",
+	TokenKindAddAssign:          "+=",
+	TokenKindSubtractAssign:     "-=",
+	TokenKindMultiplyAssign:     "*=",
+	TokenKindDivideAssign:       "/=",
+	TokenKindModulusAssign:      "%=",
+	TokenKindBitwiseAndAssign:   "&=",
+	TokenKindBitwiseOrAssign:    "|=",
+	TokenKindBitwiseExorAssign:  "^=",
+	TokenKindShiftLeftAssign:    "<<=",
+	TokenKindShiftRightAssign:   ">>=",
+	TokenKindBitClearAssign:     "&^=",
+	TokenKindLogicalAnd:         "&&",
+	TokenKindLogicalOr:          "||",
+	TokenKindChannelArrow:       "<-",
+	TokenKindIncrement:          "++",
+	TokenKindDecrement:          "--",
+	TokenKindEquals:             "==",
+	TokenKindLess:               "<",
+	TokenKindGreater:            ">",
+	TokenKindAssign:             "=",
+	TokenKindNot:                "!",
+	TokenKindNotEqual:           "!=",
+	TokenKindLessEqual:          "<=",
+	TokenKindGreaterEqual:       ">=",
+	TokenKindDeclareAssign:      ":=",
+	TokenKindEllipsis:           "...",
+	TokenKindOpenBracket:        "(",
+	TokenKindCloseBracket:       ")",
+	TokenKindOpenSquareBracket:  "[",
+	TokenKindCloseSquareBracket: "]",
+	TokenKindOpenBrace:          "{",
+	TokenKindCloseBrace:         "}",
+	TokenKindComma:              ",",
+	TokenKindDot:                ".",
+	TokenKindColon:              ":",
+	TokenKindSemicolon:          ";",
+	TokenKindBreak:              "break",
+	TokenKindCase:               "case",
+	TokenKindChan:               "chan",
+	TokenKindConst:              "const",
+	TokenKindContinue:           "continue",
+	TokenKindDefault:            "default",
+	TokenKindDefer:              "defer",
+	TokenKindElse:               "else",
+	TokenKindFallthrough:        "fallthrough",
+	TokenKindFor:                "for",
+	TokenKindFunc:               "func",
+	TokenKindGo:                 "go",
+	TokenKindGoto:               "goto",
+	TokenKindIf:                 "if",
+	TokenKindImport:             "import",
+	TokenKindInterface:          "interface",
+	TokenKindMap:                "map",
+	TokenKindPackage:            "package",
+	TokenKindRange:              "range",
+	TokenKindReturn:             "return",
+	TokenKindSelect:             "select",
+	TokenKindStruct:             "struct",
+	TokenKindSwitch:             "switch",
+	TokenKindTypeKeyword:        "type",
+	TokenKindVar:                "var",
+	TokenKindIdentifier:         "identifier",
+	TokenKindLiteralInt:         "int literal",
+	TokenKindLiteralFloat:       "float literal",
+	TokenKindLiteralRune:        "rune literal",
+	TokenKindLiteralString:      "string literal",
+	TokenKindEndOfSource:        "end of source",
+}
+
+func (tk TokenKind) String() string {
+	name, ok := tokenKindNames[tk]
+	if !ok {
+		return fmt.Sprint("token kind ", int(tk))
+	}
+
+	return name
+}
+
 // type Token is a "sum type" implemented using an interface.
 // Tokens from the lexer can come with a variety of values.
 // It's implemented by simpleToken, stringToken, uintToken and
@@ -128,6 +200,100 @@ type Token interface {
 	Pos() SrcSpan
 }
 
+// type TokenSource is somewhere the parser can get tokens from. The
+// Lexer is the usual one but tokens can come from anywhere.
+type TokenSource interface {
+	GetToken() (Token, error)           // gets the next token.
+	PeekToken(ahead int) (Token, error) // looks at a token coming up without getting it.
+}
+
+// type DocCommentSource is a TokenSource which also keeps the comments
+// from just before each line, so declarations can have doc comments. The
+// Lexer is one but other token sources don't have to be.
+type DocCommentSource interface {
+	TokenSource
+	DocComment(line int) string // gets the comment lines just before this line.
+}
+
+// type ChannelTokenSource gets tokens from a channel, for when they're
+// coming from somewhere other than our Lexer. When the channel is closed
+// it gives end of source tokens.
+type ChannelTokenSource struct {
+	tokens  <-chan Token // where the tokens come from.
+	peeked  []Token      // tokens we've looked at but not got yet.
+	lastPos SrcSpan      // where the last token was, for the end of source.
+}
+
+// NewChannelTokenSource creates a token source which reads from a channel.
+func NewChannelTokenSource(tokens <-chan Token) *ChannelTokenSource {
+	return &ChannelTokenSource{tokens: tokens}
+}
+
+// GetToken gets the next token from the channel.
+func (cts *ChannelTokenSource) GetToken() (Token, error) {
+	tok, err := cts.PeekToken(0)
+	if err != nil {
+		return nil, err
+	}
+
+	cts.peeked = cts.peeked[1:]
+	return tok, nil
+}
+
+// PeekToken looks at a token coming up without getting it.
+func (cts *ChannelTokenSource) PeekToken(ahead int) (Token, error) {
+	for len(cts.peeked) <= ahead {
+		tok, ok := <-cts.tokens
+		if !ok {
+			tok = SimpleToken{SrcSpan{cts.lastPos.end, cts.lastPos.end, cts.lastPos.file}, TokenKindEndOfSource}
+		}
+
+		cts.lastPos = tok.Pos()
+		cts.peeked = append(cts.peeked, tok)
+	}
+
+	return cts.peeked[ahead], nil
+}
+
+// type ReplayTokenSource gives out tokens from a slice, which is handy
+// for testing the parser without the lexer. Past the end it gives end of
+// source tokens.
+type ReplayTokenSource struct {
+	tokens []Token // the tokens to give out.
+	next   int     // the index of the next token.
+}
+
+// NewReplayTokenSource creates a token source which replays some tokens.
+func NewReplayTokenSource(tokens []Token) *ReplayTokenSource {
+	return &ReplayTokenSource{tokens: tokens}
+}
+
+// GetToken gets the next token.
+func (rts *ReplayTokenSource) GetToken() (Token, error) {
+	tok, _ := rts.PeekToken(0)
+	if rts.next < len(rts.tokens) {
+		rts.next++
+	}
+
+	return tok, nil
+}
+
+// PeekToken looks at a token coming up, any distance ahead.
+func (rts *ReplayTokenSource) PeekToken(ahead int) (Token, error) {
+	if rts.next+ahead < len(rts.tokens) {
+		return rts.tokens[rts.next+ahead], nil
+	}
+
+	// the end of source goes just after the last token.
+	var end SrcSpan
+	if len(rts.tokens) > 0 {
+		last := rts.tokens[len(rts.tokens)-1].Pos()
+		end = SrcSpan{last.end, last.end, last.file}
+	}
+
+	return SimpleToken{end, TokenKindEndOfSource}, nil
+}
+
 type SimpleToken struct {
 	pos SrcSpan
 	tt  TokenKind
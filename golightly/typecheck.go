@@ -0,0 +1,309 @@
+package golightly
+
+// Assignable returns true if a value of type "from" can be assigned to a
+// variable of type "to".
+func Assignable(from, to DataType, ts *DataTypeStore) bool {
+	// identical types are always assignable. since types are interned
+	// this is just a comparison.
+	if from == to {
+		return true
+	}
+
+	// untyped constants can be assigned to anything which can represent
+	// them. an interface gets them as their default type.
+	basic, ok := from.(DataTypeBasic)
+	if ok && basic.IsUntyped() {
+		if iface, ok := Underlying(to).(*DataTypeInterface); ok && basic.kind != DataTypeKindUntypedNil {
+			return Implements(defaultType(from, ts), *iface, ts)
+		}
+
+		return untypedAssignable(basic.kind, Underlying(to))
+	}
+
+	// types with identical underlying types are assignable as long as
+	// they're not both named.
+	if Underlying(from) == Underlying(to) && !(isNamedType(from) && isNamedType(to)) {
+		return true
+	}
+
+	// a bidirectional channel can be assigned to a channel which only goes
+	// one way, but not the other way round.
+	fromChan, fromOk := Underlying(from).(*DataTypeChan)
+	toChan, toOk := Underlying(to).(*DataTypeChan)
+	if fromOk && toOk && fromChan.dir == ChanDirectionBi && fromChan.elementType == toChan.elementType && !(isNamedType(from) && isNamedType(to)) {
+		return true
+	}
+
+	// anything which implements an interface can be assigned to it.
+	iface, ok := Underlying(to).(*DataTypeInterface)
+	if ok {
+		return Implements(from, *iface, ts)
+	}
+
+	return false
+}
+
+// Convertible returns true if a value of type "from" can be converted
+// to type "to" with a conversion like "int(x)".
+func Convertible(from, to DataType, ts *DataTypeStore) bool {
+	if Assignable(from, to, ts) {
+		return true
+	}
+
+	fromUnderlying := Underlying(from)
+	toUnderlying := Underlying(to)
+
+	// types with the same underlying type can be converted between.
+	if fromUnderlying == toUnderlying {
+		return true
+	}
+
+	// so can pointers to types with the same underlying type.
+	fromPointer, fromOk := fromUnderlying.(*DataTypeUnary)
+	toPointer, toOk := toUnderlying.(*DataTypeUnary)
+	if fromOk && toOk && fromPointer.kind == DataTypeKindPointer && toPointer.kind == DataTypeKindPointer {
+		return Underlying(fromPointer.subType) == Underlying(toPointer.subType)
+	}
+
+	// numbers can be converted to other kinds of numbers, but complex
+	// numbers only convert to other complex numbers.
+	if isNumeric(from) && isNumeric(to) {
+		return isComplex(from) == isComplex(to) || isUntyped(from)
+	}
+
+	// integers, []byte and []rune can be converted to strings.
+	if isString(to) {
+		return isInteger(from) || isByteOrRuneSlice(from, ts)
+	}
+
+	// strings can be converted to []byte and []rune.
+	if isString(from) {
+		return isByteOrRuneSlice(to, ts)
+	}
+
+	return false
+}
+
+// isComplex returns true for complex number types.
+func isComplex(dt DataType) bool {
+	return Underlying(dt).DataTypeKind() == DataTypeKindImaginary
+}
+
+// isByteOrRuneSlice returns true for []byte and []rune, which can be
+// converted to and from strings.
+func isByteOrRuneSlice(dt DataType, ts *DataTypeStore) bool {
+	slice, ok := Underlying(dt).(*DataTypeUnary)
+	if !ok || slice.kind != DataTypeKindSlice {
+		return false
+	}
+
+	element := Underlying(slice.subType)
+	return element == ts.ByteType() || element == ts.RuneType()
+}
+
+// Implements returns true if the concrete type has all the methods of
+// the interface.
+func Implements(concrete DataType, iface DataTypeInterface, ts *DataTypeStore) bool {
+	methods := ts.MethodSet(concrete)
+
+	for _, ifaceMethod := range iface.methods {
+		found := false
+		for _, method := range methods {
+			if method.name == ifaceMethod.name {
+				// signatures are interned so they can be compared directly.
+				found = method.signature == ifaceMethod.signature
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Comparable returns true if values of this type can be compared with
+// "==", which is what map keys need. Slices, maps and functions can't
+// be, and neither can arrays and structs with them in.
+func Comparable(dt DataType) bool {
+	switch t := Underlying(dt).(type) {
+	case nil:
+		// it's not been worked out yet so give it the benefit of the doubt.
+		return true
+
+	case *DataTypeUnary:
+		return t.kind != DataTypeKindSlice
+
+	case *DataTypeArray:
+		return Comparable(t.elementType)
+
+	case *DataTypeStruct:
+		for _, field := range t.fields {
+			if !Comparable(field.dataType) {
+				return false
+			}
+		}
+
+	case *DataTypeMap, *DataTypeFunc:
+		return false
+	}
+
+	return true
+}
+
+// isNamedType returns true for types which have a name - that's declared
+// types and predeclared types like "int", but not type literals like "[]int".
+func isNamedType(dt DataType) bool {
+	switch dt.(type) {
+	case *DataTypeNamed, DataTypeBasic, DataTypeSized:
+		return true
+	}
+
+	return false
+}
+
+// untypedAssignable returns true if an untyped constant of this kind can
+// be assigned to the given type.
+func untypedAssignable(kind DataTypeKind, to DataType) bool {
+	toKind := to.DataTypeKind()
+
+	switch kind {
+	case DataTypeKindUntypedInt, DataTypeKindUntypedRune:
+		return isNumericKind(toKind)
+
+	case DataTypeKindUntypedFloat:
+		return toKind == DataTypeKindFloat || toKind == DataTypeKindImaginary
+
+	case DataTypeKindUntypedString:
+		return toKind == DataTypeKindString
+
+	case DataTypeKindUntypedBool:
+		return toKind == DataTypeKindBool
+
+	case DataTypeKindUntypedNil:
+		switch toKind {
+		case DataTypeKindPointer, DataTypeKindSlice, DataTypeKindMap, DataTypeKindChan, DataTypeKindFunc, DataTypeKindInterface:
+			return true
+		}
+	}
+
+	return false
+}
+
+// isNumericKind returns true for integer, float and complex types.
+func isNumericKind(kind DataTypeKind) bool {
+	switch kind {
+	case DataTypeKindInt, DataTypeKindUint, DataTypeKindUintptr, DataTypeKindFloat, DataTypeKindImaginary:
+		return true
+	}
+
+	return false
+}
+
+// unifyTypes finds the type two operands of a binary operation should both
+// have. Untyped constants take on the type of the other operand.
+func unifyTypes(left, right DataType, ts *DataTypeStore) (DataType, bool) {
+	if left == right {
+		return left, true
+	}
+
+	leftUntyped := isUntyped(left)
+	rightUntyped := isUntyped(right)
+	switch {
+	case leftUntyped && rightUntyped:
+		// mixed untyped numbers become the "biggest" kind, eg. 1 + 2.0
+		// is an untyped float.
+		rank := map[DataTypeKind]int{DataTypeKindUntypedInt: 1, DataTypeKindUntypedRune: 2, DataTypeKindUntypedFloat: 3}
+		leftRank, rightRank := rank[left.DataTypeKind()], rank[right.DataTypeKind()]
+		if leftRank == 0 || rightRank == 0 {
+			return nil, false
+		}
+
+		if leftRank > rightRank {
+			return left, true
+		}
+
+		return right, true
+
+	case leftUntyped && Assignable(left, right, ts):
+		return right, true
+
+	case rightUntyped && Assignable(right, left, ts):
+		return left, true
+	}
+
+	return nil, false
+}
+
+// defaultType gets the type an untyped constant gets when there's no
+// other type for it to take on - eg. "x := 1" makes x an int.
+func defaultType(dt DataType, ts *DataTypeStore) DataType {
+	switch dt.DataTypeKind() {
+	case DataTypeKindUntypedInt:
+		return ts.IntType()
+	case DataTypeKindUntypedFloat:
+		return ts.FloatType()
+	case DataTypeKindUntypedRune:
+		return ts.RuneType()
+	case DataTypeKindUntypedString:
+		return ts.StringType()
+	case DataTypeKindUntypedBool:
+		return ts.BoolType()
+	}
+
+	return dt
+}
+
+// DefaultType gets the type an untyped constant value takes on when
+// nothing else gives it one. typed values just keep the type they've got.
+func DefaultType(v Value, ts *DataTypeStore) DataType {
+	return defaultType(v.DataType(ts), ts)
+}
+
+// isUntyped returns true for the types of untyped constants.
+func isUntyped(dt DataType) bool {
+	basic, ok := dt.(DataTypeBasic)
+	return ok && basic.IsUntyped()
+}
+
+// isUntypedNil returns true for the type of nil.
+func isUntypedNil(dt DataType) bool {
+	return dt.DataTypeKind() == DataTypeKindUntypedNil
+}
+
+// isInteger returns true for integer types, including untyped integers.
+func isInteger(dt DataType) bool {
+	switch Underlying(dt).DataTypeKind() {
+	case DataTypeKindInt, DataTypeKindUint, DataTypeKindUintptr, DataTypeKindUntypedInt, DataTypeKindUntypedRune:
+		return true
+	}
+
+	return false
+}
+
+// isUnsigned returns true for unsigned integer types.
+func isUnsigned(dt DataType) bool {
+	kind := Underlying(dt).DataTypeKind()
+	return kind == DataTypeKindUint || kind == DataTypeKindUintptr
+}
+
+// isNumeric returns true for integer, float and complex types, including
+// untyped numbers.
+func isNumeric(dt DataType) bool {
+	kind := Underlying(dt).DataTypeKind()
+	return isNumericKind(kind) || kind == DataTypeKindUntypedInt || kind == DataTypeKindUntypedRune || kind == DataTypeKindUntypedFloat
+}
+
+// isString returns true for string types, including untyped strings.
+func isString(dt DataType) bool {
+	kind := Underlying(dt).DataTypeKind()
+	return kind == DataTypeKindString || kind == DataTypeKindUntypedString
+}
+
+// isBoolean returns true for bool types, including untyped bools.
+func isBoolean(dt DataType) bool {
+	kind := Underlying(dt).DataTypeKind()
+	return kind == DataTypeKindBool || kind == DataTypeKindUntypedBool
+}
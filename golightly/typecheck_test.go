@@ -0,0 +1,226 @@
+package golightly
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestAssignable(t *testing.T) {
+	ts := NewDataTypeStore()
+	int32Type := ts.Lookup("int32")
+
+	cases := []struct {
+		from       DataType
+		to         DataType
+		assignable bool
+	}{
+		{ts.IntType(), ts.IntType(), true},
+		{ts.UntypedIntType(), int32Type, true},
+		{ts.UntypedIntType(), ts.FloatType(), true},
+		{ts.UntypedFloatType(), ts.FloatType(), true},
+		{ts.UntypedStringType(), ts.StringType(), true},
+		{ts.UntypedNilType(), ts.MakeSlice(ts.IntType()), true},
+		{ts.MakeSlice(ts.IntType()), ts.MakeSlice(ts.IntType()), true},
+		{ts.IntType(), int32Type, false},
+		{ts.StringType(), ts.IntType(), false},
+		{ts.UntypedFloatType(), ts.IntType(), false},
+		{ts.UntypedStringType(), ts.IntType(), false},
+		{ts.UntypedNilType(), ts.IntType(), false},
+		{ts.MakeSlice(ts.IntType()), ts.MakeSlice(int32Type), false},
+		{ts.UntypedIntType(), ts.MakeInterface(nil), true},
+		{ts.UntypedStringType(), ts.MakeInterface(nil), true},
+		{ts.UntypedNilType(), ts.MakeInterface(nil), true},
+		{ts.UntypedIntType(), ts.MakeInterface([]DataTypeMethod{{"String", ts.MakeFunc(nil, []DataType{ts.StringType()}, false), false}}), false},
+	}
+
+	for _, c := range cases {
+		if Assignable(c.from, c.to, ts) != c.assignable {
+			t.Errorf("assigning %s to %s should give %v", c.from, c.to, c.assignable)
+		}
+	}
+}
+
+func TestAssignableNamed(t *testing.T) {
+	ts := NewDataTypeStore()
+	myInt := ts.MakeNamed("main", "MyInt", ts.IntType())
+	otherInt := ts.MakeNamed("main", "OtherInt", ts.IntType())
+	intSlice := ts.MakeNamed("main", "IntSlice", ts.MakeSlice(ts.IntType()))
+
+	if !Assignable(ts.UntypedIntType(), myInt, ts) {
+		t.Error("untyped ints should be assignable to MyInt")
+	}
+	if Assignable(ts.IntType(), myInt, ts) {
+		t.Error("int shouldn't be assignable to MyInt")
+	}
+	if Assignable(myInt, otherInt, ts) {
+		t.Error("MyInt shouldn't be assignable to OtherInt")
+	}
+	if !Assignable(ts.MakeSlice(ts.IntType()), intSlice, ts) {
+		t.Error("[]int should be assignable to IntSlice")
+	}
+}
+
+func TestAssignableChanDirection(t *testing.T) {
+	ts := NewDataTypeStore()
+	both := ts.MakeChan(ChanDirectionBi, ts.IntType())
+	receive := ts.MakeChan(ChanDirectionIn, ts.IntType())
+	send := ts.MakeChan(ChanDirectionOut, ts.IntType())
+	named := ts.MakeNamed("main", "Ints", both)
+
+	cases := []struct {
+		from       DataType
+		to         DataType
+		assignable bool
+	}{
+		{both, receive, true},
+		{both, send, true},
+		{named, send, true},
+		{receive, both, false},
+		{send, both, false},
+		{receive, send, false},
+		{send, receive, false},
+		{both, ts.MakeChan(ChanDirectionIn, ts.StringType()), false},
+		{ts.MakeChan(ChanDirectionBi, ts.StringType()), receive, false},
+	}
+
+	for _, c := range cases {
+		if Assignable(c.from, c.to, ts) != c.assignable {
+			t.Errorf("assigning %s to %s should give %v", c.from, c.to, c.assignable)
+		}
+	}
+}
+
+func TestDefaultType(t *testing.T) {
+	ts := NewDataTypeStore()
+	int8Type := ts.Lookup("int8")
+
+	cases := []struct {
+		val Value
+		typ DataType
+	}{
+		{ValueUint{ts.UntypedIntType(), 5}, ts.IntType()},
+		{ValueBigInt{ts.UntypedIntType(), new(big.Int).Lsh(big.NewInt(1), 70)}, ts.IntType()},
+		{ValueFloat{ts.UntypedFloatType(), 2.5}, ts.FloatType()},
+		{ValueRune{'x'}, ts.RuneType()},
+		{ValueString{"hi"}, ts.StringType()},
+		{ValueBool{true}, ts.BoolType()},
+		{ValueInt{int8Type, -3}, int8Type},
+	}
+
+	for _, c := range cases {
+		if dt := DefaultType(c.val, ts); dt != c.typ {
+			t.Errorf("%v has default type %v, expected %v", c.val, dt, c.typ)
+		}
+	}
+
+	if ts.FloatType().String() != "float64" || ts.RuneType().String() != "int32" {
+		t.Errorf("float and rune defaults are %v and %v", ts.FloatType(), ts.RuneType())
+	}
+}
+
+func TestImplements(t *testing.T) {
+	ts := NewDataTypeStore()
+	stringer := ts.MakeInterface([]DataTypeMethod{{"String", ts.MakeFunc(nil, []DataType{ts.StringType()}, false), false}})
+
+	name := ts.MakeNamed("main", "Name", ts.StringType())
+	ts.AddMethod(name, "String", ts.MakeFunc(nil, []DataType{ts.StringType()}, false), false)
+
+	count := ts.MakeNamed("main", "Count", ts.IntType())
+	ts.AddMethod(count, "String", ts.MakeFunc(nil, []DataType{ts.IntType()}, false), false)
+
+	if !Implements(name, *stringer, ts) {
+		t.Error("Name should implement the interface")
+	}
+	if Implements(count, *stringer, ts) {
+		t.Error("Count has the wrong String() signature so it shouldn't implement the interface")
+	}
+	if Implements(ts.IntType(), *stringer, ts) {
+		t.Error("int shouldn't implement the interface")
+	}
+	if !Assignable(name, stringer, ts) {
+		t.Error("Name should be assignable to the interface")
+	}
+
+	empty := ts.MakeInterface(nil)
+	for _, dt := range []DataType{ts.IntType(), name, count, ts.MakeSlice(ts.StringType()), stringer} {
+		if !Implements(dt, *empty, ts) {
+			t.Errorf("%s should implement the empty interface", dt)
+		}
+	}
+}
+
+func TestImplementsError(t *testing.T) {
+	ts := NewDataTypeStore()
+	errorType := ts.Lookup("error")
+	iface, ok := Underlying(errorType).(*DataTypeInterface)
+	if errorType != ts.ErrorType() || !ok || errorType.String() != "error" {
+		t.Fatalf("error resolved to %v", errorType)
+	}
+
+	myError := ts.MakeNamed("main", "MyError", ts.StringType())
+	ts.AddMethod(myError, "Error", ts.MakeFunc(nil, []DataType{ts.StringType()}, false), false)
+	if !Implements(myError, *iface, ts) || !Assignable(myError, errorType, ts) {
+		t.Error("MyError should be an error")
+	}
+	if Implements(ts.StringType(), *iface, ts) {
+		t.Error("string shouldn't be an error")
+	}
+	if !Assignable(ts.UntypedNilType(), errorType, ts) {
+		t.Error("nil should be assignable to an error")
+	}
+}
+
+func TestImplementsCachesMethodSets(t *testing.T) {
+	ts := NewDataTypeStore()
+	stringer := ts.MakeInterface([]DataTypeMethod{{"String", ts.MakeFunc(nil, []DataType{ts.StringType()}, false), false}})
+	name := ts.MakeNamed("main", "Name", ts.StringType())
+	ts.AddMethod(name, "String", ts.MakeFunc(nil, []DataType{ts.StringType()}, false), false)
+
+	if !Implements(name, *stringer, ts) || !Implements(name, *stringer, ts) {
+		t.Error("Name should implement the interface")
+	}
+	if ts.methodSetHits != 1 {
+		t.Errorf("expected the second check to hit the cache, got %d hits", ts.methodSetHits)
+	}
+
+	// adding a method throws the cache away.
+	ts.AddMethod(name, "Len", ts.MakeFunc(nil, []DataType{ts.IntType()}, false), true)
+	methods, pointerMethods := ts.MethodSet(name), ts.MethodSet(ts.MakePointer(name))
+	if len(methods) != 1 || len(pointerMethods) != 2 {
+		t.Errorf("wrong method sets after adding a method: %v, %v", methods, pointerMethods)
+	}
+	if ts.methodSetHits != 1 {
+		t.Errorf("expected the new method sets to be worked out again, got %d hits", ts.methodSetHits)
+	}
+}
+
+func TestConvertible(t *testing.T) {
+	ts := NewDataTypeStore()
+	myInt := ts.MakeNamed("main", "MyInt", ts.IntType())
+	byteSlice := ts.MakeSlice(ts.ByteType())
+
+	cases := []struct {
+		from        DataType
+		to          DataType
+		convertible bool
+	}{
+		{ts.IntType(), myInt, true},
+		{myInt, ts.IntType(), true},
+		{ts.IntType(), ts.FloatType(), true},
+		{ts.UntypedFloatType(), ts.IntType(), true},
+		{ts.StringType(), byteSlice, true},
+		{byteSlice, ts.StringType(), true},
+		{ts.IntType(), ts.StringType(), true},
+		{ts.MakePointer(myInt), ts.MakePointer(ts.IntType()), true},
+		{ts.StringType(), ts.IntType(), false},
+		{ts.BoolType(), ts.IntType(), false},
+		{ts.FloatType(), ts.Lookup("complex128"), false},
+		{ts.MakeSlice(ts.IntType()), ts.StringType(), false},
+	}
+
+	for _, c := range cases {
+		if Convertible(c.from, c.to, ts) != c.convertible {
+			t.Errorf("converting %s to %s should give %v", c.from, c.to, c.convertible)
+		}
+	}
+}
@@ -1,5 +1,11 @@
 package golightly
 
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
 // type Value is a "sum type" implemented using an interface.
 // It represents literal values of any type.
 //
@@ -9,6 +15,7 @@ type Value interface {
 	isValue()
 	DataType(ts *DataTypeStore) DataType
 	Equals(to Value) bool
+	String() string
 }
 
 // type ValueInt is for signed integers
@@ -29,6 +36,10 @@ func (v ValueInt) Equals(to Value) bool {
 	return v.typ == too.typ && v.val == too.val
 }
 
+func (v ValueInt) String() string {
+	return strconv.FormatInt(v.val, 10)
+}
+
 // type ValueUint is for unsigned integers
 type ValueUint struct {
 	typ DataType
@@ -47,6 +58,34 @@ func (v ValueUint) Equals(to Value) bool {
 	return v.typ == too.typ && v.val == too.val
 }
 
+func (v ValueUint) String() string {
+	return strconv.FormatUint(v.val, 10)
+}
+
+// type ValueBigInt is for untyped integer constants which are too big
+// for an int64. Untyped constants can be any size until they're given a
+// type. The value mustn't be changed once it's in here.
+type ValueBigInt struct {
+	typ DataType
+	val *big.Int
+}
+
+func (v ValueBigInt) isValue() {
+}
+
+func (v ValueBigInt) DataType(ts *DataTypeStore) DataType {
+	return v.typ
+}
+
+func (v ValueBigInt) Equals(to Value) bool {
+	too, ok := to.(ValueBigInt)
+	return ok && v.typ == too.typ && v.val.Cmp(too.val) == 0
+}
+
+func (v ValueBigInt) String() string {
+	return v.val.String()
+}
+
 // type ValueFloat is for floats
 type ValueFloat struct {
 	typ DataType
@@ -65,6 +104,16 @@ func (v ValueFloat) Equals(to Value) bool {
 	return v.typ == too.typ && v.val == too.val
 }
 
+func (v ValueFloat) String() string {
+	// make sure it still looks like a float if it's a whole number.
+	str := strconv.FormatFloat(v.val, 'g', -1, 64)
+	if !strings.ContainsAny(str, ".eIN") {
+		str += ".0"
+	}
+
+	return str
+}
+
 // type ValueRune is for runes
 type ValueRune struct {
 	val rune
@@ -74,7 +123,7 @@ func (v ValueRune) isValue() {
 }
 
 func (v ValueRune) DataType(ts *DataTypeStore) DataType {
-	return ts.RuneType()
+	return ts.UntypedRuneType()
 }
 
 func (v ValueRune) Equals(to Value) bool {
@@ -82,6 +131,10 @@ func (v ValueRune) Equals(to Value) bool {
 	return v.val == too.val
 }
 
+func (v ValueRune) String() string {
+	return strconv.QuoteRune(v.val)
+}
+
 // type ValueString is for strings
 type ValueString struct {
 	val string
@@ -91,7 +144,7 @@ func (v ValueString) isValue() {
 }
 
 func (v ValueString) DataType(ts *DataTypeStore) DataType {
-	return ts.StringType()
+	return ts.UntypedStringType()
 }
 
 func (v ValueString) Equals(to Value) bool {
@@ -99,14 +152,39 @@ func (v ValueString) Equals(to Value) bool {
 	return v.val == too.val
 }
 
+func (v ValueString) String() string {
+	return strconv.Quote(v.val)
+}
+
+// type ValueBool is for booleans
+type ValueBool struct {
+	val bool
+}
+
+func (v ValueBool) isValue() {
+}
+
+func (v ValueBool) DataType(ts *DataTypeStore) DataType {
+	return ts.UntypedBoolType()
+}
+
+func (v ValueBool) Equals(to Value) bool {
+	too := to.(ValueBool)
+	return v.val == too.val
+}
+
+func (v ValueBool) String() string {
+	return strconv.FormatBool(v.val)
+}
+
 // NewValueFromToken creates a Value from a lexer Token. It assumes the
-// token is a literal value type.
+// token is a literal value type. Literals are untyped constants.
 func NewValueFromToken(tok Token, ts *DataTypeStore) Value {
 	switch tok.TokenKind() {
 	case TokenKindLiteralInt:
-		return ValueUint{ts.UintType(), tok.(UintToken).uintVal}
+		return ValueUint{ts.UntypedIntType(), tok.(UintToken).uintVal}
 	case TokenKindLiteralFloat:
-		return ValueFloat{ts.FloatType(), tok.(FloatToken).floatVal}
+		return ValueFloat{ts.UntypedFloatType(), tok.(FloatToken).floatVal}
 	case TokenKindLiteralRune:
 		return ValueRune{rune(tok.(UintToken).uintVal)}
 	case TokenKindLiteralString:
@@ -0,0 +1,66 @@
+package golightly
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValueString(t *testing.T) {
+	ts := NewDataTypeStore()
+
+	cases := []struct {
+		val Value
+		str string
+	}{
+		{ValueInt{ts.IntType(), -42}, "-42"},
+		{ValueUint{ts.UintType(), 42}, "42"},
+		{ValueFloat{ts.FloatType(), 1.5}, "1.5"},
+		{ValueFloat{ts.FloatType(), 3}, "3.0"},
+		{ValueFloat{ts.FloatType(), 1e100}, "1e+100"},
+		{ValueRune{'r'}, "'r'"},
+		{ValueRune{'\n'}, "'\\n'"},
+		{ValueString{"hello"}, "\"hello\""},
+		{ValueString{"say \"hi\"\n"}, "\"say \\\"hi\\\"\\n\""},
+		{ValueBool{true}, "true"},
+	}
+
+	for _, c := range cases {
+		if c.val.String() != c.str {
+			t.Errorf("%#v gave %s, expected %s", c.val, c.val.String(), c.str)
+		}
+	}
+}
+
+func TestNewValueFromToken(t *testing.T) {
+	ts := NewDataTypeStore()
+
+	cases := []struct {
+		src string
+		val Value
+	}{
+		{"42", ValueUint{ts.UntypedIntType(), 42}},
+		{"7.25", ValueFloat{ts.UntypedFloatType(), 7.25}},
+		{"'X'", ValueRune{'X'}},
+		{"\"hello\"", ValueString{"hello"}},
+		{"`raw`", ValueString{"raw"}},
+	}
+
+	for _, c := range cases {
+		l := NewLexer()
+		l.LexReader(strings.NewReader(c.src), "test.go")
+		tok, err := l.GetToken()
+		if err != nil {
+			t.Fatalf("error lexing '%s': %v", c.src, err)
+		}
+
+		val := NewValueFromToken(tok, ts)
+		if val == nil {
+			t.Errorf("'%s' didn't give a value", c.src)
+			continue
+		}
+
+		if val.DataType(ts) != c.val.DataType(ts) || !val.Equals(c.val) {
+			t.Errorf("'%s' gave %s, expected %s", c.src, val, c.val)
+		}
+	}
+}
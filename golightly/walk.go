@@ -0,0 +1,293 @@
+package golightly
+
+// Walk traverses an AST in depth-first order. visit is called for each
+// node before its children. If visit returns false the node's children
+// are skipped.
+func Walk(ast AST, visit func(AST) bool) {
+	if ast == nil || !visit(ast) {
+		return
+	}
+
+	for _, child := range astChildren(ast) {
+		Walk(child, visit)
+	}
+}
+
+// astChildren returns the child nodes of an AST node in source order.
+// Missing optional children are left out.
+func astChildren(ast AST) []AST {
+	var children []AST
+	switch a := ast.(type) {
+	case *ASTTopLevel:
+		children = append(children, a.imports...)
+		children = append(children, a.topLevelDecls...)
+	case *ASTImport:
+		children = []AST{a.packageName, a.importPath}
+	case *ASTUnaryExpr:
+		children = []AST{a.param}
+	case *ASTBinaryExpr:
+		children = []AST{a.left, a.right}
+	case *ASTParen:
+		children = []AST{a.expr}
+	case *ASTConstDecl:
+		children = []AST{a.ident, a.typ, a.value}
+	case *ASTVarDecl:
+		children = []AST{a.ident, a.typ, a.value}
+	case *ASTFunctionDecl:
+		children = append(children, a.receiver)
+		children = append(children, a.params...)
+		children = append(children, a.returns...)
+		children = append(children, a.body)
+	case *ASTDataTypeDecl:
+		children = []AST{a.ident, a.typ}
+	case *ASTDataTypeSlice:
+		children = []AST{a.elementType}
+	case *ASTDataTypeArray:
+		children = []AST{a.arraySize, a.elementType}
+	case *ASTDataTypePointer:
+		children = []AST{a.elementType}
+	case *ASTDataTypeMap:
+		children = []AST{a.keyType, a.valueType}
+	case *ASTDataTypeChan:
+		children = []AST{a.elementType}
+	case *ASTDataTypeStruct:
+		children = a.fields
+	case *ASTDataTypeField:
+		children = []AST{a.identifier, a.typ}
+	case *ASTDataTypeFunc:
+		children = append(children, a.params...)
+		children = append(children, a.returns...)
+	case *ASTParameterDecl:
+		children = []AST{a.identifier, a.ellipsis, a.typ}
+	case *ASTDataTypeInterface:
+		children = a.methods
+	case *ASTDataTypeMethodSpec:
+		children = append(children, a.params...)
+		children = append(children, a.returns...)
+	case *ASTBlock:
+		children = a.statements
+	case *ASTSelector:
+		children = []AST{a.expr}
+	case *ASTCall:
+		children = append(children, a.function)
+		children = append(children, a.args...)
+	case *ASTIndex:
+		children = []AST{a.expr, a.index}
+	case *ASTTypeAssert:
+		children = []AST{a.expr, a.typ}
+	case *ASTFuncLit:
+		children = append(children, a.params...)
+		children = append(children, a.returns...)
+		children = append(children, a.body)
+	case *ASTReturn:
+		children = a.values
+	case *ASTIf:
+		children = []AST{a.init, a.condition, a.then, a.otherwise}
+	case *ASTFor:
+		children = []AST{a.init, a.condition, a.post, a.body}
+	case *ASTAssign:
+		children = append(children, a.left...)
+		children = append(children, a.right...)
+	case *ASTShortVarDecl:
+		children = append(children, a.idents...)
+		children = append(children, a.values...)
+	case *ASTIncDec:
+		children = []AST{a.expr}
+	}
+
+	// leave out any missing children.
+	present := children[:0:0]
+	for _, child := range children {
+		if child != nil {
+			present = append(present, child)
+		}
+	}
+
+	return present
+}
+
+// Rewrite makes a copy of an AST with some of its nodes replaced. Each
+// node's children are rewritten first, then rewrite is called on the
+// node itself and whatever it returns takes the node's place.
+func Rewrite(ast AST, rewrite func(AST) AST) AST {
+	if ast == nil {
+		return nil
+	}
+
+	switch a := ast.(type) {
+	case *ASTTopLevel:
+		copied := *a
+		copied.imports = rewriteList(a.imports, rewrite)
+		copied.topLevelDecls = rewriteList(a.topLevelDecls, rewrite)
+		ast = &copied
+	case *ASTUnaryExpr:
+		copied := *a
+		copied.param = Rewrite(a.param, rewrite)
+		ast = &copied
+	case *ASTBinaryExpr:
+		copied := *a
+		copied.left = Rewrite(a.left, rewrite)
+		copied.right = Rewrite(a.right, rewrite)
+		ast = &copied
+	case *ASTParen:
+		copied := *a
+		copied.expr = Rewrite(a.expr, rewrite)
+		ast = &copied
+	case *ASTConstDecl:
+		copied := *a
+		copied.typ = Rewrite(a.typ, rewrite)
+		copied.value = Rewrite(a.value, rewrite)
+		ast = &copied
+	case *ASTVarDecl:
+		copied := *a
+		copied.typ = Rewrite(a.typ, rewrite)
+		copied.value = Rewrite(a.value, rewrite)
+		ast = &copied
+	case *ASTFunctionDecl:
+		copied := *a
+		copied.params = rewriteList(a.params, rewrite)
+		copied.returns = rewriteList(a.returns, rewrite)
+		copied.body = Rewrite(a.body, rewrite)
+		ast = &copied
+	case *ASTDataTypeDecl:
+		copied := *a
+		copied.typ = Rewrite(a.typ, rewrite)
+		ast = &copied
+	case *ASTDataTypeSlice:
+		copied := *a
+		copied.elementType = Rewrite(a.elementType, rewrite)
+		ast = &copied
+	case *ASTDataTypeArray:
+		copied := *a
+		copied.arraySize = Rewrite(a.arraySize, rewrite)
+		copied.elementType = Rewrite(a.elementType, rewrite)
+		ast = &copied
+	case *ASTDataTypePointer:
+		copied := *a
+		copied.elementType = Rewrite(a.elementType, rewrite)
+		ast = &copied
+	case *ASTDataTypeMap:
+		copied := *a
+		copied.keyType = Rewrite(a.keyType, rewrite)
+		copied.valueType = Rewrite(a.valueType, rewrite)
+		ast = &copied
+	case *ASTDataTypeChan:
+		copied := *a
+		copied.elementType = Rewrite(a.elementType, rewrite)
+		ast = &copied
+	case *ASTDataTypeStruct:
+		copied := *a
+		copied.fields = rewriteList(a.fields, rewrite)
+		ast = &copied
+	case *ASTDataTypeField:
+		copied := *a
+		copied.typ = Rewrite(a.typ, rewrite)
+		ast = &copied
+	case *ASTDataTypeFunc:
+		copied := *a
+		copied.params = rewriteList(a.params, rewrite)
+		copied.returns = rewriteList(a.returns, rewrite)
+		ast = &copied
+	case *ASTParameterDecl:
+		copied := *a
+		copied.typ = Rewrite(a.typ, rewrite)
+		ast = &copied
+	case *ASTDataTypeInterface:
+		copied := *a
+		copied.methods = rewriteList(a.methods, rewrite)
+		ast = &copied
+	case *ASTDataTypeMethodSpec:
+		copied := *a
+		copied.params = rewriteList(a.params, rewrite)
+		copied.returns = rewriteList(a.returns, rewrite)
+		ast = &copied
+	case *ASTBlock:
+		copied := *a
+		copied.statements = rewriteList(a.statements, rewrite)
+		ast = &copied
+	case *ASTSelector:
+		copied := *a
+		copied.expr = Rewrite(a.expr, rewrite)
+		ast = &copied
+	case *ASTCall:
+		copied := *a
+		copied.function = Rewrite(a.function, rewrite)
+		copied.args = rewriteList(a.args, rewrite)
+		ast = &copied
+	case *ASTIndex:
+		copied := *a
+		copied.expr = Rewrite(a.expr, rewrite)
+		copied.index = Rewrite(a.index, rewrite)
+		ast = &copied
+	case *ASTTypeAssert:
+		copied := *a
+		copied.expr = Rewrite(a.expr, rewrite)
+		copied.typ = Rewrite(a.typ, rewrite)
+		ast = &copied
+	case *ASTFuncLit:
+		copied := *a
+		copied.params = rewriteList(a.params, rewrite)
+		copied.returns = rewriteList(a.returns, rewrite)
+		copied.body = Rewrite(a.body, rewrite)
+		ast = &copied
+	case *ASTReturn:
+		copied := *a
+		copied.values = rewriteList(a.values, rewrite)
+		ast = &copied
+	case *ASTIf:
+		copied := *a
+		copied.init = Rewrite(a.init, rewrite)
+		copied.condition = Rewrite(a.condition, rewrite)
+		copied.then = Rewrite(a.then, rewrite)
+		copied.otherwise = Rewrite(a.otherwise, rewrite)
+		ast = &copied
+	case *ASTFor:
+		copied := *a
+		copied.init = Rewrite(a.init, rewrite)
+		copied.condition = Rewrite(a.condition, rewrite)
+		copied.post = Rewrite(a.post, rewrite)
+		copied.body = Rewrite(a.body, rewrite)
+		ast = &copied
+	case *ASTAssign:
+		copied := *a
+		copied.left = rewriteList(a.left, rewrite)
+		copied.right = rewriteList(a.right, rewrite)
+		ast = &copied
+	case *ASTShortVarDecl:
+		copied := *a
+		copied.values = rewriteList(a.values, rewrite)
+		ast = &copied
+	case *ASTIncDec:
+		copied := *a
+		copied.expr = Rewrite(a.expr, rewrite)
+		ast = &copied
+	}
+
+	return rewrite(ast)
+}
+
+// rewriteList rewrites each AST in a list, giving a new list.
+func rewriteList(asts []AST, rewrite func(AST) AST) []AST {
+	if asts == nil {
+		return nil
+	}
+
+	rewritten := make([]AST, len(asts))
+	for i, ast := range asts {
+		rewritten[i] = Rewrite(ast, rewrite)
+	}
+
+	return rewritten
+}
+
+// StripParens removes the brackets from around expressions. The grouping
+// they gave is already part of the tree so they don't change its meaning.
+func StripParens(ast AST) AST {
+	return Rewrite(ast, func(a AST) AST {
+		if paren, ok := a.(*ASTParen); ok {
+			return paren.expr
+		}
+
+		return a
+	})
+}